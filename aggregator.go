@@ -1,5 +1,13 @@
 package opentsdb
 
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 type AggregatorFuncT func(a, b Point) Point
 
 func AggregatorFunc(v string) AggregatorFuncT {
@@ -46,3 +54,91 @@ func (m DPmap) Join(n DPmap, agg string) DPmap {
 	}
 	return m
 }
+
+// Aggregate reduces values with the named OpenTSDB aggregator. Percentile
+// aggregators such as p95 or ep99r7 are computed with linear interpolation.
+func Aggregate(agg string, values []Point) (Point, error) {
+	if len(values) == 0 {
+		return Point(math.NaN()), nil
+	}
+	switch agg {
+	case "sum", "zimsum":
+		var s Point
+		for _, v := range values {
+			s += v
+		}
+		return s, nil
+	case "avg":
+		var s Point
+		for _, v := range values {
+			s += v
+		}
+		return s / Point(len(values)), nil
+	case "min", "mimmin":
+		m := values[0]
+		for _, v := range values[1:] {
+			if v < m {
+				m = v
+			}
+		}
+		return m, nil
+	case "max", "mimmax":
+		m := values[0]
+		for _, v := range values[1:] {
+			if v > m {
+				m = v
+			}
+		}
+		return m, nil
+	case "count":
+		return Point(len(values)), nil
+	case "first":
+		return values[0], nil
+	case "last":
+		return values[len(values)-1], nil
+	case "dev":
+		avg, _ := Aggregate("avg", values)
+		var s float64
+		for _, v := range values {
+			s += float64((v - avg) * (v - avg))
+		}
+		return Point(math.Sqrt(s / float64(len(values)))), nil
+	case "median":
+		return percentile(values, 50), nil
+	}
+	if p, ok := parsePercentileAgg(agg); ok {
+		return percentile(values, p), nil
+	}
+	return 0, fmt.Errorf("opentsdb: unknown aggregator %s", agg)
+}
+
+// parsePercentileAgg parses aggregators of the form p99 or ep99r3.
+func parsePercentileAgg(agg string) (float64, bool) {
+	s := strings.TrimPrefix(agg, "e")
+	if !strings.HasPrefix(s, "p") {
+		return 0, false
+	}
+	s = s[1:]
+	if i := strings.IndexByte(s, 'r'); i > 0 {
+		s = s[:i]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	// p999 is the 99.9th percentile
+	p := float64(n)
+	for p >= 100 {
+		p /= 10
+	}
+	return p, true
+}
+
+func percentile(values []Point, p float64) Point {
+	s := make([]float64, len(values))
+	for i, v := range values {
+		s[i] = float64(v)
+	}
+	sort.Float64s(s)
+	return Point(sortedQuantile(s, p/100, InterpolateLinear))
+}
@@ -0,0 +1,171 @@
+package opentsdb
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MetricAliaser maps external metric names, as used by dashboards, to the
+// internal names stored in OpenTSDB, supporting gradual renames. Aliases
+// ending in '*' map a prefix to another, e.g. "app.*" to "svc.app.*". The
+// aliases may be replaced at any time.
+type MetricAliaser struct {
+	mu       sync.RWMutex
+	exact    map[string]string
+	reverse  map[string]string
+	prefixes []aliasPrefix // longest external prefix first
+	byIntern []aliasPrefix // longest internal prefix first
+}
+
+type aliasPrefix struct {
+	external, internal string
+}
+
+// NewMetricAliaser returns an aliaser with aliases from external to
+// internal names.
+func NewMetricAliaser(aliases map[string]string) (*MetricAliaser, error) {
+	a := &MetricAliaser{}
+	if err := a.Set(aliases); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Set replaces the aliases of a.
+func (a *MetricAliaser) Set(aliases map[string]string) error {
+	exact := map[string]string{}
+	reverse := map[string]string{}
+	var prefixes []aliasPrefix
+	for ext, in := range aliases {
+		extWild, inWild := strings.HasSuffix(ext, "*"), strings.HasSuffix(in, "*")
+		switch {
+		case extWild != inWild:
+			return fmt.Errorf("opentsdb: alias %q to %q: both or neither must end in *", ext, in)
+		case extWild:
+			prefixes = append(prefixes, aliasPrefix{strings.TrimSuffix(ext, "*"), strings.TrimSuffix(in, "*")})
+		default:
+			exact[ext] = in
+			reverse[in] = ext
+		}
+	}
+	// longest prefixes first on the side matched so that the most
+	// specific alias wins
+	byIntern := append([]aliasPrefix(nil), prefixes...)
+	sort.Slice(prefixes, func(i, j int) bool {
+		return longerPrefix(prefixes[i].external, prefixes[j].external)
+	})
+	sort.Slice(byIntern, func(i, j int) bool {
+		return longerPrefix(byIntern[i].internal, byIntern[j].internal)
+	})
+	a.mu.Lock()
+	a.exact, a.reverse, a.prefixes, a.byIntern = exact, reverse, prefixes, byIntern
+	a.mu.Unlock()
+	return nil
+}
+
+// longerPrefix orders prefixes longest first, and equally long ones by
+// name so that the order does not depend on that of a map.
+func longerPrefix(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a < b
+}
+
+// LoadFile replaces the aliases of a with those of a YAML or JSON file
+// mapping external names to internal ones.
+func (a *MetricAliaser) LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var aliases map[string]string
+	if err := yaml.Unmarshal(b, &aliases); err != nil {
+		return fmt.Errorf("opentsdb: reading aliases from %s: %w", path, err)
+	}
+	return a.Set(aliases)
+}
+
+// Internal returns the internal name of the external metric name.
+func (a *MetricAliaser) Internal(name string) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if in, ok := a.exact[name]; ok {
+		return in
+	}
+	for _, p := range a.prefixes {
+		if strings.HasPrefix(name, p.external) {
+			return p.internal + name[len(p.external):]
+		}
+	}
+	return name
+}
+
+// External returns the external name of the internal metric name. When
+// several external names alias the same metric, any of them may be
+// returned.
+func (a *MetricAliaser) External(name string) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if ext, ok := a.reverse[name]; ok {
+		return ext
+	}
+	for _, p := range a.byIntern {
+		if strings.HasPrefix(name, p.internal) {
+			return p.external + name[len(p.internal):]
+		}
+	}
+	return name
+}
+
+type aliasContext struct {
+	Context
+	a *MetricAliaser
+}
+
+func (c *aliasContext) Query(r *Request) (ResponseSet, error) {
+	r = r.Clone()
+	// the names asked for, to map responses back to them rather than to
+	// any alias of their metric
+	asked := map[string]string{}
+	for _, q := range r.Queries {
+		in := c.a.Internal(q.Metric)
+		if in != q.Metric {
+			asked[in] = q.Metric
+			q.Metric = in
+		}
+	}
+	rs, err := c.Context.Query(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range rs {
+		ext, ok := asked[resp.Metric]
+		if !ok {
+			ext = c.a.External(resp.Metric)
+		}
+		if ext != resp.Metric {
+			resp.Metric = ext
+			resp.rekey()
+		}
+		if q := &resp.Query; q.Metric != "" {
+			if ext, ok := asked[q.Metric]; ok {
+				q.Metric = ext
+			}
+		}
+	}
+	return rs, nil
+}
+
+// Middleware returns a middleware querying the internal names of metrics
+// and returning responses under the names asked for.
+func (a *MetricAliaser) Middleware() QueryMiddleware {
+	return func(c Context) Context {
+		return &aliasContext{Context: c, a: a}
+	}
+}
@@ -0,0 +1,93 @@
+package opentsdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMetricAliaser(t *testing.T) {
+	a, err := NewMetricAliaser(map[string]string{
+		"cpu":     "sys.cpu.user",
+		"app.*":   "svc.app.*",
+		"app.v2*": "svc2.app*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ext, in := range map[string]string{
+		"cpu":         "sys.cpu.user",
+		"app.latency": "svc.app.latency",
+		"app.v2.rps":  "svc2.app.rps",
+		"other":       "other",
+	} {
+		if got := a.Internal(ext); got != in {
+			t.Errorf("Internal(%q) = %q, want %q", ext, got, in)
+		}
+		if got := a.External(in); got != ext {
+			t.Errorf("External(%q) = %q, want %q", in, got, ext)
+		}
+	}
+
+	var sent []string
+	backend := funcContext(func(r *Request) (ResponseSet, error) {
+		var rs ResponseSet
+		for _, q := range r.Queries {
+			sent = append(sent, q.Metric)
+			rs = append(rs, &Response{Metric: q.Metric, Tags: TagSet{}})
+		}
+		return rs, nil
+	})
+	c := Chain(backend, a.Middleware())
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "cpu", Aggregator: "sum"}, {Metric: "app.errors", Aggregator: "sum"}}}
+	rs, err := c.Query(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent[0] != "sys.cpu.user" || sent[1] != "svc.app.errors" {
+		t.Errorf("sent %v", sent)
+	}
+	if rs[0].Metric != "cpu" || rs[1].Metric != "app.errors" {
+		t.Errorf("got %q and %q", rs[0].Metric, rs[1].Metric)
+	}
+	if r.Queries[0].Metric != "cpu" {
+		t.Error("request modified")
+	}
+
+	// the longer internal prefix wins although its external one is shorter
+	a, err = NewMetricAliaser(map[string]string{
+		"web.*":     "svc.*",
+		"web.api.*": "svc.v2.api.*",
+		"s.*":       "svc.v2.*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.External("svc.v2.api.rps"); got != "web.api.rps" {
+		t.Errorf("External = %q, want %q", got, "web.api.rps")
+	}
+	if got := a.External("svc.v2.cpu"); got != "s.cpu" {
+		t.Errorf("External = %q, want %q", got, "s.cpu")
+	}
+
+	if _, err := NewMetricAliaser(map[string]string{"a*": "b"}); err == nil {
+		t.Error("expected an error for a prefix alias to a name")
+	}
+}
+
+func TestMetricAliaserLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.yaml")
+	if err := os.WriteFile(path, []byte("cpu: sys.cpu.user\n\"net.*\": sys.net.*\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := NewMetricAliaser(map[string]string{"mem": "sys.mem"})
+	if err := a.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Internal("net.rx"); got != "sys.net.rx" {
+		t.Errorf("got %q", got)
+	}
+	if got := a.Internal("mem"); got != "mem" {
+		t.Errorf("old alias kept: %q", got)
+	}
+}
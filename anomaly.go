@@ -0,0 +1,147 @@
+package opentsdb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// MeanStdDev returns the mean and population standard deviation of the
+// points of dps in [from, to]. NaN points are ignored.
+func (dps DPmap) MeanStdDev(from, to Epoch) (mean, stddev float64, n int) {
+	var sum, sq float64
+	for t, v := range dps {
+		if t < from || t > to || math.IsNaN(float64(v)) {
+			continue
+		}
+		sum += float64(v)
+		sq += float64(v) * float64(v)
+		n++
+	}
+	if n == 0 {
+		return math.NaN(), math.NaN(), 0
+	}
+	mean = sum / float64(n)
+	return mean, math.Sqrt(math.Max(sq/float64(n)-mean*mean, 0)), n
+}
+
+// ZScore returns how many standard deviations every point of dps is away
+// from the mean of the points in the trailing baseline window before it.
+// Points with fewer than two baseline points or a constant baseline are
+// left out. The window slides over the sorted points, so this takes linear
+// time after the sort.
+func (dps DPmap) ZScore(baseline Duration) DPmap {
+	times := dps.GetSortedTimes()
+	w := epochSpan(times, baseline)
+
+	// the non-NaN points, and for each the index of the latest one that
+	// differs from the point before it, which tells constant windows
+	// apart without relying on a rounded variance
+	ts := make([]Epoch, 0, len(times))
+	vs := make([]float64, 0, len(times))
+	changed := make([]int, 0, len(times))
+	for _, t := range times {
+		v := float64(dps[t])
+		if math.IsNaN(v) {
+			continue
+		}
+		c := 0
+		if k := len(vs); k > 0 {
+			if c = changed[k-1]; v != vs[k-1] {
+				c = k
+			}
+		}
+		ts, vs, changed = append(ts, t), append(vs, v), append(changed, c)
+	}
+
+	out := DPmap{}
+	var win runningStats
+	lo, hi := 0, 0
+	for _, t := range times {
+		for ; hi < len(ts) && ts[hi] < t; hi++ {
+			win.add(vs[hi])
+		}
+		for ; lo < hi && ts[lo] < t-w; lo++ {
+			win.remove(vs[lo])
+		}
+		if hi-lo < 2 || changed[hi-1] <= lo {
+			continue
+		}
+		out[t] = Point((float64(dps[t]) - win.mean) / win.stddev())
+	}
+	return out
+}
+
+// runningStats keeps the mean and population variance of a window of
+// values as they enter and leave it, with Welford's method.
+type runningStats struct {
+	n        int
+	mean, m2 float64
+}
+
+func (s *runningStats) add(v float64) {
+	s.n++
+	d := v - s.mean
+	s.mean += d / float64(s.n)
+	s.m2 += d * (v - s.mean)
+}
+
+func (s *runningStats) remove(v float64) {
+	s.n--
+	if s.n == 0 {
+		*s = runningStats{}
+		return
+	}
+	d := v - s.mean
+	s.mean -= d / float64(s.n)
+	s.m2 -= d * (v - s.mean)
+}
+
+func (s *runningStats) stddev() float64 {
+	return math.Sqrt(math.Max(s.m2/float64(s.n), 0))
+}
+
+// ZScores applies ZScore to every response of r.
+func (r ResponseSet) ZScores(baseline Duration) ResponseSet {
+	out, _ := r.Transform(func(dps DPmap) (DPmap, error) {
+		return dps.ZScore(baseline), nil
+	})
+	return out
+}
+
+// PercentileBands computes, at every timestamp present in r, the given
+// percentiles across the series of r. It returns one response per
+// percentile holding the tags common to r and a band tag naming the
+// percentile, e.g. band=p90.
+func PercentileBands(r ResponseSet, percentiles ...float64) (ResponseSet, error) {
+	for _, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("opentsdb: invalid percentile %v", p)
+		}
+	}
+	values := map[Epoch][]Point{}
+	tags := make([]TagSet, 0, len(r))
+	metric := ""
+	for _, resp := range r {
+		for t, v := range resp.DPS {
+			if !math.IsNaN(float64(v)) {
+				values[t] = append(values[t], v)
+			}
+		}
+		tags = append(tags, resp.Tags)
+		metric = resp.Metric
+	}
+	common, agg := commonTags(tags)
+
+	out := make(ResponseSet, len(percentiles))
+	for i, p := range percentiles {
+		band := common.Copy()
+		band["band"] = "p" + strconv.FormatFloat(p, 'f', -1, 64)
+		dps := make(DPmap, len(values))
+		for t, vals := range values {
+			dps[t] = percentile(vals, p)
+		}
+		out[i] = &Response{Metric: metric, Tags: band, AggregateTags: append([]string{}, agg...), DPS: dps}
+	}
+	return out, nil
+}
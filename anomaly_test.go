@@ -0,0 +1,79 @@
+package opentsdb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestZScore(t *testing.T) {
+	dps := DPmap{0: 1, 60: 3, 120: 1, 180: 3, 240: 10}
+	z := dps.ZScore(4 * Minute)
+	if _, ok := z[60]; ok {
+		t.Error("expected no z-score without baseline")
+	}
+	// baseline 1, 3, 1, 3: mean 2, stddev 1
+	if z[240] != 8 {
+		t.Errorf("got %v", z)
+	}
+	mean, sd, n := dps.MeanStdDev(0, 180)
+	if mean != 2 || sd != 1 || n != 4 {
+		t.Errorf("got %v %v %v", mean, sd, n)
+	}
+}
+
+func TestZScoreWindow(t *testing.T) {
+	dps := DPmap{}
+	for i := 0; i < 500; i++ {
+		v := Point(i % 7 * i % 13)
+		switch {
+		case i%17 == 0:
+			v = Point(math.NaN())
+		case i >= 300 && i < 360:
+			v = 4 // constant stretch longer than the baseline
+		}
+		dps[Epoch(i*10)] = v
+	}
+	baseline := 5 * Minute
+	z := dps.ZScore(baseline)
+	for _, ts := range dps.GetSortedTimes() {
+		mean, sd, n := dps.MeanStdDev(ts-300, ts-1)
+		got, ok := z[ts]
+		if n < 2 || sd == 0 {
+			if ok && ts >= 3300 && ts < 3600 {
+				t.Errorf("%d: z-score %v over a constant baseline", ts, got)
+			}
+			continue
+		}
+		want := (float64(dps[ts]) - mean) / sd
+		if !ok || math.Abs(float64(got)-want) > 1e-9*math.Max(1, math.Abs(want)) && !math.IsNaN(want) {
+			t.Errorf("%d: got %v, want %v", ts, got, want)
+		}
+	}
+}
+
+func TestPercentileBands(t *testing.T) {
+	rs := ResponseSet{}
+	for i := 0; i <= 10; i++ {
+		rs = append(rs, &Response{Metric: "m", Tags: TagSet{"host": string(rune('a' + i)), "dc": "x"}, DPS: DPmap{60: Point(i)}})
+	}
+	rs[0].DPS[120] = Point(math.NaN())
+	bands, err := PercentileBands(rs, 10, 50, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Point{1, 5, 9}
+	for i, b := range bands {
+		if b.DPS[60] != want[i] {
+			t.Errorf("%s: got %v, want %v", b.Tags, b.DPS[60], want[i])
+		}
+		if _, ok := b.DPS[120]; ok {
+			t.Errorf("%s: NaN only timestamp was kept", b.Tags)
+		}
+	}
+	if bands[2].Tags["band"] != "p90" || bands[2].Tags["dc"] != "x" || bands[2].AggregateTags[0] != "host" {
+		t.Errorf("unexpected band series %v %v", bands[2].Tags, bands[2].AggregateTags)
+	}
+	if _, err := PercentileBands(rs, 101); err == nil {
+		t.Error("expected invalid percentile error")
+	}
+}
@@ -0,0 +1,317 @@
+package opentsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// Arrow type, message header and metadata version numbers used by
+// WriteArrow, as numbered by the Arrow format.
+const (
+	arrowFloatingPoint = 3
+	arrowUtf8          = 5
+	arrowTimestamp     = 10
+
+	arrowSchema      = 1
+	arrowRecordBatch = 3
+
+	arrowV5 = 4
+)
+
+var errArrowSize = errors.New("opentsdb: column too large for an arrow record batch")
+
+// arrowField is a column of an Arrow record batch with its buffers, the
+// validity bitmap left empty as no value is null.
+type arrowField struct {
+	name    string
+	typ     byte
+	buffers [][]byte
+}
+
+// WriteArrow writes c to w as an Arrow IPC stream of one record batch,
+// with the columns metric, timestamp (milliseconds, UTC), value and one
+// per tag key, as WriteCSV. Tags missing from a series are empty rather
+// than null.
+func (c *Columns) WriteArrow(w io.Writer) error {
+	keys, err := c.columnKeys()
+	if err != nil {
+		return err
+	}
+	fields := []arrowField{
+		{"metric", arrowUtf8, nil},
+		{"timestamp", arrowTimestamp, [][]byte{nil, plainInt64s(c.Timestamp)}},
+		{"value", arrowFloatingPoint, [][]byte{nil, plainFloat64s(c.Value)}},
+	}
+	for _, k := range keys {
+		fields = append(fields, arrowField{name: k, typ: arrowUtf8})
+	}
+	if fields[0].buffers, err = arrowStrings(c.Metric); err != nil {
+		return err
+	}
+	for i, k := range keys {
+		if fields[3+i].buffers, err = arrowStrings(c.Tags[k]); err != nil {
+			return err
+		}
+	}
+
+	if err := writeArrowMessage(w, arrowSchemaMessage(fields), nil); err != nil {
+		return err
+	}
+	if err := writeArrowMessage(w, arrowBatchMessage(fields, c.Len()), fields); err != nil {
+		return err
+	}
+	// end of stream
+	_, err = w.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	return err
+}
+
+// arrowStrings returns the offsets and data buffers of s as an Arrow
+// string column.
+func arrowStrings(s []string) ([][]byte, error) {
+	offsets := make([]byte, 4, 4*(len(s)+1))
+	var data []byte
+	for _, v := range s {
+		data = append(data, v...)
+		if len(data) > math.MaxInt32 {
+			return nil, errArrowSize
+		}
+		offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+	}
+	return [][]byte{nil, offsets, data}, nil
+}
+
+// arrowPad returns n rounded up to a multiple of 8, to which Arrow aligns
+// messages and buffers.
+func arrowPad(n int) int {
+	return (n + 7) &^ 7
+}
+
+// writeArrowMessage writes the message metadata meta to w, followed by the
+// buffers of fields as its body.
+func writeArrowMessage(w io.Writer, meta []byte, fields []arrowField) error {
+	b := make([]byte, 8, 8+len(meta))
+	binary.LittleEndian.PutUint32(b, 0xffffffff)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(meta)))
+	if _, err := w.Write(append(b, meta...)); err != nil {
+		return err
+	}
+	var pad [8]byte
+	for _, f := range fields {
+		for _, buf := range f.buffers {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			if _, err := w.Write(pad[:arrowPad(len(buf))-len(buf)]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// arrowSchemaMessage returns the metadata of the schema message of fields.
+func arrowSchemaMessage(fields []arrowField) []byte {
+	var b flatBuilder
+	offs := make([]int, len(fields))
+	for i, f := range fields {
+		name := b.createString(f.name)
+		var typ int
+		switch f.typ {
+		case arrowTimestamp:
+			utc := b.createString("UTC")
+			b.startTable()
+			b.addInt16(0, 1) // MILLISECOND
+			b.addOffset(1, utc)
+			typ = b.endTable()
+		case arrowFloatingPoint:
+			b.startTable()
+			b.addInt16(0, 2) // DOUBLE
+			typ = b.endTable()
+		default:
+			b.startTable()
+			typ = b.endTable()
+		}
+		children := b.createOffsets(nil)
+		b.startTable()
+		b.addOffset(0, name)
+		b.addUint8(1, 0) // not nullable
+		b.addUint8(2, f.typ)
+		b.addOffset(3, typ)
+		b.addOffset(5, children)
+		offs[i] = b.endTable()
+	}
+	vec := b.createOffsets(offs)
+	b.startTable()
+	b.addInt16(0, 0) // little endian
+	b.addOffset(1, vec)
+	schema := b.endTable()
+	return arrowMessage(&b, arrowSchema, schema, 0)
+}
+
+// arrowBatchMessage returns the metadata of the record batch message of n
+// rows of fields.
+func arrowBatchMessage(fields []arrowField, n int) []byte {
+	var b flatBuilder
+	var buffers, nodes []int64
+	var body int64
+	for _, f := range fields {
+		nodes = append(nodes, int64(n), 0)
+		for _, buf := range f.buffers {
+			buffers = append(buffers, body, int64(len(buf)))
+			body += int64(arrowPad(len(buf)))
+		}
+	}
+	bufVec := b.createStructs(buffers, 2)
+	nodeVec := b.createStructs(nodes, 2)
+	b.startTable()
+	b.addInt64(0, int64(n))
+	b.addOffset(1, nodeVec)
+	b.addOffset(2, bufVec)
+	batch := b.endTable()
+	return arrowMessage(&b, arrowRecordBatch, batch, body)
+}
+
+// arrowMessage finishes b with a message of the header of type typ and
+// returns it, padded to a multiple of 8 bytes.
+func arrowMessage(b *flatBuilder, typ byte, header int, bodyLength int64) []byte {
+	b.startTable()
+	b.addInt16(0, arrowV5)
+	b.addUint8(1, typ)
+	b.addOffset(2, header)
+	b.addInt64(3, bodyLength)
+	return b.finish(b.endTable())
+}
+
+// flatBuilder builds a FlatBuffer, in which Arrow metadata is written,
+// back to front as the reference builder does: objects are referred to by
+// their offset from the end of the buffer, which are fixed once written.
+// Everything is aligned to 8 bytes from the end, and the finished buffer
+// is a multiple of 8 bytes long, so alignments hold from the start too.
+type flatBuilder struct {
+	b      []byte // reversed
+	table  int    // offset of the start of the current table
+	fields []int  // offsets of the fields of the current table, by id
+}
+
+// prep pads b with zeros so that after size more bytes it is aligned to
+// align.
+func (b *flatBuilder) prep(align, size int) {
+	for (len(b.b)+size)%align != 0 {
+		b.b = append(b.b, 0)
+	}
+}
+
+// put prepends the little endian v of size bytes.
+func (b *flatBuilder) put(v uint64, size int) {
+	b.prep(size, size)
+	for i := size - 1; i >= 0; i-- {
+		b.b = append(b.b, byte(v>>(8*i)))
+	}
+}
+
+// offset returns the offset from the end of the next prepended uint32 to
+// the object at off.
+func (b *flatBuilder) offset(off int) uint64 {
+	b.prep(4, 4)
+	return uint64(len(b.b) + 4 - off)
+}
+
+// createString writes s and returns its offset.
+func (b *flatBuilder) createString(s string) int {
+	b.prep(4, len(s)+1+4)
+	b.b = append(b.b, 0)
+	for i := len(s) - 1; i >= 0; i-- {
+		b.b = append(b.b, s[i])
+	}
+	b.put(uint64(len(s)), 4)
+	return len(b.b)
+}
+
+// createOffsets writes a vector of the objects at offs and returns its offset.
+func (b *flatBuilder) createOffsets(offs []int) int {
+	b.prep(4, 4*len(offs)+4)
+	for i := len(offs) - 1; i >= 0; i-- {
+		b.put(b.offset(offs[i]), 4)
+	}
+	b.put(uint64(len(offs)), 4)
+	return len(b.b)
+}
+
+// createStructs writes a vector of structs of fields 64 bit fields each, taken
+// in turn from v, and returns its offset.
+func (b *flatBuilder) createStructs(v []int64, fields int) int {
+	b.prep(8, 8*len(v))
+	for i := len(v) - 1; i >= 0; i-- {
+		b.put(uint64(v[i]), 8)
+	}
+	b.put(uint64(len(v)/fields), 4)
+	return len(b.b)
+}
+
+// startTable starts a table, whose fields are then added by id.
+func (b *flatBuilder) startTable() {
+	b.table = len(b.b)
+	b.fields = b.fields[:0]
+}
+
+func (b *flatBuilder) field(id int) {
+	for len(b.fields) <= id {
+		b.fields = append(b.fields, 0)
+	}
+	b.fields[id] = len(b.b)
+}
+
+func (b *flatBuilder) addUint8(id int, v byte) {
+	b.put(uint64(v), 1)
+	b.field(id)
+}
+
+func (b *flatBuilder) addInt16(id int, v int16) {
+	b.put(uint64(uint16(v)), 2)
+	b.field(id)
+}
+
+func (b *flatBuilder) addInt64(id int, v int64) {
+	b.put(uint64(v), 8)
+	b.field(id)
+}
+
+// addOffset sets the field id to the object at off.
+func (b *flatBuilder) addOffset(id, off int) {
+	b.put(b.offset(off), 4)
+	b.field(id)
+}
+
+// endTable writes the table and its vtable and returns its offset.
+func (b *flatBuilder) endTable() int {
+	b.put(0, 4)
+	table := len(b.b)
+	vtable := make([]uint64, 0, 2+len(b.fields))
+	vtable = append(vtable, uint64(4+2*len(b.fields)), uint64(table-b.table))
+	for _, f := range b.fields {
+		if f != 0 {
+			f = table - f
+		}
+		vtable = append(vtable, uint64(f))
+	}
+	for i := len(vtable) - 1; i >= 0; i-- {
+		b.put(vtable[i], 2)
+	}
+	// the table starts with the offset back to its vtable, reversed as b
+	binary.BigEndian.PutUint32(b.b[table-4:], uint32(len(b.b)-table))
+	return table
+}
+
+// finish writes the root offset to the table at root and returns the
+// buffer.
+func (b *flatBuilder) finish(root int) []byte {
+	b.prep(8, 4)
+	b.put(b.offset(root), 4)
+	out := make([]byte, len(b.b))
+	for i, c := range b.b {
+		out[len(out)-1-i] = c
+	}
+	return out
+}
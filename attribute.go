@@ -0,0 +1,72 @@
+package opentsdb
+
+// AttributeTo returns the responses of rs keyed by the index in r of the
+// query they answer. Responses carrying their query, with ShowQuery, are
+// attributed by its index. Others are attributed on a best effort basis
+// to the query of their metric whose tags and filters their tags satisfy,
+// preferring the query with the most constraints satisfied, then the
+// first one. Responses matching no query are left out.
+func (rs ResponseSet) AttributeTo(r *Request) map[int][]*Response {
+	out := map[int][]*Response{}
+	for _, resp := range rs {
+		if i := attribute(r, resp); i >= 0 {
+			out[i] = append(out[i], resp)
+		}
+	}
+	return out
+}
+
+func attribute(r *Request, resp *Response) int {
+	if resp.Query.Metric != "" {
+		if i := resp.Query.Index; i >= 0 && i < len(r.Queries) {
+			return i
+		}
+	}
+	best, bestScore := -1, -1
+	for i, q := range r.Queries {
+		if q.Metric != resp.Metric {
+			continue
+		}
+		if score, ok := q.explains(resp); ok && score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+// explains reports whether q may have produced resp, with the number of
+// its constraints resp satisfies.
+func (q *Query) explains(resp *Response) (int, bool) {
+	aggregated := map[string]bool{}
+	for _, k := range resp.AggregateTags {
+		aggregated[k] = true
+	}
+	score := 0
+	for _, f := range q.tagFilters() {
+		v, ok := resp.Tags[f.TagK]
+		switch {
+		case ok:
+			if !matchFilter(f, v) {
+				return 0, false
+			}
+			score++
+		case f.GroupBy:
+			// series are grouped by the key, so responses have it
+			return 0, false
+		case !aggregated[f.TagK]:
+			return 0, false
+		}
+	}
+	if q.ExplicitTags {
+		keys := map[string]bool{}
+		for _, f := range q.tagFilters() {
+			keys[f.TagK] = true
+		}
+		for k := range resp.Tags {
+			if !keys[k] {
+				return 0, false
+			}
+		}
+	}
+	return score, true
+}
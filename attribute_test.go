@@ -0,0 +1,36 @@
+package opentsdb
+
+import "testing"
+
+func TestAttributeTo(t *testing.T) {
+	r := &Request{Queries: []*Query{
+		{Metric: "cpu", Filters: Filters{{Type: "literal_or", TagK: "dc", Filter: "east", GroupBy: true}}},
+		{Metric: "cpu", Filters: Filters{{Type: "literal_or", TagK: "dc", Filter: "west", GroupBy: true}}},
+		{Metric: "cpu", Filters: Filters{{Type: "wildcard", TagK: "host", Filter: "*", GroupBy: true}, {Type: "literal_or", TagK: "dc", Filter: "east"}}},
+		{Metric: "mem"},
+	}}
+	rs := ResponseSet{
+		{Metric: "cpu", Tags: TagSet{"dc": "east"}, AggregateTags: []string{"host"}},
+		{Metric: "cpu", Tags: TagSet{"dc": "west"}, AggregateTags: []string{"host"}},
+		{Metric: "cpu", Tags: TagSet{"dc": "east", "host": "a"}},
+		{Metric: "mem", Tags: TagSet{}, AggregateTags: []string{"host"}},
+		{Metric: "disk", Tags: TagSet{}},
+		{Metric: "cpu", Tags: TagSet{"dc": "west"}, Query: Query{Metric: "cpu", Index: 0}},
+	}
+	got := rs.AttributeTo(r)
+	want := map[int][]int{0: {0, 5}, 1: {1}, 2: {2}, 3: {3}}
+	if len(got) != len(want) {
+		t.Errorf("got %d queries, want %d", len(got), len(want))
+	}
+	for qi, idx := range want {
+		if len(got[qi]) != len(idx) {
+			t.Errorf("query %d: got %d responses, want %d", qi, len(got[qi]), len(idx))
+			continue
+		}
+		for j, ri := range idx {
+			if got[qi][j] != rs[ri] {
+				t.Errorf("query %d: response %d is %+v, want %+v", qi, j, got[qi][j], rs[ri])
+			}
+		}
+	}
+}
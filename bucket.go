@@ -0,0 +1,156 @@
+package opentsdb
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The bucket helpers work in the unit of their epochs: seconds, or
+// milliseconds above 2^32, as elsewhere in the package.
+
+// Truncate returns e rounded down to a multiple of d since the Unix epoch,
+// which is how OpenTSDB aligns downsampling buckets. d below the unit of e
+// leaves e unchanged.
+func (e Epoch) Truncate(d Duration) Epoch {
+	step := epochSpan([]Epoch{e}, d)
+	if step < 1 {
+		return e
+	}
+	return floorEpoch(e, step)
+}
+
+// floorEpoch returns the multiple of step at or before t.
+func floorEpoch(t, step Epoch) Epoch {
+	f := t - t%step
+	if t < 0 && t%step != 0 {
+		f -= step
+	}
+	return f
+}
+
+// Add returns e plus d, rounded down to the unit of e.
+func (e Epoch) Add(d Duration) Epoch {
+	return e + epochSpan([]Epoch{e}, d)
+}
+
+// CalendarTruncate returns e rounded down to the start of its calendar
+// bucket of the OpenTSDB duration spec in loc, which is how OpenTSDB aligns
+// downsampling buckets with useCalendar. A spec of n years, months ("n"),
+// weeks or days aligns to multiples of n of that unit counted on the
+// calendar of loc from a fixed origin: year 0, January of year 0,
+// Sunday 1970-01-04 and 1970-01-01, so "3n" buckets are quarters and "2d"
+// buckets pairs of days. Other durations that divide a day, such as "6h",
+// align to multiples since midnight; longer ones align as by Truncate.
+func (e Epoch) CalendarTruncate(spec string, loc *time.Location) (Epoch, error) {
+	unit, n, d, err := calendarSpec(spec)
+	if err != nil {
+		return e, err
+	}
+	t := epochTime(e).In(loc)
+	y, m, day := t.Date()
+	switch unit {
+	case 'y':
+		y = int(floorEpoch(Epoch(y), Epoch(n)))
+		t = time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	case 'n':
+		months := floorEpoch(Epoch(12*y+int(m)-1), Epoch(n))
+		t = time.Date(0, time.Month(months)+1, 1, 0, 0, 0, 0, loc)
+	case 'w', 'd':
+		origin, step := 0, n
+		if unit == 'w' {
+			origin, step = 3, 7*n
+		}
+		days := int(time.Date(y, m, day, 0, 0, 0, 0, time.UTC).Unix()/86400) - origin
+		days = int(floorEpoch(Epoch(days), Epoch(step)))
+		t = time.Date(1970, 1, 1+origin+days, 0, 0, 0, 0, loc)
+	default:
+		if d <= 0 {
+			return e, nil
+		}
+		if Day%d != 0 {
+			return e.Truncate(d), nil
+		}
+		midnight := time.Date(y, m, day, 0, 0, 0, 0, loc)
+		t = midnight.Add(t.Sub(midnight) / time.Duration(d) * time.Duration(d))
+	}
+	return timeEpoch(t, e), nil
+}
+
+// CalendarAdd returns e plus the OpenTSDB duration spec in loc, adding
+// years, months, weeks and days on the calendar as the package-level
+// CalendarAdd does.
+func (e Epoch) CalendarAdd(spec string, loc *time.Location) (Epoch, error) {
+	t, err := CalendarAdd(epochTime(e).In(loc), spec)
+	return timeEpoch(t, e), err
+}
+
+// calendarSpec splits a spec of a single calendar unit, such as "3n" or
+// "2d", into the unit and its count n. Other specs, such as "6h" or
+// "1d12h", return a zero unit and their fixed length d.
+func calendarSpec(spec string) (unit byte, n int, d Duration, err error) {
+	if i := len(spec) - 1; i > 0 && strings.IndexByte("dwny", spec[i]) >= 0 {
+		if n, err := strconv.Atoi(spec[:i]); err == nil && n > 0 {
+			return spec[i], n, 0, nil
+		}
+	}
+	d, err = ParseDuration(spec)
+	return 0, 0, d, err
+}
+
+// timeEpoch converts t to an epoch in the unit of like.
+func timeEpoch(t time.Time, like Epoch) Epoch {
+	if like > 0xffffffff {
+		return Epoch(t.UnixMilli())
+	}
+	return Epoch(t.Unix())
+}
+
+// BucketIter iterates over the buckets covering a time range.
+type BucketIter struct {
+	start, next, end Epoch
+	d                Duration
+	spec             string
+	loc              *time.Location
+}
+
+// BucketRange returns an iterator over the buckets of d from the one
+// holding start to the one holding end, aligned as by Epoch.Truncate.
+func BucketRange(start, end Epoch, d Duration) *BucketIter {
+	return &BucketIter{next: start.Truncate(d), end: end, d: d}
+}
+
+// CalendarBucketRange is like BucketRange, with buckets of the OpenTSDB
+// duration spec aligned as by Epoch.CalendarTruncate in loc.
+func CalendarBucketRange(start, end Epoch, spec string, loc *time.Location) (*BucketIter, error) {
+	next, err := start.CalendarTruncate(spec, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &BucketIter{next: next, end: end, spec: spec, loc: loc}, nil
+}
+
+// Next advances to the next bucket and reports whether there is one.
+func (b *BucketIter) Next() bool {
+	if b.next > b.end {
+		return false
+	}
+	b.start = b.next
+	if b.loc != nil {
+		// the spec was checked by CalendarBucketRange
+		b.next, _ = b.next.CalendarAdd(b.spec, b.loc)
+	} else {
+		b.next = b.next.Add(b.d)
+	}
+	if b.next <= b.start {
+		// d is below the unit of the epochs
+		b.next = b.start + 1
+	}
+	return true
+}
+
+// Bucket returns the start of the current bucket and the start of the
+// following one.
+func (b *BucketIter) Bucket() (start, next Epoch) {
+	return b.start, b.next
+}
@@ -0,0 +1,113 @@
+package opentsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEpochTruncate(t *testing.T) {
+	for _, tc := range []struct {
+		e    Epoch
+		d    Duration
+		want Epoch
+	}{
+		{1500000123, Minute, 1500000120},
+		{1500000123, Hour, 1499997600},
+		{1500000123456, Minute, 1500000120000},
+		{-5, Minute, -60},
+		{1500000123, Millisecond, 1500000123},
+	} {
+		if got := tc.e.Truncate(tc.d); got != tc.want {
+			t.Errorf("%d.Truncate(%v) = %d, want %d", tc.e, tc.d, got, tc.want)
+		}
+	}
+	if got := Epoch(1500000000000).Add(1500 * Millisecond); got != 1500000001500 {
+		t.Errorf("ms Add = %d", got)
+	}
+	if got := Epoch(1500000000).Add(1500 * Millisecond); got != 1500000001 {
+		t.Errorf("s Add = %d", got)
+	}
+}
+
+func TestEpochCalendar(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Wednesday 2021-03-17 15:30 in New York
+	e := Epoch(time.Date(2021, 3, 17, 15, 30, 0, 0, loc).Unix())
+	for _, tc := range []struct {
+		spec string
+		want time.Time
+	}{
+		{"1d", time.Date(2021, 3, 17, 0, 0, 0, 0, loc)},
+		{"2d", time.Date(2021, 3, 16, 0, 0, 0, 0, loc)},
+		{"60d", time.Date(2021, 2, 2, 0, 0, 0, 0, loc)},
+		{"1w", time.Date(2021, 3, 14, 0, 0, 0, 0, loc)},
+		{"2w", time.Date(2021, 3, 7, 0, 0, 0, 0, loc)},
+		{"1n", time.Date(2021, 3, 1, 0, 0, 0, 0, loc)},
+		{"3n", time.Date(2021, 1, 1, 0, 0, 0, 0, loc)},
+		{"6n", time.Date(2021, 1, 1, 0, 0, 0, 0, loc)},
+		{"1y", time.Date(2021, 1, 1, 0, 0, 0, 0, loc)},
+		{"2y", time.Date(2020, 1, 1, 0, 0, 0, 0, loc)},
+		{"6h", time.Date(2021, 3, 17, 12, 0, 0, 0, loc)},
+	} {
+		got, err := e.CalendarTruncate(tc.spec, loc)
+		if err != nil || got != Epoch(tc.want.Unix()) {
+			t.Errorf("CalendarTruncate(%s) = %v, %v, want %v", tc.spec, epochTime(got).In(loc), err, tc.want)
+		}
+	}
+	if _, err := e.CalendarTruncate("1x", loc); err == nil {
+		t.Error("CalendarTruncate(1x) succeeded")
+	}
+
+	// quarters follow the calendar whatever the month lengths
+	it, err := CalendarBucketRange(e, Epoch(time.Date(2021, 12, 31, 0, 0, 0, 0, loc).Unix()), "3n", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var quarters []time.Month
+	for it.Next() {
+		s, _ := it.Bucket()
+		quarters = append(quarters, epochTime(s).In(loc).Month())
+	}
+	if len(quarters) != 4 || quarters[0] != time.January || quarters[3] != time.October {
+		t.Errorf("quarters %v", quarters)
+	}
+
+	// daily buckets across the DST change of 2021-03-14 are 23 hours long
+	start := Epoch(time.Date(2021, 3, 13, 12, 0, 0, 0, loc).Unix())
+	end := Epoch(time.Date(2021, 3, 15, 12, 0, 0, 0, loc).Unix())
+	it, err = CalendarBucketRange(start, end, "1d", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lengths []Epoch
+	for it.Next() {
+		s, n := it.Bucket()
+		lengths = append(lengths, n-s)
+	}
+	if len(lengths) != 3 || lengths[0] != 86400 || lengths[1] != 82800 || lengths[2] != 86400 {
+		t.Errorf("bucket lengths %v", lengths)
+	}
+
+	feb, err := Epoch(time.Date(2021, 1, 31, 0, 0, 0, 0, loc).Unix()).CalendarAdd("1n", loc)
+	if got := epochTime(feb).In(loc); err != nil || got.Month() != time.February || got.Day() != 28 {
+		t.Errorf("month after January 31st: %v, %v", got, err)
+	}
+}
+
+func TestBucketRange(t *testing.T) {
+	it := BucketRange(125, 300, Minute)
+	var starts []Epoch
+	for it.Next() {
+		s, n := it.Bucket()
+		if n-s != 60 {
+			t.Errorf("bucket %d to %d", s, n)
+		}
+		starts = append(starts, s)
+	}
+	if len(starts) != 4 || starts[0] != 120 || starts[3] != 300 {
+		t.Errorf("got %v", starts)
+	}
+}
@@ -0,0 +1,206 @@
+package opentsdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"sync"
+)
+
+// BusMessage is a batch of data points encoded as NDJSON for a message
+// bus such as Kafka. All points of a message belong to the same partition.
+type BusMessage struct {
+	Partition int
+	// Key is the series key of the first point, for buses that partition
+	// by key themselves.
+	Key   []byte
+	Value []byte
+}
+
+// BusProducer publishes messages to a message bus.
+type BusProducer interface {
+	Produce(ctx context.Context, msgs []BusMessage) error
+}
+
+// BusConsumer reads the messages of a message bus in order. Consume
+// blocks until a message is available and returns io.EOF once the bus is
+// closed.
+type BusConsumer interface {
+	Consume(ctx context.Context) (BusMessage, error)
+}
+
+// SeriesPartition returns the partition of the series of dp among n, from
+// a hash of its metric and tags, so that the points of a series keep their
+// order across the bus.
+func SeriesPartition(dp *DataPoint, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	io.WriteString(h, dp.Metric)
+	io.WriteString(h, dp.Tags.String())
+	return int(h.Sum32() % uint32(n))
+}
+
+// BusSink publishes data points to a message bus. It has the signature of
+// Client.Put, so it can stand in for a client.
+type BusSink struct {
+	Producer   BusProducer
+	Partitions int
+}
+
+// NewBusSink returns a sink publishing to p over the given number of
+// partitions.
+func NewBusSink(p BusProducer, partitions int) *BusSink {
+	return &BusSink{Producer: p, Partitions: partitions}
+}
+
+// Put publishes dps as one message per partition, keeping the order of
+// the points of every series.
+func (s *BusSink) Put(dps MultiDataPoint) error {
+	return s.PutContext(context.Background(), dps)
+}
+
+// PutContext is Put with a context.
+func (s *BusSink) PutContext(ctx context.Context, dps MultiDataPoint) error {
+	n := s.Partitions
+	if n < 1 {
+		n = 1
+	}
+	bufs := make([]*bytes.Buffer, n)
+	encs := make([]*NDJSONEncoder, n)
+	keys := make([][]byte, n)
+	for _, dp := range dps {
+		p := SeriesPartition(dp, n)
+		if bufs[p] == nil {
+			bufs[p] = &bytes.Buffer{}
+			encs[p] = NewNDJSONEncoder(bufs[p])
+			keys[p] = []byte(dp.Metric + dp.Tags.String())
+		}
+		if err := encs[p].Encode(dp); err != nil {
+			return err
+		}
+	}
+	var msgs []BusMessage
+	for p, b := range bufs {
+		if b != nil {
+			msgs = append(msgs, BusMessage{Partition: p, Key: keys[p], Value: b.Bytes()})
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return s.Producer.Produce(ctx, msgs)
+}
+
+// BusSource consumes data points from a message bus and passes every
+// message's points to Put, typically the Put method of a Client.
+type BusSource struct {
+	Consumer BusConsumer
+	Put      func(MultiDataPoint) error
+	// OnError, if set, receives the malformed lines of messages, which
+	// are skipped.
+	OnError func(error)
+}
+
+// Run consumes messages until ctx is done or the bus is closed, which
+// returns nil. A failing Put stops Run with its error.
+func (s *BusSource) Run(ctx context.Context) error {
+	for {
+		msg, err := s.Consumer.Consume(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dps, err := ReadNDJSONDataPoints(bytes.NewReader(msg.Value))
+		if err != nil && s.OnError != nil {
+			s.OnError(err)
+		}
+		if len(dps) == 0 {
+			continue
+		}
+		if err := s.Put(dps); err != nil {
+			return err
+		}
+	}
+}
+
+// MemoryBus is an in-memory message bus with a fixed number of
+// partitions, for tests and for decoupling producers from a Client within
+// one process.
+type MemoryBus struct {
+	parts []chan BusMessage
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewMemoryBus returns a bus of the given number of partitions, each
+// buffering up to size messages.
+func NewMemoryBus(partitions, size int) *MemoryBus {
+	if partitions < 1 {
+		partitions = 1
+	}
+	b := &MemoryBus{parts: make([]chan BusMessage, partitions)}
+	for i := range b.parts {
+		b.parts[i] = make(chan BusMessage, size)
+	}
+	return b
+}
+
+var errBusClosed = errors.New("opentsdb: bus closed")
+
+// Produce appends msgs to their partitions, blocking while a partition is
+// full.
+func (b *MemoryBus) Produce(ctx context.Context, msgs []BusMessage) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return errBusClosed
+	}
+	for _, m := range msgs {
+		select {
+		case b.parts[m.Partition%len(b.parts)] <- m:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Consumer returns a consumer of partition p.
+func (b *MemoryBus) Consumer(p int) BusConsumer {
+	return memoryConsumer(b.parts[p%len(b.parts)])
+}
+
+// Close stops the bus. Consumers get the messages already produced, then
+// io.EOF.
+func (b *MemoryBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, c := range b.parts {
+		close(c)
+	}
+}
+
+type memoryConsumer chan BusMessage
+
+func (c memoryConsumer) Consume(ctx context.Context) (BusMessage, error) {
+	select {
+	case m, ok := <-c:
+		if !ok {
+			return m, io.EOF
+		}
+		return m, nil
+	case <-ctx.Done():
+		return BusMessage{}, ctx.Err()
+	}
+}
@@ -0,0 +1,56 @@
+package opentsdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	const n = 4
+	bus := NewMemoryBus(n, 16)
+	sink := NewBusSink(bus, n)
+	var dps MultiDataPoint
+	for i := 1; i <= 20; i++ {
+		dps = append(dps, &DataPoint{Metric: "m", Timestamp: Epoch(i), Value: i, Tags: TagSet{"host": fmt.Sprint(i % 5)}})
+	}
+	if err := sink.Put(dps); err != nil {
+		t.Fatal(err)
+	}
+	bus.Close()
+
+	got := map[string][]Epoch{}
+	for p := 0; p < n; p++ {
+		src := &BusSource{
+			Consumer: bus.Consumer(p),
+			Put: func(dps MultiDataPoint) error {
+				for _, dp := range dps {
+					if SeriesPartition(dp, n) != p {
+						t.Errorf("point %v in partition %d", dp, p)
+					}
+					key := dp.Tags["host"]
+					got[key] = append(got[key], dp.Timestamp)
+				}
+				return nil
+			},
+		}
+		if err := src.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := 0
+	for host, ts := range got {
+		total += len(ts)
+		for i := 1; i < len(ts); i++ {
+			if ts[i] <= ts[i-1] {
+				t.Errorf("%s: out of order %v", host, ts)
+			}
+		}
+	}
+	if total != 20 {
+		t.Errorf("got %d points", total)
+	}
+	if err := sink.Put(dps); err == nil {
+		t.Error("expected error on closed bus")
+	}
+}
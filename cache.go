@@ -0,0 +1,262 @@
+package opentsdb
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CacheContext caches the responses of a Context by the canonical key of
+// requests, which suits repeated queries of historical ranges. Requests
+// with relative times are keyed on their unresolved times, so that they
+// hit the cache until TTL expires. Every call returns its own copy of the
+// cached responses, which callers may modify.
+type CacheContext struct {
+	Context Context
+	// TTL is how long responses are served from the cache. Zero keeps
+	// them until invalidated or evicted.
+	TTL time.Duration
+	// MaxEntries bounds the number of cached responses, the least
+	// recently used being evicted. It is DefaultCacheEntries if zero.
+	MaxEntries int
+	// Revalidate makes expired entries be refreshed in place: when the
+	// new response has the same content hash as the cached one, the entry
+	// is kept and Refresh reports it unchanged, so that callers can skip
+	// re-processing it.
+	Revalidate bool
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	lru       list.List // of *cacheEntry, most recent first
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// DefaultCacheEntries is the MaxEntries of a CacheContext unless set.
+const DefaultCacheEntries = 1000
+
+type cacheEntry struct {
+	key     string
+	rs      ResponseSet
+	hash    string
+	fetched time.Time
+	// queries are the canonical forms of the queries of the request
+	// cached, in order, to map query indexes to equivalent requests.
+	queries []string
+}
+
+// NewCacheContext returns a CacheContext caching the responses of c for
+// ttl.
+func NewCacheContext(c Context, ttl time.Duration) *CacheContext {
+	return &CacheContext{Context: c, TTL: ttl}
+}
+
+func (c *CacheContext) Version() Version {
+	return c.Context.Version()
+}
+
+func (c *CacheContext) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now().UTC()
+}
+
+// cacheKey returns the key of r: its canonical key, or for requests whose
+// time range moves with now, a hash of its unresolved times and canonical
+// parameters.
+func cacheKey(r *Request, now time.Time) (string, error) {
+	_, relStart := relativeSpec(r.Start)
+	_, relEnd := relativeSpec(r.End)
+	if !relStart && !relEnd && hasTime(r.End) {
+		return r.CanonicalKeyAt(now)
+	}
+	if _, _, err := r.timeRange(now); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("start=%v&end=%v", r.Start, r.End) + r.canonicalParams()))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Query returns the cached response of r if it hasn't expired, and queries
+// the wrapped context otherwise. Errors aren't cached.
+func (c *CacheContext) Query(r *Request) (ResponseSet, error) {
+	now := c.clock()
+	key, err := cacheKey(r, now)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	var e *cacheEntry
+	if ok {
+		e = el.Value.(*cacheEntry)
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if ok && (c.TTL <= 0 || now.Sub(e.fetched) < c.TTL) {
+		return e.reindex(r), nil
+	}
+	if ok && !c.Revalidate {
+		c.remove(key)
+	}
+	rs, _, err := c.refresh(r, key, now)
+	return rs, err
+}
+
+// Refresh queries r from the wrapped context and caches the response. It
+// reports whether the response differs from the cached one.
+func (c *CacheContext) Refresh(r *Request) (rs ResponseSet, changed bool, err error) {
+	now := c.clock()
+	key, err := cacheKey(r, now)
+	if err != nil {
+		return nil, false, err
+	}
+	return c.refresh(r, key, now)
+}
+
+func (c *CacheContext) refresh(r *Request, key string, now time.Time) (ResponseSet, bool, error) {
+	rs, err := c.Context.Query(r)
+	if err != nil {
+		return nil, false, err
+	}
+	hash, err := rs.ContentHash()
+	if err != nil {
+		return nil, false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]*list.Element{}
+	}
+	defer c.sweep(now)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		c.lru.MoveToFront(el)
+		if e.hash == hash {
+			e.fetched = now
+			return rs, false, nil
+		}
+		e.rs, e.hash, e.fetched, e.queries = rs.Copy(), hash, now, canonicalQueries(r)
+		return rs, true, nil
+	}
+	e := &cacheEntry{key: key, rs: rs.Copy(), hash: hash, fetched: now, queries: canonicalQueries(r)}
+	c.entries[key] = c.lru.PushFront(e)
+	max := c.MaxEntries
+	if max <= 0 {
+		max = DefaultCacheEntries
+	}
+	for c.lru.Len() > max {
+		c.removeElement(c.lru.Back())
+	}
+	return rs, true, nil
+}
+
+// sweep removes the expired entries, at most once per TTL.
+func (c *CacheContext) sweep(now time.Time) {
+	if c.TTL <= 0 || now.Sub(c.lastSweep) < c.TTL {
+		return
+	}
+	c.lastSweep = now
+	for el := c.lru.Back(); el != nil; {
+		prev := el.Prev()
+		if now.Sub(el.Value.(*cacheEntry).fetched) >= c.TTL {
+			c.removeElement(el)
+		}
+		el = prev
+	}
+}
+
+func (c *CacheContext) removeElement(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+func (c *CacheContext) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Len returns the number of cached responses.
+func (c *CacheContext) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Invalidate removes the cached response of r.
+func (c *CacheContext) Invalidate(r *Request) {
+	key, err := cacheKey(r, c.clock())
+	if err != nil {
+		return
+	}
+	c.remove(key)
+}
+
+// Purge removes all cached responses.
+func (c *CacheContext) Purge() {
+	c.mu.Lock()
+	c.entries = nil
+	c.lru.Init()
+	c.mu.Unlock()
+}
+
+func canonicalQueries(r *Request) []string {
+	qs := make([]string, len(r.Queries))
+	for i, q := range r.Queries {
+		qs[i] = q.canonicalString()
+	}
+	return qs
+}
+
+// reindex returns a copy of the cached responses with their query indexes
+// mapped to those of the equivalent queries of r, which may be in another
+// order. Without ShowQuery responses carry no index.
+func (e *cacheEntry) reindex(r *Request) ResponseSet {
+	rs := e.rs.Copy()
+	if !r.ShowQuery {
+		return rs
+	}
+	positions := map[string][]int{}
+	for i, q := range canonicalQueries(r) {
+		positions[q] = append(positions[q], i)
+	}
+	index := make([]int, len(e.queries))
+	same := true
+	for i, q := range e.queries {
+		index[i] = i
+		if p := positions[q]; len(p) > 0 {
+			index[i], positions[q] = p[0], p[1:]
+		}
+		same = same && index[i] == i
+	}
+	if same {
+		return rs
+	}
+	for _, resp := range rs {
+		if qi := resp.Query.Index; qi >= 0 && qi < len(index) {
+			resp.Query.Index = index[qi]
+		}
+	}
+	sort.SliceStable(rs, func(i, j int) bool { return rs[i].Query.Index < rs[j].Query.Index })
+	return rs
+}
+
+// ContentHash returns a hash of the content of rs: two response sets with
+// the same series and points in the same order have the same hash.
+func (rs ResponseSet) ContentHash() (string, error) {
+	b, err := json.Marshal(rs)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,125 @@
+package opentsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheContext(t *testing.T) {
+	var calls int
+	value := Point(1)
+	backend := funcContext(func(*Request) (ResponseSet, error) {
+		calls++
+		return ResponseSet{{Metric: "m", Tags: TagSet{}, DPS: DPmap{100: value}}}, nil
+	})
+	now := time.Unix(1000, 0)
+	c := NewCacheContext(backend, time.Minute)
+	c.Revalidate = true
+	c.now = func() time.Time { return now }
+
+	r := &Request{Start: "100", End: "200", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	first, err := c.Query(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same := &Request{Start: "100", End: "200", Queries: []*Query{{Aggregator: "sum", Metric: "m"}}}
+	// callers get copies they may modify
+	first[0].Metric = "renamed"
+	first[0].DPS[100] *= 10
+	if rs, _ := c.Query(same); calls != 1 || rs[0].Metric != "m" || rs[0].DPS[100] != 1 {
+		t.Errorf("equivalent request not served from cache, %d calls, got %v", calls, rs[0])
+	}
+
+	// expired but unchanged: the cached response set is kept
+	now = now.Add(2 * time.Minute)
+	if rs, _ := c.Query(r); calls != 2 || rs[0].DPS[100] != 1 {
+		t.Errorf("unchanged response not revalidated, %d calls", calls)
+	}
+	if _, changed, _ := c.Refresh(r); changed {
+		t.Error("Refresh reported an unchanged response as changed")
+	}
+
+	value = 2
+	rs, changed, err := c.Refresh(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || rs[0].DPS[100] != 2 {
+		t.Errorf("got changed=%v %v after a change", changed, rs[0].DPS)
+	}
+	if rs, _ := c.Query(r); rs[0].DPS[100] != 2 {
+		t.Errorf("cache not updated, got %v", rs[0].DPS)
+	}
+
+	c.Invalidate(r)
+	calls = 0
+	c.Query(r)
+	if calls != 1 {
+		t.Errorf("invalidated request not queried")
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	a := ResponseSet{{Metric: "m", Tags: TagSet{"a": "1", "b": "2"}, DPS: DPmap{1: 1, 2: 2}}}
+	b := ResponseSet{{Metric: "m", Tags: TagSet{"b": "2", "a": "1"}, DPS: DPmap{2: 2, 1: 1}}}
+	ha, _ := a.ContentHash()
+	hb, _ := b.ContentHash()
+	if ha != hb {
+		t.Error("equal response sets hash differently")
+	}
+	b[0].DPS[2] = 3
+	if hb, _ = b.ContentHash(); ha == hb {
+		t.Error("different response sets hash the same")
+	}
+}
+
+func TestCacheContextKeys(t *testing.T) {
+	var calls int
+	backend := funcContext(func(r *Request) (ResponseSet, error) {
+		calls++
+		var rs ResponseSet
+		for i, q := range r.Queries {
+			rs = append(rs, &Response{Metric: q.Metric, Query: Query{Metric: q.Metric, Index: i}, DPS: DPmap{1: 1}})
+		}
+		return rs, nil
+	})
+	now := time.Unix(10000, 0)
+	c := NewCacheContext(backend, time.Minute)
+	c.MaxEntries = 2
+	c.now = func() time.Time { return now }
+	q := func(m string) *Query { return &Query{Metric: m, Aggregator: "sum"} }
+
+	rel := &Request{Start: "1h-ago", Queries: []*Query{q("a")}}
+	c.Query(rel)
+	now = now.Add(time.Second)
+	c.Query(rel)
+	if calls != 1 {
+		t.Errorf("relative request missed the cache, %d calls", calls)
+	}
+
+	ab := &Request{Start: "100", End: "200", ShowQuery: true, Queries: []*Query{q("a"), q("b")}}
+	ba := &Request{Start: "100", End: "200", ShowQuery: true, Queries: []*Query{q("b"), q("a")}}
+	c.Query(ab)
+	rs, _ := c.Query(ba)
+	if calls != 2 || rs[0].Metric != "b" || rs[0].Query.Index != 0 || rs[1].Metric != "a" || rs[1].Query.Index != 1 {
+		t.Errorf("reordered request: %d calls, got %v %v", calls, rs[0], rs[1])
+	}
+	if rs, _ := c.Query(ab); rs[0].Metric != "a" || rs[0].Query.Index != 0 {
+		t.Error("cached responses modified by reindexing")
+	}
+
+	c.Query(&Request{Start: "300", End: "400", Queries: []*Query{q("c")}})
+	if c.Len() != 2 {
+		t.Errorf("%d entries, want 2", c.Len())
+	}
+	c.Query(rel)
+	if calls != 4 {
+		t.Errorf("least recently used entry not evicted, %d calls", calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	c.Query(&Request{Start: "500", End: "600", Queries: []*Query{q("d")}})
+	if c.Len() != 1 {
+		t.Errorf("expired entries not swept, %d entries", c.Len())
+	}
+}
@@ -0,0 +1,136 @@
+package opentsdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// location returns the time zone of r, UTC when unset.
+func (r *Request) location() (*time.Location, error) {
+	if r.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(r.Timezone)
+}
+
+// hasTime returns true if v holds a start or end time.
+func hasTime(v interface{}) bool {
+	if t, ok := v.(time.Time); ok {
+		return !t.IsZero()
+	}
+	return v != nil && v != "" && v != TimeSpec("")
+}
+
+// relativeSpec returns the duration of a relative "X-ago" time.
+func relativeSpec(v interface{}) (string, bool) {
+	var s string
+	switch i := v.(type) {
+	case string:
+		s = i
+	case TimeSpec:
+		s = string(i)
+	default:
+		return "", false
+	}
+	if !strings.HasSuffix(s, "-ago") {
+		return "", false
+	}
+	return strings.TrimSuffix(s, "-ago"), true
+}
+
+// parseTimeAt resolves a start or end value of r against now. Wall clock
+// times are read in the request's time zone and, with UseCalendar set,
+// relative times are computed with calendar units in that zone.
+func (r *Request) parseTimeAt(v interface{}, now time.Time) (time.Time, error) {
+	loc, err := r.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	spec, ok := relativeSpec(v)
+	if !ok || !r.UseCalendar {
+		return parseTimeIn(v, now, loc)
+	}
+	return CalendarAdd(now.In(loc), "-"+spec)
+}
+
+// timeRange returns the start and end of r resolved against now. A missing
+// end is now.
+func (r *Request) timeRange(now time.Time) (start, end time.Time, err error) {
+	if !hasTime(r.Start) {
+		return start, end, ErrMissingStartTime
+	}
+	if start, err = r.parseTimeAt(r.Start, now); err != nil {
+		return
+	}
+	end = now
+	if hasTime(r.End) {
+		end, err = r.parseTimeAt(r.End, now)
+	}
+	return
+}
+
+// CalendarAdd adds the OpenTSDB duration d, such as "-1n", "2w" or "1d12h",
+// to t. Days, weeks, months and years follow the calendar of t's location,
+// so they honor daylight saving changes and month lengths; a month after
+// January 31st is the last day of February. Smaller units are fixed.
+func CalendarAdd(t time.Time, d string) (time.Time, error) {
+	s := d
+	sign := 1
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		if s[0] == '-' {
+			sign = -1
+		}
+		s = s[1:]
+	}
+	if s == "" {
+		return t, fmt.Errorf("time: invalid duration %s", d)
+	}
+	var fixed Duration
+	for s != "" {
+		i := 0
+		for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+			i++
+		}
+		j := i
+		for j < len(s) && s[j] >= 'a' && s[j] <= 'z' {
+			j++
+		}
+		elem, unit := s[:j], s[i:j]
+		s = s[j:]
+		if n, err := strconv.Atoi(elem[:i]); err == nil {
+			n *= sign
+			switch unit {
+			case "d":
+				t = t.AddDate(0, 0, n)
+				continue
+			case "w":
+				t = t.AddDate(0, 0, 7*n)
+				continue
+			case "n":
+				t = addMonths(t, n)
+				continue
+			case "y":
+				t = addMonths(t, 12*n)
+				continue
+			}
+		}
+		v, err := ParseDuration(elem)
+		if err != nil {
+			return t, fmt.Errorf("time: invalid duration %s", d)
+		}
+		fixed += Duration(sign) * v
+	}
+	return t.Add(time.Duration(fixed)), nil
+}
+
+// addMonths adds n months to t, clamping the day to the end of the month.
+func addMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
@@ -0,0 +1,104 @@
+package opentsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarAdd(t *testing.T) {
+	base := time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		d    string
+		want time.Time
+	}{
+		{"-1n", time.Date(2023, 2, 28, 12, 0, 0, 0, time.UTC)},
+		{"-1y", time.Date(2022, 3, 31, 12, 0, 0, 0, time.UTC)},
+		{"-2w", time.Date(2023, 3, 17, 12, 0, 0, 0, time.UTC)},
+		{"1d", time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)},
+		{"-90m", time.Date(2023, 3, 31, 10, 30, 0, 0, time.UTC)},
+		{"-1n1d", time.Date(2023, 2, 27, 12, 0, 0, 0, time.UTC)},
+		{"1d12h", time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC)},
+		{"-1h30m", time.Date(2023, 3, 31, 10, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := CalendarAdd(base, test.d)
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("%s: got %v %v, expected %v", test.d, got, err, test.want)
+		}
+	}
+	if _, err := CalendarAdd(base, "xd"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestSetTimeRelativeEnd(t *testing.T) {
+	now := time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC)
+	r := &Request{Start: "1n-ago", End: "10m-ago", UseCalendar: true}
+	if err := r.SetTime(now); err != nil {
+		t.Fatal(err)
+	}
+	if r.Start != TimeSpec("1677585600") || r.End != TimeSpec("1680263400") {
+		t.Errorf("got start=%v end=%v", r.Start, r.End)
+	}
+
+	r = &Request{Start: "1h-ago"}
+	if err := r.SetTime(now); err != nil {
+		t.Fatal(err)
+	}
+	if r.End != TimeSpec("1680264000") {
+		t.Errorf("got end=%v", r.End)
+	}
+}
+
+func TestGetDurationCalendar(t *testing.T) {
+	r := &Request{Start: "1y-ago", UseCalendar: true, Timezone: "UTC"}
+	d, err := r.GetDuration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != 365*Day && d != 366*Day {
+		t.Errorf("got %v", d.HumanString())
+	}
+
+	r = &Request{Start: "2023/03/01-00:00:00", End: "2023/03/31-00:00:00", UseCalendar: true, Queries: []*Query{{}}}
+	if err := r.AutoDownsample(20); err != nil {
+		t.Fatal(err)
+	}
+	if r.Queries[0].Downsample != "2d-avg" {
+		t.Errorf("got %s", r.Queries[0].Downsample)
+	}
+}
+
+func TestParseAbsTimeIn(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tm, err := ParseAbsTimeIn("2023/01/30-18:00:00", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tm.Unix() != 1675119600 {
+		t.Errorf("got %d", tm.Unix())
+	}
+
+	r, err := RequestFromJSON([]byte(`{"start":"2023/01/30-18:00:00","timezone":"America/New_York","queries":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Start != int64(1675119600) {
+		t.Errorf("got start %v", r.Start)
+	}
+
+	r, err = ParseRequest("start=2023/01/30-18:00:00&end=2023/01/30-20:00:00&tz=America/New_York&m=sum:m", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, end, err := r.timeRange(time.Now())
+	if err != nil || start.Unix() != 1675119600 || end.Sub(start) != 2*time.Hour {
+		t.Errorf("got %v %v %v", start, end, err)
+	}
+	if enc := r.String(); enc != "end=2023/01/30-20:00:00&m=sum:m&start=2023/01/30-18:00:00&tz=America/New_York" {
+		t.Errorf("got %s", enc)
+	}
+}
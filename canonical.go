@@ -0,0 +1,109 @@
+package opentsdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CanonicalKey returns a stable hash identifying r. Relative start and end
+// times are resolved to absolute epochs, and queries, tags and filters are
+// sorted, so equivalent requests share a key regardless of how they were
+// written. Grafana specific fields and query indexes are ignored.
+func (r *Request) CanonicalKey() (string, error) {
+	return r.CanonicalKeyAt(time.Now().UTC())
+}
+
+// CanonicalKeyAt is like CanonicalKey but resolves relative times against now.
+func (r *Request) CanonicalKeyAt(now time.Time) (string, error) {
+	s, err := r.canonicalString(now)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (r *Request) canonicalString(now time.Time) (string, error) {
+	start, end, err := r.timeRange(now)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("start=%d&end=%d", start.Unix(), end.Unix()) + r.canonicalParams(), nil
+}
+
+// canonicalParams returns the canonical form of the parameters of r other
+// than its time range.
+func (r *Request) canonicalParams() string {
+	queries := make([]string, len(r.Queries))
+	for i, q := range r.Queries {
+		queries[i] = q.canonicalString()
+	}
+	sort.Strings(queries)
+
+	b := &strings.Builder{}
+	for _, f := range []struct {
+		name string
+		v    bool
+	}{
+		{"noAnnotations", r.NoAnnotations},
+		{"globalAnnotations", r.GlobalAnnotations},
+		{"msResolution", r.MsResolution},
+		{"showTSUIDs", r.ShowTSUIDs},
+		{"showSummary", r.ShowSummary},
+		{"showStats", r.ShowStats},
+		{"showQuery", r.ShowQuery},
+		{"delete", r.Delete},
+		{"useCalendar", r.UseCalendar},
+	} {
+		if f.v {
+			fmt.Fprintf(b, "&%s", f.name)
+		}
+	}
+	if r.Timezone != "" {
+		fmt.Fprintf(b, "&timezone=%s", r.Timezone)
+	}
+	for _, q := range queries {
+		fmt.Fprintf(b, "&m=%s", q)
+	}
+	return b.String()
+}
+
+func (q *Query) canonicalString() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s:%s:", q.Aggregator, q.Downsample)
+	if q.Rate {
+		b.WriteString("rate")
+		if o := q.RateOptions; o != nil {
+			fmt.Fprintf(b, "{%t,%d,%d,%t}", o.Counter, o.CounterMax, o.ResetValue, o.DropResets)
+		}
+	}
+	fmt.Fprintf(b, ":%s", q.Metric)
+	if len(q.Tags) > 0 {
+		b.WriteString(q.Tags.String())
+	}
+	filters := make([]string, len(q.Filters))
+	for i, f := range q.Filters {
+		filters[i] = fmt.Sprintf("%s:%t", f, f.GroupBy)
+	}
+	sort.Strings(filters)
+	fmt.Fprintf(b, "[%s]", strings.Join(filters, ","))
+	if q.ExplicitTags {
+		b.WriteString("explicit")
+	}
+	if len(q.TSUIDs) > 0 {
+		tsuids := append([]string(nil), q.TSUIDs...)
+		sort.Strings(tsuids)
+		fmt.Fprintf(b, "tsuids=%s", strings.Join(tsuids, ","))
+	}
+	if len(q.Percentiles) > 0 {
+		fmt.Fprintf(b, "percentiles=%v", q.Percentiles)
+	}
+	if q.ShowHistogramBuckets {
+		b.WriteString("buckets")
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package opentsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanonicalKey(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	key := func(q string) string {
+		r, err := ParseRequest(q, Version2_2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := r.CanonicalKeyAt(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	same := [][2]string{
+		{"start=1h-ago&m=sum:a{x=1,y=2}", "start=1699996400&end=1700000000&m=sum:a{y=2,x=1}"},
+		{"start=1h-ago&m=sum:a&m=avg:b", "start=60m-ago&m=avg:b&m=sum:a"},
+		{"start=1h-ago&m=sum:a{}{x=1,y=wildcard(z*)}", "start=1h-ago&m=sum:a{}{y=wildcard(z*),x=1}"},
+	}
+	for _, p := range same {
+		if key(p[0]) != key(p[1]) {
+			t.Errorf("expected same key for %s and %s", p[0], p[1])
+		}
+	}
+
+	different := [][2]string{
+		{"start=1h-ago&m=sum:a", "start=2h-ago&m=sum:a"},
+		{"start=1h-ago&m=sum:a{x=1}", "start=1h-ago&m=sum:a{}{x=1}"},
+		{"start=1h-ago&m=sum:a", "start=1h-ago&m=sum:rate:a"},
+	}
+	for _, p := range different {
+		if key(p[0]) == key(p[1]) {
+			t.Errorf("expected different keys for %s and %s", p[0], p[1])
+		}
+	}
+}
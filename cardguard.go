@@ -0,0 +1,299 @@
+package opentsdb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CardinalityGuard tracks the distinct values of every tag key of every
+// metric put, and catches points that would take a tag key over its
+// budget, protecting the TSD from accidental UID exhaustion. Values are
+// counted exactly up to the budget; those counted beyond it when points
+// aren't dropped are counted approximately with HyperLogLog sketches.
+// Values already seen always pass. It is safe for concurrent use.
+type CardinalityGuard struct {
+	// Max is the budget of tag keys matched by no Budgets, unlimited if
+	// zero.
+	Max int
+	// Budgets are searched in order for the budget of a metric's tag key.
+	Budgets []CardinalityBudget
+	// Window, if set, makes values count for one to two windows after
+	// they were last seen rather than forever. Tag keys of a metric not
+	// put for two windows are forgotten.
+	Window time.Duration
+	// MaxKeys is the most tag keys of metrics tracked, 4096 if zero.
+	// Once reached, points needing a new one are over budget, which stops
+	// a flood of new metric names too.
+	MaxKeys int
+	// Precision is the log2 of the registers of each sketch, from 4 to
+	// 16, 12 if zero. Each tracked tag key of a metric uses up to twice
+	// 2^Precision bytes besides the hashes of up to its budget of values,
+	// and estimates beyond the budget are off by about 1.04/√2^Precision.
+	Precision uint8
+	// Drop drops the points over budget instead of only reporting them.
+	Drop bool
+	// Report, if set, is called for every tag over budget. Calls may be
+	// concurrent.
+	Report func(CardinalityViolation)
+
+	mu        sync.Mutex
+	sketches  map[cardinalityKey]*windowSketch
+	lastSweep time.Time
+	exceeded  int64
+	now       func() time.Time
+}
+
+// CardinalityBudget is the most distinct values of tag keys matching TagK
+// of metrics matching Metric. Empty patterns match everything, and
+// patterns may use '*' wildcards. A zero Max is unlimited.
+type CardinalityBudget struct {
+	Metric string
+	TagK   string
+	Max    int
+}
+
+// CardinalityViolation describes a tag that took its key over budget. When
+// the tag key of the metric couldn't be tracked because MaxKeys are
+// already, Max is MaxKeys and Estimate the keys tracked.
+type CardinalityViolation struct {
+	Metric   string
+	TagK     string
+	TagV     string
+	Estimate uint64 // distinct values with TagV
+	Max      int
+}
+
+type cardinalityKey struct {
+	metric, tagk string
+}
+
+// windowSketch counts the values of the current window and the one before.
+// The hashes of values are also kept exactly, up to the budget of the tag
+// key; the sketches only count those beyond it.
+type windowSketch struct {
+	cur, prev         *HyperLogLog
+	curSet, prevSet   map[uint64]struct{}
+	prevOnly          int  // values of prevSet not in curSet
+	curOver, prevOver bool // whether a window has values missing from its set
+	since             time.Time
+	used              time.Time
+}
+
+// Apply returns the points of dps within budget, or all of them unless
+// Drop is set, reporting the others.
+func (g *CardinalityGuard) Apply(dps MultiDataPoint) MultiDataPoint {
+	out := make(MultiDataPoint, 0, len(dps))
+	for _, d := range dps {
+		if g.Check(d) || !g.Drop {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Check reports whether d is within budget, counting its tag values if it
+// is or if points aren't dropped.
+func (g *CardinalityGuard) Check(d *DataPoint) bool {
+	violations := g.check(d)
+	if len(violations) == 0 {
+		return true
+	}
+	atomic.AddInt64(&g.exceeded, 1)
+	if g.Report != nil {
+		for _, v := range violations {
+			g.Report(v)
+		}
+	}
+	return false
+}
+
+// check is Check without the reporting, which happens unlocked so that
+// Report may use g.
+func (g *CardinalityGuard) check(d *DataPoint) []CardinalityViolation {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.sketches == nil {
+		g.sketches = map[cardinalityKey]*windowSketch{}
+	}
+	now := g.clock()
+	g.sweep(now)
+	var pending []*windowSketch
+	var hashes []uint64
+	var maxes []int
+	var violations []CardinalityViolation
+	for k, v := range d.Tags {
+		max := g.budget(d.Metric, k)
+		if max <= 0 {
+			continue
+		}
+		s := g.sketch(cardinalityKey{d.Metric, k}, now)
+		if s == nil {
+			violations = append(violations, CardinalityViolation{Metric: d.Metric, TagK: k, TagV: v, Estimate: uint64(len(g.sketches)), Max: g.maxKeys()})
+			continue
+		}
+		x := hashString(v)
+		pending, hashes, maxes = append(pending, s), append(hashes, x), append(maxes, max)
+		if s.seen(x) {
+			continue
+		}
+		if n := s.countWith(x); n > uint64(max) {
+			violations = append(violations, CardinalityViolation{Metric: d.Metric, TagK: k, TagV: v, Estimate: n, Max: max})
+		}
+	}
+	if len(violations) == 0 || !g.Drop {
+		for i, s := range pending {
+			s.add(hashes[i], maxes[i])
+		}
+	}
+	return violations
+}
+
+// Exceeded returns the number of points found over budget.
+func (g *CardinalityGuard) Exceeded() int64 {
+	return atomic.LoadInt64(&g.exceeded)
+}
+
+// Estimate returns the estimated distinct values of tagk of metric.
+func (g *CardinalityGuard) Estimate(metric, tagk string) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.sketches[cardinalityKey{metric, tagk}]
+	if !ok {
+		return 0
+	}
+	s.rotate(g.clock(), g.Window)
+	return s.count()
+}
+
+func (g *CardinalityGuard) clock() time.Time {
+	if g.now != nil {
+		return g.now()
+	}
+	return time.Now()
+}
+
+func (g *CardinalityGuard) budget(metric, tagk string) int {
+	for _, b := range g.Budgets {
+		if (b.Metric == "" || matchWildcard(b.Metric, metric)) && (b.TagK == "" || matchWildcard(b.TagK, tagk)) {
+			return b.Max
+		}
+	}
+	return g.Max
+}
+
+func (g *CardinalityGuard) maxKeys() int {
+	if g.MaxKeys > 0 {
+		return g.MaxKeys
+	}
+	return 4096
+}
+
+// sketch returns the sketch of key, or nil if it is new and MaxKeys are
+// tracked already.
+func (g *CardinalityGuard) sketch(key cardinalityKey, now time.Time) *windowSketch {
+	s, ok := g.sketches[key]
+	if !ok {
+		if len(g.sketches) >= g.maxKeys() {
+			return nil
+		}
+		p := g.Precision
+		if p == 0 {
+			p = 12
+		}
+		s = &windowSketch{cur: NewHyperLogLog(p), prev: NewHyperLogLog(p), since: now,
+			curSet: map[uint64]struct{}{}, prevSet: map[uint64]struct{}{}}
+		g.sketches[key] = s
+	}
+	s.rotate(now, g.Window)
+	s.used = now
+	return s
+}
+
+// sweep forgets the keys not used for two windows, at most once a window.
+func (g *CardinalityGuard) sweep(now time.Time) {
+	if g.Window <= 0 || now.Sub(g.lastSweep) < g.Window {
+		return
+	}
+	g.lastSweep = now
+	for key, s := range g.sketches {
+		if now.Sub(s.used) >= 2*g.Window {
+			delete(g.sketches, key)
+		}
+	}
+}
+
+// rotate starts a new window if the current one is over.
+func (s *windowSketch) rotate(now time.Time, window time.Duration) {
+	if window <= 0 || now.Sub(s.since) < window {
+		return
+	}
+	if now.Sub(s.since) >= 2*window {
+		s.prev, s.prevSet, s.prevOver = NewHyperLogLog(s.cur.p), map[uint64]struct{}{}, false
+	} else {
+		s.prev, s.prevSet, s.prevOver = s.cur, s.curSet, s.curOver
+	}
+	s.cur, s.curSet, s.curOver, s.since = NewHyperLogLog(s.cur.p), map[uint64]struct{}{}, false, now
+	s.prevOnly = len(s.prevSet)
+}
+
+// seen reports whether the value hashed to x was counted exactly in either
+// window. Values beyond the budget are never seen, so that they are
+// checked against the estimate again.
+func (s *windowSketch) seen(x uint64) bool {
+	if _, ok := s.curSet[x]; ok {
+		return true
+	}
+	_, ok := s.prevSet[x]
+	return ok
+}
+
+// exact reports whether every value of both windows is in their sets.
+func (s *windowSketch) exact() bool {
+	return !s.curOver && !s.prevOver
+}
+
+// count returns the distinct values of both windows, exactly while
+// possible.
+func (s *windowSketch) count() uint64 {
+	if s.exact() {
+		return uint64(len(s.curSet) + s.prevOnly)
+	}
+	return s.union().Count()
+}
+
+// countWith returns the distinct values of both windows and the value
+// hashed to x, which is not seen.
+func (s *windowSketch) countWith(x uint64) uint64 {
+	if s.exact() {
+		return uint64(len(s.curSet)+s.prevOnly) + 1
+	}
+	u := s.union()
+	u.add(x)
+	return u.Count()
+}
+
+// add adds the value hashed to x to the current window, keeping it
+// exactly if fewer than max values are.
+func (s *windowSketch) add(x uint64, max int) {
+	s.cur.add(x)
+	if _, ok := s.curSet[x]; ok {
+		return
+	}
+	_, inPrev := s.prevSet[x]
+	switch {
+	case inPrev:
+		s.prevOnly--
+	case len(s.curSet)+s.prevOnly >= max:
+		s.curOver = true
+		return
+	}
+	s.curSet[x] = struct{}{}
+}
+
+// union returns a sketch of the values of both windows.
+func (s *windowSketch) union() *HyperLogLog {
+	u := s.cur.Clone()
+	u.merge(s.prev)
+	return u
+}
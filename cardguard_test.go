@@ -0,0 +1,119 @@
+package opentsdb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCardinalityGuard(t *testing.T) {
+	now := time.Unix(0, 0)
+	var reports []CardinalityViolation
+	g := &CardinalityGuard{
+		Max:     100,
+		Budgets: []CardinalityBudget{{Metric: "app.*", TagK: "env", Max: 2}, {TagK: "path"}},
+		Window:  time.Hour,
+		Drop:    true,
+		Report:  func(v CardinalityViolation) { reports = append(reports, v) },
+		now:     func() time.Time { return now },
+	}
+	point := func(metric, k, v string) *DataPoint {
+		return &DataPoint{Metric: metric, Timestamp: 1, Value: 1, Tags: TagSet{k: v}}
+	}
+
+	var dps MultiDataPoint
+	for i := 0; i < 150; i++ {
+		dps = append(dps, point("os.cpu", "host", "h"+strconv.Itoa(i)))
+	}
+	kept := g.Apply(dps)
+	if len(kept) < 95 || len(kept) > 105 {
+		t.Errorf("kept %d points, want about 100", len(kept))
+	}
+	if int(g.Exceeded()) != 150-len(kept) || len(reports) != 150-len(kept) || reports[0].TagK != "host" {
+		t.Errorf("exceeded %d, reports %d", g.Exceeded(), len(reports))
+	}
+	if n := g.Estimate("os.cpu", "host"); n < 95 || n > 105 {
+		t.Errorf("estimate %d, want about 100", n)
+	}
+	if !g.Check(point("os.cpu", "host", "h0")) {
+		t.Error("value already seen dropped")
+	}
+
+	for i, want := range []bool{true, true, false, true} {
+		if got := g.Check(point("app.req", "env", []string{"a", "b", "c", "a"}[i])); got != want {
+			t.Errorf("env %d: got %v, want %v", i, got, want)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		if !g.Check(point("app.req", "path", "/"+strconv.Itoa(i))) {
+			t.Fatal("unlimited tag key dropped")
+		}
+	}
+
+	now = now.Add(2 * time.Hour)
+	if !g.Check(point("app.req", "env", "c")) || g.Estimate("app.req", "env") != 1 {
+		t.Error("values not forgotten after the window")
+	}
+}
+
+func TestPutPolicyCardinality(t *testing.T) {
+	p := &PutPolicy{Cardinality: &CardinalityGuard{Max: 1, Drop: true}}
+	dps := MultiDataPoint{
+		{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"host": "a"}},
+		{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"host": "b"}},
+		{Metric: "m", Timestamp: 2, Value: 1, Tags: TagSet{"host": "a"}},
+	}
+	if out := p.Apply(dps); len(out) != 2 || out[1].Timestamp != 2 || p.Stats().Dropped != 1 {
+		t.Errorf("got %v, stats %+v", out, p.Stats())
+	}
+}
+
+func TestCardinalityGuardKeys(t *testing.T) {
+	now := time.Unix(0, 0)
+	var estimates []uint64
+	g := &CardinalityGuard{Max: 1, MaxKeys: 3, Window: time.Minute, Drop: true, now: func() time.Time { return now }}
+	g.Report = func(v CardinalityViolation) {
+		estimates = append(estimates, g.Estimate(v.Metric, v.TagK))
+	}
+	point := func(metric, v string) *DataPoint {
+		return &DataPoint{Metric: metric, Timestamp: 1, Value: 1, Tags: TagSet{"host": v}}
+	}
+	g.Check(point("m0", "a"))
+	if g.Check(point("m0", "b")) || len(estimates) != 1 || estimates[0] != 1 {
+		t.Errorf("over budget: got estimates %v", estimates)
+	}
+	g.Check(point("m1", "a"))
+	g.Check(point("m2", "a"))
+	if g.Check(point("m3", "a")) || len(g.sketches) != 3 {
+		t.Errorf("tracked %d keys, want at most 3", len(g.sketches))
+	}
+
+	now = now.Add(time.Minute)
+	g.Check(point("m0", "a"))
+	now = now.Add(90 * time.Second)
+	if !g.Check(point("m3", "a")) {
+		t.Error("idle keys not forgotten")
+	}
+	if len(g.sketches) != 2 {
+		t.Errorf("tracked %d keys, want m0 and m3", len(g.sketches))
+	}
+}
+
+func TestCardinalityGuardLargeBudget(t *testing.T) {
+	// budgets beyond the 4096 registers of the sketches are still exact
+	for _, max := range []int{1000, 5000} {
+		g := &CardinalityGuard{Max: max, Drop: true}
+		kept := 0
+		for i := 0; i < 4*max; i++ {
+			if g.Check(&DataPoint{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"id": strconv.Itoa(i)}}) {
+				kept++
+			}
+		}
+		if kept != max || g.Estimate("m", "id") != uint64(max) {
+			t.Errorf("max %d: kept %d, estimate %d", max, kept, g.Estimate("m", "id"))
+		}
+		if !g.Check(&DataPoint{Metric: "m", Timestamp: 2, Value: 1, Tags: TagSet{"id": "0"}}) {
+			t.Errorf("max %d: value already seen dropped", max)
+		}
+	}
+}
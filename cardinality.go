@@ -0,0 +1,131 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+)
+
+// CardinalityReport describes the series of the metrics matching a
+// pattern, to find the metrics and tags responsible for high cardinality.
+type CardinalityReport struct {
+	Series int
+	// Metrics are sorted by decreasing number of series.
+	Metrics []MetricCardinality
+}
+
+// MetricCardinality describes the series of a metric.
+type MetricCardinality struct {
+	Metric string
+	Series int
+	// Tags are sorted by decreasing number of values.
+	Tags []TagCardinality
+}
+
+// TagCardinality describes the values of a tag key among the series of a
+// metric.
+type TagCardinality struct {
+	Key    string
+	Values int
+	// Top are the values in the most series, most first.
+	Top []ValueCount
+}
+
+// ValueCount is the number of series having a tag value.
+type ValueCount struct {
+	Value  string
+	Series int
+}
+
+// lookupPage is the page size of the lookups of CardinalityReport.
+const lookupPage = 10000
+
+// CardinalityReport counts the series of the metrics matching pattern, in
+// which * matches any run of characters, and the values of their tag keys,
+// listing the topN values in most series for each, or all of them if topN
+// is not positive. Metrics are expanded
+// with /api/suggest and their series listed with /api/search/lookup, one
+// page at a time.
+func (c *Client) CardinalityReport(ctx context.Context, pattern string, topN int) (*CardinalityReport, error) {
+	metrics, err := c.ExpandMetrics(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	report := &CardinalityReport{}
+	for _, m := range metrics {
+		mc := MetricCardinality{Metric: m}
+		values := map[string]map[string]int{}
+		err := c.lookupAll(ctx, &LookupQuery{Metric: m, Limit: lookupPage}, func(res LookupResult) {
+			mc.Series++
+			for k, v := range res.Tags {
+				if values[k] == nil {
+					values[k] = map[string]int{}
+				}
+				values[k][v]++
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		for k, counts := range values {
+			mc.Tags = append(mc.Tags, tagCardinality(k, counts, topN))
+		}
+		sort.Slice(mc.Tags, func(i, j int) bool {
+			a, b := mc.Tags[i], mc.Tags[j]
+			return a.Values > b.Values || a.Values == b.Values && a.Key < b.Key
+		})
+		report.Series += mc.Series
+		report.Metrics = append(report.Metrics, mc)
+	}
+	sort.SliceStable(report.Metrics, func(i, j int) bool {
+		return report.Metrics[i].Series > report.Metrics[j].Series
+	})
+	return report, nil
+}
+
+func tagCardinality(key string, counts map[string]int, topN int) TagCardinality {
+	tc := TagCardinality{Key: key, Values: len(counts)}
+	for v, n := range counts {
+		tc.Top = append(tc.Top, ValueCount{v, n})
+	}
+	sort.Slice(tc.Top, func(i, j int) bool {
+		a, b := tc.Top[i], tc.Top[j]
+		return a.Series > b.Series || a.Series == b.Series && a.Value < b.Value
+	})
+	if topN > 0 && len(tc.Top) > topN {
+		tc.Top = tc.Top[:topN]
+	}
+	return tc
+}
+
+// lookupAll calls f with every result of lq, paging through them.
+func (c *Client) lookupAll(ctx context.Context, lq *LookupQuery, f func(LookupResult)) error {
+	q := *lq
+	for {
+		b, err := json.Marshal(&q)
+		if err != nil {
+			return err
+		}
+		resp, err := c.send(ctx, "/api/search/lookup", nil, b, c.queryTimeout(nil), nil)
+		if err != nil {
+			return err
+		}
+		var lr LookupResponse
+		if resp.StatusCode/100 != 2 {
+			err = responseError(resp, b)
+		} else {
+			err = decodeError(json.NewDecoder(resp.Body).Decode(&lr))
+		}
+		closeBody(resp.Body)
+		if err != nil {
+			return err
+		}
+		for _, res := range lr.Results {
+			f(res)
+		}
+		q.StartIndex += len(lr.Results)
+		if len(lr.Results) == 0 || q.StartIndex >= lr.TotalResults {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCardinalityReport(t *testing.T) {
+	series := map[string][]TagSet{}
+	for i := 0; i < 5; i++ {
+		series["app.cpu"] = append(series["app.cpu"], TagSet{"host": fmt.Sprint("h", i), "dc": "east"})
+	}
+	series["app.cpu"] = append(series["app.cpu"], TagSet{"host": "h9", "dc": "west"})
+	series["app.mem"] = []TagSet{{"host": "h0"}}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/suggest":
+			json.NewEncoder(w).Encode([]string{"app.cpu", "app.mem", "other"})
+		case "/api/search/lookup":
+			var lq LookupQuery
+			json.NewDecoder(req.Body).Decode(&lq)
+			all := series[lq.Metric]
+			lr := LookupResponse{Metric: lq.Metric, TotalResults: len(all)}
+			for i := lq.StartIndex; i < len(all) && i < lq.StartIndex+2; i++ {
+				lr.Results = append(lr.Results, LookupResult{Metric: lq.Metric, Tags: all[i]})
+			}
+			json.NewEncoder(w).Encode(lr)
+		}
+	}))
+	defer ts.Close()
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := c.CardinalityReport(context.Background(), "app.*", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Series != 7 || len(report.Metrics) != 2 {
+		t.Fatalf("got %+v", report)
+	}
+	cpu := report.Metrics[0]
+	if cpu.Metric != "app.cpu" || cpu.Series != 6 || len(cpu.Tags) != 2 {
+		t.Fatalf("got %+v", cpu)
+	}
+	if host := cpu.Tags[0]; host.Key != "host" || host.Values != 6 || len(host.Top) != 1 {
+		t.Errorf("host: %+v", host)
+	}
+	if dc := cpu.Tags[1]; dc.Key != "dc" || dc.Values != 2 || dc.Top[0] != (ValueCount{"east", 5}) {
+		t.Errorf("dc: %+v", dc)
+	}
+
+	for _, n := range []int{0, -1} {
+		if tc := tagCardinality("dc", map[string]int{"east": 5, "west": 1}, n); len(tc.Top) != 2 {
+			t.Errorf("topN %d: got %+v", n, tc.Top)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package opentsdb
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/the-cloud-source/opentsdb/name"
+)
+
+// cleaner cleans datapoints with a single name processor, which is safe
+// for concurrent use.
+type cleaner struct {
+	np name.RuneLevelProcessor
+}
+
+func newCleaner() (cleaner, error) {
+	np, err := NewOpenTsdbNameProcessor("")
+	if err != nil {
+		return cleaner{}, fmt.Errorf("Failed to create name processor: %w", err)
+	}
+	return cleaner{np}, nil
+}
+
+// name is Clean with the cleaner's processor.
+func (c cleaner) name(s string) (string, error) {
+	result, err := c.np.FormatName(s)
+	if err != nil {
+		return "", fmt.Errorf("Failed to format string: %w", err)
+	}
+	return result, nil
+}
+
+// tags is TagSet.Clean with the cleaner's processor.
+func (c cleaner) tags(t TagSet) error {
+	for k, v := range t {
+		kc, err := c.name(k)
+		if err != nil {
+			return fmt.Errorf("cleaning tag %s: %s", k, err)
+		}
+		vc, err := c.name(v)
+		if err != nil {
+			return fmt.Errorf("cleaning value %s for tag %s: %s", v, k, err)
+		}
+		if kc == "" || vc == "" {
+			return fmt.Errorf("cleaning value [%s] for tag [%s] result in an empty string", v, k)
+		}
+		if kc != k || vc != v {
+			delete(t, k)
+			t[kc] = vc
+		}
+	}
+	return nil
+}
+
+// dataPoint is DataPoint.Clean with the cleaner's processor.
+func (c cleaner) dataPoint(d *DataPoint) error {
+	if err := c.tags(d.Tags); err != nil {
+		return fmt.Errorf("cleaning tags for metric %s: %s", d.Metric, err)
+	}
+	m, err := c.name(d.Metric)
+	if err != nil {
+		return fmt.Errorf("cleaning metric %s: %s", d.Metric, err)
+	}
+	if d.Metric != m {
+		d.Metric = m
+	}
+	switch v := d.Value.(type) {
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			d.Value = i
+		} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+			d.Value = f
+		} else {
+			return fmt.Errorf("Unparseable number %v", v)
+		}
+	case uint64:
+		if v > math.MaxInt64 {
+			d.Value = float64(v)
+		}
+	case *big.Int:
+		if bigMaxInt64.Cmp(v) < 0 {
+			if f, err := strconv.ParseFloat(v.String(), 64); err == nil {
+				d.Value = f
+			}
+		}
+	}
+	// if timestamp bigger than 32 bits, likely in milliseconds
+	if d.Timestamp > 0xffffffff {
+		d.Timestamp /= 1000
+	}
+	if !c.valid(d) {
+		return fmt.Errorf("datapoint is invalid")
+	}
+	return nil
+}
+
+// valid is DataPoint.Valid for a cleaned datapoint, whose tags can be
+// checked directly rather than parsed.
+func (c cleaner) valid(d *DataPoint) bool {
+	if d.Metric == "" || !c.np.IsValid(d.Metric) || d.Timestamp == 0 || d.Value == nil {
+		return false
+	}
+	for k, v := range d.Tags {
+		if !c.np.IsValid(k) || !c.np.IsValid(v) {
+			return false
+		}
+	}
+	f, err := strconv.ParseFloat(fmt.Sprint(d.Value), 64)
+	return err == nil && !math.IsNaN(f)
+}
+
+// RejectedPoint is a datapoint CleanBatch rejected. DataPoint is a copy of
+// the datapoint as given, before any cleaning, and Index its position in
+// the batch.
+type RejectedPoint struct {
+	DataPoint *DataPoint
+	Index     int
+	Err       error
+}
+
+// cleanChunk is the number of datapoints a CleanBatch worker takes at once.
+const cleanChunk = 1024
+
+// CleanBatch cleans dps like DataPoint.Clean, in place, with workers
+// goroutines sharing one name processor, GOMAXPROCS of them if workers is
+// not positive. Each point gets a cleaned copy of its tags, so points may
+// share a TagSet, which is left untouched. It returns the datapoints cleaned, in order, and those
+// that failed.
+func CleanBatch(dps MultiDataPoint, workers int) (ok MultiDataPoint, rejected []RejectedPoint) {
+	c, err := newCleaner()
+	if err != nil {
+		for i, d := range dps {
+			rejected = append(rejected, RejectedPoint{DataPoint: d, Index: i, Err: err})
+		}
+		return nil, rejected
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if n := (len(dps) + cleanChunk - 1) / cleanChunk; workers > n {
+		workers = n
+	}
+
+	errs := make([]error, len(dps))
+	origs := make([]*DataPoint, len(dps))
+	clean := func(i int) {
+		d := dps[i]
+		orig := *d
+		// points often share a TagSet, which must not be cleaned
+		// concurrently
+		d.Tags = d.Tags.Copy()
+		if errs[i] = c.dataPoint(d); errs[i] != nil {
+			orig.Tags = orig.Tags.Copy()
+			origs[i] = &orig
+		}
+	}
+	if workers <= 1 {
+		for i := range dps {
+			clean(i)
+		}
+	} else {
+		var next int64
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					start := int(atomic.AddInt64(&next, cleanChunk)) - cleanChunk
+					if start >= len(dps) {
+						return
+					}
+					end := start + cleanChunk
+					if end > len(dps) {
+						end = len(dps)
+					}
+					for i := start; i < end; i++ {
+						clean(i)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	ok = make(MultiDataPoint, 0, len(dps))
+	for i, d := range dps {
+		if errs[i] != nil {
+			rejected = append(rejected, RejectedPoint{DataPoint: origs[i], Index: i, Err: errs[i]})
+			continue
+		}
+		ok = append(ok, d)
+	}
+	return ok, rejected
+}
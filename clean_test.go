@@ -0,0 +1,56 @@
+package opentsdb
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCleanBatch(t *testing.T) {
+	var dps, want MultiDataPoint
+	var bad []int
+	for i := 0; i < 3000; i++ {
+		d := &DataPoint{Metric: "cpu use", Timestamp: 1500000000000, Value: strconv.Itoa(i), Tags: TagSet{"host": "web " + strconv.Itoa(i%7)}}
+		if i%500 == 0 {
+			d.Tags["bad"] = "!!"
+			bad = append(bad, i)
+		}
+		dps = append(dps, d)
+		c := *d
+		c.Tags = d.Tags.Copy()
+		if c.Clean() == nil {
+			want = append(want, &c)
+		}
+	}
+	for _, workers := range []int{1, 4} {
+		in := make(MultiDataPoint, len(dps))
+		for i, d := range dps {
+			c := *d
+			c.Tags = d.Tags.Copy()
+			in[i] = &c
+		}
+		ok, rejected := CleanBatch(in, workers)
+		if !reflect.DeepEqual(ok, want) {
+			t.Errorf("%d workers: cleaned points differ", workers)
+		}
+		if len(rejected) != len(bad) {
+			t.Fatalf("%d workers: %d rejected, want %d", workers, len(rejected), len(bad))
+		}
+		for i, r := range rejected {
+			if r.Index != bad[i] || r.Err == nil || !reflect.DeepEqual(r.DataPoint, dps[r.Index]) {
+				t.Errorf("%d workers: got reject %+v", workers, r)
+			}
+		}
+	}
+	shared := TagSet{"host": "web 1", "dc": "l g a"}
+	var same MultiDataPoint
+	for i := 0; i < 5000; i++ {
+		same = append(same, &DataPoint{Metric: "m", Timestamp: Epoch(i + 1), Value: i, Tags: shared})
+	}
+	if ok, rejected := CleanBatch(same, 8); len(ok) != len(same) || rejected != nil || ok[0].Tags["dc"] != "lga" || shared["dc"] != "l g a" {
+		t.Errorf("shared tags: got %d points, %v, %v, %v", len(ok), rejected, ok[0].Tags, shared)
+	}
+	if ok, rejected := CleanBatch(nil, 0); len(ok) != 0 || rejected != nil {
+		t.Errorf("empty batch: got %v, %v", ok, rejected)
+	}
+}
@@ -0,0 +1,369 @@
+package opentsdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client is a Context bound to a single OpenTSDB host. Unlike the package
+// level functions it owns its http.Client and timeouts, so several clients
+// with different settings can be used side by side.
+type Client struct {
+	Host        string
+	TSDBVersion Version
+	// HTTPClient is used for all requests made by the client.
+	HTTPClient *http.Client
+	// Timeout bounds every request. QueryTimeout and PutTimeout take
+	// precedence for their endpoint when non-zero, and Request.Timeout
+	// takes precedence over both.
+	Timeout      time.Duration
+	QueryTimeout time.Duration
+	PutTimeout   time.Duration
+	// PutPolicy, if set, filters the datapoints passed to Put.
+	PutPolicy *PutPolicy
+	// Rejects, if set, receives the datapoints dropped from puts because
+	// they fail Clean.
+	Rejects RejectHandler
+	// Dialect, if set, adapts requests to an OpenTSDB compatible backend.
+	Dialect *Dialect
+	// UserAgent, if set, overrides the package User-Agent for requests
+	// made by the client. A User-Agent in the headers given to
+	// QueryWithHeaders takes precedence over both.
+	UserAgent string
+	// Signer, if set, signs every request made by the client.
+	Signer RequestSigner
+	// Redirects is how redirect responses are handled.
+	Redirects RedirectPolicy
+	// QueryMethod is the HTTP method of queries, POST unless set to GET,
+	// which sends them in the m query string form of Request.Encode for
+	// backends and proxies that only accept it.
+	QueryMethod string
+
+	// transport is configured by the transport options and used when no
+	// HTTPClient is given.
+	transport *http.Transport
+}
+
+// ClientOption configures a Client in NewClient.
+type ClientOption func(*Client) error
+
+// NewClient returns a client for host configured by opts.
+func NewClient(host string, opts ...ClientOption) (*Client, error) {
+	c := &Client{
+		Host:        host,
+		TSDBVersion: Version2_4,
+		Timeout:     DefaultTimeout,
+		transport:   newTransport(),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Transport: c.transport}
+	}
+	return c, nil
+}
+
+// WithHTTPClient makes the client use hc for all requests. Options that
+// configure the transport, such as the TLS options, have no effect on hc.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) error {
+		c.HTTPClient = hc
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent of requests made by the client.
+func WithUserAgent(ua string) ClientOption {
+	return func(c *Client) error {
+		c.UserAgent = ua
+		return nil
+	}
+}
+
+// WithQueryMethod sets the HTTP method of queries, http.MethodPost or
+// http.MethodGet.
+func WithQueryMethod(method string) ClientOption {
+	return func(c *Client) error {
+		switch method {
+		case http.MethodGet, http.MethodPost:
+		default:
+			return fmt.Errorf("opentsdb: unsupported query method %q", method)
+		}
+		c.QueryMethod = method
+		return nil
+	}
+}
+
+// WithVersion sets the OpenTSDB version reported by the client.
+func WithVersion(v Version) ClientOption {
+	return func(c *Client) error {
+		c.TSDBVersion = v
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of every request made by the client.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.Timeout = d
+		return nil
+	}
+}
+
+// WithQueryTimeout sets the timeout of /api/query requests.
+func WithQueryTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.QueryTimeout = d
+		return nil
+	}
+}
+
+// WithPutTimeout sets the timeout of /api/put requests.
+func WithPutTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.PutTimeout = d
+		return nil
+	}
+}
+
+func (c *Client) userAgent() string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+	return GetUserAgent()
+}
+
+func (c *Client) Version() Version {
+	return c.TSDBVersion
+}
+
+func (c *Client) queryTimeout(r *Request) time.Duration {
+	if r != nil && r.Timeout > 0 {
+		return r.Timeout
+	}
+	if c.QueryTimeout > 0 {
+		return c.QueryTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Client) putTimeout() time.Duration {
+	if c.PutTimeout > 0 {
+		return c.PutTimeout
+	}
+	return c.Timeout
+}
+
+// Query performs the request against the client's host.
+func (c *Client) Query(r *Request) (ResponseSet, error) {
+	return c.QueryWithHeaders(r, nil)
+}
+
+// QueryWithHeaders performs the request adding headers to the HTTP request.
+func (c *Client) QueryWithHeaders(r *Request, headers http.Header) (ResponseSet, error) {
+	rs, _, err := c.QueryWithReport(r, headers)
+	return rs, err
+}
+
+// QueryWithReport performs the request like QueryWithHeaders and also
+// returns the client side timing of the query. On error the report covers
+// the stages completed so far.
+func (c *Client) QueryWithReport(r *Request, headers http.Header) (ResponseSet, *QueryReport, error) {
+	rep := &QueryReport{}
+	start := time.Now()
+	defer func() { rep.Total = time.Since(start) }()
+	if r.ExpandMetrics {
+		var err error
+		if r, err = c.expandMetrics(r.Context(), r); err != nil {
+			return nil, rep, err
+		}
+	}
+	if c.Dialect != nil || c.QueryMethod == http.MethodGet {
+		rep.Build = time.Since(start)
+		rs, err := c.dialectQuery(r, headers, rep)
+		return rs, rep, err
+	}
+	if c.UserAgent != "" && headers.Get("User-Agent") == "" {
+		headers = headers.Clone()
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Set("User-Agent", c.UserAgent)
+	}
+	b, err := json.Marshal(r)
+	rep.Build = time.Since(start)
+	if err != nil {
+		return nil, rep, err
+	}
+	sent := time.Now()
+	resp, err := postQuery(r.Context(), c.Host, b, nil, c.sender(c.queryTimeout(r)), headers)
+	rep.Network = time.Since(sent)
+	if err != nil {
+		return nil, rep, err
+	}
+	defer closeBody(resp.Body)
+	rs, err := rep.decode(resp.Body, DecodeResponseSet)
+	return rs, rep, err
+}
+
+// dialectQuery performs r as adapted by the client's dialect, if any, with
+// the client's query method, timing it in rep.
+func (c *Client) dialectQuery(r *Request, headers http.Header, rep *QueryReport) (ResponseSet, error) {
+	start := time.Now()
+	r = c.Dialect.request(r)
+	var b []byte
+	var resp *http.Response
+	var sent time.Time
+	var err error
+	if c.QueryMethod == http.MethodGet {
+		q, _ := url.ParseQuery(r.getQuery())
+		// errors show the request as it would be POSTed
+		b, _ = json.Marshal(r)
+		rep.Build += time.Since(start)
+		sent = time.Now()
+		resp, err = c.do(r.Context(), http.MethodGet, "/api/query", q, nil, c.queryTimeout(r), headers)
+	} else {
+		b, err = json.Marshal(r)
+		rep.Build += time.Since(start)
+		if err != nil {
+			return nil, err
+		}
+		sent = time.Now()
+		resp, err = c.send(r.Context(), "/api/query", nil, b, c.queryTimeout(r), headers)
+	}
+	rep.Network = time.Since(sent)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp, b)
+	}
+	return rep.decode(resp.Body, c.Dialect.decode)
+}
+
+// Put sends dps to the /api/put endpoint of the client's host. With
+// Rejects set, datapoints are cleaned first and those that can't be are
+// handed to Rejects instead of being sent; otherwise they are sent as they
+// are.
+func (c *Client) Put(dps MultiDataPoint) error {
+	if c.Rejects != nil {
+		if dps = cleanRejecting(dps, c.Rejects); len(dps) == 0 {
+			return nil
+		}
+	}
+	if c.PutPolicy != nil {
+		if dps = c.PutPolicy.Apply(dps); len(dps) == 0 {
+			return nil
+		}
+	}
+	return c.post("/api/put", dps, nil, c.putTimeout())
+}
+
+// post sends body as JSON to endpoint and decodes the response into out
+// unless out is nil.
+func (c *Client) post(endpoint string, body, out interface{}, timeout time.Duration) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(context.Background(), endpoint, nil, b, timeout, nil)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp, b)
+	}
+	if out != nil {
+		return decodeError(json.NewDecoder(resp.Body).Decode(out))
+	}
+	return nil
+}
+
+// send posts the JSON body b to endpoint, as mapped by the client's
+// dialect, with the query parameters q and the extra headers.
+func (c *Client) send(ctx context.Context, endpoint string, q url.Values, b []byte, timeout time.Duration, headers http.Header) (*http.Response, error) {
+	return c.do(ctx, http.MethodPost, endpoint, q, b, timeout, headers)
+}
+
+// do sends a request like send with method. A nil b sends no body.
+func (c *Client) do(ctx context.Context, method, endpoint string, q url.Values, b []byte, timeout time.Duration, headers http.Header) (*http.Response, error) {
+	path, err := c.Dialect.path(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u := apiURL(c.Host, path)
+	if len(q) > 0 {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += q.Encode()
+	}
+	var body io.Reader
+	if b != nil {
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	for k, a := range headers {
+		for _, v := range a {
+			req.Header.Add(k, v)
+		}
+	}
+	setUserAgent(req, c.userAgent())
+	return c.sender(timeout).do(req, b, readOnly(endpoint))
+}
+
+// sender returns the sender of requests bounded by timeout.
+func (c *Client) sender(timeout time.Duration) sender {
+	return sender{withTimeout(c.HTTPClient, timeout), c.Signer, c.Redirects}
+}
+
+// WithMaxIdleConnsPerHost sets the number of idle connections kept per host.
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(c *Client) error {
+		c.transport.MaxIdleConnsPerHost = n
+		return nil
+	}
+}
+
+// WithMaxConnsPerHost limits the total number of connections per host,
+// zero means no limit.
+func WithMaxConnsPerHost(n int) ClientOption {
+	return func(c *Client) error {
+		c.transport.MaxConnsPerHost = n
+		return nil
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection is kept open.
+func WithIdleConnTimeout(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		c.transport.IdleConnTimeout = d
+		return nil
+	}
+}
+
+// WithForceAttemptHTTP2 makes the transport try HTTP/2 even though it has a
+// custom TLS configuration.
+func WithForceAttemptHTTP2(v bool) ClientOption {
+	return func(c *Client) error {
+		c.transport.ForceAttemptHTTP2 = v
+		return nil
+	}
+}
@@ -0,0 +1,276 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientTimeouts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL, WithQueryTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	if _, err := c.Query(r); err == nil {
+		t.Error("expected query timeout")
+	}
+	r.Timeout = time.Second
+	if _, err := c.Query(r); err != nil {
+		t.Errorf("request timeout should override client: %v", err)
+	}
+	if c.HTTPClient.Timeout != 0 {
+		t.Error("per request timeout leaked into the client")
+	}
+}
+
+func TestClientPut(t *testing.T) {
+	var got MultiDataPoint
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/put" {
+			t.Errorf("unexpected path %s", req.URL.Path)
+		}
+		json.NewDecoder(req.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL, WithPutTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dps := MultiDataPoint{{Metric: "sys.cpu", Timestamp: 1600000000, Value: 1, Tags: TagSet{"host": "a"}}}
+	if err := c.Put(dps); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Metric != "sys.cpu" {
+		t.Errorf("unexpected put body %v", got)
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query(r); err == nil {
+		t.Error("expected certificate verification to fail by default")
+	}
+
+	c, err = NewClient(ts.URL, WithInsecureSkipVerify())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query(r); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := NewClient(ts.URL, WithCACertFile("does-not-exist.pem")); err == nil {
+		t.Error("expected error for missing CA file")
+	}
+}
+
+func TestClientUserAgent(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req.Header.Get("User-Agent")
+		w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	c, _ := NewClient(ts.URL)
+	if _, err := c.Query(r); err != nil || got != DefaultUserAgent() || !strings.HasPrefix(got, "go-opentsdb/") {
+		t.Errorf("got %q %v", got, err)
+	}
+	c, _ = NewClient(ts.URL, WithUserAgent("app/1"))
+	if _, err := c.Query(r); err != nil || got != "app/1" {
+		t.Errorf("got %q %v", got, err)
+	}
+	c.Put(MultiDataPoint{{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"a": "b"}}})
+	if got != "app/1" {
+		t.Errorf("put: got %q", got)
+	}
+	if _, err := c.QueryWithHeaders(r, http.Header{"User-Agent": {"req/2"}}); err != nil || got != "req/2" {
+		t.Errorf("got %q %v", got, err)
+	}
+}
+
+func TestClientConnectionReuse(t *testing.T) {
+	fail := false
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.Copy(io.Discard, req.Body)
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(strings.Repeat("x", 200<<10)))
+			return
+		}
+		w.Write([]byte(`[]` + strings.Repeat(" ", 200<<10)))
+	}))
+	conns := 0
+	ts.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			conns++
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL)
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	for i := 0; i < 5; i++ {
+		if _, err := c.Query(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fail = true
+	for i := 0; i < 3; i++ {
+		if _, err := c.Query(r); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if conns != 1 {
+		t.Errorf("got %d connections", conns)
+	}
+}
+
+func TestClientSigner(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		if got, want := req.Header.Get("X-Signature"), string(b); got != want {
+			t.Errorf("%s: signature %q, want %q", req.URL.Path, got, want)
+		}
+		if req.URL.Path == "/api/query" {
+			w.Write([]byte(`[]`))
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	var signed []string
+	c, err := NewClient(ts.URL, WithSigner(RequestSignerFunc(func(req *http.Request, body []byte) error {
+		signed = append(signed, req.URL.Path)
+		req.Header.Set("X-Signature", string(body))
+		return nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	if _, err := c.Query(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(MultiDataPoint{{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"host": "a"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/api/query", "/api/put"}; strings.Join(signed, " ") != strings.Join(want, " ") {
+		t.Errorf("signed %v, want %v", signed, want)
+	}
+
+	c.Signer = RequestSignerFunc(func(*http.Request, []byte) error { return errTestSign })
+	if _, err := c.Query(r); err != errTestSign {
+		t.Errorf("got %v, want the signer error", err)
+	}
+}
+
+var errTestSign = errors.New("sign failed")
+
+func TestClientGetQueries(t *testing.T) {
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = req
+		w.Write([]byte(`[{"metric":"m","tags":{"host":"a"},"aggregateTags":[],"dps":{"60":1}}]`))
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL, WithQueryMethod(http.MethodGet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Request{Start: "1h-ago", MsResolution: true, ShowQuery: true,
+		Queries: []*Query{{Metric: "m", Aggregator: "sum", Downsample: "1m-avg", Tags: TagSet{"host": "*"}}}}
+	rs, err := c.Query(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].DPS[60] != 1 {
+		t.Errorf("got %v", rs)
+	}
+	q := got.URL.Query()
+	if got.Method != http.MethodGet || got.URL.Path != "/api/query" {
+		t.Errorf("sent %s %s", got.Method, got.URL.Path)
+	}
+	if q.Get("start") != "1h-ago" || q.Get("m") != "sum:1m-avg:m{host=*}" || !q.Has("ms") || !q.Has("show_query") {
+		t.Errorf("query string %v", q)
+	}
+
+	if _, err := NewClient(ts.URL, WithQueryMethod("PUT")); err == nil {
+		t.Error("expected an error for PUT")
+	}
+}
+
+func TestClientQueryReport(t *testing.T) {
+	const body = `[{"metric":"m","tags":{},"aggregateTags":[],"dps":{"1":1}}]`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	for _, method := range []string{http.MethodPost, http.MethodGet} {
+		c, _ := NewClient(ts.URL, WithQueryMethod(method))
+		rs, rep, err := c.QueryWithReport(r, nil)
+		if err != nil || len(rs) != 1 {
+			t.Fatalf("%s: got %v, %v", method, rs, err)
+		}
+		if rep.Bytes != int64(len(body)) {
+			t.Errorf("%s: read %d bytes, want %d", method, rep.Bytes, len(body))
+		}
+		if rep.Network < 10*time.Millisecond || rep.Total < rep.Build+rep.Network+rep.Decode {
+			t.Errorf("%s: inconsistent report %+v", method, rep)
+		}
+	}
+}
+
+func TestClientPoolOptions(t *testing.T) {
+	c, err := NewClient("tsdb:4242",
+		WithMaxIdleConnsPerHost(32),
+		WithMaxConnsPerHost(8),
+		WithIdleConnTimeout(time.Minute),
+		WithForceAttemptHTTP2(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, ok := c.HTTPClient.Transport.(*http.Transport)
+	if !ok || tr != c.transport {
+		t.Fatal("client doesn't use its transport")
+	}
+	if tr.MaxIdleConnsPerHost != 32 || tr.MaxConnsPerHost != 8 || tr.IdleConnTimeout != time.Minute || !tr.ForceAttemptHTTP2 {
+		t.Errorf("got %d %d %v %v", tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost, tr.IdleConnTimeout, tr.ForceAttemptHTTP2)
+	}
+	c, _ = NewClient("tsdb:4242")
+	if tr := c.transport; tr.MaxConnsPerHost != 0 || tr.ForceAttemptHTTP2 {
+		t.Errorf("defaults: got %d %v", tr.MaxConnsPerHost, tr.ForceAttemptHTTP2)
+	}
+}
@@ -0,0 +1,118 @@
+package opentsdb
+
+import (
+	"math"
+	"reflect"
+)
+
+// Clone returns a deep copy of r.
+func (r *Request) Clone() *Request {
+	if r == nil {
+		return nil
+	}
+	n := *r
+	if r.Queries != nil {
+		n.Queries = make([]*Query, len(r.Queries))
+		for i, q := range r.Queries {
+			n.Queries[i] = q.Clone()
+		}
+	}
+	return &n
+}
+
+// Clone returns a deep copy of q.
+func (q *Query) Clone() *Query {
+	if q == nil {
+		return nil
+	}
+	n := *q
+	n.RateOptions = q.RateOptions.Clone()
+	n.Filters = q.Filters.Clone()
+	if q.Tags != nil {
+		n.Tags = q.Tags.Copy()
+	}
+	if q.GroupByTags != nil {
+		n.GroupByTags = q.GroupByTags.Copy()
+	}
+	if q.TSUIDs != nil {
+		n.TSUIDs = append(make([]string, 0, len(q.TSUIDs)), q.TSUIDs...)
+	}
+	if q.Percentiles != nil {
+		n.Percentiles = append(make([]float64, 0, len(q.Percentiles)), q.Percentiles...)
+	}
+	return &n
+}
+
+// Clone returns a copy of f.
+func (f Filters) Clone() Filters {
+	if f == nil {
+		return nil
+	}
+	return append(make(Filters, 0, len(f)), f...)
+}
+
+// Clone returns a copy of o.
+func (o *RateOptions) Clone() *RateOptions {
+	if o == nil {
+		return nil
+	}
+	n := *o
+	return &n
+}
+
+// copyJSONValue deep copies the maps and slices of a decoded JSON value.
+func copyJSONValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		n := make(map[string]any, len(v))
+		for k, e := range v {
+			n[k] = copyJSONValue(e)
+		}
+		return n
+	case []any:
+		n := make([]any, len(v))
+		for i, e := range v {
+			n[i] = copyJSONValue(e)
+		}
+		return n
+	}
+	return v
+}
+
+// DeepEqual reports whether r and o hold the same data. Nil and empty
+// tags, aggregate tags and datapoints are equal, as are NaN points.
+func (r *Response) DeepEqual(o *Response) bool {
+	if r == nil || o == nil {
+		return r == o
+	}
+	if r.Metric != o.Metric || r.Unit != o.Unit || !r.Tags.Equal(o.Tags) || len(r.AggregateTags) != len(o.AggregateTags) || len(r.DPS) != len(o.DPS) {
+		return false
+	}
+	for i, t := range r.AggregateTags {
+		if o.AggregateTags[i] != t {
+			return false
+		}
+	}
+	for t, v := range r.DPS {
+		ov, ok := o.DPS[t]
+		if !ok || ov != v && !(math.IsNaN(float64(v)) && math.IsNaN(float64(ov))) {
+			return false
+		}
+	}
+	return reflect.DeepEqual(r.Query, o.Query) &&
+		reflect.DeepEqual(r.Stats, o.Stats) &&
+		reflect.DeepEqual(r.StatsSummary, o.StatsSummary)
+}
+
+// DeepEqual reports whether r and o hold equal responses in the same order.
+func (r ResponseSet) DeepEqual(o ResponseSet) bool {
+	if len(r) != len(o) {
+		return false
+	}
+	for i := range r {
+		if !r[i].DeepEqual(o[i]) {
+			return false
+		}
+	}
+	return true
+}
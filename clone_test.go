@@ -0,0 +1,75 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestRequestClone(t *testing.T) {
+	r, err := ParseRequest("start=1h-ago&m=sum:rate{counter,,1}:a{host=a}&m=sum:b{dc=*}{host=literal_or(x)}", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Queries[0].Tags = TagSet{"host": "a"}
+	r.Queries[0].TSUIDs = []string{"0001"}
+	before, _ := json.Marshal(r)
+
+	c := r.Clone()
+	after, _ := json.Marshal(c)
+	if string(before) != string(after) {
+		t.Errorf("clone differs:\n%s\n%s", before, after)
+	}
+	c.Queries[0].Tags["host"] = "b"
+	c.Queries[0].TSUIDs[0] = "0002"
+	c.Queries[0].RateOptions.Counter = false
+	c.Queries[1].Filters[0].Filter = "y"
+	c.Queries = append(c.Queries, &Query{})
+	if now, _ := json.Marshal(r); string(now) != string(before) {
+		t.Errorf("modifying the clone changed the original:\n%s\n%s", before, now)
+	}
+	if (*Request)(nil).Clone() != nil || (*Query)(nil).Clone() != nil {
+		t.Error("nil clone")
+	}
+}
+
+func TestResponseCopyAggregateTags(t *testing.T) {
+	r := &Response{Metric: "m", AggregateTags: []string{"host"}}
+	c := r.Copy()
+	if len(c.AggregateTags) != 1 || c.AggregateTags[0] != "host" {
+		t.Fatalf("got %v", c.AggregateTags)
+	}
+	c.AggregateTags[0] = "dc"
+	if r.AggregateTags[0] != "host" {
+		t.Error("copy shares aggregate tags")
+	}
+}
+
+func TestResponseCopy(t *testing.T) {
+	r := &Response{
+		Metric:        "m",
+		Tags:          TagSet{"host": "a"},
+		AggregateTags: []string{"dc"},
+		Query:         Query{Metric: "m", Aggregator: "sum", Tags: TagSet{"host": "*"}, Index: 1},
+		DPS:           DPmap{60: 1, 120: Point(math.NaN())},
+		Stats:         &QueryStats{EmittedDPS: 2},
+		StatsSummary:  &QueryStatsSummary{Queries: map[int]*QueryStageStats{0: {EmittedDPs: 2}}, Extra: map[string]any{"x": []any{1.0}}},
+	}
+	c := r.Copy()
+	if !c.DeepEqual(r) {
+		t.Fatalf("copy differs: %+v", c)
+	}
+	c.Query.Tags["host"] = "b"
+	c.Stats.EmittedDPS = 3
+	c.StatsSummary.Queries[0].EmittedDPs = 3
+	c.StatsSummary.Extra["x"].([]any)[0] = 2.0
+	if r.Query.Tags["host"] != "*" || r.Stats.EmittedDPS != 2 || r.StatsSummary.Queries[0].EmittedDPs != 2 || r.StatsSummary.Extra["x"].([]any)[0] != 1.0 {
+		t.Error("copy shares data with the original")
+	}
+	if c.DeepEqual(r) || (ResponseSet{r}).DeepEqual(ResponseSet{c}) {
+		t.Error("DeepEqual ignores differences")
+	}
+	if !(ResponseSet{r}).DeepEqual(ResponseSet{r.Copy()}) {
+		t.Error("DeepEqual of copied sets")
+	}
+}
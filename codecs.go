@@ -11,6 +11,19 @@ func (v *Epoch) UnmarshalText(text []byte) error {
 	return err
 }
 
+// UnmarshalJSON reads v from a JSON number or from a string holding one,
+// as OpenTSDB accepts both for timestamps.
+func (v *Epoch) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		s, err := strconv.Unquote(string(b))
+		if err != nil {
+			return err
+		}
+		b = []byte(s)
+	}
+	return v.UnmarshalText(b)
+}
+
 func (v Epoch) MarshalText() (text []byte, err error) {
 	text = strconv.AppendInt(text, int64(v), 10)
 	return text, err
@@ -0,0 +1,106 @@
+package opentsdb
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Columns holds query results in columnar form, one row per point, for
+// handing off to analytics tools. Tags are flattened into one column per
+// tag key, empty for series without that tag. Columns are written as CSV,
+// Parquet or Arrow IPC streams without dependencies.
+type Columns struct {
+	Metric    []string
+	Timestamp []int64 // milliseconds
+	Value     []float64
+	Tags      map[string][]string
+}
+
+// NewColumns returns the points of rs in columnar form, each series in
+// time order.
+func NewColumns(rs ResponseSet) *Columns {
+	c := &Columns{Tags: map[string][]string{}}
+	c.Append(rs)
+	return c
+}
+
+// Len returns the number of rows of c.
+func (c *Columns) Len() int {
+	return len(c.Metric)
+}
+
+// Append adds the points of rs to c.
+func (c *Columns) Append(rs ResponseSet) {
+	if c.Tags == nil {
+		c.Tags = map[string][]string{}
+	}
+	for _, resp := range rs {
+		for k := range resp.Tags {
+			if _, ok := c.Tags[k]; !ok {
+				c.Tags[k] = make([]string, c.Len())
+			}
+		}
+		for _, t := range resp.DPS.GetSortedTimes() {
+			c.Metric = append(c.Metric, resp.Metric)
+			c.Timestamp = append(c.Timestamp, epochTime(t).UnixMilli())
+			c.Value = append(c.Value, float64(resp.DPS[t]))
+			for k, col := range c.Tags {
+				c.Tags[k] = append(col, resp.Tags[k])
+			}
+		}
+	}
+}
+
+// TagKeys returns the sorted tag columns of c.
+func (c *Columns) TagKeys() []string {
+	keys := make([]string, 0, len(c.Tags))
+	for k := range c.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// columnKeys returns the sorted tag columns of c, failing if one has the
+// name of a fixed column, which readers couldn't tell apart.
+func (c *Columns) columnKeys() ([]string, error) {
+	keys := c.TagKeys()
+	for _, k := range keys {
+		switch k {
+		case "metric", "timestamp", "value":
+			return nil, fmt.Errorf("opentsdb: tag key %q is the name of a fixed column", k)
+		}
+	}
+	return keys, nil
+}
+
+// WriteCSV writes c to w with a header row of metric, timestamp, value
+// and the tag keys. Tag keys named as a fixed column are an error, as
+// they are for WriteParquet and WriteArrow.
+func (c *Columns) WriteCSV(w io.Writer) error {
+	keys, err := c.columnKeys()
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"metric", "timestamp", "value"}, keys...)); err != nil {
+		return err
+	}
+	row := make([]string, 3+len(keys))
+	for i := range c.Metric {
+		row[0] = c.Metric[i]
+		row[1] = strconv.FormatInt(c.Timestamp[i], 10)
+		row[2] = strconv.FormatFloat(c.Value[i], 'g', -1, 64)
+		for j, k := range keys {
+			row[3+j] = c.Tags[k][i]
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,74 @@
+package opentsdb
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestColumns(t *testing.T) {
+	c := NewColumns(ResponseSet{
+		{Metric: "a", Tags: TagSet{"host": "x"}, DPS: DPmap{20: 2, 10: 1}},
+	})
+	c.Append(ResponseSet{
+		{Metric: "b", Tags: TagSet{"dc": "y"}, DPS: DPmap{1700000000000: 3}},
+	})
+	if c.Len() != 3 || c.Timestamp[0] != 10000 || c.Value[1] != 2 {
+		t.Fatalf("got %+v", c)
+	}
+	var buf bytes.Buffer
+	if err := c.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "metric,timestamp,value,dc,host\n" +
+		"a,10000,1,,x\n" +
+		"a,20000,2,,x\n" +
+		"b,1700000000000,3,y,\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s", buf.String())
+	}
+}
+
+// goldenColumns are the columns of testdata/columns.parquet and
+// testdata/columns.arrow. Those files were checked by reading them back
+// with github.com/xitongsys/parquet-go and the ipc package of
+// github.com/apache/arrow/go/arrow, which gave these rows.
+func goldenColumns() *Columns {
+	return NewColumns(ResponseSet{
+		{Metric: "sys.cpu", Tags: TagSet{"host": "web-1"}, DPS: DPmap{10: 1, 20: 2.5}},
+		{Metric: "sys.mem", Tags: TagSet{"dc": "eu"}, DPS: DPmap{1700000000000: -3}},
+	})
+}
+
+func TestColumnsGolden(t *testing.T) {
+	c := goldenColumns()
+	for _, test := range []struct {
+		file  string
+		write func(io.Writer) error
+	}{
+		{"testdata/columns.parquet", c.WriteParquet},
+		{"testdata/columns.arrow", c.WriteArrow},
+	} {
+		want, err := os.ReadFile(test.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := test.write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: output differs from the golden file", test.file)
+		}
+	}
+}
+
+func TestColumnsFixedNames(t *testing.T) {
+	c := NewColumns(ResponseSet{{Metric: "m", Tags: TagSet{"value": "x"}, DPS: DPmap{1: 1}}})
+	for _, write := range []func(io.Writer) error{c.WriteCSV, c.WriteParquet, c.WriteArrow} {
+		if err := write(io.Discard); err == nil {
+			t.Error("expected an error for a tag key named value")
+		}
+	}
+}
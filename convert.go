@@ -0,0 +1,64 @@
+package opentsdb
+
+import "fmt"
+
+// ConversionWarning describes a filter ConvertRequest couldn't convert
+// exactly.
+type ConversionWarning struct {
+	Query  int // index of the query in the request
+	Filter Filter
+	// Action is what was done with the filter: "approximated" when the
+	// tag selects the same series but groups or matches case differently,
+	// "broadened" when the tag is * and selects more series, "dropped"
+	// when nothing replaces it.
+	Action string
+}
+
+func (w ConversionWarning) String() string {
+	return fmt.Sprintf("opentsdb: query %d: %s(%s) filter on %s %s", w.Query, w.Filter.Type, w.Filter.Filter, w.Filter.TagK, w.Action)
+}
+
+// ConvertRequest returns a copy of r rewritten for a target of version v,
+// so that requests can be federated across versions. For 2.2 and later,
+// legacy tags become filters, which is exact. For older versions filters
+// become tags: those without an exact equivalent are approximated,
+// broadened to * or dropped, with a warning for each.
+func ConvertRequest(r *Request, v Version) (*Request, []ConversionWarning) {
+	c := r.Clone()
+	if v.FilterSupport() {
+		c.Normalize(v)
+		return c, nil
+	}
+	var warnings []ConversionWarning
+	for i, q := range c.Queries {
+		q.Normalize(v)
+		for _, f := range q.Filters {
+			w := ConversionWarning{Query: i, Filter: f}
+			tag := "*"
+			switch f.Type {
+			case "literal_or", "iliteral_or":
+				// a 2.1 tag always groups by and matches case
+				tag, w.Action = f.Filter, "approximated"
+			default:
+				if f.GroupBy {
+					w.Action = "broadened"
+				} else {
+					w.Action = "dropped"
+				}
+			}
+			if _, dup := q.Tags[f.TagK]; dup {
+				w.Action = "dropped"
+			}
+			if w.Action != "dropped" {
+				if q.Tags == nil {
+					q.Tags = TagSet{}
+				}
+				q.Tags[f.TagK] = tag
+			}
+			warnings = append(warnings, w)
+		}
+		q.Filters = nil
+		q.Normalize(v)
+	}
+	return c, warnings
+}
@@ -0,0 +1,71 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestConvertRequest(t *testing.T) {
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum", Filters: Filters{
+		{Type: "literal_or", TagK: "host", Filter: "a|b", GroupBy: true},
+		{Type: "iliteral_or", TagK: "dc", Filter: "east", GroupBy: false},
+		{Type: "regexp", TagK: "env", Filter: "prod.*", GroupBy: true},
+		{Type: "not_literal_or", TagK: "role", Filter: "db", GroupBy: false},
+	}}}}
+
+	c, warnings := ConvertRequest(r, Version2_1)
+	q := c.Queries[0]
+	if want := (TagSet{"host": "a|b", "dc": "east", "env": "*"}); !reflect.DeepEqual(q.Tags, want) || len(q.Filters) != 0 {
+		t.Errorf("got tags %v filters %v, want tags %v", q.Tags, q.Filters, want)
+	}
+	var actions []string
+	for _, w := range warnings {
+		actions = append(actions, w.Filter.TagK+" "+w.Action)
+	}
+	if want := []string{"dc approximated", "env broadened", "role dropped"}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("warnings %v, want %v", actions, want)
+	}
+	if len(r.Queries[0].Filters) != 4 {
+		t.Error("request modified")
+	}
+
+	back, warnings := ConvertRequest(c, Version2_2)
+	if len(warnings) != 0 || len(back.Queries[0].Tags) != 0 || len(back.Queries[0].Filters) != 3 {
+		t.Errorf("to 2.2: got %+v, %v", back.Queries[0], warnings)
+	}
+}
+
+func TestMultiContextConvert(t *testing.T) {
+	var sent []*Request
+	var hosts []*SynContext
+	for _, v := range []Version{Version2_4, Version2_1} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var r Request
+			json.NewDecoder(req.Body).Decode(&r)
+			sent = append(sent, &r)
+			w.Write([]byte(`[]`))
+		}))
+		defer ts.Close()
+		h := NewSynContext(ts.URL, -1)
+		h.TSDBVersion = v
+		hosts = append(hosts, h)
+	}
+	var warned []ConversionWarning
+	hosts[1].Warn = func(w ConversionWarning) { warned = append(warned, w) }
+
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum", Filters: Filters{
+		{Type: "regexp", TagK: "host", Filter: "web.*", GroupBy: true},
+	}}}}
+	if _, err := NewMultiContext(hosts...).Query(r); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 || len(sent[0].Queries[0].Filters) != 1 || sent[1].Queries[0].Tags["host"] != "*" {
+		t.Errorf("sent %+v and %+v", sent[0].Queries[0], sent[1].Queries[0])
+	}
+	if len(warned) != 1 || warned[0].Action != "broadened" {
+		t.Errorf("warnings %v", warned)
+	}
+}
@@ -0,0 +1,101 @@
+package opentsdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// NewDataPoint returns the data point of metric at ts with value and a
+// copy of tags, cleaned. Names that are still invalid after cleaning give
+// a *NameError, a zero ts ErrMissingTimestamp and a non numeric value
+// ErrInvalidValue, joined.
+func NewDataPoint(metric string, ts time.Time, value interface{}, tags TagSet) (*DataPoint, error) {
+	b := BuildDataPoint(metric).At(ts).WithTags(tags)
+	if f, ok := value.(float64); ok {
+		b.Float(f)
+	} else {
+		b.dp.Value = value
+	}
+	return b.Build()
+}
+
+// DataPointBuilder builds a DataPoint, cleaning its metric and tags as
+// they are set. The problems found are returned together by Build.
+type DataPointBuilder struct {
+	dp  DataPoint
+	err error // an infinite value, which Validate accepts
+}
+
+// BuildDataPoint starts building a data point of metric, e.g.
+//
+//	dp, err := BuildDataPoint("sys.cpu.user").At(now).Float(0.5).WithTag("host", h).Build()
+func BuildDataPoint(metric string) *DataPointBuilder {
+	b := &DataPointBuilder{dp: DataPoint{Tags: TagSet{}}}
+	b.dp.Metric, _ = Clean(metric)
+	return b
+}
+
+// At sets the timestamp to t, in seconds. A zero t leaves it unset.
+func (b *DataPointBuilder) At(t time.Time) *DataPointBuilder {
+	b.dp.Timestamp = 0
+	if !t.IsZero() {
+		b.dp.Timestamp = Epoch(t.Unix())
+	}
+	return b
+}
+
+// Float sets a floating point value. NaN and infinities are invalid.
+func (b *DataPointBuilder) Float(v float64) *DataPointBuilder {
+	b.err = nil
+	if math.IsInf(v, 0) {
+		b.err = fmt.Errorf("%w: %v", ErrInvalidValue, v)
+	}
+	b.dp.Value = v
+	return b
+}
+
+// Int sets an integer value.
+func (b *DataPointBuilder) Int(v int64) *DataPointBuilder {
+	b.err = nil
+	b.dp.Value = v
+	return b
+}
+
+// WithTag sets the tag k to v, both cleaned.
+func (b *DataPointBuilder) WithTag(k, v string) *DataPointBuilder {
+	kc, _ := Clean(k)
+	vc, _ := Clean(v)
+	b.dp.Tags[kc] = vc
+	return b
+}
+
+// WithTags sets every tag of ts, as WithTag does.
+func (b *DataPointBuilder) WithTags(ts TagSet) *DataPointBuilder {
+	for _, k := range ts.Keys() {
+		b.WithTag(k, ts[k])
+	}
+	return b
+}
+
+// Build returns the cleaned data point. It fails with every problem found
+// by Validate, joined, and an infinite value.
+func (b *DataPointBuilder) Build() (*DataPoint, error) {
+	dp := b.dp
+	dp.Tags = b.dp.Tags.Copy()
+	var errs []error
+	if b.err != nil {
+		errs = append(errs, b.err)
+	}
+	cleanErr := dp.Clean()
+	if err := dp.Validate(); err != nil {
+		errs = append(errs, err)
+	} else if cleanErr != nil {
+		errs = append(errs, cleanErr)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &dp, nil
+}
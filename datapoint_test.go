@@ -0,0 +1,41 @@
+package opentsdb
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewDataPoint(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	dp, err := NewDataPoint("sys cpu", ts, 1.5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dp.Metric != "syscpu" || dp.Timestamp != 1700000000 || dp.Tags == nil {
+		t.Errorf("got %+v", dp)
+	}
+
+	_, err = NewDataPoint("m", time.Time{}, "x", TagSet{"host": "a"})
+	if !errors.Is(err, ErrMissingTimestamp) || !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v", err)
+	}
+
+	var ne *NameError
+	_, err = NewDataPoint("m", time.Time{}, math.Inf(1), TagSet{"host": "!!"})
+	if !errors.As(err, &ne) || !errors.Is(err, ErrMissingTimestamp) || !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v", err)
+	}
+
+	dp, err = BuildDataPoint("m").At(ts).Int(3).WithTag("host", "web 1").Build()
+	if err != nil || dp.Value != int64(3) || dp.Tags["host"] != "web1" {
+		t.Errorf("got %+v %v", dp, err)
+	}
+	if _, err := BuildDataPoint("m").At(ts).Int(1).WithTag("host", "!!").Build(); !errors.As(err, &ne) {
+		t.Errorf("got %v", err)
+	}
+	if _, err := BuildDataPoint("m").At(ts).Float(math.NaN()).Build(); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package opentsdb
+
+import (
+	"fmt"
+	"io"
+)
+
+// Dialect adapts a Client to an OpenTSDB compatible backend whose API
+// differs from OpenTSDB 2.x, such as a newer major version or a store
+// implementing only part of the API.
+type Dialect struct {
+	Name string
+	// Version, if set, is the OpenTSDB version the backend behaves as,
+	// reported by Client.Version.
+	Version Version
+	// Endpoints maps OpenTSDB endpoint paths, such as /api/put, to the
+	// paths of the backend. Paths not in the map are used unchanged, and
+	// paths mapped to "" are not supported.
+	Endpoints map[string]string
+	// Rewrite, if set, adjusts a copy of every request before it is
+	// sent, e.g. to clear fields the backend rejects.
+	Rewrite func(r *Request)
+	// Decode, if set, decodes query responses instead of
+	// DecodeResponseSet.
+	Decode func(r io.Reader) (ResponseSet, error)
+}
+
+// OpenTSDB2 is the dialect of OpenTSDB 2.x, which clients use by default.
+var OpenTSDB2 = &Dialect{Name: "opentsdb2"}
+
+// MinimalDialect is the dialect of stores implementing only the query and
+// put endpoints of OpenTSDB. Requests are sent without the fields asking
+// for TSUIDs, summaries, statistics, annotations or deletion.
+var MinimalDialect = &Dialect{
+	Name:    "minimal",
+	Version: Version2_2,
+	Endpoints: map[string]string{
+		"/api/histogram":     "",
+		"/api/rollup":        "",
+		"/api/search/lookup": "",
+		"/api/suggest":       "",
+	},
+	Rewrite: func(r *Request) {
+		r.ShowTSUIDs = false
+		r.ShowSummary = false
+		r.ShowStats = false
+		r.GlobalAnnotations = false
+		r.NoAnnotations = false
+		r.Delete = false
+	},
+}
+
+// WithDialect makes the client target a backend speaking d.
+func WithDialect(d *Dialect) ClientOption {
+	return func(c *Client) error {
+		c.Dialect = d
+		if d != nil && d.Version != (Version{}) {
+			c.TSDBVersion = d.Version
+		}
+		return nil
+	}
+}
+
+// path returns the backend path of endpoint.
+func (d *Dialect) path(endpoint string) (string, error) {
+	if d == nil {
+		return endpoint, nil
+	}
+	p, ok := d.Endpoints[endpoint]
+	if !ok {
+		return endpoint, nil
+	}
+	if p == "" {
+		return "", fmt.Errorf("%w: %s %s", ErrUnsupportedEndpoint, d.Name, endpoint)
+	}
+	return p, nil
+}
+
+// request returns r as sent to the backend.
+func (d *Dialect) request(r *Request) *Request {
+	if d == nil || d.Rewrite == nil {
+		return r
+	}
+	r = r.Clone()
+	d.Rewrite(r)
+	return r
+}
+
+func (d *Dialect) decode(r io.Reader) (ResponseSet, error) {
+	if d == nil || d.Decode == nil {
+		return DecodeResponseSet(r)
+	}
+	return d.Decode(r)
+}
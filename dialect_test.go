@@ -0,0 +1,45 @@
+package opentsdb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDialect(t *testing.T) {
+	var body, path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body, path = string(b), r.URL.Path
+		w.Write([]byte(`[{"metric":"m","tags":{},"aggregateTags":[],"dps":{"1":1}}]`))
+	}))
+	defer ts.Close()
+
+	d := *MinimalDialect
+	d.Endpoints = map[string]string{"/api/query": "/v1/query", "/api/suggest": ""}
+	c, err := NewClient(ts.URL, WithDialect(&d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version() != Version2_2 {
+		t.Errorf("got version %v", c.Version())
+	}
+	r := &Request{Start: "1h-ago", ShowStats: true, Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	rs, err := c.Query(r)
+	if err != nil || len(rs) != 1 {
+		t.Fatalf("got %v %v", rs, err)
+	}
+	if path != "/v1/query" || strings.Contains(body, "showStats") || !r.ShowStats {
+		t.Errorf("got %s %s", path, body)
+	}
+	if err := c.Put(MultiDataPoint{{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"a": "b"}}}); err != nil || path != "/api/put" {
+		t.Errorf("got %v %s", err, path)
+	}
+	if _, err := c.Suggest(context.Background(), "metrics", "m", 10); !errors.Is(err, ErrUnsupportedEndpoint) {
+		t.Errorf("got %v", err)
+	}
+}
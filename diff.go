@@ -0,0 +1,106 @@
+package opentsdb
+
+import "math"
+
+// ResponseSetDiff describes how two ResponseSets differ. Series are matched
+// by metric, tags and aggregate tags.
+type ResponseSetDiff struct {
+	Missing []*Response  // series only present in the first set
+	Extra   []*Response  // series only present in the second set
+	Series  []SeriesDiff // series present in both whose points differ
+}
+
+// SeriesDiff describes the differences between the points of a series.
+type SeriesDiff struct {
+	Metric  string
+	Tags    TagSet
+	Missing []Epoch // timestamps only present in the first series
+	Extra   []Epoch // timestamps only present in the second series
+	Changed []PointDiff
+}
+
+// PointDiff is a timestamp whose values differ by more than the tolerance.
+type PointDiff struct {
+	Timestamp Epoch
+	A, B      Point
+}
+
+// Empty returns true if no difference was found.
+func (d *ResponseSetDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Series) == 0
+}
+
+// Empty returns true if no difference was found.
+func (d *SeriesDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0
+}
+
+// DiffResponseSets compares a to b. Points are considered equal when they
+// differ by at most tolerance; NaN equals NaN.
+func DiffResponseSets(a, b ResponseSet, tolerance float64) *ResponseSetDiff {
+	d := &ResponseSetDiff{}
+	bIdx := make(map[string]*Response, len(b))
+	for _, r := range b {
+		bIdx[stableKey(r)] = r
+	}
+	seen := map[string]bool{}
+	for _, ra := range a {
+		key := stableKey(ra)
+		seen[key] = true
+		rb, ok := bIdx[key]
+		if !ok {
+			d.Missing = append(d.Missing, ra)
+			continue
+		}
+		if sd := DiffDPmaps(ra.DPS, rb.DPS, tolerance); !sd.Empty() {
+			sd.Metric = ra.Metric
+			sd.Tags = ra.Tags
+			d.Series = append(d.Series, sd)
+		}
+	}
+	for _, rb := range b {
+		if !seen[stableKey(rb)] {
+			d.Extra = append(d.Extra, rb)
+		}
+	}
+	return d
+}
+
+// DiffDPmaps compares the points of a and b. The returned diff has no
+// metric or tags.
+func DiffDPmaps(a, b DPmap, tolerance float64) SeriesDiff {
+	d := SeriesDiff{}
+	for _, t := range a.GetSortedTimes() {
+		vb, ok := b[t]
+		if !ok {
+			d.Missing = append(d.Missing, t)
+			continue
+		}
+		if !pointsEqual(a[t], vb, tolerance) {
+			d.Changed = append(d.Changed, PointDiff{Timestamp: t, A: a[t], B: vb})
+		}
+	}
+	for _, t := range b.GetSortedTimes() {
+		if _, ok := a[t]; !ok {
+			d.Extra = append(d.Extra, t)
+		}
+	}
+	return d
+}
+
+func pointsEqual(a, b Point, tolerance float64) bool {
+	fa, fb := float64(a), float64(b)
+	if math.IsNaN(fa) || math.IsNaN(fb) {
+		return math.IsNaN(fa) && math.IsNaN(fb)
+	}
+	if fa == fb {
+		return true
+	}
+	return math.Abs(fa-fb) <= tolerance
+}
+
+// Equal returns true if r and o hold the same series with points differing
+// by at most tolerance.
+func (r ResponseSet) Equal(o ResponseSet, tolerance float64) bool {
+	return DiffResponseSets(r, o, tolerance).Empty()
+}
@@ -0,0 +1,34 @@
+package opentsdb
+
+import "testing"
+
+func TestDiffResponseSets(t *testing.T) {
+	a := ResponseSet{
+		{Metric: "m", Tags: TagSet{"host": "a"}, DPS: DPmap{1: 1, 2: 2, 3: 3}},
+		{Metric: "m", Tags: TagSet{"host": "b"}, DPS: DPmap{1: 1}},
+	}
+	b := ResponseSet{
+		{Metric: "m", Tags: TagSet{"host": "a"}, DPS: DPmap{1: 1.001, 2: 2.5, 4: 4}},
+		{Metric: "m", Tags: TagSet{"host": "c"}, DPS: DPmap{1: 1}},
+	}
+	d := DiffResponseSets(a, b, 0.01)
+	if len(d.Missing) != 1 || d.Missing[0].Tags["host"] != "b" {
+		t.Errorf("missing: %v", d.Missing)
+	}
+	if len(d.Extra) != 1 || d.Extra[0].Tags["host"] != "c" {
+		t.Errorf("extra: %v", d.Extra)
+	}
+	if len(d.Series) != 1 {
+		t.Fatalf("expected one differing series, got %d", len(d.Series))
+	}
+	s := d.Series[0]
+	if len(s.Changed) != 1 || s.Changed[0].Timestamp != 2 {
+		t.Errorf("changed: %v", s.Changed)
+	}
+	if len(s.Missing) != 1 || s.Missing[0] != 3 || len(s.Extra) != 1 || s.Extra[0] != 4 {
+		t.Errorf("missing %v extra %v", s.Missing, s.Extra)
+	}
+	if !a.Equal(a.Copy(), 0) {
+		t.Error("set should equal its copy")
+	}
+}
@@ -2,11 +2,14 @@ package opentsdb
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
+	"sort"
+	"strings"
 	"time"
 )
 
-var dRexStr = `([+-]?[0-9]+.?[0-9]*(?:ms|s|m|h|d|w|n|y))(?:-[a-z]+)(?:-[a-z]+)?`
+var dRexStr = `([+-]?(?:[0-9]*\.?[0-9]+(?:ms|s|m|h|d|w|n|y))+)(?:-[a-z]+)(?:-[a-z]+)?`
 var drex = regexp.MustCompile(dRexStr)
 
 func ParseDownsample(d string) (Duration, error) {
@@ -19,6 +22,45 @@ func ParseDownsample(d string) (Duration, error) {
 	return ParseDuration(match[1])
 }
 
+// DownsampleSpec is a parsed downsample specification such as 1m-avg-zero.
+type DownsampleSpec struct {
+	Interval   Duration
+	Aggregator string
+	Fill       string
+}
+
+// ParseDownsampleSpec parses the interval, aggregator and optional fill
+// policy of a downsample specification.
+func ParseDownsampleSpec(d string) (DownsampleSpec, error) {
+	var spec DownsampleSpec
+	parts := strings.SplitN(d, "-", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		return spec, errors.New("Invalid downsample")
+	}
+	interval, err := ParseDuration(parts[0])
+	if err != nil {
+		return spec, err
+	}
+	spec.Interval = interval
+	spec.Aggregator = parts[1]
+	if len(parts) == 3 {
+		if parts[2] == "" {
+			return spec, errors.New("Invalid downsample")
+		}
+		spec.Fill = parts[2]
+	}
+	return spec, nil
+}
+
+// String returns the spec in OpenTSDB downsample syntax.
+func (s DownsampleSpec) String() string {
+	v := s.Interval.HumanString() + "-" + s.Aggregator
+	if s.Fill != "" {
+		v += "-" + s.Fill
+	}
+	return v
+}
+
 const maxDuration = Duration(^uint(0) >> 1)
 
 func (r *Request) GetMinDownsample() (Duration, error) {
@@ -75,3 +117,142 @@ func (r *Request) DisableDownsampling() bool {
 	}
 	return v
 }
+
+// AutoDownsampleOptions tune Request.AutoDownsampleWith.
+type AutoDownsampleOptions struct {
+	// Aggregator is the downsample aggregator, avg when empty.
+	Aggregator string
+	// PreserveAggregator keeps the aggregator and fill policy of a query
+	// that is already downsampled.
+	PreserveAggregator bool
+	// MinInterval is the smallest interval set. It defaults to one second,
+	// or one millisecond for requests with MsResolution.
+	MinInterval Duration
+	// OnlyExceeding leaves alone queries whose current resolution already
+	// produces at most the requested number of points.
+	OnlyExceeding bool
+}
+
+// AutoDownsampleWith sets downsamplers producing about l points per series,
+// as tuned by opts. Unlike AutoDownsample it never removes a downsampler.
+func (r *Request) AutoDownsampleWith(l int, opts AutoDownsampleOptions) error {
+	if l <= 0 {
+		return ErrInvalidAutoDownsample
+	}
+	span, err := GetDuration(r)
+	if err != nil {
+		return err
+	}
+	min := opts.MinInterval
+	if min <= 0 {
+		min = Second
+		if r.MsResolution {
+			min = Millisecond
+		}
+	}
+	d := span / Duration(l)
+	if d < min {
+		d = min
+	}
+	switch {
+	case r.UseCalendar:
+		d = calendarInterval(d)
+	case d >= Second:
+		d = d / Second * Second
+	default:
+		d = d / Millisecond * Millisecond
+	}
+
+	for _, q := range r.Queries {
+		current := Second // raw data is assumed to be 1 dp/sec
+		spec, err := ParseDownsampleSpec(q.Downsample)
+		if err == nil {
+			current = spec.Interval
+		}
+		if opts.OnlyExceeding && current > 0 && span/current <= Duration(l) {
+			continue
+		}
+		next := DownsampleSpec{Interval: d, Aggregator: opts.Aggregator}
+		if next.Aggregator == "" {
+			next.Aggregator = "avg"
+		}
+		if opts.PreserveAggregator && err == nil {
+			next.Aggregator = spec.Aggregator
+			next.Fill = spec.Fill
+		}
+		q.Downsample = next.String()
+	}
+	return nil
+}
+
+// SnapDownsample rounds the downsample interval of every query up to the
+// nearest of allowed, such as the available rollup intervals. An interval
+// beyond the largest allowed one is an error, since snapping it down would
+// return more points than asked for; r is then left unchanged. Queries
+// without a downsampler, or downsampling with "0all" or calendar intervals
+// such as "1dc", are left alone.
+func (r *Request) SnapDownsample(allowed []Duration) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	sorted := append([]Duration(nil), allowed...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	snapped := make([]string, len(r.Queries))
+	for i, q := range r.Queries {
+		snapped[i] = q.Downsample
+		if q.Downsample == "" || !fixedDownsample(q.Downsample) {
+			continue
+		}
+		spec, err := ParseDownsampleSpec(q.Downsample)
+		if err != nil {
+			return err
+		}
+		j := sort.Search(len(sorted), func(j int) bool { return sorted[j] >= spec.Interval })
+		if j == len(sorted) {
+			return fmt.Errorf("opentsdb: downsample %s is coarser than the largest allowed interval %s", q.Downsample, sorted[j-1].HumanString())
+		}
+		if spec.Interval != sorted[j] {
+			spec.Interval = sorted[j]
+			snapped[i] = spec.String()
+		}
+	}
+	for i, q := range r.Queries {
+		q.Downsample = snapped[i]
+	}
+	return nil
+}
+
+// fixedDownsample reports whether the interval of the downsampler ds is a
+// fixed duration, rather than "0all" or a calendar interval such as "1dc".
+func fixedDownsample(ds string) bool {
+	interval, _, _ := strings.Cut(ds, "-")
+	return !strings.HasSuffix(interval, "all") && !strings.HasSuffix(interval, "c")
+}
+
+// Snap moves every point of m to the start of its interval bucket,
+// combining points that land in the same bucket with the named aggregator.
+func (m DPmap) Snap(interval Duration, agg string) (DPmap, error) {
+	times := m.GetSortedTimes()
+	step := epochSpan(times, interval)
+	if step <= 0 {
+		return m, nil
+	}
+	buckets := map[Epoch][]Point{}
+	for _, t := range times {
+		b := floorEpoch(t, step)
+		buckets[b] = append(buckets[b], m[t])
+	}
+	out := make(DPmap, len(buckets))
+	for b, vals := range buckets {
+		if len(vals) == 1 {
+			out[b] = vals[0]
+			continue
+		}
+		v, err := Aggregate(agg, vals)
+		if err != nil {
+			return nil, err
+		}
+		out[b] = v
+	}
+	return out, nil
+}
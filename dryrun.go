@@ -0,0 +1,97 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Marshal returns the JSON body of r as sent to a target of version v,
+// normalized and converted by ConvertRequest.
+func (r *Request) Marshal(v Version) ([]byte, error) {
+	c, _ := ConvertRequest(r, v)
+	return json.Marshal(c)
+}
+
+// DryRun is a query as it would be sent.
+type DryRun struct {
+	Method string
+	URL    string
+	// Body is the JSON body of the request. GET requests carry it in the
+	// URL instead, and Body is what would have been POSTed.
+	Body     []byte
+	Warnings []ConversionWarning
+}
+
+// DryRunContext is a Context that records the requests it is given as they
+// would be sent, without sending them. Placed under middleware, it shows
+// the requests the middleware produces. Metrics aren't expanded.
+type DryRunContext struct {
+	Host        string
+	TSDBVersion Version
+	Dialect     *Dialect
+	// QueryMethod is the HTTP method of queries, POST unless GET.
+	QueryMethod string
+
+	mu   sync.Mutex
+	last *DryRun
+}
+
+// NewDryRunContext returns a DryRunContext with the host, version, dialect
+// and query method of c.
+func NewDryRunContext(c *Client) *DryRunContext {
+	return &DryRunContext{
+		Host:        c.Host,
+		TSDBVersion: c.Version(),
+		Dialect:     c.Dialect,
+		QueryMethod: c.QueryMethod,
+	}
+}
+
+func (d *DryRunContext) Version() Version {
+	return d.TSDBVersion
+}
+
+// Plan returns r as it would be sent.
+func (d *DryRunContext) Plan(r *Request) (*DryRun, error) {
+	c, warnings := ConvertRequest(r, d.TSDBVersion)
+	c = d.Dialect.request(c)
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	path, err := d.Dialect.path("/api/query")
+	if err != nil {
+		return nil, err
+	}
+	u := apiURL(d.Host, path)
+	run := &DryRun{Method: http.MethodPost, Body: b, Warnings: warnings}
+	if d.QueryMethod == http.MethodGet {
+		run.Method = http.MethodGet
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += c.getQuery()
+	}
+	run.URL = u.String()
+	return run, nil
+}
+
+// Query records r as Last would return it and returns no responses.
+func (d *DryRunContext) Query(r *Request) (ResponseSet, error) {
+	run, err := d.Plan(r)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	d.last = run
+	d.mu.Unlock()
+	return ResponseSet{}, nil
+}
+
+// Last returns the request last given to Query, or nil.
+func (d *DryRunContext) Last() *DryRun {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last
+}
@@ -0,0 +1,45 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDryRunContext(t *testing.T) {
+	r, err := ParseRequest("start=1h-ago&m=sum:a{host=web*}", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := NewClient("http://tsdb:4242", WithVersion(Version2_1))
+	d := NewDryRunContext(c)
+	ctx := Chain(d, InjectTags(TagSet{"env": "prod"}))
+	if _, err := ctx.Query(r); err != nil {
+		t.Fatal(err)
+	}
+	run := d.Last()
+	if run.Method != http.MethodPost || run.URL != "http://tsdb:4242/api/query" {
+		t.Errorf("got %s %s", run.Method, run.URL)
+	}
+	want, _ := r.Marshal(Version2_1)
+	var sent Request
+	if err := json.Unmarshal(run.Body, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if q := sent.Queries[0]; q.Tags["env"] != "prod" || q.Tags["host"] != "*" || len(q.Filters) != 0 {
+		t.Errorf("got tags %v filters %v", q.Tags, q.Filters)
+	}
+	if string(want) == string(run.Body) {
+		t.Error("middleware not applied")
+	}
+	if len(run.Warnings) != 1 || run.Warnings[0].Action != "broadened" {
+		t.Errorf("got warnings %v", run.Warnings)
+	}
+
+	d.QueryMethod = http.MethodGet
+	run, _ = d.Plan(r)
+	if run.Method != http.MethodGet || !strings.Contains(run.URL, "/api/query?m=sum%3Aa") {
+		t.Errorf("got %s %s", run.Method, run.URL)
+	}
+}
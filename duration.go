@@ -5,6 +5,7 @@
 package opentsdb
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -158,7 +159,12 @@ func (d Duration) SpanString() string {
 	return s
 }
 
+// HumanString formats d in the largest OpenTSDB unit dividing it, e.g. 90m
+// or 2w. Negative durations are prefixed with a minus sign.
 func (d Duration) HumanString() string {
+	if d < 0 {
+		return "-" + (-d).HumanString()
+	}
 	if d >= Year && d%Year == 0 {
 		return fmt.Sprintf("%dy", d/Year)
 	}
@@ -189,6 +195,43 @@ func (d Duration) SecondsInt64() int64 {
 	return int64(time.Duration(d).Seconds())
 }
 
+// Truncate returns d rounded toward zero to a multiple of m, like
+// time.Duration.Truncate. With m a downsample interval this is the offset
+// of the bucket d falls in.
+func (d Duration) Truncate(m Duration) Duration {
+	return Duration(time.Duration(d).Truncate(time.Duration(m)))
+}
+
+// Round returns d rounded to the nearest multiple of m, like
+// time.Duration.Round.
+func (d Duration) Round(m Duration) Duration {
+	return Duration(time.Duration(d).Round(time.Duration(m)))
+}
+
+// MarshalJSON writes d as a string in OpenTSDB duration syntax, e.g. "5m".
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.HumanString())
+}
+
+// UnmarshalJSON reads d from a string in OpenTSDB duration syntax, e.g.
+// "90s" or "1n", or from a number of nanoseconds as time.Duration is
+// encoded.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] != '"' {
+		var ns int64
+		if err := json.Unmarshal(b, &ns); err != nil {
+			return fmt.Errorf("opentsdb: invalid duration %s", b)
+		}
+		*d = Duration(ns)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
 func (d *Duration) UnmarshalText(text []byte) error {
 	duration, err := ParseDuration(string(text))
 	if err != nil {
@@ -24,6 +24,33 @@ func TestDownsample(t *testing.T) {
 
 }
 
+func TestParseDurationCompound(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Duration
+	}{
+		{"1h30m", 90 * Minute},
+		{"1d12h", 36 * Hour},
+		{"-1h30m", -90 * Minute},
+		{"2w3d", 17 * Day},
+		{"1m500ms", Minute + 500*Millisecond},
+	}
+	for _, test := range tests {
+		got, err := ParseDuration(test.s)
+		if err != nil || got != test.want {
+			t.Errorf("%s: got %v %v, expected %v", test.s, got, err, test.want)
+		}
+	}
+	if got := (90 * Minute).String(); got != "5400000ms" {
+		t.Errorf("got %s", got)
+	}
+
+	ds, err := ParseDownsample("1h30m15s-avg")
+	if err != nil || ds != 90*Minute+15*Second {
+		t.Errorf("got %v %v", ds, err)
+	}
+}
+
 func TestDuration(t *testing.T) {
 
 	var q = []byte(
@@ -44,3 +71,105 @@ func TestDuration(t *testing.T) {
 		t.Errorf("want %s have %s", "7260h54m51s", reqSpan.SpanString())
 	}
 }
+
+func TestAutoDownsampleWith(t *testing.T) {
+	newReq := func() *Request {
+		return &Request{
+			Start: "2023/01/30-00:00:00",
+			End:   "2023/01/30-01:00:00",
+			Queries: []*Query{
+				{Metric: "a", Aggregator: "sum"},
+				{Metric: "b", Aggregator: "sum", Downsample: "1m-max-zero"},
+				{Metric: "c", Aggregator: "sum", Downsample: "10m-sum"},
+			},
+		}
+	}
+
+	r := newReq()
+	if err := r.AutoDownsampleWith(12, AutoDownsampleOptions{Aggregator: "max", PreserveAggregator: true, OnlyExceeding: true}); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"5m-max", "5m-max-zero", "10m-sum"} {
+		if r.Queries[i].Downsample != want {
+			t.Errorf("query %d: got %s, expected %s", i, r.Queries[i].Downsample, want)
+		}
+	}
+
+	r = newReq()
+	r.MsResolution = true
+	if err := r.AutoDownsampleWith(36000, AutoDownsampleOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Queries[0].Downsample != "100ms-avg" || r.Queries[2].Downsample != "100ms-avg" {
+		t.Errorf("got %s %s", r.Queries[0].Downsample, r.Queries[2].Downsample)
+	}
+
+	r = newReq()
+	if err := r.AutoDownsampleWith(36000, AutoDownsampleOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if r.Queries[0].Downsample != "1s-avg" {
+		t.Errorf("got %s", r.Queries[0].Downsample)
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	for _, d := range []Duration{90 * Minute, 2 * Week, Month, Year, 1500 * Millisecond, -Hour} {
+		b, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Duration
+		if err := json.Unmarshal(b, &got); err != nil || got != d {
+			t.Errorf("%s: got %v, %v", b, got, err)
+		}
+	}
+	var d Duration
+	if err := json.Unmarshal([]byte(`"1h30m"`), &d); err != nil || d != 90*Minute {
+		t.Errorf("compound: got %v, %v", d, err)
+	}
+	if err := json.Unmarshal([]byte(`60000000000`), &d); err != nil || d != Minute {
+		t.Errorf("nanoseconds: got %v, %v", d, err)
+	}
+	if err := json.Unmarshal([]byte(`"1x"`), &d); err == nil {
+		t.Error("invalid unit accepted")
+	}
+	if got := (90 * Minute).Truncate(Hour); got != Hour {
+		t.Errorf("truncate: got %v", got.HumanString())
+	}
+	if got := (90 * Minute).Round(Hour); got != 2*Hour {
+		t.Errorf("round: got %v", got.HumanString())
+	}
+}
+
+func TestSnapDownsample(t *testing.T) {
+	r := &Request{Queries: []*Query{
+		{Metric: "a", Aggregator: "sum"},
+		{Metric: "b", Aggregator: "sum", Downsample: "30s-max-zero"},
+		{Metric: "c", Aggregator: "sum", Downsample: "1h-sum"},
+		{Metric: "d", Aggregator: "sum", Downsample: "0all-sum"},
+		{Metric: "e", Aggregator: "sum", Downsample: "1dc-avg"},
+	}}
+	if err := r.SnapDownsample([]Duration{Day, Minute, Hour}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "1m-max-zero", "1h-sum", "0all-sum", "1dc-avg"}
+	for i, q := range r.Queries {
+		if q.Downsample != want[i] {
+			t.Errorf("%s: got %q, expected %q", q.Metric, q.Downsample, want[i])
+		}
+	}
+
+	r.Queries[0].Downsample = "2d-avg"
+	r.Queries[1].Downsample = "30s-max"
+	if err := r.SnapDownsample([]Duration{Minute, Day}); err == nil {
+		t.Error("expected error for an interval beyond the largest allowed")
+	}
+	if r.Queries[1].Downsample != "30s-max" {
+		t.Errorf("request modified on error: %q", r.Queries[1].Downsample)
+	}
+	r.Queries[0].Downsample = "bad"
+	if err := r.SnapDownsample([]Duration{Minute}); err == nil {
+		t.Error("expected error")
+	}
+}
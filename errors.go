@@ -1,7 +1,12 @@
 package opentsdb
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
 
 	"github.com/the-cloud-source/opentsdb/name"
 )
@@ -17,6 +22,25 @@ var (
 	ErrNameLeftEmpty    = errors.New("Name left empty after formatting")
 
 	ErrLeadingInt = errors.New("time: bad [0-9]*")
+
+	ErrNotRecorded = errors.New("opentsdb: request not recorded")
+
+	ErrMetricDenied = errors.New("opentsdb: metric not allowed")
+
+	ErrResponseTooLarge = errors.New("opentsdb: response too large")
+
+	ErrMergeConflict = errors.New("opentsdb: backends returned conflicting points")
+
+	ErrTooManyTags = errors.New("opentsdb: too many tags")
+
+	ErrUnsupportedEndpoint = errors.New("opentsdb: endpoint not supported by dialect")
+
+	ErrMissingTimestamp = errors.New("opentsdb: missing timestamp")
+	ErrInvalidValue     = errors.New("opentsdb: invalid value")
+
+	ErrSnapshotFormat = errors.New("opentsdb: not a response set snapshot")
+
+	ErrUnitMismatch = errors.New("opentsdb: units of different dimensions")
 )
 
 func errInvalidRuneCheck() error {
@@ -26,3 +50,148 @@ func errInvalidRuneCheck() error {
 func errInvalidPatern() error {
 	return name.ErrInvalidPatern
 }
+
+// Error kinds. Errors returned by this package wrap one of them when their
+// cause is known, so that callers can test them with errors.Is.
+var (
+	// ErrTimeout means the request timed out. It is retryable.
+	ErrTimeout = errors.New("opentsdb: timeout")
+	// ErrTooLarge means a response or query exceeded a configured limit.
+	// Retrying the same request fails again.
+	ErrTooLarge = errors.New("opentsdb: too large")
+	// ErrBadQuery means the TSD rejected the request with a 4xx status or
+	// the request failed validation. It is not retryable.
+	ErrBadQuery = errors.New("opentsdb: bad query")
+	// ErrUnavailable means the TSD could not be reached or answered with
+	// a 5xx status. It is retryable.
+	ErrUnavailable = errors.New("opentsdb: unavailable")
+	// ErrDecode means the response could not be decoded. It is not
+	// retryable unless the response was cut short.
+	ErrDecode = errors.New("opentsdb: invalid response")
+)
+
+// ResponseTooLargeError is returned by contexts limiting the size of
+// responses when the limit is hit. Partial holds the responses decoded
+// before it, which callers may show as truncated results.
+type ResponseTooLargeError struct {
+	Limit     int64
+	BytesRead int64
+	Partial   ResponseSet
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("TSDB response too large: limited to %E bytes", float64(e.Limit))
+}
+
+// Is matches ErrResponseTooLarge and the ErrTooLarge kind.
+func (e *ResponseTooLargeError) Is(target error) bool {
+	return target == ErrResponseTooLarge || target == ErrTooLarge
+}
+
+// ResultLimitError is returned by contexts limiting the number of series
+// or datapoints of responses when a limit is hit. Limit names the limit
+// that tripped, "series" or "datapoints"; Series and DataPoints are the
+// counts observed when it did.
+type ResultLimitError struct {
+	Limit      string
+	Max        int64
+	Series     int
+	DataPoints int64
+	Partial    ResponseSet
+}
+
+func (e *ResultLimitError) Error() string {
+	return fmt.Sprintf("TSDB response too large: %d series and %d datapoints exceed the limit of %d %s",
+		e.Series, e.DataPoints, e.Max, e.Limit)
+}
+
+// Is matches ErrResponseTooLarge and the ErrTooLarge kind.
+func (e *ResultLimitError) Is(target error) bool {
+	return target == ErrResponseTooLarge || target == ErrTooLarge
+}
+
+// responseLimits bounds a response in bytes, series and datapoints. Zero
+// series and datapoint limits are unlimited.
+type responseLimits struct {
+	Bytes      int64
+	Series     int
+	DataPoints int64
+}
+
+// decodeLimited decodes a response set from r, stopping as soon as one of
+// the limits is exceeded.
+func decodeLimited(r io.Reader, l responseLimits) (ResponseSet, error) {
+	check := func(series int, dps int64) error {
+		switch {
+		case l.Series > 0 && series > l.Series:
+			return &ResultLimitError{Limit: "series", Max: int64(l.Series), Series: series, DataPoints: dps}
+		case l.DataPoints > 0 && dps > l.DataPoints:
+			return &ResultLimitError{Limit: "datapoints", Max: l.DataPoints, Series: series, DataPoints: dps}
+		}
+		return nil
+	}
+	lr := &io.LimitedReader{R: r, N: l.Bytes}
+	rs, err := decodeResponseSet(lr, check)
+	if le, ok := err.(*ResultLimitError); ok {
+		le.Partial = rs
+		return nil, err
+	}
+	if lr.N == 0 {
+		return nil, &ResponseTooLargeError{Limit: l.Bytes, BytesRead: l.Bytes - lr.N, Partial: rs}
+	}
+	return rs, err
+}
+
+// Retryable reports whether err is of a kind that may succeed if retried.
+func Retryable(err error) bool {
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrUnavailable)
+}
+
+// kindError wraps err with one of the error kinds.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// statusKind returns the error kind of an HTTP status code.
+func statusKind(code int) error {
+	switch {
+	case code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout:
+		return ErrTimeout
+	case code == http.StatusRequestEntityTooLarge:
+		return ErrTooLarge
+	case code >= 500:
+		return ErrUnavailable
+	case code >= 400:
+		return ErrBadQuery
+	}
+	return nil
+}
+
+// transportError classifies an error of http.Client.Do or of reading a
+// response body.
+func transportError(err error) error {
+	var ne net.Error
+	switch {
+	case err == nil || errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return &kindError{ErrTimeout, err}
+	}
+	return &kindError{ErrUnavailable, err}
+}
+
+// decodeError classifies an error of decoding a response body.
+func decodeError(err error) error {
+	var ne net.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &ne), errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return transportError(err)
+	}
+	return &kindError{ErrDecode, err}
+}
@@ -0,0 +1,160 @@
+package opentsdb
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestErrorKinds(t *testing.T) {
+	var mu sync.Mutex
+	status, body := http.StatusOK, `[]`
+	respond := func(s int, b string) {
+		mu.Lock()
+		status, body = s, b
+		mu.Unlock()
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("sleep") != "" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		mu.Lock()
+		s, b := status, body
+		mu.Unlock()
+		w.WriteHeader(s)
+		io.WriteString(w, b)
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL)
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	tests := []struct {
+		status    int
+		body      string
+		kind      error
+		retryable bool
+	}{
+		{http.StatusBadRequest, `{"error":{"code":400,"message":"No such name"}}`, ErrBadQuery, false},
+		{http.StatusRequestEntityTooLarge, `{"error":{"code":413,"message":"too many points"}}`, ErrTooLarge, false},
+		{http.StatusServiceUnavailable, `unavailable`, ErrUnavailable, true},
+		{http.StatusGatewayTimeout, ``, ErrTimeout, true},
+		{http.StatusOK, `[{"metric":`, ErrDecode, false},
+	}
+	for _, test := range tests {
+		respond(test.status, test.body)
+		_, err := c.Query(r)
+		if !errors.Is(err, test.kind) || Retryable(err) != test.retryable {
+			t.Errorf("status %d: got %v", test.status, err)
+		}
+	}
+
+	respond(http.StatusOK, `[]`)
+	slow, _ := NewClient(ts.URL+"/api/query?sleep=1", WithTimeout(10*time.Millisecond))
+	if _, err := slow.Query(r); !errors.Is(err, ErrTimeout) || !Retryable(err) {
+		t.Errorf("timeout: got %v", err)
+	}
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+	down, _ := NewClient(addr)
+	if _, err := down.Query(r); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("connection refused: got %v", err)
+	}
+
+	respond(http.StatusOK, strings.Repeat(" ", 100)+"[]")
+	lc := &LimitContext{Host: ts.URL, Limit: 10}
+	if _, err := lc.Query(r); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("limit: got %v", err)
+	}
+	if !errors.Is(&ValidationError{}, ErrBadQuery) || !errors.Is(&QueryTooExpensiveError{}, ErrTooLarge) {
+		t.Error("validation and guard errors are not classified")
+	}
+}
+
+func TestResponseTooLargePartial(t *testing.T) {
+	first := `{"metric":"a","tags":{},"aggregateTags":[],"dps":{"1":1}}`
+	body := "[" + first + "," + `{"metric":"b","tags":{},"aggregateTags":[],"dps":{"1":2,"2":3}}]`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	limit := int64(len(first) + 10)
+	lc := &LimitContext{Host: ts.URL, Limit: limit}
+	_, err := lc.Query(&Request{Start: "1h-ago", Queries: []*Query{{Metric: "a", Aggregator: "sum"}}})
+	var tl *ResponseTooLargeError
+	if !errors.As(err, &tl) || !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("got %v", err)
+	}
+	if tl.Limit != limit || tl.BytesRead != limit {
+		t.Errorf("limit %d, read %d", tl.Limit, tl.BytesRead)
+	}
+	if len(tl.Partial) != 1 || tl.Partial[0].Metric != "a" {
+		t.Errorf("partial: %v", tl.Partial)
+	}
+}
+
+func TestResultLimits(t *testing.T) {
+	body := `[{"metric":"a","tags":{},"aggregateTags":[],"dps":{"1":1,"2":2}},` +
+		`{"metric":"b","tags":{},"aggregateTags":[],"dps":{"1":2,"2":3}}]`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "a", Aggregator: "sum"}}}
+
+	tests := []struct {
+		series int
+		dps    int64
+		limit  string
+		count  int64
+	}{
+		{0, 0, "", 0},
+		{2, 4, "", 0},
+		{1, 0, "series", 2},
+		{0, 3, "datapoints", 4},
+	}
+	for _, test := range tests {
+		lc := &LimitContext{Host: ts.URL, Limit: 1 << 20, MaxSeries: test.series, MaxDataPoints: test.dps}
+		rs, err := lc.Query(r)
+		if test.limit == "" {
+			if err != nil || len(rs) != 2 {
+				t.Errorf("%d/%d: got %v, %v", test.series, test.dps, rs, err)
+			}
+			continue
+		}
+		var le *ResultLimitError
+		if !errors.As(err, &le) || !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("%d/%d: got %v", test.series, test.dps, err)
+		}
+		count := le.DataPoints
+		if le.Limit == "series" {
+			count = int64(le.Series)
+		}
+		if le.Limit != test.limit || count != test.count || len(le.Partial) != 1 {
+			t.Errorf("%d/%d: got %+v", test.series, test.dps, le)
+		}
+	}
+}
+
+func TestResultLimitsStopInSeries(t *testing.T) {
+	// decoding stops at the third point, before the malformed rest
+	body := `[{"metric":"a","dps":{"1":1,"2":NaN,"3":3,"4":}`
+	_, err := decodeLimited(strings.NewReader(body), responseLimits{Bytes: 1 << 20, DataPoints: 2})
+	var le *ResultLimitError
+	if !errors.As(err, &le) || le.Limit != "datapoints" || le.DataPoints != 3 || le.Series != 1 || len(le.Partial) != 0 {
+		t.Fatalf("got %v", err)
+	}
+
+	rs, err := decodeLimited(strings.NewReader(`[{"dps":{"1":1},"metric":"a","tags":{"h":"x"}}]`), responseLimits{Bytes: 1 << 20, DataPoints: 1})
+	if err != nil || len(rs) != 1 || rs[0].Metric != "a" || rs[0].Tags["h"] != "x" || rs[0].DPS[1] != 1 {
+		t.Errorf("got %v, %v", rs, err)
+	}
+}
@@ -0,0 +1,97 @@
+package opentsdb
+
+import "strings"
+
+// CardinalityFunc returns the number of time series a query reads.
+type CardinalityFunc func(q *Query) (int, error)
+
+// DPSEstimate is the estimated cost of a request in datapoints read.
+type DPSEstimate struct {
+	Total   int64
+	Queries []QueryDPSEstimate
+}
+
+// QueryDPSEstimate is the estimated cost of a single query.
+type QueryDPSEstimate struct {
+	Index     int
+	Series    int
+	PerSeries int64 // datapoints read per series
+	DPS       int64 // PerSeries * Series
+}
+
+// EstimateDPSWith estimates the datapoints read by r like EstimateDPS, but
+// multiplies the estimate of each query by the number of series it matches
+// as reported by card. A nil card assumes one series per query.
+func (r *Request) EstimateDPSWith(card CardinalityFunc) (*DPSEstimate, error) {
+	duration, err := r.GetDuration()
+	if err != nil {
+		return nil, err
+	}
+	d := duration.SecondsInt64()
+	est := &DPSEstimate{}
+	for i, q := range r.Queries {
+		qe := QueryDPSEstimate{Index: i, Series: 1, PerSeries: d}
+		if q.Downsample != "" {
+			ds, err := ParseDownsample(q.Downsample)
+			if err != nil {
+				return nil, err
+			}
+			qe.PerSeries = int64(float64(d) / ds.Seconds())
+		}
+		if card != nil {
+			if qe.Series, err = card(q); err != nil {
+				return nil, err
+			}
+		}
+		qe.DPS = qe.PerSeries * int64(qe.Series)
+		est.Total += qe.DPS
+		est.Queries = append(est.Queries, qe)
+	}
+	return est, nil
+}
+
+// StaticCardinality returns a CardinalityFunc reading the series count of a
+// query's metric from hint. Unknown metrics count as one series.
+func StaticCardinality(hint map[string]int) CardinalityFunc {
+	return func(q *Query) (int, error) {
+		if n, ok := hint[q.Metric]; ok {
+			return n, nil
+		}
+		return 1, nil
+	}
+}
+
+// LookupCardinality returns a CardinalityFunc counting the series matched by
+// a query with /api/search/lookup. Filters that lookup can't express are
+// applied to the returned series, reading at most limit of them.
+func LookupCardinality(c *Client, limit int) CardinalityFunc {
+	return func(q *Query) (int, error) {
+		lq := &LookupQuery{Metric: q.Metric, Limit: limit}
+		var post Filters
+		for _, f := range q.tagFilters() {
+			switch {
+			case f.Type == "literal_or" && !strings.Contains(f.Filter, "|"):
+				lq.Tags = append(lq.Tags, LookupTag{Key: f.TagK, Value: f.Filter})
+			case f.Type == "wildcard" && f.Filter == "*":
+				lq.Tags = append(lq.Tags, LookupTag{Key: f.TagK, Value: "*"})
+			default:
+				lq.Tags = append(lq.Tags, LookupTag{Key: f.TagK, Value: "*"})
+				post = append(post, f)
+			}
+		}
+		lr, err := c.Lookup(lq)
+		if err != nil {
+			return 0, err
+		}
+		if len(post) == 0 {
+			return lr.TotalResults, nil
+		}
+		n := 0
+		for _, res := range lr.Results {
+			if memMatch(res.Tags, post, false) {
+				n++
+			}
+		}
+		return n, nil
+	}
+}
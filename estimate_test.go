@@ -0,0 +1,46 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEstimateDPSWith(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var lq LookupQuery
+		json.NewDecoder(req.Body).Decode(&lq)
+		lr := LookupResponse{Metric: lq.Metric, TotalResults: 3, Results: []LookupResult{
+			{Metric: lq.Metric, Tags: TagSet{"host": "web1"}},
+			{Metric: lq.Metric, Tags: TagSet{"host": "web2"}},
+			{Metric: lq.Metric, Tags: TagSet{"host": "db1"}},
+		}}
+		json.NewEncoder(w).Encode(&lr)
+	}))
+	defer ts.Close()
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ParseRequest("start=2023/01/30-00:00:00&end=2023/01/30-01:00:00&m=sum:1m-avg:a{host=*}&m=sum:b{host=wildcard(web*)}", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	est, err := r.EstimateDPSWith(LookupCardinality(c, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Queries[0].DPS != 60*3 || est.Queries[1].DPS != 3600*2 || est.Total != 180+7200 {
+		t.Errorf("unexpected estimate %+v", est)
+	}
+
+	est, err = r.EstimateDPSWith(StaticCardinality(map[string]int{"a": 10}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.Total != 600+3600 {
+		t.Errorf("unexpected estimate %+v", est)
+	}
+}
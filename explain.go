@@ -0,0 +1,151 @@
+package opentsdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Plan describes how a request would be performed, as returned by
+// Request.Explain.
+type Plan struct {
+	Start    time.Time   `json:"start"`
+	End      time.Time   `json:"end"`
+	CacheKey string      `json:"cacheKey"`
+	DPS      int64       `json:"dps"` // estimated datapoints read
+	Queries  []QueryPlan `json:"queries"`
+}
+
+// QueryPlan describes a query of a Plan.
+type QueryPlan struct {
+	Index      int             `json:"index"`
+	Metric     string          `json:"metric"`
+	Aggregator string          `json:"aggregator"`
+	Downsample *DownsampleSpec `json:"downsample,omitempty"`
+	Rate       bool            `json:"rate,omitempty"`
+	// Filters are the filters in effect, legacy tags included.
+	Filters Filters  `json:"filters"`
+	GroupBy []string `json:"groupBy"`
+	Series  int      `json:"series"`
+	DPS     int64    `json:"dps"`
+	// Backend is the route chosen by the router of ExplainOptions, if any.
+	Backend string `json:"backend,omitempty"`
+}
+
+// ExplainOptions are the optional inputs of ExplainWith.
+type ExplainOptions struct {
+	// Now resolves relative times, the current time if zero.
+	Now time.Time
+	// Cardinality, if set, estimates the series of each query.
+	Cardinality CardinalityFunc
+	// Router, if set, is asked for the backend of each query.
+	Router *RouterContext
+}
+
+// Explain returns the plan of r for a target of version v.
+func (r *Request) Explain(v Version) (*Plan, error) {
+	return r.ExplainWith(v, ExplainOptions{})
+}
+
+// ExplainWith returns the plan of r for a target of version v, using opts.
+// The request is planned as normalized for v.
+func (r *Request) ExplainWith(v Version, opts ExplainOptions) (*Plan, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	c, _ := ConvertRequest(r, v)
+	start, end, err := c.timeRange(now)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.CanonicalKeyAt(now)
+	if err != nil {
+		return nil, err
+	}
+	est, err := c.EstimateDPSWith(opts.Cardinality)
+	if err != nil {
+		return nil, err
+	}
+	p := &Plan{Start: start, End: end, CacheKey: key, DPS: est.Total}
+	for i, q := range c.Queries {
+		qp := QueryPlan{
+			Index:      i,
+			Metric:     q.Metric,
+			Aggregator: q.Aggregator,
+			Rate:       q.Rate,
+			Filters:    q.tagFilters(),
+			GroupBy:    []string{},
+			Series:     est.Queries[i].Series,
+			DPS:        est.Queries[i].DPS,
+		}
+		if q.Downsample != "" {
+			ds, err := ParseDownsampleSpec(q.Downsample)
+			if err != nil {
+				return nil, err
+			}
+			qp.Downsample = &ds
+		}
+		for _, f := range qp.Filters {
+			if f.GroupBy {
+				qp.GroupBy = append(qp.GroupBy, f.TagK)
+			}
+		}
+		sort.Strings(qp.GroupBy)
+		if opts.Router != nil {
+			qp.Backend = opts.Router.routeName(q.Metric)
+		}
+		p.Queries = append(p.Queries, qp)
+	}
+	return p, nil
+}
+
+// String formats the plan as text.
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s to %s (%s), ~%d dps, key %s\n", p.Start.Format(time.RFC3339), p.End.Format(time.RFC3339), p.End.Sub(p.Start), p.DPS, p.CacheKey)
+	for _, q := range p.Queries {
+		fmt.Fprintf(&b, "query %d: %s %s", q.Index, q.Aggregator, q.Metric)
+		if q.Rate {
+			b.WriteString(" rate")
+		}
+		if q.Backend != "" {
+			fmt.Fprintf(&b, " on %s", q.Backend)
+		}
+		fmt.Fprintf(&b, ", %d series, ~%d dps\n", q.Series, q.DPS)
+		if ds := q.Downsample; ds != nil {
+			fmt.Fprintf(&b, "  downsample: %s %s", ds.Interval.SpanString(), ds.Aggregator)
+			if ds.Fill != "" {
+				fmt.Fprintf(&b, " fill %s", ds.Fill)
+			}
+			b.WriteByte('\n')
+		}
+		for _, f := range q.Filters {
+			fmt.Fprintf(&b, "  filter: %s", f)
+			if f.GroupBy {
+				b.WriteString(" group by")
+			}
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// routeName describes the route of metric: the rule it matches, default or
+// none.
+func (c *RouterContext) routeName(metric string) string {
+	for i, rule := range c.Rules {
+		if !rule.match(metric) {
+			continue
+		}
+		if rule.Pattern != nil {
+			return fmt.Sprintf("rule %d (%s)", i, rule.Pattern)
+		}
+		return fmt.Sprintf("rule %d (%s*)", i, rule.Prefix)
+	}
+	if c.Default == nil {
+		return "none"
+	}
+	return "default"
+}
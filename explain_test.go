@@ -0,0 +1,49 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplain(t *testing.T) {
+	r, err := ParseRequest("start=1h-ago&m=sum:1m-avg:os.cpu{host=*,dc=lga}&m=max:rate:app.req", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0).UTC()
+	router := &RouterContext{Rules: []RouteRule{{Prefix: "os.", Context: &captureContext{}}}}
+	p, err := r.ExplainWith(Version2_2, ExplainOptions{Now: now, Cardinality: StaticCardinality(map[string]int{"os.cpu": 10}), Router: router})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.End.Equal(now) || p.End.Sub(p.Start) != time.Hour {
+		t.Errorf("got range %v to %v", p.Start, p.End)
+	}
+	if want, _ := r.CanonicalKeyAt(now); p.CacheKey != want {
+		t.Errorf("got key %s, want %s", p.CacheKey, want)
+	}
+	q := p.Queries[0]
+	if q.Downsample == nil || q.Downsample.Aggregator != "avg" || q.Series != 10 || q.DPS != 600 {
+		t.Errorf("got %+v", q)
+	}
+	if !reflect.DeepEqual(q.GroupBy, []string{"dc", "host"}) || len(q.Filters) != 2 {
+		t.Errorf("got group by %v filters %v", q.GroupBy, q.Filters)
+	}
+	if q.Backend != "rule 0 (os.*)" || p.Queries[1].Backend != "none" || !p.Queries[1].Rate {
+		t.Errorf("got %+v", p.Queries)
+	}
+	if p.DPS != 600+3600 {
+		t.Errorf("got %d dps", p.DPS)
+	}
+	if s := p.String(); !strings.Contains(s, "query 0: sum os.cpu on rule 0 (os.*), 10 series") || !strings.Contains(s, "filter: host=wildcard(*) group by") {
+		t.Errorf("got\n%s", s)
+	}
+	b, _ := json.Marshal(p)
+	var back Plan
+	if err := json.Unmarshal(b, &back); err != nil || !reflect.DeepEqual(&back, p) {
+		t.Errorf("round trip: %v\n%s", err, b)
+	}
+}
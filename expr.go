@@ -0,0 +1,375 @@
+package opentsdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression is an arithmetic expression over named series sets, such as
+// errors/requests*100. It supports + - * /, unary minus, parentheses and
+// numeric constants.
+//
+// Series of two sets are joined when they have the same values for the tags
+// they have in common, and their points are combined at the timestamps
+// present in both.
+type Expression struct {
+	src  string
+	root exprNode
+}
+
+// EvalOptions tune Expression.Eval.
+type EvalOptions struct {
+	// Interval, if set, aligns every input series to a grid with
+	// DPmap.Fill before evaluation.
+	Interval Duration
+	// Fill is the fill policy used for alignment, linear by default.
+	Fill FillPolicy
+	// DropNaN leaves NaN and infinite results out of the output.
+	DropNaN bool
+}
+
+// ParseExpression parses s.
+func ParseExpression(s string) (*Expression, error) {
+	p := &exprParser{src: s}
+	p.next()
+	root, err := p.expr()
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %q", p.tok.text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{src: s, root: root}, nil
+}
+
+func (e *Expression) String() string { return e.src }
+
+// Vars returns the sorted names of the series sets e refers to.
+func (e *Expression) Vars() []string {
+	seen := map[string]bool{}
+	var walk func(n exprNode)
+	walk = func(n exprNode) {
+		switch n := n.(type) {
+		case exprVar:
+			seen[string(n)] = true
+		case exprBinary:
+			walk(n.l)
+			walk(n.r)
+		case exprNeg:
+			walk(n.x)
+		}
+	}
+	walk(e.root)
+	vars := make([]string, 0, len(seen))
+	for v := range seen {
+		vars = append(vars, v)
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+// Eval computes e over sets. The metric of the resulting responses is the
+// expression itself.
+func (e *Expression) Eval(sets map[string]ResponseSet, opts EvalOptions) (ResponseSet, error) {
+	if opts.Interval > 0 {
+		fill := opts.Fill
+		if fill == "" {
+			fill = FillLinear
+		}
+		aligned := make(map[string]ResponseSet, len(sets))
+		for name, rs := range sets {
+			out := make(ResponseSet, len(rs))
+			for i, r := range rs {
+				dps, err := r.DPS.Fill(opts.Interval, fill)
+				if err != nil {
+					return nil, err
+				}
+				c := *r
+				c.DPS = dps
+				out[i] = &c
+			}
+			aligned[name] = out
+		}
+		sets = aligned
+	}
+	v, err := e.root.eval(sets)
+	if err != nil {
+		return nil, err
+	}
+	if !v.isSet {
+		return nil, errors.New("opentsdb: expression has no series")
+	}
+	// a bare variable evaluates to the caller's responses
+	out := make(ResponseSet, len(v.set))
+	for i, r := range v.set {
+		r = r.Copy()
+		r.Metric = e.src
+		r.rekey()
+		if opts.DropNaN {
+			for t, p := range r.DPS {
+				if math.IsNaN(float64(p)) || math.IsInf(float64(p), 0) {
+					delete(r.DPS, t)
+				}
+			}
+		}
+		out[i] = r
+	}
+	return out, nil
+}
+
+type exprValue struct {
+	scalar Point
+	set    ResponseSet
+	isSet  bool
+}
+
+type exprNode interface {
+	eval(sets map[string]ResponseSet) (exprValue, error)
+}
+
+type (
+	exprNum    Point
+	exprVar    string
+	exprNeg    struct{ x exprNode }
+	exprBinary struct {
+		op   byte
+		l, r exprNode
+	}
+)
+
+func (n exprNum) eval(map[string]ResponseSet) (exprValue, error) {
+	return exprValue{scalar: Point(n)}, nil
+}
+
+func (n exprVar) eval(sets map[string]ResponseSet) (exprValue, error) {
+	rs, ok := sets[string(n)]
+	if !ok {
+		return exprValue{}, fmt.Errorf("opentsdb: unknown series set %q", string(n))
+	}
+	return exprValue{set: rs, isSet: true}, nil
+}
+
+func (n exprNeg) eval(sets map[string]ResponseSet) (exprValue, error) {
+	return exprBinary{op: '*', l: exprNum(-1), r: n.x}.eval(sets)
+}
+
+func (n exprBinary) eval(sets map[string]ResponseSet) (exprValue, error) {
+	l, err := n.l.eval(sets)
+	if err != nil {
+		return l, err
+	}
+	r, err := n.r.eval(sets)
+	if err != nil {
+		return r, err
+	}
+	apply := func(a, b Point) Point { return exprOp(n.op, a, b) }
+	switch {
+	case !l.isSet && !r.isSet:
+		return exprValue{scalar: apply(l.scalar, r.scalar)}, nil
+	case !r.isSet:
+		return exprValue{set: mapSet(l.set, func(p Point) Point { return apply(p, r.scalar) }), isSet: true}, nil
+	case !l.isSet:
+		return exprValue{set: mapSet(r.set, func(p Point) Point { return apply(l.scalar, p) }), isSet: true}, nil
+	}
+	out := ResponseSet{}
+	for _, a := range l.set {
+		for _, b := range r.set {
+			if !a.Tags.Compatible(b.Tags) {
+				continue
+			}
+			dps := DPmap{}
+			for t, av := range a.DPS {
+				if bv, ok := b.DPS[t]; ok {
+					dps[t] = apply(av, bv)
+				}
+			}
+			out = append(out, &Response{
+				Metric:        a.Metric,
+				Tags:          a.Tags.Copy().Merge(b.Tags),
+				AggregateTags: unionStrings(a.AggregateTags, b.AggregateTags),
+				DPS:           dps,
+			})
+		}
+	}
+	return exprValue{set: out, isSet: true}, nil
+}
+
+// exprOp applies op to a and b. Division by zero is NaN.
+func exprOp(op byte, a, b Point) Point {
+	switch op {
+	case '+':
+		return a + b
+	case '-':
+		return a - b
+	case '*':
+		return a * b
+	default:
+		if b == 0 {
+			return Point(math.NaN())
+		}
+		return a / b
+	}
+}
+
+func mapSet(rs ResponseSet, f func(Point) Point) ResponseSet {
+	out := make(ResponseSet, len(rs))
+	for i, r := range rs {
+		dps := make(DPmap, len(r.DPS))
+		for t, v := range r.DPS {
+			dps[t] = f(v)
+		}
+		out[i] = &Response{Metric: r.Metric, Tags: r.Tags.Copy(), AggregateTags: append([]string{}, r.AggregateTags...), DPS: dps}
+	}
+	return out
+}
+
+func unionStrings(a, b []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+const (
+	tokEOF = iota
+	tokNum
+	tokName
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	src string
+	pos int
+	tok exprToken
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("opentsdb: expression %q at %d: %s", p.src, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = exprToken{kind: tokEOF, pos: start}
+		return
+	}
+	c := rune(p.src[p.pos])
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			if c >= '0' && c <= '9' || c == '.' {
+				p.pos++
+			} else if (c == 'e' || c == 'E') && p.pos+1 < len(p.src) {
+				p.pos++
+				if p.src[p.pos] == '+' || p.src[p.pos] == '-' {
+					p.pos++
+				}
+			} else {
+				break
+			}
+		}
+		p.tok = exprToken{kind: tokNum, text: p.src[start:p.pos], pos: start}
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.src) {
+			c := rune(p.src[p.pos])
+			if !(unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '.') {
+				break
+			}
+			p.pos++
+		}
+		p.tok = exprToken{kind: tokName, text: p.src[start:p.pos], pos: start}
+	default:
+		p.pos++
+		p.tok = exprToken{kind: tokOp, text: p.src[start:p.pos], pos: start}
+	}
+}
+
+func (p *exprParser) isOp(ops string) bool {
+	return p.tok.kind == tokOp && strings.IndexByte(ops, p.tok.text[0]) >= 0
+}
+
+func (p *exprParser) expr() (exprNode, error) {
+	l, err := p.term()
+	for err == nil && p.isOp("+-") {
+		op := p.tok.text[0]
+		p.next()
+		var r exprNode
+		if r, err = p.term(); err == nil {
+			l = exprBinary{op: op, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *exprParser) term() (exprNode, error) {
+	l, err := p.unary()
+	for err == nil && p.isOp("*/") {
+		op := p.tok.text[0]
+		p.next()
+		var r exprNode
+		if r, err = p.unary(); err == nil {
+			l = exprBinary{op: op, l: l, r: r}
+		}
+	}
+	return l, err
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if p.isOp("-") {
+		p.next()
+		x, err := p.unary()
+		return exprNeg{x}, err
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	switch tok := p.tok; tok.kind {
+	case tokNum:
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		p.next()
+		return exprNum(v), nil
+	case tokName:
+		p.next()
+		return exprVar(tok.text), nil
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			n, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOp(")") {
+				return nil, p.errorf("missing )")
+			}
+			p.next()
+			return n, nil
+		}
+		return nil, p.errorf("unexpected %q", tok.text)
+	}
+	return nil, p.errorf("unexpected end of expression")
+}
@@ -0,0 +1,86 @@
+package opentsdb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpression(t *testing.T) {
+	sets := map[string]ResponseSet{
+		"errors": {
+			{Metric: "http.errors", Tags: TagSet{"host": "a"}, DPS: DPmap{60: 1, 120: 2, 180: 0}},
+			{Metric: "http.errors", Tags: TagSet{"host": "b"}, DPS: DPmap{60: 5}},
+		},
+		"requests": {
+			{Metric: "http.requests", Tags: TagSet{"host": "a", "dc": "x"}, DPS: DPmap{60: 10, 120: 0, 180: 4}},
+			{Metric: "http.requests", Tags: TagSet{"host": "c", "dc": "x"}, DPS: DPmap{60: 10}},
+		},
+	}
+	e, err := ParseExpression("errors / requests * 100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars := e.Vars(); len(vars) != 2 || vars[0] != "errors" {
+		t.Errorf("got vars %v", vars)
+	}
+	rs, err := e.Eval(sets, EvalOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 {
+		t.Fatalf("expected one joined series, got %d", len(rs))
+	}
+	r := rs[0]
+	if r.Metric != "errors / requests * 100" || !r.Tags.Equal(TagSet{"host": "a", "dc": "x"}) {
+		t.Errorf("unexpected series %s%s", r.Metric, r.Tags)
+	}
+	if r.DPS[60] != 10 || !math.IsNaN(float64(r.DPS[120])) || r.DPS[180] != 0 {
+		t.Errorf("unexpected points %v", r.DPS)
+	}
+
+	rs, _ = e.Eval(sets, EvalOptions{DropNaN: true})
+	if _, ok := rs[0].DPS[120]; ok {
+		t.Error("NaN was not dropped")
+	}
+
+	e, _ = ParseExpression("-(errors + 1) * 2")
+	rs, err = e.Eval(sets, EvalOptions{})
+	if err != nil || len(rs) != 2 || rs[0].DPS[60] != -4 {
+		t.Errorf("got %v, %v", rs, err)
+	}
+
+	e, _ = ParseExpression("errors")
+	sets["errors"][1].DPS[120] = Point(math.NaN())
+	rs, err = e.Eval(sets, EvalOptions{DropNaN: true})
+	if err != nil || rs[0].Metric != "errors" || len(rs[1].DPS) != 1 {
+		t.Errorf("bare variable: got %v, %v", rs, err)
+	}
+	if in := sets["errors"][1]; in.Metric != "http.errors" || len(in.DPS) != 2 {
+		t.Errorf("bare variable modified its input: %+v", in)
+	}
+
+	for _, bad := range []string{"", "a +", "(a", "a b", "1 + 2", "1.2.3"} {
+		e, err := ParseExpression(bad)
+		if err == nil {
+			_, err = e.Eval(sets, EvalOptions{})
+		}
+		if err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestExpressionAlign(t *testing.T) {
+	sets := map[string]ResponseSet{
+		"a": {{Metric: "a", DPS: DPmap{0: 1, 60: 1}}},
+		"b": {{Metric: "b", DPS: DPmap{30: 1, 90: 3}}},
+	}
+	e, _ := ParseExpression("a + b")
+	rs, err := e.Eval(sets, EvalOptions{Interval: Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs[0].DPS[60] != 3 {
+		t.Errorf("got %v", rs[0].DPS)
+	}
+}
@@ -0,0 +1,115 @@
+package opentsdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FailoverContext sends queries to a primary context and only falls back to
+// the secondaries, in order, when it fails. Once a secondary answers, it
+// keeps receiving queries until FailBack has elapsed, after which the
+// primary is tried first again.
+type FailoverContext struct {
+	// Contexts holds the primary followed by the secondaries.
+	Contexts []Context
+	// Timeout, if positive, abandons a context that takes longer to answer
+	// and moves on to the next one.
+	Timeout time.Duration
+	// FailBack is how long queries stick to a secondary. Zero never fails
+	// back.
+	FailBack time.Duration
+
+	mu     sync.Mutex
+	active int
+	since  time.Time
+}
+
+// NewFailoverContext returns a FailoverContext with primary and secondaries,
+// failing back to the primary after a minute.
+func NewFailoverContext(primary Context, secondaries ...Context) *FailoverContext {
+	return &FailoverContext{
+		Contexts: append([]Context{primary}, secondaries...),
+		FailBack: time.Minute,
+	}
+}
+
+// Active returns the index in Contexts of the context queried first.
+func (c *FailoverContext) Active() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.active > 0 && c.FailBack > 0 && time.Since(c.since) >= c.FailBack {
+		c.active = 0
+	}
+	return c.active
+}
+
+func (c *FailoverContext) Version() Version {
+	if len(c.Contexts) == 0 {
+		return Version2_1
+	}
+	return c.Contexts[c.Active()].Version()
+}
+
+// Query tries the active context, then the following ones, wrapping
+// around to the primary. Invalid queries are not retried, since they would
+// fail everywhere. If all contexts fail, the error of each is returned.
+func (c *FailoverContext) Query(r *Request) (ResponseSet, error) {
+	if len(c.Contexts) == 0 {
+		return nil, errors.New("opentsdb: no contexts to query")
+	}
+	start := c.Active()
+	var errs []error
+	for n := 0; n < len(c.Contexts); n++ {
+		i := (start + n) % len(c.Contexts)
+		rs, err := c.query(c.Contexts[i], r)
+		if err == nil {
+			c.activate(i)
+			return rs, nil
+		}
+		if errors.Is(err, ErrBadQuery) {
+			return nil, err
+		}
+		errs = append(errs, fmt.Errorf("context %d: %w", i, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (c *FailoverContext) activate(i int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if i != c.active {
+		c.active = i
+		c.since = time.Now()
+	}
+}
+
+// query queries ctx, giving up after Timeout. A request given up on is
+// cancelled through its context.
+func (c *FailoverContext) query(ctx Context, r *Request) (ResponseSet, error) {
+	if c.Timeout <= 0 {
+		return ctx.Query(r)
+	}
+	type result struct {
+		rs  ResponseSet
+		err error
+	}
+	rctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	r = r.WithContext(rctx)
+	done := make(chan result, 1)
+	go func() {
+		rs, err := ctx.Query(r)
+		done <- result{rs, err}
+	}()
+	t := time.NewTimer(c.Timeout)
+	defer t.Stop()
+	select {
+	case res := <-done:
+		return res.rs, res.err
+	case <-t.C:
+		return nil, &kindError{ErrTimeout, fmt.Errorf("no response after %v", c.Timeout)}
+	}
+}
@@ -0,0 +1,78 @@
+package opentsdb
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// funcContext answers queries with f.
+type funcContext func(*Request) (ResponseSet, error)
+
+func (f funcContext) Query(r *Request) (ResponseSet, error) { return f(r) }
+func (f funcContext) Version() Version                      { return Version2_4 }
+
+func TestFailoverContext(t *testing.T) {
+	var primaryDown, always atomic.Bool
+	always.Store(true)
+	var calls [3]atomic.Int64
+	count := func() []int64 {
+		return []int64{calls[0].Load(), calls[1].Load(), calls[2].Load()}
+	}
+	host := func(i int, fail *atomic.Bool) Context {
+		return funcContext(func(*Request) (ResponseSet, error) {
+			calls[i].Add(1)
+			if fail != nil && fail.Load() {
+				return nil, ErrUnavailable
+			}
+			return ResponseSet{{Metric: "m"}}, nil
+		})
+	}
+	cancelled := make(chan error, 1)
+	slow := funcContext(func(r *Request) (ResponseSet, error) {
+		calls[1].Add(1)
+		select {
+		case <-r.Context().Done():
+			cancelled <- r.Context().Err()
+		case <-time.After(time.Second):
+			cancelled <- nil
+		}
+		return nil, nil
+	})
+	c := NewFailoverContext(host(0, &primaryDown), slow, host(2, nil))
+	c.Timeout = 10 * time.Millisecond
+	c.FailBack = 50 * time.Millisecond
+	r := &Request{}
+
+	if _, err := c.Query(r); err != nil || calls[0].Load() != 1 || c.Active() != 0 {
+		t.Fatalf("primary: %v, calls %v", err, count())
+	}
+	primaryDown.Store(true)
+	if _, err := c.Query(r); err != nil || c.Active() != 2 || calls[1].Load() != 1 {
+		t.Fatalf("failover: %v, calls %v, active %d", err, count(), c.Active())
+	}
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("abandoned query not cancelled: %v", err)
+	}
+	c.Query(r)
+	if calls[0].Load() != 2 || calls[2].Load() != 2 {
+		t.Errorf("not sticky: calls %v", count())
+	}
+
+	primaryDown.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.Query(r); err != nil || calls[0].Load() != 3 || c.Active() != 0 {
+		t.Errorf("fail back: %v, calls %v", err, count())
+	}
+
+	down := NewFailoverContext(host(0, &always), host(2, &always))
+	if _, err := down.Query(r); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("all down: got %v", err)
+	}
+	bad := NewFailoverContext(funcContext(func(*Request) (ResponseSet, error) { return nil, ErrBadQuery }), host(2, nil))
+	if _, err := bad.Query(r); !errors.Is(err, ErrBadQuery) {
+		t.Errorf("bad query: got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package opentsdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// FillPolicy says how DPmap.Fill computes the value of grid timestamps
+// that have no datapoint.
+type FillPolicy string
+
+const (
+	FillNone     FillPolicy = "none"     // leave the timestamp out
+	FillZero     FillPolicy = "zero"     // 0
+	FillNaN      FillPolicy = "nan"      // NaN
+	FillNull     FillPolicy = "null"     // NaN, which Point can't tell from null
+	FillPrevious FillPolicy = "previous" // the last value before it
+	FillLinear   FillPolicy = "linear"   // interpolated from its neighbours
+)
+
+// Fill returns the points of dps on a grid of interval steps aligned to
+// multiples of interval, from the first to the last timestamp of dps.
+// Datapoints on the grid are kept, the other grid timestamps are filled
+// according to policy and datapoints off the grid are dropped. Previous and
+// linear use the dropped datapoints, so they are the policies to use when
+// realigning series with a different phase. Timestamps above 2^32 are
+// taken to be in milliseconds.
+func (dps DPmap) Fill(interval Duration, policy FillPolicy) (DPmap, error) {
+	if err := policy.check(); err != nil {
+		return nil, err
+	}
+	out := DPmap{}
+	times := dps.GetSortedTimes()
+	if len(times) == 0 {
+		return out, nil
+	}
+	step := epochSpan(times, interval)
+	if step < 1 {
+		return nil, errors.New("opentsdb: fill interval too small")
+	}
+
+	for t := floorEpoch(times[0], step); t <= times[len(times)-1]; t += step {
+		if v, ok := dps.fillAt(times, t, policy); ok {
+			out[t] = v
+		}
+	}
+	return out, nil
+}
+
+func (p FillPolicy) check() error {
+	switch p {
+	case FillNone, FillZero, FillNaN, FillNull, FillPrevious, FillLinear:
+		return nil
+	}
+	return fmt.Errorf("opentsdb: unknown fill policy %q", p)
+}
+
+// fillAt returns the value of dps at t, filled according to policy if dps
+// has no datapoint at t, and whether there is one. times are the sorted
+// timestamps of dps.
+func (dps DPmap) fillAt(times []Epoch, t Epoch, policy FillPolicy) (Point, bool) {
+	if v, ok := dps[t]; ok {
+		return v, true
+	}
+	// index of the first datapoint after t
+	i := sort.Search(len(times), func(i int) bool { return times[i] > t })
+	switch policy {
+	case FillZero:
+		return 0, true
+	case FillNaN, FillNull:
+		return Point(math.NaN()), true
+	case FillPrevious:
+		if i > 0 {
+			return dps[times[i-1]], true
+		}
+	case FillLinear:
+		if i > 0 && i < len(times) {
+			t0, t1 := times[i-1], times[i]
+			v0, v1 := dps[t0], dps[t1]
+			return v0 + (v1-v0)*Point(t-t0)/Point(t1-t0), true
+		}
+	}
+	return 0, false
+}
+
+// Align returns copies of the responses of rs with points at the same
+// timestamps, the multiples of step from start to end, as charting
+// libraries require. Points are filled according to fill, as DPmap.Fill
+// does; grid timestamps left unfilled, all of them with FillNone, are NaN.
+// start, end and the timestamps of rs must be in the same unit, seconds,
+// or milliseconds if end is above 2^32.
+func (rs ResponseSet) Align(start, end Epoch, step Duration, fill FillPolicy) (ResponseSet, error) {
+	if err := fill.check(); err != nil {
+		return nil, err
+	}
+	s := epochSpan([]Epoch{end}, step)
+	if s < 1 {
+		return nil, errors.New("opentsdb: align step too small")
+	}
+	first := floorEpoch(start, s)
+	out := make(ResponseSet, len(rs))
+	for i, resp := range rs {
+		times := resp.DPS.GetSortedTimes()
+		dps := DPmap{}
+		for t := first; t <= end; t += s {
+			v, ok := resp.DPS.fillAt(times, t, fill)
+			if !ok {
+				v = Point(math.NaN())
+			}
+			dps[t] = v
+		}
+		c := *resp
+		c.DPS = dps
+		out[i] = &c
+	}
+	return out, nil
+}
+
+// epochSpan converts d to the unit of times, which are taken to be in
+// milliseconds if the last one is above 2^32.
+func epochSpan(times []Epoch, d Duration) Epoch {
+	if len(times) > 0 && times[len(times)-1] > 0xffffffff {
+		return Epoch(d / Millisecond)
+	}
+	return Epoch(d.SecondsInt64())
+}
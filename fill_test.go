@@ -0,0 +1,78 @@
+package opentsdb
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDPmapFill(t *testing.T) {
+	dps := DPmap{60: 1, 150: 4, 300: 5}
+	tests := []struct {
+		policy FillPolicy
+		want   DPmap
+	}{
+		{FillNone, DPmap{60: 1, 300: 5}},
+		{FillZero, DPmap{60: 1, 120: 0, 180: 0, 240: 0, 300: 5}},
+		{FillPrevious, DPmap{60: 1, 120: 1, 180: 4, 240: 4, 300: 5}},
+		{FillLinear, DPmap{60: 1, 120: 3, 180: 4.2, 240: 4.6, 300: 5}},
+	}
+	for _, test := range tests {
+		got, err := dps.Fill(Minute, test.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.policy, got, test.want)
+			continue
+		}
+		for k, v := range test.want {
+			if math.Abs(float64(got[k]-v)) > 1e-9 {
+				t.Errorf("%s: got %v, want %v", test.policy, got, test.want)
+				break
+			}
+		}
+	}
+
+	got, _ := dps.Fill(Minute, FillNaN)
+	if !math.IsNaN(float64(got[120])) {
+		t.Errorf("nan: got %v", got)
+	}
+	ms, _ := DPmap{1600000000000: 1, 1600000002000: 3}.Fill(Second, FillLinear)
+	if ms[1600000001000] != 2 {
+		t.Errorf("ms: got %v", ms)
+	}
+	if _, err := dps.Fill(Minute, "bogus"); err == nil {
+		t.Error("expected unknown policy error")
+	}
+}
+
+func TestResponseSetAlign(t *testing.T) {
+	rs := ResponseSet{
+		{Metric: "a", DPS: DPmap{60: 1, 120: 2, 240: 4}},
+		{Metric: "b", DPS: DPmap{130: 5}},
+	}
+	out, err := rs.Align(50, 250, Duration(time.Minute), FillPrevious)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid := []Epoch{0, 60, 120, 180, 240}
+	want := [][]float64{{math.NaN(), 1, 2, 2, 4}, {math.NaN(), math.NaN(), math.NaN(), 5, 5}}
+	for i, resp := range out {
+		if resp.Metric != rs[i].Metric || len(resp.DPS) != len(grid) {
+			t.Fatalf("%s: got %v", resp.Metric, resp.DPS)
+		}
+		for j, ts := range grid {
+			v, w := float64(resp.DPS[ts]), want[i][j]
+			if v != w && !(math.IsNaN(v) && math.IsNaN(w)) {
+				t.Errorf("%s at %d: got %v, want %v", resp.Metric, ts, v, w)
+			}
+		}
+	}
+	if len(rs[0].DPS) != 3 {
+		t.Error("input modified")
+	}
+	if _, err := rs.Align(0, 100, Duration(time.Minute), "bogus"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,146 @@
+package opentsdb
+
+import (
+	"container/list"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// matchFilter reports whether tag value v satisfies f, following the
+// semantics of the OpenTSDB 2.2+ filter types.
+func matchFilter(f Filter, v string) bool {
+	switch f.Type {
+	case "literal_or":
+		return matchLiteral(f.Filter, v, false)
+	case "iliteral_or":
+		return matchLiteral(f.Filter, v, true)
+	case "not_literal_or":
+		return !matchLiteral(f.Filter, v, false)
+	case "not_iliteral_or":
+		return !matchLiteral(f.Filter, v, true)
+	case "wildcard":
+		return matchWildcard(f.Filter, v)
+	case "iwildcard":
+		return matchWildcard(strings.ToLower(f.Filter), strings.ToLower(v))
+	case "regexp":
+		re, err := compileFilterRegexp(f.Filter)
+		return err == nil && re.MatchString(v)
+	}
+	return false
+}
+
+// maxFilterRegexps is the number of compiled filter regexps kept.
+const maxFilterRegexps = 1024
+
+// filterRegexps caches compiled filter regexps, evicting the least recently
+// used beyond maxFilterRegexps.
+var filterRegexps = struct {
+	sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List // of *filterRegexp, most recent first
+}{entries: map[string]*list.Element{}}
+
+type filterRegexp struct {
+	expr string
+	re   *regexp.Regexp
+}
+
+// compileFilterRegexp compiles the regexp of a filter, caching it since the
+// same filters are matched against many series.
+func compileFilterRegexp(expr string) (*regexp.Regexp, error) {
+	c := &filterRegexps
+	c.Lock()
+	if el, ok := c.entries[expr]; ok {
+		c.lru.MoveToFront(el)
+		c.Unlock()
+		return el.Value.(*filterRegexp).re, nil
+	}
+	c.Unlock()
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[expr]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*filterRegexp).re, nil
+	}
+	c.entries[expr] = c.lru.PushFront(&filterRegexp{expr, re})
+	for c.lru.Len() > maxFilterRegexps {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*filterRegexp).expr)
+	}
+	return re, nil
+}
+
+// Matches reports whether t satisfies f as OpenTSDB evaluates it: t must
+// have the tag key of f, whatever its type, and a value matching it.
+func (t TagSet) Matches(f Filter) bool {
+	v, ok := t[f.TagK]
+	return ok && matchFilter(f, v)
+}
+
+// Match reports whether ts satisfies every filter of f.
+func (f Filters) Match(ts TagSet) bool {
+	for _, filter := range f {
+		if !ts.Matches(filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchLiteral(filter, v string, fold bool) bool {
+	for _, s := range strings.Split(filter, "|") {
+		if s == v || fold && strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard matches v against filter where * matches any run of
+// characters, the only wildcard OpenTSDB supports.
+func matchWildcard(filter, v string) bool {
+	parts := strings.Split(filter, "*")
+	if len(parts) == 1 {
+		return filter == v
+	}
+	if !strings.HasPrefix(v, parts[0]) {
+		return false
+	}
+	v = v[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(v, p)
+		if i < 0 {
+			return false
+		}
+		v = v[i+len(p):]
+	}
+	return len(v) >= len(last) && strings.HasSuffix(v, last)
+}
+
+// tagFilters returns the filters of q, with the legacy tags converted into
+// group by filters the way OpenTSDB does.
+func (q *Query) tagFilters() Filters {
+	filters := make(Filters, 0, len(q.Tags)+len(q.Filters))
+	keys := make([]string, 0, len(q.Tags))
+	for k := range q.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := q.Tags[k]
+		f := Filter{Type: "literal_or", TagK: k, Filter: v, GroupBy: true}
+		if strings.Contains(v, "*") {
+			f.Type = "wildcard"
+		}
+		filters = append(filters, f)
+	}
+	return append(filters, q.Filters...)
+}
@@ -0,0 +1,82 @@
+package opentsdb
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	ts := TagSet{"host": "Web01", "dc": "lga"}
+	tests := []struct {
+		f    Filter
+		want bool
+	}{
+		{Filter{Type: "literal_or", TagK: "host", Filter: "db01|Web01"}, true},
+		{Filter{Type: "literal_or", TagK: "host", Filter: "web01"}, false},
+		{Filter{Type: "iliteral_or", TagK: "host", Filter: "web01"}, true},
+		{Filter{Type: "not_literal_or", TagK: "host", Filter: "web01"}, true},
+		{Filter{Type: "not_literal_or", TagK: "app", Filter: "x"}, false},
+		{Filter{Type: "not_iliteral_or", TagK: "host", Filter: "web01"}, false},
+		{Filter{Type: "wildcard", TagK: "host", Filter: "W*1"}, true},
+		{Filter{Type: "wildcard", TagK: "host", Filter: "w*"}, false},
+		{Filter{Type: "iwildcard", TagK: "host", Filter: "w*"}, true},
+		{Filter{Type: "wildcard", TagK: "dc", Filter: "*"}, true},
+		{Filter{Type: "regexp", TagK: "dc", Filter: "^l.a$"}, true},
+		{Filter{Type: "regexp", TagK: "dc", Filter: "("}, false},
+		{Filter{Type: "unknown", TagK: "dc", Filter: "lga"}, false},
+	}
+	for _, test := range tests {
+		if got := ts.Matches(test.f); got != test.want {
+			t.Errorf("%v: got %v", test.f, got)
+		}
+	}
+	fs := Filters{tests[0].f, tests[10].f}
+	if !fs.Match(ts) || (Filters{tests[0].f, tests[1].f}).Match(ts) || !(Filters{}).Match(ts) {
+		t.Error("Filters.Match does not require every filter")
+	}
+}
+
+func TestFilterTagsQueries(t *testing.T) {
+	r := &Request{Queries: []*Query{
+		{Metric: "cpu", Filters: Filters{{Type: "wildcard", TagK: "host", Filter: "*", GroupBy: true}, {Type: "literal_or", TagK: "dc", Filter: "east"}}},
+		{Metric: "cpu", ExplicitTags: true, Filters: Filters{{Type: "regexp", TagK: "env", Filter: ".*"}}},
+		{Metric: "mem", Tags: TagSet{"role": "*"}},
+	}}
+	tags := func() TagSet { return TagSet{"host": "a", "dc": "east", "env": "prod", "role": "web"} }
+	rs := ResponseSet{
+		{Metric: "cpu", Tags: tags(), Query: Query{Metric: "cpu", Index: 0}},
+		{Metric: "cpu", Tags: tags(), Query: Query{Metric: "cpu", Index: 1}},
+		{Metric: "mem", Tags: tags()},
+		{Metric: "cpu", Tags: tags()},
+	}
+	r.ShowQuery = true
+	FilterTags(r, rs)
+	for i, want := range []TagSet{
+		{"host": "a", "dc": "east"},
+		{"env": "prod"},
+		{"role": "web"},
+		tags(), // can't tell which cpu query
+	} {
+		if !reflect.DeepEqual(rs[i].Tags, want) {
+			t.Errorf("response %d: got %v, want %v", i, rs[i].Tags, want)
+		}
+	}
+}
+
+func TestFilterRegexpCache(t *testing.T) {
+	for i := 0; i < maxFilterRegexps+10; i++ {
+		if _, err := compileFilterRegexp(fmt.Sprintf("^web%d$", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filterRegexps.Lock()
+	n := len(filterRegexps.entries)
+	filterRegexps.Unlock()
+	if n != maxFilterRegexps {
+		t.Errorf("cached %d regexps, want %d", n, maxFilterRegexps)
+	}
+	if !matchFilter(Filter{Type: "regexp", Filter: "^web0$"}, "web0") {
+		t.Error("evicted regexp no longer matches")
+	}
+}
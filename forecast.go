@@ -0,0 +1,224 @@
+package opentsdb
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Forecast is a predicted continuation of a series with a confidence band
+// around it.
+type Forecast struct {
+	Predicted, Lower, Upper DPmap
+}
+
+// ForecastOptions tune the forecasts of a DPmap. The series is assumed to
+// be regular, such as a downsampled one; points are predicted at its
+// median interval after its last point.
+type ForecastOptions struct {
+	// Horizon is how far past the last point to predict.
+	Horizon Duration
+	// Z is the half width of the band in standard deviations of the
+	// one step errors of the fit, 1.96 (about 95%) when zero.
+	Z float64
+	// Alpha, Beta and Gamma smooth the level, trend and season of the
+	// exponential smoothing forecasts. They default to 0.5, 0.1 and 0.1.
+	Alpha, Beta, Gamma float64
+	// Season is the length of the seasonal cycle of Holt-Winters, e.g.
+	// a day.
+	Season Duration
+}
+
+var errForecastPoints = errors.New("opentsdb: not enough points to forecast")
+
+func (o ForecastOptions) withDefaults() ForecastOptions {
+	if o.Z == 0 {
+		o.Z = 1.96
+	}
+	if o.Alpha == 0 {
+		o.Alpha = 0.5
+	}
+	if o.Beta == 0 {
+		o.Beta = 0.1
+	}
+	if o.Gamma == 0 {
+		o.Gamma = 0.1
+	}
+	return o
+}
+
+// forecastInput returns the sorted times and values of m without NaN, the
+// interval between points and the number of points to predict.
+func forecastInput(m DPmap, horizon Duration, min int) ([]Epoch, []float64, Epoch, int, error) {
+	var times []Epoch
+	var ys []float64
+	for _, t := range m.GetSortedTimes() {
+		if v := float64(m[t]); !math.IsNaN(v) {
+			times = append(times, t)
+			ys = append(ys, v)
+		}
+	}
+	if len(times) < min || len(times) < 2 {
+		return nil, nil, 0, 0, errForecastPoints
+	}
+	steps := make([]Epoch, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		steps[i-1] = times[i] - times[i-1]
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i] < steps[j] })
+	step := steps[len(steps)/2]
+	n := int(epochSpan(times, horizon) / step)
+	return times, ys, step, n, nil
+}
+
+// stddev returns the standard deviation of errs around zero.
+func stddev(errs []float64) float64 {
+	if len(errs) == 0 {
+		return 0
+	}
+	var s float64
+	for _, e := range errs {
+		s += e * e
+	}
+	return math.Sqrt(s / float64(len(errs)))
+}
+
+// LinearTrend returns the least squares line through the points of m,
+// with x in the time units of m.
+func (m DPmap) LinearTrend() (slope, intercept float64, ok bool) {
+	// x is taken relative to the first point for precision with epochs
+	var x0 Epoch
+	for t := range m {
+		if x0 == 0 || t < x0 {
+			x0 = t
+		}
+	}
+	var n, sx, sy, sxx, sxy float64
+	for t, v := range m {
+		if math.IsNaN(float64(v)) {
+			continue
+		}
+		x, y := float64(t-x0), float64(v)
+		n++
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	d := n*sxx - sx*sx
+	if n < 2 || d == 0 {
+		return 0, 0, false
+	}
+	slope = (n*sxy - sx*sy) / d
+	return slope, (sy-slope*sx)/n - slope*float64(x0), true
+}
+
+// ForecastLinear extends the least squares trend of m over the horizon.
+// The band has a constant width from the residuals of the fit.
+func (m DPmap) ForecastLinear(opts ForecastOptions) (*Forecast, error) {
+	opts = opts.withDefaults()
+	times, ys, step, n, err := forecastInput(m, opts.Horizon, 2)
+	if err != nil {
+		return nil, err
+	}
+	slope, intercept, ok := m.LinearTrend()
+	if !ok {
+		return nil, errForecastPoints
+	}
+	errs := make([]float64, len(ys))
+	for i, y := range ys {
+		errs[i] = y - (slope*float64(times[i]) + intercept)
+	}
+	width := opts.Z * stddev(errs)
+	f := newForecast(n)
+	last := times[len(times)-1]
+	for h := 1; h <= n; h++ {
+		t := last + Epoch(h)*step
+		f.set(t, slope*float64(t)+intercept, width)
+	}
+	return f, nil
+}
+
+// ForecastHolt forecasts m with double exponential smoothing, following
+// its level and trend. The band widens with the square root of the
+// number of steps ahead.
+func (m DPmap) ForecastHolt(opts ForecastOptions) (*Forecast, error) {
+	opts = opts.withDefaults()
+	times, ys, step, n, err := forecastInput(m, opts.Horizon, 2)
+	if err != nil {
+		return nil, err
+	}
+	level, trend := ys[0], ys[1]-ys[0]
+	var errs []float64
+	for _, y := range ys[1:] {
+		errs = append(errs, y-(level+trend))
+		prev := level
+		level = opts.Alpha*y + (1-opts.Alpha)*(level+trend)
+		trend = opts.Beta*(level-prev) + (1-opts.Beta)*trend
+	}
+	sd := stddev(errs)
+	f := newForecast(n)
+	last := times[len(times)-1]
+	for h := 1; h <= n; h++ {
+		f.set(last+Epoch(h)*step, level+float64(h)*trend, opts.Z*sd*math.Sqrt(float64(h)))
+	}
+	return f, nil
+}
+
+// ForecastHoltWinters forecasts m with additive triple exponential
+// smoothing, following its level, trend and a season of opts.Season. It
+// needs at least two seasons of points.
+func (m DPmap) ForecastHoltWinters(opts ForecastOptions) (*Forecast, error) {
+	opts = opts.withDefaults()
+	times, ys, step, n, err := forecastInput(m, opts.Horizon, 4)
+	if err != nil {
+		return nil, err
+	}
+	p := int(epochSpan(times, opts.Season) / step)
+	if p < 2 {
+		return nil, errors.New("opentsdb: season must span at least two points")
+	}
+	if len(ys) < 2*p {
+		return nil, errForecastPoints
+	}
+	mean := func(v []float64) float64 {
+		var s float64
+		for _, x := range v {
+			s += x
+		}
+		return s / float64(len(v))
+	}
+	level := mean(ys[:p])
+	trend := (mean(ys[p:2*p]) - level) / float64(p)
+	season := make([]float64, len(ys), len(ys)+n)
+	for i := 0; i < p; i++ {
+		season[i] = ys[i] - level
+	}
+	var errs []float64
+	for i := p; i < len(ys); i++ {
+		y := ys[i]
+		errs = append(errs, y-(level+trend+season[i-p]))
+		prev := level
+		level = opts.Alpha*(y-season[i-p]) + (1-opts.Alpha)*(level+trend)
+		trend = opts.Beta*(level-prev) + (1-opts.Beta)*trend
+		season[i] = opts.Gamma*(y-level) + (1-opts.Gamma)*season[i-p]
+	}
+	sd := stddev(errs)
+	f := newForecast(n)
+	last := times[len(times)-1]
+	for h := 1; h <= n; h++ {
+		s := season[len(ys)-p+(h-1)%p]
+		f.set(last+Epoch(h)*step, level+float64(h)*trend+s, opts.Z*sd*math.Sqrt(float64(h)))
+	}
+	return f, nil
+}
+
+func newForecast(n int) *Forecast {
+	return &Forecast{Predicted: make(DPmap, n), Lower: make(DPmap, n), Upper: make(DPmap, n)}
+}
+
+func (f *Forecast) set(t Epoch, v, width float64) {
+	f.Predicted[t] = Point(v)
+	f.Lower[t] = Point(v - width)
+	f.Upper[t] = Point(v + width)
+}
@@ -0,0 +1,58 @@
+package opentsdb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestForecast(t *testing.T) {
+	line := DPmap{}
+	for i := Epoch(0); i < 10; i++ {
+		line[i*60] = Point(2*i + 1)
+	}
+	near := func(a Point, b float64) bool { return math.Abs(float64(a)-b) < 1e-6 }
+
+	f, err := line.ForecastLinear(ForecastOptions{Horizon: 3 * Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Predicted) != 3 || !near(f.Predicted[720], 25) || f.Upper[720] != f.Predicted[720] {
+		t.Errorf("linear: got %v %v", f.Predicted, f.Upper)
+	}
+
+	f, err = line.ForecastHolt(ForecastOptions{Horizon: 2 * Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(f.Predicted[600], 21) || !near(f.Predicted[660], 23) {
+		t.Errorf("holt: got %v", f.Predicted)
+	}
+
+	seasonal := DPmap{}
+	for i := Epoch(0); i < 16; i++ {
+		seasonal[i*60] = Point([]float64{10, 20, 10, 0}[i%4])
+	}
+	f, err = seasonal.ForecastHoltWinters(ForecastOptions{Horizon: 4 * Minute, Season: 4 * Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float64{10, 20, 10, 0} {
+		if got := f.Predicted[Epoch(16+i)*60]; !near(got, want) {
+			t.Errorf("holt-winters step %d: got %v, expected %v", i, got, want)
+		}
+	}
+	if _, err := seasonal.ForecastHoltWinters(ForecastOptions{Horizon: Minute, Season: 10 * Minute}); err == nil {
+		t.Error("expected error for short series")
+	}
+}
+
+func TestLinearTrendEpochs(t *testing.T) {
+	m := DPmap{}
+	for i := Epoch(0); i < 100; i++ {
+		m[1700000000+i*10] = Point(i)
+	}
+	slope, intercept, ok := m.LinearTrend()
+	if !ok || math.Abs(slope-0.1) > 1e-9 || math.Abs(slope*1700000990+intercept-99) > 1e-6 {
+		t.Errorf("got %v %v", slope, intercept)
+	}
+}
@@ -0,0 +1,183 @@
+package opentsdb
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SeriesSpec describes a synthetic series: a data point every Step from
+// Start until End, exclusive. Steps below a second produce millisecond
+// timestamps.
+type SeriesSpec struct {
+	Metric string
+	Tags   TagSet
+	Start  time.Time
+	End    time.Time
+	Step   time.Duration
+}
+
+// Generator is a DataPointIterator producing a synthetic series, which can
+// be written with Client.PutStream.
+type Generator struct {
+	Spec  SeriesSpec
+	Value func(t time.Time) float64
+
+	t   time.Time
+	err error // returned by Next, for generators built with invalid arguments
+}
+
+// NewGenerator returns a generator computing the value at every time of s
+// with f.
+func NewGenerator(s SeriesSpec, f func(t time.Time) float64) *Generator {
+	return &Generator{Spec: s, Value: f, t: s.Start}
+}
+
+// Next returns the next point of the series, or io.EOF.
+func (g *Generator) Next() (*DataPoint, error) {
+	if g.err != nil {
+		return nil, g.err
+	}
+	if g.Spec.Step <= 0 {
+		return nil, fmt.Errorf("opentsdb: invalid step %s", g.Spec.Step)
+	}
+	if g.t.IsZero() {
+		g.t = g.Spec.Start
+	}
+	if !g.t.Before(g.Spec.End) {
+		return nil, io.EOF
+	}
+	t := g.t
+	g.t = g.t.Add(g.Spec.Step)
+	ts := Epoch(t.Unix())
+	if g.Spec.Step < time.Second {
+		ts = Epoch(t.UnixMilli())
+	}
+	return &DataPoint{Metric: g.Spec.Metric, Timestamp: ts, Value: g.Value(t), Tags: g.Spec.Tags.Copy()}, nil
+}
+
+// ConstantSeries generates v at every step.
+func ConstantSeries(s SeriesSpec, v float64) *Generator {
+	return NewGenerator(s, func(time.Time) float64 { return v })
+}
+
+// RandomWalk generates a series starting at start that moves by up to
+// maxStep in either direction at every step. The same seed produces the
+// same series.
+func RandomWalk(s SeriesSpec, start, maxStep float64, seed int64) *Generator {
+	rnd := rand.New(rand.NewSource(seed))
+	v := start
+	first := true
+	return NewGenerator(s, func(time.Time) float64 {
+		if !first {
+			v += (rnd.Float64()*2 - 1) * maxStep
+		}
+		first = false
+		return v
+	})
+}
+
+// Sine generates offset + amplitude*sin(2πt/period), with t the time since
+// the epoch, so series with the same period are in phase. The period must
+// be positive, or Next fails.
+func Sine(s SeriesSpec, amplitude, offset float64, period time.Duration) *Generator {
+	g := NewGenerator(s, func(t time.Time) float64 {
+		phase := float64(t.UnixNano()%int64(period)) / float64(period)
+		return offset + amplitude*math.Sin(2*math.Pi*phase)
+	})
+	if period <= 0 {
+		g.err = fmt.Errorf("opentsdb: invalid sine period %s", period)
+	}
+	return g
+}
+
+// CSVSeries reads data points from CSV with a header row. The timestamp
+// and value columns are required; a metric column overrides metric, and
+// every other column is a tag. Empty tag cells are left out.
+func CSVSeries(r io.Reader, metric string, tags TagSet) (DataPointIterator, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("opentsdb: csv header: %w", err)
+	}
+	it := &csvIterator{r: cr, metric: metric, tags: tags, ts: -1, value: -1, metricCol: -1}
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "timestamp":
+			it.ts = i
+		case "value":
+			it.value = i
+		case "metric":
+			it.metricCol = i
+		default:
+			it.tagCols = append(it.tagCols, i)
+		}
+	}
+	if it.ts < 0 || it.value < 0 {
+		return nil, fmt.Errorf("opentsdb: csv needs timestamp and value columns")
+	}
+	it.header = header
+	return it, nil
+}
+
+type csvIterator struct {
+	r         *csv.Reader
+	header    []string
+	metric    string
+	tags      TagSet
+	ts, value int
+	metricCol int
+	tagCols   []int
+}
+
+func (it *csvIterator) Next() (*DataPoint, error) {
+	rec, err := it.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	line, _ := it.r.FieldPos(0)
+	ts, err := strconv.ParseInt(rec[it.ts], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("opentsdb: csv line %d: timestamp: %w", line, err)
+	}
+	v, err := strconv.ParseFloat(rec[it.value], 64)
+	if err != nil {
+		return nil, fmt.Errorf("opentsdb: csv line %d: value: %w", line, err)
+	}
+	d := &DataPoint{Metric: it.metric, Timestamp: Epoch(ts), Value: v, Tags: it.tags.Copy()}
+	if it.metricCol >= 0 && rec[it.metricCol] != "" {
+		d.Metric = rec[it.metricCol]
+	}
+	for _, i := range it.tagCols {
+		if rec[i] != "" {
+			d.Tags[strings.TrimSpace(it.header[i])] = rec[i]
+		}
+	}
+	return d, nil
+}
+
+// ConcatIterators yields the points of its in order.
+func ConcatIterators(its ...DataPointIterator) DataPointIterator {
+	return &concatIterator{its: its}
+}
+
+type concatIterator struct {
+	its []DataPointIterator
+}
+
+func (c *concatIterator) Next() (*DataPoint, error) {
+	for len(c.its) > 0 {
+		d, err := c.its[0].Next()
+		if err != io.EOF {
+			return d, err
+		}
+		c.its = c.its[1:]
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,83 @@
+package opentsdb
+
+import (
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func collect(t *testing.T, it DataPointIterator) MultiDataPoint {
+	t.Helper()
+	var dps MultiDataPoint
+	for {
+		d, err := it.Next()
+		if err == io.EOF {
+			return dps
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		dps = append(dps, d)
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	s := SeriesSpec{Metric: "m", Tags: TagSet{"host": "a"}, Start: start, End: start.Add(time.Hour), Step: time.Minute}
+
+	dps := collect(t, ConstantSeries(s, 7))
+	if len(dps) != 60 || dps[0].Timestamp != 1600000000 || dps[59].Timestamp != 1600003540 || dps[1].Value != 7.0 {
+		t.Errorf("constant: got %d points, first %v", len(dps), dps[0])
+	}
+
+	a := collect(t, RandomWalk(s, 100, 1, 42))
+	b := collect(t, RandomWalk(s, 100, 1, 42))
+	if a[0].Value != 100.0 || a[59].Value != b[59].Value {
+		t.Error("random walk is not reproducible")
+	}
+	for i := 1; i < len(a); i++ {
+		if math.Abs(a[i].Value.(float64)-a[i-1].Value.(float64)) > 1 {
+			t.Fatalf("random walk step too large at %d", i)
+		}
+	}
+
+	s.Start = time.Unix(0, 0)
+	s.End = s.Start.Add(time.Hour)
+	sine := collect(t, Sine(s, 2, 10, time.Hour))
+	if math.Abs(sine[15].Value.(float64)-12) > 1e-9 || math.Abs(sine[45].Value.(float64)-8) > 1e-9 {
+		t.Errorf("sine: got %v and %v", sine[15].Value, sine[45].Value)
+	}
+	if _, err := Sine(s, 2, 10, 0).Next(); err == nil {
+		t.Error("sine: expected error for a zero period")
+	}
+
+	s.Step = 500 * time.Millisecond
+	s.End = s.Start.Add(time.Second)
+	if ms := collect(t, ConstantSeries(s, 1)); len(ms) != 2 || ms[1].Timestamp != 500 {
+		t.Errorf("ms: got %v", ms)
+	}
+}
+
+func TestCSVSeries(t *testing.T) {
+	in := "timestamp,value,host,metric\n1600000000,1.5,a,\n1600000060,2,,other\n"
+	it, err := CSVSeries(strings.NewReader(in), "m", TagSet{"dc": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dps := collect(t, ConcatIterators(it, IterateDataPoints(MultiDataPoint{{Metric: "z"}})))
+	if len(dps) != 3 || dps[0].Metric != "m" || dps[0].Tags["host"] != "a" || dps[0].Tags["dc"] != "x" || dps[0].Value != 1.5 {
+		t.Errorf("got %+v", dps[0])
+	}
+	if dps[1].Metric != "other" || len(dps[1].Tags) != 1 || dps[2].Metric != "z" {
+		t.Errorf("got %+v %+v", dps[1], dps[2])
+	}
+	if _, err := CSVSeries(strings.NewReader("time,value\n"), "m", nil); err == nil {
+		t.Error("expected missing column error")
+	}
+	it, _ = CSVSeries(strings.NewReader("timestamp,value\nx,1\n"), "m", nil)
+	if _, err := it.Next(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package opentsdb
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// Block is a series compressed as in Facebook's Gorilla: timestamps are
+// stored as deltas of deltas and values XORed with their predecessor,
+// which takes a few bits per point for regular series. Points must be
+// appended in increasing time order. A Block is not safe for concurrent
+// use.
+type Block struct {
+	b     bitWriter
+	n     int
+	t     Epoch
+	delta int64
+	v     uint64
+	// leading and trailing zeros of the last stored XOR
+	leading, trailing uint8
+}
+
+// NewBlock returns an empty block.
+func NewBlock() *Block {
+	return &Block{}
+}
+
+// BlockFromDPmap compresses the points of m.
+func BlockFromDPmap(m DPmap) *Block {
+	b := NewBlock()
+	for _, t := range m.GetSortedTimes() {
+		b.Append(t, m[t])
+	}
+	return b
+}
+
+var errBlockOrder = errors.New("opentsdb: block points must be appended in time order")
+
+// Append adds the point v at t, which must be later than the last point.
+func (b *Block) Append(t Epoch, v Point) error {
+	bits64 := math.Float64bits(float64(v))
+	switch b.n {
+	case 0:
+		b.b.writeBits(uint64(t), 64)
+		b.b.writeBits(bits64, 64)
+	default:
+		if t <= b.t {
+			return errBlockOrder
+		}
+		delta := int64(t - b.t)
+		b.writeDoD(delta - b.delta)
+		b.delta = delta
+		b.writeXOR(bits64 ^ b.v)
+	}
+	b.t, b.v = t, bits64
+	b.n++
+	return nil
+}
+
+// writeDoD writes a delta of delta with the variable length prefixes of
+// Gorilla, widened to suit second and millisecond timestamps.
+func (b *Block) writeDoD(dod int64) {
+	switch {
+	case dod == 0:
+		b.b.writeBit(0)
+	case -63 <= dod && dod <= 64:
+		b.b.writeBits(0b10, 2)
+		b.b.writeBits(uint64(dod), 7)
+	case -255 <= dod && dod <= 256:
+		b.b.writeBits(0b110, 3)
+		b.b.writeBits(uint64(dod), 9)
+	case -2047 <= dod && dod <= 2048:
+		b.b.writeBits(0b1110, 4)
+		b.b.writeBits(uint64(dod), 12)
+	default:
+		b.b.writeBits(0b1111, 4)
+		b.b.writeBits(uint64(dod), 64)
+	}
+}
+
+func (b *Block) writeXOR(x uint64) {
+	if x == 0 {
+		b.b.writeBit(0)
+		return
+	}
+	b.b.writeBit(1)
+	leading := uint8(bits.LeadingZeros64(x))
+	trailing := uint8(bits.TrailingZeros64(x))
+	if leading > 31 {
+		leading = 31
+	}
+	if b.n > 1 && leading >= b.leading && trailing >= b.trailing {
+		// the meaningful bits fit in the previous window
+		b.b.writeBit(0)
+		b.b.writeBits(x>>b.trailing, 64-int(b.leading)-int(b.trailing))
+		return
+	}
+	b.leading, b.trailing = leading, trailing
+	sig := 64 - int(leading) - int(trailing)
+	b.b.writeBit(1)
+	b.b.writeBits(uint64(leading), 5)
+	// sig is 1 to 64, stored minus one in 6 bits
+	b.b.writeBits(uint64(sig-1), 6)
+	b.b.writeBits(x>>trailing, sig)
+}
+
+// Len returns the number of points of b.
+func (b *Block) Len() int { return b.n }
+
+// Size returns the size of b in bytes.
+func (b *Block) Size() int { return len(b.b.buf) }
+
+// Iter returns an iterator over the points of b as they are when Iter is
+// called.
+func (b *Block) Iter() *BlockIterator {
+	return &BlockIterator{r: bitReader{buf: b.b.buf}, n: b.n}
+}
+
+// DPmap returns the points of b.
+func (b *Block) DPmap() DPmap {
+	m := make(DPmap, b.n)
+	it := b.Iter()
+	for it.Next() {
+		t, v := it.At()
+		m[t] = v
+	}
+	return m
+}
+
+// BlockIterator iterates over the points of a Block in time order.
+type BlockIterator struct {
+	r                 bitReader
+	n, i              int
+	t                 Epoch
+	delta             int64
+	v                 uint64
+	leading, trailing uint8
+}
+
+// Next advances to the next point and reports whether there is one.
+func (it *BlockIterator) Next() bool {
+	if it.i >= it.n {
+		return false
+	}
+	if it.i == 0 {
+		it.t = Epoch(it.r.readBits(64))
+		it.v = it.r.readBits(64)
+		it.i++
+		return true
+	}
+	it.delta += it.readDoD()
+	it.t += Epoch(it.delta)
+	if it.r.readBit() == 1 {
+		if it.r.readBit() == 1 {
+			it.leading = uint8(it.r.readBits(5))
+			sig := uint8(it.r.readBits(6)) + 1
+			it.trailing = 64 - it.leading - sig
+		}
+		sig := 64 - int(it.leading) - int(it.trailing)
+		it.v ^= it.r.readBits(sig) << it.trailing
+	}
+	it.i++
+	return true
+}
+
+func (it *BlockIterator) readDoD() int64 {
+	var n int
+	switch {
+	case it.r.readBit() == 0:
+		return 0
+	case it.r.readBit() == 0:
+		n = 7
+	case it.r.readBit() == 0:
+		n = 9
+	case it.r.readBit() == 0:
+		n = 12
+	default:
+		return int64(it.r.readBits(64))
+	}
+	v := int64(it.r.readBits(n))
+	// sign extend
+	if v >= 1<<(n-1)+1 {
+		v -= 1 << n
+	}
+	return v
+}
+
+// At returns the current point.
+func (it *BlockIterator) At() (Epoch, Point) {
+	return it.t, Point(math.Float64frombits(it.v))
+}
+
+type bitWriter struct {
+	buf   []byte
+	nfree uint8 // free bits in the last byte
+}
+
+func (w *bitWriter) writeBit(bit uint8) {
+	if w.nfree == 0 {
+		w.buf = append(w.buf, 0)
+		w.nfree = 8
+	}
+	w.nfree--
+	if bit != 0 {
+		w.buf[len(w.buf)-1] |= 1 << w.nfree
+	}
+}
+
+// writeBits writes the n low bits of v, most significant first.
+func (w *bitWriter) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.writeBit(uint8(v >> uint(i) & 1))
+	}
+}
+
+type bitReader struct {
+	buf []byte
+	pos int // in bits
+}
+
+func (r *bitReader) readBit() uint8 {
+	b := r.buf[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+	r.pos++
+	return b
+}
+
+func (r *bitReader) readBits(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		v = v<<1 | uint64(r.readBit())
+	}
+	return v
+}
@@ -0,0 +1,79 @@
+package opentsdb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBlockRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		dps  DPmap
+	}{
+		{"empty", DPmap{}},
+		{"single", DPmap{1500000000: 1.5}},
+		{"irregular", DPmap{1500000000: 1, 1500000003: 1, 1500000070: -2.25, 1500000071: 1e300, 1500009999: 0, 1500010000: 42}},
+		{"ms", DPmap{1500000000000: 1, 1500000000250: 2, 1500000001250: 2, 1500000004000: 0.1}},
+	} {
+		b := BlockFromDPmap(tc.dps)
+		if b.Len() != len(tc.dps) {
+			t.Errorf("%s: Len = %d, want %d", tc.name, b.Len(), len(tc.dps))
+		}
+		got := b.DPmap()
+		if len(got) != len(tc.dps) {
+			t.Fatalf("%s: got %v, want %v", tc.name, got, tc.dps)
+		}
+		for ts, v := range tc.dps {
+			if got[ts] != v {
+				t.Errorf("%s: %d = %v, want %v", tc.name, ts, got[ts], v)
+			}
+		}
+	}
+}
+
+func TestBlockAppend(t *testing.T) {
+	b := NewBlock()
+	if err := b.Append(100, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Append(100, 2); err == nil {
+		t.Error("expected an error for a duplicate timestamp")
+	}
+	b.Append(110, Point(math.NaN()))
+	b.Append(120, Point(math.Inf(-1)))
+
+	it := b.Iter()
+	var n int
+	for it.Next() {
+		ts, v := it.At()
+		switch n {
+		case 0:
+			if ts != 100 || v != 1 {
+				t.Errorf("got %d %v", ts, v)
+			}
+		case 1:
+			if ts != 110 || !math.IsNaN(float64(v)) {
+				t.Errorf("got %d %v", ts, v)
+			}
+		case 2:
+			if ts != 120 || !math.IsInf(float64(v), -1) {
+				t.Errorf("got %d %v", ts, v)
+			}
+		}
+		n++
+	}
+	if n != 3 {
+		t.Errorf("iterated %d points, want 3", n)
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	b := NewBlock()
+	for i := 0; i < 3600; i++ {
+		b.Append(Epoch(1500000000+i*10), Point(100+i%7))
+	}
+	// a DPmap entry takes at least 16 bytes
+	if raw := b.Len() * 16; b.Size()*10 > raw {
+		t.Errorf("block of %d bytes, want under a tenth of %d", b.Size(), raw)
+	}
+}
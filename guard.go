@@ -0,0 +1,160 @@
+package opentsdb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQueryTooExpensive is matched by every QueryTooExpensiveError.
+var ErrQueryTooExpensive = errors.New("opentsdb: query too expensive")
+
+// QueryTooExpensiveError reports the budget of a GuardContext a request
+// exceeded. Query is the index of the offending query, or -1 when the
+// budget applies to the whole request.
+type QueryTooExpensiveError struct {
+	Limit string // span, dps, series or downsample
+	Query int
+	Value int64
+	Max   int64
+}
+
+func (e *QueryTooExpensiveError) Error() string {
+	if e.Query < 0 {
+		return fmt.Sprintf("opentsdb: query too expensive: %s %d exceeds %d", e.Limit, e.Value, e.Max)
+	}
+	return fmt.Sprintf("opentsdb: query too expensive: query %d: %s %d exceeds %d", e.Query, e.Limit, e.Value, e.Max)
+}
+
+// Is matches ErrQueryTooExpensive and the ErrTooLarge kind.
+func (e *QueryTooExpensiveError) Is(target error) bool {
+	return target == ErrQueryTooExpensive || target == ErrTooLarge
+}
+
+// GuardContext protects a Context from expensive requests. Budgets left at
+// zero are not enforced.
+type GuardContext struct {
+	Context Context
+	// MaxSpan is the longest time range a request may cover.
+	MaxSpan Duration
+	// MaxDPS is the most datapoints a request may read, as estimated by
+	// EstimateDPSWith with Cardinality.
+	MaxDPS int64
+	// MaxSeries is the most series a single query may read.
+	MaxSeries int
+	// DownsampleAfter requires every query of requests spanning more than
+	// it to be downsampled.
+	DownsampleAfter Duration
+	// Cardinality counts the series read by a query; nil assumes one.
+	Cardinality CardinalityFunc
+	// Rewrite adds or coarsens downsamplers to bring requests within the
+	// downsample and datapoint budgets instead of rejecting them.
+	Rewrite bool
+}
+
+func (c *GuardContext) Version() Version {
+	return c.Context.Version()
+}
+
+// Query checks r against the budgets, rewriting a copy of it if allowed,
+// and forwards it. Rejected requests return a *QueryTooExpensiveError.
+func (c *GuardContext) Query(r *Request) (ResponseSet, error) {
+	r, err := c.Check(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.Context.Query(r)
+}
+
+// Check returns r, or a rewritten copy of it, if it fits the budgets.
+func (c *GuardContext) Check(r *Request) (*Request, error) {
+	span, err := r.GetDuration()
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxSpan > 0 && span > c.MaxSpan {
+		return nil, &QueryTooExpensiveError{Limit: "span", Query: -1, Value: span.SecondsInt64(), Max: c.MaxSpan.SecondsInt64()}
+	}
+
+	est, err := r.EstimateDPSWith(c.Cardinality)
+	if err != nil {
+		return nil, err
+	}
+	// rewrites only change downsamplers, so the series counted now are
+	// reused rather than counted again for every estimate
+	series := make([]int, len(est.Queries))
+	total := 0
+	for i, qe := range est.Queries {
+		series[i] = qe.Series
+		total += qe.Series
+	}
+	if c.MaxSeries > 0 {
+		for _, qe := range est.Queries {
+			if qe.Series > c.MaxSeries {
+				return nil, &QueryTooExpensiveError{Limit: "series", Query: qe.Index, Value: int64(qe.Series), Max: int64(c.MaxSeries)}
+			}
+		}
+	}
+
+	if c.DownsampleAfter > 0 && span > c.DownsampleAfter {
+		for i, q := range r.Queries {
+			if q.Downsample != "" {
+				continue
+			}
+			if !c.Rewrite {
+				return nil, &QueryTooExpensiveError{Limit: "downsample", Query: i, Value: span.SecondsInt64(), Max: c.DownsampleAfter.SecondsInt64()}
+			}
+			r = r.Clone()
+			// as coarse as one point per second over DownsampleAfter
+			if err := r.AutoDownsampleWith(int(c.DownsampleAfter.SecondsInt64()), AutoDownsampleOptions{OnlyExceeding: true, PreserveAggregator: true}); err != nil {
+				return nil, err
+			}
+			if est, err = estimateWithSeries(r, series); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	if c.MaxDPS > 0 && est.Total > c.MaxDPS {
+		if !c.Rewrite {
+			return nil, &QueryTooExpensiveError{Limit: "dps", Query: -1, Value: est.Total, Max: c.MaxDPS}
+		}
+		points := c.MaxDPS / int64(total)
+		orig := r
+		// intervals are rounded down, so retry with fewer points, in
+		// proportion to the excess, until the estimate fits
+		for est.Total > c.MaxDPS {
+			if points < 1 {
+				return nil, &QueryTooExpensiveError{Limit: "dps", Query: -1, Value: est.Total, Max: c.MaxDPS}
+			}
+			r = orig.Clone()
+			if err := r.AutoDownsampleWith(int(points), AutoDownsampleOptions{OnlyExceeding: true, PreserveAggregator: true}); err != nil {
+				return nil, err
+			}
+			if est, err = estimateWithSeries(r, series); err != nil {
+				return nil, err
+			}
+			if est.Total > c.MaxDPS {
+				fewer := int64(float64(points) * float64(c.MaxDPS) / float64(est.Total))
+				if fewer >= points {
+					fewer = points - 1
+				}
+				points = fewer
+			}
+		}
+	}
+	return r, nil
+}
+
+// estimateWithSeries estimates the datapoints r reads with the series
+// counted for each of its queries.
+func estimateWithSeries(r *Request, series []int) (*DPSEstimate, error) {
+	return r.EstimateDPSWith(func(q *Query) (int, error) {
+		for i, rq := range r.Queries {
+			if rq == q && i < len(series) {
+				return series[i], nil
+			}
+		}
+		return 1, nil
+	})
+}
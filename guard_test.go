@@ -0,0 +1,70 @@
+package opentsdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGuardContext(t *testing.T) {
+	mem := NewMemContext()
+	r, err := ParseRequest("start=2023/01/30-00:00:00&end=2023/01/31-00:00:00&m=sum:a{host=*}", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		guard GuardContext
+		limit string
+	}{
+		{GuardContext{MaxSpan: Hour}, "span"},
+		{GuardContext{MaxSeries: 5, Cardinality: StaticCardinality(map[string]int{"a": 10})}, "series"},
+		{GuardContext{DownsampleAfter: Hour}, "downsample"},
+		{GuardContext{MaxDPS: 1000}, "dps"},
+		{GuardContext{MaxDPS: 5, Cardinality: StaticCardinality(map[string]int{"a": 10}), Rewrite: true}, "dps"},
+		{GuardContext{MaxSpan: Day, MaxDPS: 100000}, ""},
+	}
+	for i, test := range tests {
+		test.guard.Context = mem
+		_, err := test.guard.Query(r)
+		var qe *QueryTooExpensiveError
+		if test.limit == "" {
+			if err != nil {
+				t.Errorf("test %d: %v", i, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrQueryTooExpensive) || !errors.As(err, &qe) || qe.Limit != test.limit {
+			t.Errorf("test %d: expected %s limit, got %v", i, test.limit, err)
+		}
+	}
+
+	g := &GuardContext{Context: mem, MaxDPS: 1000, DownsampleAfter: Hour, Rewrite: true}
+	rw, err := g.Check(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Queries[0].Downsample != "" {
+		t.Error("caller's request was modified")
+	}
+	if rw.Queries[0].Downsample == "" {
+		t.Errorf("got %s", rw.Queries[0].Downsample)
+	}
+	if est, _ := rw.EstimateDPSWith(nil); est.Total > 1000 {
+		t.Errorf("rewritten request still reads %d points", est.Total)
+	}
+
+	lookups := 0
+	g = &GuardContext{Context: mem, MaxDPS: 997, Rewrite: true, Cardinality: func(q *Query) (int, error) {
+		lookups++
+		return 7, nil
+	}}
+	if rw, err = g.Check(r); err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 1 {
+		t.Errorf("cardinality looked up %d times", lookups)
+	}
+	if est, _ := rw.EstimateDPSWith(StaticCardinality(map[string]int{"a": 7})); est.Total > 997 {
+		t.Errorf("rewritten request still reads %d points", est.Total)
+	}
+}
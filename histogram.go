@@ -0,0 +1,150 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HistogramPoint is a data point for the /api/histogram route of OpenTSDB
+// 2.4. It is either a simple bucketed histogram, given by Buckets,
+// Underflow and Overflow, or a histogram encoded by the codec ID into
+// Value, which is sent base64 encoded.
+type HistogramPoint struct {
+	Metric    string            `json:"metric" yaml:"metric"`
+	Timestamp Epoch             `json:"timestamp" yaml:"timestamp"`
+	Tags      TagSet            `json:"tags" yaml:"tags"`
+	Buckets   []HistogramBucket `json:"buckets,omitempty" yaml:"buckets,omitempty"`
+	Underflow int64             `json:"underflow,omitempty" yaml:"underflow,omitempty"`
+	Overflow  int64             `json:"overflow,omitempty" yaml:"overflow,omitempty"`
+	ID        int               `json:"id,omitempty" yaml:"id,omitempty"`
+	Value     []byte            `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+// HistogramBucket counts the values in [Lower, Upper).
+type HistogramBucket struct {
+	Lower float64 `json:"lower" yaml:"lower"`
+	Upper float64 `json:"upper" yaml:"upper"`
+	Count int64   `json:"count" yaml:"count"`
+}
+
+// histogramJSON is the wire format of HistogramPoint, where buckets are
+// keyed by "lower,upper".
+type histogramJSON struct {
+	Metric    string           `json:"metric"`
+	Timestamp Epoch            `json:"timestamp"`
+	Tags      TagSet           `json:"tags"`
+	Buckets   map[string]int64 `json:"buckets,omitempty"`
+	Underflow int64            `json:"underflow,omitempty"`
+	Overflow  int64            `json:"overflow,omitempty"`
+	ID        int              `json:"id,omitempty"`
+	Value     []byte           `json:"value,omitempty"`
+}
+
+// MarshalJSON cleans the metric and tags of p and encodes it in the format
+// of /api/histogram.
+func (p *HistogramPoint) MarshalJSON() ([]byte, error) {
+	if err := p.Clean(); err != nil {
+		return nil, err
+	}
+	h := histogramJSON{
+		Metric:    p.Metric,
+		Timestamp: p.Timestamp,
+		Tags:      p.Tags,
+		Underflow: p.Underflow,
+		Overflow:  p.Overflow,
+		ID:        p.ID,
+		Value:     p.Value,
+	}
+	if len(p.Buckets) > 0 {
+		h.Buckets = make(map[string]int64, len(p.Buckets))
+		for _, b := range p.Buckets {
+			h.Buckets[formatBucket(b.Lower, b.Upper)] = b.Count
+		}
+	}
+	return json.Marshal(h)
+}
+
+// UnmarshalJSON decodes the /api/histogram format. Buckets are sorted by
+// their lower bound.
+func (p *HistogramPoint) UnmarshalJSON(b []byte) error {
+	var h histogramJSON
+	if err := json.Unmarshal(b, &h); err != nil {
+		return err
+	}
+	*p = HistogramPoint{
+		Metric:    h.Metric,
+		Timestamp: h.Timestamp,
+		Tags:      h.Tags,
+		Underflow: h.Underflow,
+		Overflow:  h.Overflow,
+		ID:        h.ID,
+		Value:     h.Value,
+	}
+	for k, count := range h.Buckets {
+		lower, upper, err := parseBucket(k)
+		if err != nil {
+			return err
+		}
+		p.Buckets = append(p.Buckets, HistogramBucket{Lower: lower, Upper: upper, Count: count})
+	}
+	sort.Slice(p.Buckets, func(i, j int) bool { return p.Buckets[i].Lower < p.Buckets[j].Lower })
+	return nil
+}
+
+func formatBucket(lower, upper float64) string {
+	return strconv.FormatFloat(lower, 'g', -1, 64) + "," + strconv.FormatFloat(upper, 'g', -1, 64)
+}
+
+func parseBucket(k string) (lower, upper float64, err error) {
+	i := strings.IndexByte(k, ',')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("opentsdb: invalid histogram bucket %q", k)
+	}
+	if lower, err = strconv.ParseFloat(k[:i], 64); err == nil {
+		upper, err = strconv.ParseFloat(k[i+1:], 64)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("opentsdb: invalid histogram bucket %q", k)
+	}
+	return lower, upper, nil
+}
+
+// Clean removes invalid characters from the metric and tags of p and checks
+// that it holds either buckets or an encoded value.
+func (p *HistogramPoint) Clean() error {
+	if err := p.Tags.Clean(); err != nil {
+		return fmt.Errorf("cleaning tags for metric %s: %s", p.Metric, err)
+	}
+	m, err := Clean(p.Metric)
+	if err != nil {
+		return fmt.Errorf("cleaning metric %s: %s", p.Metric, err)
+	}
+	p.Metric = m
+	if p.Timestamp > 0xffffffff {
+		p.Timestamp /= 1000
+	}
+	switch {
+	case p.Metric == "" || p.Timestamp == 0:
+		return errors.New("histogram point is invalid")
+	case len(p.Buckets) > 0 && len(p.Value) > 0:
+		return errors.New("histogram point has both buckets and an encoded value")
+	case len(p.Buckets) == 0 && len(p.Value) == 0:
+		return errors.New("histogram point has no buckets")
+	}
+	for _, b := range p.Buckets {
+		if b.Upper <= b.Lower || b.Count < 0 {
+			return fmt.Errorf("histogram bucket %s is invalid", formatBucket(b.Lower, b.Upper))
+		}
+	}
+	return nil
+}
+
+// PutHistogram sends hps to the /api/histogram endpoint of the client's
+// host.
+func (c *Client) PutHistogram(hps []*HistogramPoint) error {
+	return c.post("/api/histogram", hps, nil, c.putTimeout())
+}
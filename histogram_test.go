@@ -0,0 +1,77 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHistogramPointJSON(t *testing.T) {
+	p := &HistogramPoint{
+		Metric:    "http.latency",
+		Timestamp: 1600000000,
+		Tags:      TagSet{"host": "a"},
+		Buckets:   []HistogramBucket{{Lower: 1.75, Upper: 3.5, Count: 16}, {Lower: 0, Upper: 1.75, Count: 12}},
+		Overflow:  1,
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"buckets":{"0,1.75":12,"1.75,3.5":16}`) {
+		t.Errorf("unexpected encoding %s", b)
+	}
+	var got HistogramPoint
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Buckets) != 2 || got.Buckets[0] != (HistogramBucket{0, 1.75, 12}) || got.Overflow != 1 {
+		t.Errorf("round trip: got %+v", got)
+	}
+
+	enc := &HistogramPoint{Metric: "m", Timestamp: 1, Tags: TagSet{"a": "b"}, ID: 1, Value: []byte{1, 2}}
+	if b, err := json.Marshal(enc); err != nil || !strings.Contains(string(b), `"value":"AQI="`) {
+		t.Errorf("encoded value: %s %v", b, err)
+	}
+	for _, bad := range []*HistogramPoint{
+		{Metric: "m", Timestamp: 1},
+		{Metric: "m", Timestamp: 1, Buckets: []HistogramBucket{{Lower: 2, Upper: 1}}},
+		{Metric: "m", Timestamp: 1, Buckets: []HistogramBucket{{Lower: 0, Upper: 1}}, Value: []byte{1}},
+	} {
+		if _, err := json.Marshal(bad); err == nil {
+			t.Errorf("%+v: expected error", bad)
+		}
+	}
+}
+
+func TestPutRollupAndHistogram(t *testing.T) {
+	paths := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body json.RawMessage
+		json.NewDecoder(req.Body).Decode(&body)
+		paths[req.URL.Path] = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL)
+	err := c.PutRollup([]*RollupPoint{
+		{DataPoint: DataPoint{Metric: "m", Timestamp: 3600, Value: 1, Tags: TagSet{"a": "b"}}, Interval: "1h", Aggregator: "SUM"},
+		{DataPoint: DataPoint{Metric: "m", Timestamp: 3600, Value: 1, Tags: TagSet{"a": "b"}}, GroupByAggregator: "SUM"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutRollup([]*RollupPoint{{DataPoint: DataPoint{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"a": "b"}}}}); err == nil {
+		t.Error("expected error for rollup without interval")
+	}
+	err = c.PutHistogram([]*HistogramPoint{{Metric: "m", Timestamp: 1, Tags: TagSet{"a": "b"}, Buckets: []HistogramBucket{{0, 1, 1}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(paths["/api/rollup"], `"interval":"1h"`) || !strings.Contains(paths["/api/histogram"], `"0,1":1`) {
+		t.Errorf("unexpected bodies %v", paths)
+	}
+}
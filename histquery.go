@@ -0,0 +1,139 @@
+package opentsdb
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HistogramResponse is the result of a histogram query, OpenTSDB 2.4
+// returning one series per bucket with ShowHistogramBuckets and one per
+// percentile with Percentiles. Bucket series are named
+// <metric>_<lower>_<upper> and percentile series <metric>_pct_<p>.
+type HistogramResponse struct {
+	Metric        string
+	Tags          TagSet
+	AggregateTags []string
+	Query         Query
+	// Buckets are sorted by their upper bound. Their points are counts.
+	Buckets     []HistogramSeries
+	Percentiles map[float64]DPmap
+}
+
+// HistogramSeries holds the counts of the bucket [Lower, Upper) over time.
+type HistogramSeries struct {
+	Lower, Upper float64
+	DPS          DPmap
+}
+
+// GroupHistograms gathers the bucket and percentile series of rs by
+// histogram metric, tags and query. The responses that are not part of a
+// histogram are returned in rest.
+func GroupHistograms(rs ResponseSet) (hs []*HistogramResponse, rest ResponseSet) {
+	byKey := map[string]*HistogramResponse{}
+	for _, resp := range rs {
+		metric, lower, upper, pct, ok := parseHistogramMetric(resp.Metric)
+		if !ok {
+			rest = append(rest, resp)
+			continue
+		}
+		key := strconv.Itoa(resp.Query.Index) + " " + metric + resp.Tags.String()
+		h := byKey[key]
+		if h == nil {
+			h = &HistogramResponse{
+				Metric:        metric,
+				Tags:          resp.Tags,
+				AggregateTags: resp.AggregateTags,
+				Query:         resp.Query,
+				Percentiles:   map[float64]DPmap{},
+			}
+			byKey[key] = h
+			hs = append(hs, h)
+		}
+		if pct >= 0 {
+			h.Percentiles[pct] = resp.DPS
+		} else {
+			h.Buckets = append(h.Buckets, HistogramSeries{Lower: lower, Upper: upper, DPS: resp.DPS})
+		}
+	}
+	for _, h := range hs {
+		sort.Slice(h.Buckets, func(i, j int) bool { return h.Buckets[i].Upper < h.Buckets[j].Upper })
+	}
+	return hs, rest
+}
+
+// parseHistogramMetric splits the name of a bucket or percentile series.
+// pct is negative for buckets.
+func parseHistogramMetric(m string) (metric string, lower, upper, pct float64, ok bool) {
+	if i := strings.LastIndex(m, "_pct_"); i > 0 {
+		p, err := strconv.ParseFloat(m[i+5:], 64)
+		if err == nil {
+			return m[:i], 0, 0, p, true
+		}
+	}
+	i := strings.LastIndexByte(m, '_')
+	if i <= 0 {
+		return "", 0, 0, 0, false
+	}
+	j := strings.LastIndexByte(m[:i], '_')
+	if j <= 0 {
+		return "", 0, 0, 0, false
+	}
+	lower, err1 := strconv.ParseFloat(m[j+1:i], 64)
+	upper, err2 := strconv.ParseFloat(m[i+1:], 64)
+	if err1 != nil || err2 != nil || upper <= lower {
+		return "", 0, 0, 0, false
+	}
+	return m[:j], lower, upper, -1, true
+}
+
+// At returns the bucket counts at t.
+func (h *HistogramResponse) At(t Epoch) []HistogramBucket {
+	out := make([]HistogramBucket, 0, len(h.Buckets))
+	for _, b := range h.Buckets {
+		out = append(out, HistogramBucket{Lower: b.Lower, Upper: b.Upper, Count: int64(b.DPS[t])})
+	}
+	return out
+}
+
+// Quantile estimates the q quantile, 0 <= q <= 1, at every timestamp of
+// the buckets, interpolating linearly within the bucket holding it.
+// Timestamps without counts are left out.
+func (h *HistogramResponse) Quantile(q float64) DPmap {
+	times := map[Epoch]bool{}
+	for _, b := range h.Buckets {
+		for t := range b.DPS {
+			times[t] = true
+		}
+	}
+	out := DPmap{}
+	for t := range times {
+		if v, ok := bucketQuantile(h.At(t), q); ok {
+			out[t] = Point(v)
+		}
+	}
+	return out
+}
+
+// bucketQuantile estimates the q quantile of the counts of buckets, which
+// are sorted.
+func bucketQuantile(buckets []HistogramBucket, q float64) (float64, bool) {
+	var total int64
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0, false
+	}
+	rank := q * float64(total)
+	var cum float64
+	for _, b := range buckets {
+		c := float64(b.Count)
+		if c > 0 && cum+c >= rank {
+			return b.Lower + (b.Upper-b.Lower)*(rank-cum)/c, true
+		}
+		cum += c
+	}
+	last := buckets[len(buckets)-1]
+	return last.Upper, true
+}
@@ -0,0 +1,28 @@
+package opentsdb
+
+import "testing"
+
+func TestGroupHistograms(t *testing.T) {
+	rs := ResponseSet{
+		{Metric: "lat_10_20", Tags: TagSet{"host": "a"}, DPS: DPmap{60: 2, 120: 0}},
+		{Metric: "lat_0_10", Tags: TagSet{"host": "a"}, DPS: DPmap{60: 8, 120: 0}},
+		{Metric: "lat_pct_99.0", Tags: TagSet{"host": "a"}, DPS: DPmap{60: 19}},
+		{Metric: "lat_0_10", Tags: TagSet{"host": "b"}, DPS: DPmap{60: 1}},
+		{Metric: "sys.cpu", Tags: TagSet{"host": "a"}, DPS: DPmap{60: 1}},
+	}
+	hs, rest := GroupHistograms(rs)
+	if len(hs) != 2 || len(rest) != 1 || rest[0].Metric != "sys.cpu" {
+		t.Fatalf("got %d histograms, rest %v", len(hs), rest)
+	}
+	h := hs[0]
+	if h.Metric != "lat" || len(h.Buckets) != 2 || h.Buckets[0].Upper != 10 || h.Percentiles[99][60] != 19 {
+		t.Errorf("got %+v", h)
+	}
+	q := h.Quantile(0.5)
+	if q[60] != 6.25 || len(q) != 1 {
+		t.Errorf("median: got %v", q)
+	}
+	if q := h.Quantile(0.9); q[60] != 15 {
+		t.Errorf("p90: got %v", q)
+	}
+}
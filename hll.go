@@ -0,0 +1,117 @@
+package opentsdb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLog is a sketch estimating the number of distinct values added to
+// it. With precision p it holds 2^p one byte registers and its estimates
+// have a standard error of about 1.04/√2^p.
+type HyperLogLog struct {
+	p   uint8
+	reg []uint8
+}
+
+// NewHyperLogLog returns an empty sketch of precision p, clamped to 4..16.
+func NewHyperLogLog(p uint8) *HyperLogLog {
+	if p < 4 {
+		p = 4
+	} else if p > 16 {
+		p = 16
+	}
+	return &HyperLogLog{p: p, reg: make([]uint8, 1<<p)}
+}
+
+// hashString returns a well mixed 64 bit hash of s.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	// fnv leaves the high bits poorly mixed; finish like splitmix64
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Precision returns the precision of s.
+func (s *HyperLogLog) Precision() uint8 { return s.p }
+
+// AddString adds v and reports whether the sketch changed, which it never
+// does for a value already added.
+func (s *HyperLogLog) AddString(v string) bool {
+	return s.add(hashString(v))
+}
+
+// Merge adds the values added to o, which must have the same precision.
+func (s *HyperLogLog) Merge(o *HyperLogLog) error {
+	if o.p != s.p {
+		return fmt.Errorf("opentsdb: merging HyperLogLog of precision %d into %d", o.p, s.p)
+	}
+	s.merge(o)
+	return nil
+}
+
+// Clone returns a copy of s.
+func (s *HyperLogLog) Clone() *HyperLogLog {
+	return &HyperLogLog{p: s.p, reg: append([]uint8(nil), s.reg...)}
+}
+
+// register returns the register of x and the rank to store in it.
+func (s *HyperLogLog) register(x uint64) (int, uint8) {
+	i := x >> (64 - s.p)
+	rank := uint8(bits.LeadingZeros64(x<<s.p|1<<(s.p-1))) + 1
+	return int(i), rank
+}
+
+// add adds the value hashed to x and reports whether the sketch changed.
+// Adding a value already added never changes it.
+func (s *HyperLogLog) add(x uint64) bool {
+	i, rank := s.register(x)
+	if rank <= s.reg[i] {
+		return false
+	}
+	s.reg[i] = rank
+	return true
+}
+
+// merge is Merge without the precision check.
+func (s *HyperLogLog) merge(o *HyperLogLog) {
+	for i, r := range o.reg {
+		if r > s.reg[i] {
+			s.reg[i] = r
+		}
+	}
+}
+
+// Count returns the estimated number of distinct values added.
+func (s *HyperLogLog) Count() uint64 {
+	m := float64(len(s.reg))
+	sum, zeros := 0.0, 0
+	for _, r := range s.reg {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	switch len(s.reg) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	}
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small cardinalities
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
@@ -2,25 +2,118 @@ package opentsdb
 
 import (
 	"crypto/tls"
+	"io"
 	"net/http"
+	"runtime/debug"
+	"sync/atomic"
 	"time"
 )
 
+// DefaultTimeout is the request timeout used unless overridden.
+const DefaultTimeout = 30 * time.Second
+
 // DefaultClient is the default http client for requests.
 var DefaultClient = &http.Client{
-	Transport: &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
+	Transport: newTransport(),
+	Timeout:   DefaultTimeout,
+}
+
+// newTransport returns a transport keeping enough idle connections per host
+// for a MultiContext fan-out or a PutStream to reuse them.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        256,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
 		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
+			InsecureSkipVerify: insecureSkipVerify.Load(),
 		},
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
-	},
-	Timeout: 30 * time.Second,
+	}
+}
+
+const (
+	// maxErrorBody is the most of an error response read into errors.
+	maxErrorBody = 64 << 10
+	// maxDrain is the most of an unread response body drained so that
+	// its connection can be reused. Longer bodies close the connection.
+	maxDrain = 256 << 10
+)
+
+// closeBody drains what is left of body, up to maxDrain, and closes it,
+// letting the transport reuse the connection.
+func closeBody(body io.ReadCloser) error {
+	io.CopyN(io.Discard, body, maxDrain)
+	return body.Close()
+}
+
+// withTimeout returns client, or a shallow copy of it bounded by d when d is
+// positive.
+func withTimeout(client *http.Client, d time.Duration) *http.Client {
+	if d <= 0 || client.Timeout == d {
+		return client
+	}
+	c := *client
+	c.Timeout = d
+	return &c
+}
+
+var insecureSkipVerify atomic.Bool
+
+// SetInsecureSkipVerify disables certificate verification for DefaultClient
+// and for clients created afterwards. It exists for compatibility with
+// deployments that relied on verification being off; prefer WithCACertFile.
+// It must be called before any clients are built or requests are sent,
+// since DefaultClient's TLS configuration is changed in place.
+func SetInsecureSkipVerify(v bool) {
+	insecureSkipVerify.Store(v)
+	if t, ok := DefaultClient.Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+		t.TLSClientConfig.InsecureSkipVerify = v
+	}
+}
+
+// modulePath is the import path of this package's module.
+const modulePath = "github.com/the-cloud-source/opentsdb"
+
+// DefaultUserAgent returns the User-Agent sent unless overridden, of the
+// form go-opentsdb/<version>. The version is that of this module in the
+// build, or devel when it isn't known.
+func DefaultUserAgent() string {
+	v := "devel"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Path == modulePath && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			v = bi.Main.Version
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == modulePath && dep.Version != "" {
+				v = dep.Version
+			}
+		}
+	}
+	return "go-opentsdb/" + v
 }
 
-var userAgent = ""
+var userAgent atomic.Value
 
-func UserAgentSet(ua string) { userAgent = ua }
-func SetUserAgent(ua string) { userAgent = ua }
-func GetUserAgent() string   { return userAgent }
+func init() { userAgent.Store(DefaultUserAgent()) }
+
+// SetUserAgent sets the User-Agent of requests made by the package level
+// functions and by clients without their own. An empty ua sends Go's
+// default User-Agent.
+func SetUserAgent(ua string) { userAgent.Store(ua) }
+
+// UserAgentSet is the same as SetUserAgent.
+func UserAgentSet(ua string) { SetUserAgent(ua) }
+
+// GetUserAgent returns the User-Agent set by SetUserAgent.
+func GetUserAgent() string { return userAgent.Load().(string) }
+
+// setUserAgent sets the User-Agent of req to ua unless ua is empty or req
+// already has one.
+func setUserAgent(req *http.Request, ua string) {
+	if ua != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", ua)
+	}
+}
@@ -0,0 +1,91 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// MaxQueryBodySize is the largest body ParseQueryRequest reads.
+var MaxQueryBodySize int64 = 1 << 20
+
+// QueryRequestError is returned by ParseQueryRequest. Status is the HTTP
+// status to answer the request with. Err is the cause, which for invalid
+// queries joins the ValidationErrors found.
+type QueryRequestError struct {
+	Status int
+	Err    error
+}
+
+func (e *QueryRequestError) Error() string {
+	return fmt.Sprintf("opentsdb: invalid query request: %v", e.Err)
+}
+
+func (e *QueryRequestError) Unwrap() error { return e.Err }
+
+// Is matches the ErrBadQuery kind.
+func (e *QueryRequestError) Is(target error) bool {
+	return target == ErrBadQuery
+}
+
+// ParseQueryRequest parses an incoming /api/query request: the m query
+// syntax of GET requests and of POSTed forms, or a POSTed JSON request.
+// JSON requests may give a single query object instead of an array and
+// millisecond timestamps. The request is validated against the latest
+// version of OpenTSDB.
+func ParseQueryRequest(req *http.Request) (*Request, error) {
+	r, err := parseQueryRequest(req)
+	if err != nil {
+		var qe *QueryRequestError
+		if errors.As(err, &qe) {
+			return nil, err
+		}
+		return nil, &QueryRequestError{Status: http.StatusBadRequest, Err: err}
+	}
+	if errs := r.Validate(Version2_4); len(errs) > 0 {
+		return nil, &QueryRequestError{Status: http.StatusBadRequest, Err: errors.Join(errs...)}
+	}
+	return r, nil
+}
+
+func parseQueryRequest(req *http.Request) (*Request, error) {
+	switch req.Method {
+	case http.MethodGet:
+		return ParseRequest(req.URL.RawQuery, Version2_4)
+	case http.MethodPost:
+	default:
+		return nil, &QueryRequestError{Status: http.StatusMethodNotAllowed, Err: fmt.Errorf("method %s not allowed", req.Method)}
+	}
+
+	b, err := io.ReadAll(io.LimitReader(req.Body, MaxQueryBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > MaxQueryBodySize {
+		return nil, &QueryRequestError{Status: http.StatusRequestEntityTooLarge, Err: fmt.Errorf("body larger than %d bytes", MaxQueryBodySize)}
+	}
+	ct, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch ct {
+	case "application/x-www-form-urlencoded":
+		return ParseRequest(string(b), Version2_4)
+	case "", "application/json", "text/plain":
+	default:
+		return nil, &QueryRequestError{Status: http.StatusUnsupportedMediaType, Err: fmt.Errorf("unsupported content type %s", ct)}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	if q := bytes.TrimSpace(fields["queries"]); len(q) > 0 && q[0] == '{' {
+		fields["queries"] = append(append([]byte{'['}, q...), ']')
+		if b, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+	}
+	return RequestFromJSON(b)
+}
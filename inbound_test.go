@@ -0,0 +1,48 @@
+package opentsdb
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseQueryRequest(t *testing.T) {
+	tests := []struct {
+		method, ctype, target, body string
+		status                      int
+		metric                      string
+	}{
+		{"GET", "", "/api/query?start=1h-ago&m=sum:sys.cpu", "", 0, "sys.cpu"},
+		{"POST", "application/x-www-form-urlencoded", "/api/query", "start=1h-ago&m=sum:sys.mem", 0, "sys.mem"},
+		{"POST", "application/json", "/api/query", `{"start":1500000000000,"queries":[{"metric":"a","aggregator":"sum"}]}`, 0, "a"},
+		{"POST", "", "/api/query", `{"start":"1h-ago","queries":{"metric":"b","aggregator":"avg"}}`, 0, "b"},
+		{"POST", "application/json", "/api/query", `{"start":"1h-ago","queries":[{"metric":"c","aggregator":"nope"}]}`, http.StatusBadRequest, ""},
+		{"POST", "application/json", "/api/query", `{`, http.StatusBadRequest, ""},
+		{"POST", "application/xml", "/api/query", `<q/>`, http.StatusUnsupportedMediaType, ""},
+		{"POST", "", "/api/query", strings.Repeat(" ", int(MaxQueryBodySize)+1), http.StatusRequestEntityTooLarge, ""},
+		{"DELETE", "", "/api/query", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		if test.ctype != "" {
+			req.Header.Set("Content-Type", test.ctype)
+		}
+		r, err := ParseQueryRequest(req)
+		if test.status != 0 {
+			var qe *QueryRequestError
+			if !errors.As(err, &qe) || qe.Status != test.status || !errors.Is(err, ErrBadQuery) {
+				t.Errorf("%s %s: got %v", test.method, test.body, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: %v", test.method, test.body, err)
+			continue
+		}
+		if len(r.Queries) != 1 || r.Queries[0].Metric != test.metric {
+			t.Errorf("%s %s: got %+v", test.method, test.body, r.Queries)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package opentsdb
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FrozenTagSet is an immutable TagSet. Frozen sets are compared by their
+// canonical key, which is computed once.
+type FrozenTagSet struct {
+	key  string
+	tags TagSet
+}
+
+// Freeze returns an immutable copy of t.
+func Freeze(t TagSet) FrozenTagSet {
+	return FrozenTagSet{key: canonicalTags(t), tags: t.Copy()}
+}
+
+// Key returns the canonical k=v,k=v form of the set, sorted by key.
+func (f FrozenTagSet) Key() string { return f.key }
+
+// String returns the set in {k=v} form like TagSet.String.
+func (f FrozenTagSet) String() string { return "{" + f.key + "}" }
+
+// Len returns the number of tags in the set.
+func (f FrozenTagSet) Len() int { return len(f.tags) }
+
+// Get returns the value of tag k.
+func (f FrozenTagSet) Get(k string) (string, bool) {
+	v, ok := f.tags[k]
+	return v, ok
+}
+
+// Range calls fn for every tag until it returns false.
+func (f FrozenTagSet) Range(fn func(k, v string) bool) {
+	for k, v := range f.tags {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Equal reports whether f and o hold the same tags.
+func (f FrozenTagSet) Equal(o FrozenTagSet) bool { return f.key == o.key }
+
+// TagSet returns a mutable copy of the set.
+func (f FrozenTagSet) TagSet() TagSet { return f.tags.Copy() }
+
+// Shared returns the TagSet backing f without copying it. It must not be
+// modified.
+func (f FrozenTagSet) Shared() TagSet { return f.tags }
+
+// canonicalTags returns the k=v pairs of t sorted by key and separated by
+// commas. It matches TagSet.Tags.
+func canonicalTags(t TagSet) string {
+	switch len(t) {
+	case 0:
+		return ""
+	case 1:
+		for k, v := range t {
+			return k + "=" + v
+		}
+	}
+	var small [8]string
+	keys := small[:0]
+	n := len(t) - 1
+	for k, v := range t {
+		keys = append(keys, k)
+		n += len(k) + len(v) + 1
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.Grow(n)
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(t[k])
+	}
+	return b.String()
+}
+
+// TagPool interns tag sets so that identical sets share one map. It is safe
+// for concurrent use.
+type TagPool struct {
+	mu   sync.RWMutex
+	sets map[string]FrozenTagSet
+}
+
+// NewTagPool returns an empty pool.
+func NewTagPool() *TagPool {
+	return &TagPool{sets: map[string]FrozenTagSet{}}
+}
+
+// Intern returns the pooled set equal to t, adding a copy of t if there is
+// none.
+func (p *TagPool) Intern(t TagSet) FrozenTagSet {
+	key := canonicalTags(t)
+	p.mu.RLock()
+	f, ok := p.sets[key]
+	p.mu.RUnlock()
+	if ok {
+		return f
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if f, ok = p.sets[key]; !ok {
+		f = FrozenTagSet{key: key, tags: t.Copy()}
+		p.sets[key] = f
+	}
+	return f
+}
+
+// Len returns the number of distinct sets in the pool.
+func (p *TagPool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.sets)
+}
+
+// Reset empties the pool.
+func (p *TagPool) Reset() {
+	p.mu.Lock()
+	p.sets = map[string]FrozenTagSet{}
+	p.mu.Unlock()
+}
+
+// InternTags replaces the tags of every response with the shared set from
+// p. The tags of the responses must not be modified afterwards; functions
+// of this package that filter tags replace the map instead.
+func (rs ResponseSet) InternTags(p *TagPool) {
+	for _, r := range rs {
+		r.Tags = p.Intern(r.Tags).Shared()
+	}
+}
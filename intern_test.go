@@ -0,0 +1,55 @@
+package opentsdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTagPool(t *testing.T) {
+	p := NewTagPool()
+	a := p.Intern(TagSet{"host": "a", "dc": "x"})
+	b := p.Intern(TagSet{"dc": "x", "host": "a"})
+	c := p.Intern(TagSet{"host": "b"})
+	if !a.Equal(b) || a.Equal(c) || p.Len() != 2 {
+		t.Errorf("unexpected pool state: %v %v %v (%d)", a, b, c, p.Len())
+	}
+	if a.Key() != "dc=x,host=a" || a.String() != (TagSet{"host": "a", "dc": "x"}).String() {
+		t.Errorf("got key %s", a.Key())
+	}
+	// identical sets share one map
+	a.Shared()["probe"] = "1"
+	if _, ok := b.Get("probe"); !ok {
+		t.Error("interned sets are not shared")
+	}
+
+	rs := ResponseSet{
+		{Metric: "m", Tags: TagSet{"host": "b", "dc": "y"}},
+		{Metric: "m", Tags: TagSet{"host": "b", "dc": "y"}},
+	}
+	rs.InternTags(p)
+	r := &Request{Queries: []*Query{{Tags: TagSet{"host": "*"}}}}
+	FilterTags(r, rs)
+	if len(rs[0].Tags) != 1 || p.Intern(TagSet{"host": "b", "dc": "y"}).Len() != 2 {
+		t.Error("FilterTags modified interned tags")
+	}
+}
+
+func TestCanonicalTags(t *testing.T) {
+	for _, ts := range []TagSet{{}, {"a": "b"}, {"c": "d", "a": "b", "e": "f"}} {
+		if got, want := canonicalTags(ts), ts.Tags(); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func BenchmarkTagPoolIntern(b *testing.B) {
+	sets := make([]TagSet, 100)
+	for i := range sets {
+		sets[i] = TagSet{"host": fmt.Sprintf("host%d", i), "dc": "x", "env": "prod"}
+	}
+	p := NewTagPool()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Intern(sets[i%len(sets)])
+	}
+}
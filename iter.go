@@ -0,0 +1,92 @@
+package opentsdb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ResponseIterator executes a request one time slice at a time, so that
+// long ranges can be processed without holding all of their points in
+// memory. It is used like bufio.Scanner:
+//
+//	it := r.Iter(ctx, c, Day)
+//	for it.Next() {
+//		process(it.Scan())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ResponseIterator struct {
+	ctx   context.Context
+	c     Context
+	r     *Request
+	slice time.Duration
+
+	next, end time.Time
+	from, to  time.Time
+	cur       ResponseSet
+	err       error
+}
+
+// Iter returns an iterator over the results of r against c in consecutive
+// slices of the given length, oldest first. Each slice ends just before
+// the next one starts, so no point is returned twice.
+func (r *Request) Iter(ctx context.Context, c Context, slice Duration) *ResponseIterator {
+	it := &ResponseIterator{ctx: ctx, c: c, r: r, slice: time.Duration(slice)}
+	if slice < Second {
+		it.err = errors.New("opentsdb: iterator slice must be at least one second")
+		return it
+	}
+	it.next, it.end, it.err = r.timeRange(time.Now().UTC())
+	return it
+}
+
+// Next queries the next slice and reports whether it succeeded. It returns
+// false when the range is exhausted, the context is done or a query fails.
+func (it *ResponseIterator) Next() bool {
+	it.cur = nil
+	if it.err != nil || it.next.After(it.end) {
+		return false
+	}
+	if it.err = it.ctx.Err(); it.err != nil {
+		return false
+	}
+	from := it.next
+	to := from.Add(it.slice)
+	last := to.Add(-time.Second)
+	if it.r.MsResolution {
+		last = to.Add(-time.Millisecond)
+	}
+	if last.After(it.end) {
+		last = it.end
+	}
+	req := it.r.Clone()
+	req.Start = TimeSpec(strconv.FormatInt(from.Unix(), 10))
+	req.End = TimeSpec(strconv.FormatInt(last.Unix(), 10))
+	if it.r.MsResolution {
+		req.End = TimeSpec(strconv.FormatInt(last.UnixMilli(), 10))
+	}
+	if it.cur, it.err = it.c.Query(req); it.err != nil {
+		return false
+	}
+	it.from, it.to = from, last
+	it.next = to
+	return true
+}
+
+// Scan returns the results of the current slice.
+func (it *ResponseIterator) Scan() ResponseSet {
+	return it.cur
+}
+
+// Slice returns the inclusive time range of the current slice.
+func (it *ResponseIterator) Slice() (from, to time.Time) {
+	return it.from, it.to
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ResponseIterator) Err() error {
+	return it.err
+}
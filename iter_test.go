@@ -0,0 +1,40 @@
+package opentsdb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestIter(t *testing.T) {
+	c := NewMemContext()
+	c.AddSeries("m", TagSet{"host": "a"}, DPmap{100: 1, 159: 2, 160: 3, 230: 4, 280: 5})
+
+	r, err := ParseRequest("start=100&end=280&m=sum:m", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := r.Iter(context.Background(), c, Minute)
+	var sizes []int
+	total := 0
+	for it.Next() {
+		n := 0
+		for _, resp := range it.Scan() {
+			n += len(resp.DPS)
+		}
+		sizes = append(sizes, n)
+		total += n
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sizes) != 4 || total != 5 || sizes[0] != 2 || sizes[3] != 1 {
+		t.Errorf("got slices %v", sizes)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it = r.Iter(ctx, c, Minute)
+	if it.Next() || it.Err() != context.Canceled {
+		t.Errorf("got %v", it.Err())
+	}
+}
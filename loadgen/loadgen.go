@@ -0,0 +1,198 @@
+// Package loadgen replays OpenTSDB requests against a Context at a
+// controlled rate and reports latency, errors and throughput.
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/the-cloud-source/opentsdb"
+)
+
+// Options control a Run.
+type Options struct {
+	// QPS limits the rate requests are started at; zero is unlimited.
+	QPS float64
+	// Concurrency is the number of requests in flight, 1 by default.
+	Concurrency int
+	// Requests is the number of requests to send, cycling through the
+	// workload. Zero sends the workload once unless Duration is set.
+	Requests int
+	// Duration stops the run after that long.
+	Duration time.Duration
+	// MeasureBytes adds the JSON encoded size of responses to the report.
+	MeasureBytes bool
+}
+
+// Latency holds latency statistics.
+type Latency struct {
+	Min, Mean, P50, P90, P99, Max time.Duration
+}
+
+// Report is the outcome of a Run.
+type Report struct {
+	Requests   int
+	Errors     int
+	ErrorRate  float64
+	Elapsed    time.Duration
+	Latency    Latency
+	Series     int64
+	DataPoints int64
+	Bytes      int64
+	// DataPointsPerSec and QPS are computed over Elapsed.
+	DataPointsPerSec float64
+	QPS              float64
+	// ErrorCounts counts errors by message.
+	ErrorCounts map[string]int
+}
+
+// Run sends requests to c as configured by opts and returns the report once
+// done or when ctx is cancelled.
+func Run(ctx context.Context, c opentsdb.Context, requests []*opentsdb.Request, opts Options) (*Report, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("loadgen: no requests")
+	}
+	total := opts.Requests
+	if total <= 0 && opts.Duration <= 0 {
+		total = len(requests)
+	}
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	var mu sync.Mutex
+	report := &Report{ErrorCounts: map[string]int{}}
+	var latencies []time.Duration
+
+	jobs := make(chan *opentsdb.Request)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range jobs {
+				start := time.Now()
+				rs, err := c.Query(r)
+				d := time.Since(start)
+				var size int64
+				if err == nil && opts.MeasureBytes {
+					b, _ := json.Marshal(rs)
+					size = int64(len(b))
+				}
+				mu.Lock()
+				report.Requests++
+				latencies = append(latencies, d)
+				if err != nil {
+					report.Errors++
+					report.ErrorCounts[err.Error()]++
+				} else {
+					report.Series += int64(len(rs))
+					for _, resp := range rs {
+						report.DataPoints += int64(len(resp.DPS))
+					}
+					report.Bytes += size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var tick <-chan time.Time
+	if opts.QPS > 0 {
+		t := time.NewTicker(time.Duration(float64(time.Second) / opts.QPS))
+		defer t.Stop()
+		tick = t.C
+	}
+	began := time.Now()
+send:
+	for i := 0; total <= 0 || i < total; i++ {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				break send
+			}
+		}
+		select {
+		case jobs <- requests[i%len(requests)]:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	report.Elapsed = time.Since(began)
+	report.Latency = latencyStats(latencies)
+	if report.Requests > 0 {
+		report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+	}
+	if secs := report.Elapsed.Seconds(); secs > 0 {
+		report.QPS = float64(report.Requests) / secs
+		report.DataPointsPerSec = float64(report.DataPoints) / secs
+	}
+	return report, nil
+}
+
+func latencyStats(ls []time.Duration) Latency {
+	if len(ls) == 0 {
+		return Latency{}
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i] < ls[j] })
+	var sum time.Duration
+	for _, l := range ls {
+		sum += l
+	}
+	at := func(p float64) time.Duration {
+		return ls[int(p*float64(len(ls)-1)+0.5)]
+	}
+	return Latency{
+		Min:  ls[0],
+		Mean: sum / time.Duration(len(ls)),
+		P50:  at(0.5),
+		P90:  at(0.9),
+		P99:  at(0.99),
+		Max:  ls[len(ls)-1],
+	}
+}
+
+// LoadRecordings returns the requests saved in dir by an
+// opentsdb.RecordingContext, sorted by file name.
+func LoadRecordings(dir string) ([]*opentsdb.Request, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var reqs []*opentsdb.Request
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var rec struct {
+			Request json.RawMessage `json:"request"`
+		}
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return nil, err
+		}
+		r, err := opentsdb.RequestFromJSON(rec.Request)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, r)
+	}
+	return reqs, nil
+}
@@ -0,0 +1,63 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/the-cloud-source/opentsdb"
+)
+
+type flaky struct {
+	opentsdb.Context
+}
+
+func (f *flaky) Query(r *opentsdb.Request) (opentsdb.ResponseSet, error) {
+	if r.Queries[0].Metric == "missing" {
+		return nil, errors.New("no such metric")
+	}
+	return f.Context.Query(r)
+}
+
+func TestRun(t *testing.T) {
+	mem := opentsdb.NewMemContext()
+	now := opentsdb.Epoch(time.Now().Unix())
+	mem.AddSeries("m", opentsdb.TagSet{"host": "a"}, opentsdb.DPmap{now - 60: 1, now - 30: 2})
+	mem.AddSeries("m", opentsdb.TagSet{"host": "b"}, opentsdb.DPmap{now - 60: 1})
+	ok, _ := opentsdb.ParseRequest("start=1h-ago&m=none:m", opentsdb.Version2_2)
+	bad, _ := opentsdb.ParseRequest("start=1h-ago&m=sum:missing", opentsdb.Version2_2)
+
+	report, err := Run(context.Background(), &flaky{Context: mem}, []*opentsdb.Request{ok, bad}, Options{Requests: 10, Concurrency: 3, MeasureBytes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Requests != 10 || report.Errors != 5 || report.ErrorRate != 0.5 || report.ErrorCounts["no such metric"] != 5 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.Series != 10 || report.DataPoints != 15 || report.Bytes == 0 {
+		t.Errorf("unexpected totals %+v", report)
+	}
+	if l := report.Latency; l.Min > l.P50 || l.P50 > l.P99 || l.P99 > l.Max {
+		t.Errorf("unordered latencies %+v", l)
+	}
+
+	report, _ = Run(context.Background(), mem, []*opentsdb.Request{ok}, Options{QPS: 100, Duration: 100 * time.Millisecond})
+	if report.Requests < 5 || report.Requests > 12 {
+		t.Errorf("rate limit: %d requests in 100ms at 100 QPS", report.Requests)
+	}
+}
+
+func TestLoadRecordings(t *testing.T) {
+	dir := t.TempDir()
+	rc, err := opentsdb.NewRecordingContext(opentsdb.NewMemContext(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := opentsdb.ParseRequest("start=1h-ago&m=sum:m{host=a}", opentsdb.Version2_2)
+	rc.Query(r)
+	reqs, err := LoadRecordings(dir)
+	if err != nil || len(reqs) != 1 || reqs[0].Queries[0].Metric != "m" {
+		t.Errorf("got %v, %v", reqs, err)
+	}
+}
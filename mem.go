@@ -0,0 +1,322 @@
+package opentsdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemContext is a Context answering requests from series held in memory. It
+// evaluates the time range, filters, downsampling, rate and aggregation of
+// each query locally, which makes it suitable for tests and offline work.
+//
+// Aggregation happens on the timestamps present in the series, without the
+// interpolation OpenTSDB performs.
+type MemContext struct {
+	TSDBVersion Version
+
+	mu     sync.RWMutex
+	series map[string]*memSeries
+}
+
+type memSeries struct {
+	metric string
+	tags   TagSet
+	dps    DPmap
+}
+
+// NewMemContext returns an empty MemContext.
+func NewMemContext() *MemContext {
+	return &MemContext{
+		TSDBVersion: Version2_4,
+		series:      map[string]*memSeries{},
+	}
+}
+
+func (c *MemContext) Version() Version {
+	return c.TSDBVersion
+}
+
+// AddSeries stores points for the series identified by metric and tags,
+// merging them with points already stored. Millisecond timestamps are
+// converted to seconds.
+func (c *MemContext) AddSeries(metric string, tags TagSet, points DPmap) {
+	key := metric + tags.String()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &memSeries{metric: metric, tags: tags.Copy(), dps: DPmap{}}
+		c.series[key] = s
+	}
+	for t, v := range points {
+		if t > 0xffffffff {
+			t /= 1000
+		}
+		s.dps[t] = v
+	}
+}
+
+// Query evaluates r against the stored series.
+func (c *MemContext) Query(r *Request) (ResponseSet, error) {
+	start, end, err := r.timeRange(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	from, to := Epoch(start.Unix()), Epoch(end.Unix())
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rs := ResponseSet{}
+	for i, q := range r.Queries {
+		res, err := c.query(q, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, resp := range res {
+			if r.ShowQuery {
+				resp.Query = *q
+				resp.Query.Index = i
+			}
+		}
+		rs = append(rs, res...)
+	}
+	return rs, nil
+}
+
+func (c *MemContext) query(q *Query, from, to Epoch) (ResponseSet, error) {
+	filters := q.tagFilters()
+	groupBy := []string{}
+	for _, f := range filters {
+		if f.GroupBy {
+			groupBy = append(groupBy, f.TagK)
+		}
+	}
+	sort.Strings(groupBy)
+
+	var ds DownsampleSpec
+	whole := strings.HasPrefix(q.Downsample, "0all-")
+	if q.Downsample != "" {
+		spec := q.Downsample
+		if whole {
+			// a zero interval, which ParseDuration accepts as "0"
+			spec = "0" + spec[len("0all"):]
+		}
+		var err error
+		if ds, err = ParseDownsampleSpec(spec); err != nil {
+			return nil, err
+		}
+		if ds.Fill != "" {
+			if err := FillPolicy(ds.Fill).check(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	groups := map[string][]*memSeries{}
+	var keys []string
+	for _, s := range c.series {
+		if s.metric != q.Metric || !memMatch(s.tags, filters, q.ExplicitTags) {
+			continue
+		}
+		key := groupKey(s.tags, groupBy)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], s)
+	}
+	sort.Strings(keys)
+
+	rs := ResponseSet{}
+	for _, key := range keys {
+		var all []DPmap
+		var tags []TagSet
+		for _, s := range groups[key] {
+			dps, err := memSeriesPoints(s.dps, q, ds, whole, from, to)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, dps)
+			tags = append(tags, s.tags)
+		}
+		if q.Aggregator == "none" {
+			for i, dps := range all {
+				rs = append(rs, &Response{Metric: q.Metric, Tags: tags[i].Copy(), AggregateTags: []string{}, DPS: dps})
+			}
+			continue
+		}
+		dps, err := aggregateSeries(q.Aggregator, all)
+		if err != nil {
+			return nil, err
+		}
+		common, aggTags := commonTags(tags)
+		rs = append(rs, &Response{Metric: q.Metric, Tags: common, AggregateTags: aggTags, DPS: dps})
+	}
+	return rs, nil
+}
+
+// memMatch reports whether tags satisfy all filters. With explicit tags
+// the series may not carry tag keys that are not filtered on.
+func memMatch(tags TagSet, filters Filters, explicit bool) bool {
+	if !filters.Match(tags) {
+		return false
+	}
+	if explicit {
+		keys := map[string]bool{}
+		for _, f := range filters {
+			keys[f.TagK] = true
+		}
+		for k := range tags {
+			if !keys[k] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func groupKey(tags TagSet, groupBy []string) string {
+	var b strings.Builder
+	for _, k := range groupBy {
+		fmt.Fprintf(&b, "%s=%s,", k, tags[k])
+	}
+	return b.String()
+}
+
+// memSeriesPoints returns the points of dps within the time range, with the
+// query's downsampling and rate applied. With whole, the points are
+// downsampled into a single one at from, as "0all" does; otherwise the
+// buckets of the downsample interval between from and to that have no
+// points are filled according to the fill policy.
+func memSeriesPoints(dps DPmap, q *Query, ds DownsampleSpec, whole bool, from, to Epoch) (DPmap, error) {
+	out := DPmap{}
+	for t, v := range dps {
+		if t >= from && t <= to {
+			out[t] = v
+		}
+	}
+	if whole && len(out) > 0 {
+		vals := make([]Point, 0, len(out))
+		for _, v := range out {
+			vals = append(vals, v)
+		}
+		v, err := Aggregate(ds.Aggregator, vals)
+		if err != nil {
+			return nil, err
+		}
+		out = DPmap{from: v}
+	} else if ds.Interval > 0 {
+		step := Epoch(ds.Interval.SecondsInt64())
+		if step < 1 {
+			step = 1
+		}
+		buckets := map[Epoch][]Point{}
+		for _, t := range out.GetSortedTimes() {
+			b := floorEpoch(t, step)
+			buckets[b] = append(buckets[b], out[t])
+		}
+		out = DPmap{}
+		for b, vals := range buckets {
+			v, err := Aggregate(ds.Aggregator, vals)
+			if err != nil {
+				return nil, err
+			}
+			out[b] = v
+		}
+		if ds.Fill != "" {
+			times := out.GetSortedTimes()
+			filled := DPmap{}
+			for t := floorEpoch(from, step); t <= to; t += step {
+				if v, ok := out.fillAt(times, t, FillPolicy(ds.Fill)); ok {
+					filled[t] = v
+				}
+			}
+			out = filled
+		}
+	}
+	if q.Rate {
+		out = rate(out, q.RateOptions)
+	}
+	return out, nil
+}
+
+// rate returns the per second rate of change of dps.
+func rate(dps DPmap, opts *RateOptions) DPmap {
+	out := DPmap{}
+	times := dps.GetSortedTimes()
+	for i := 1; i < len(times); i++ {
+		prev, cur := dps[times[i-1]], dps[times[i]]
+		delta := cur - prev
+		if opts != nil && opts.Counter && delta < 0 {
+			if opts.DropResets {
+				continue
+			}
+			max := Point(opts.CounterMax)
+			if max == 0 {
+				max = Point(1<<63 - 1)
+			}
+			delta = max - prev + cur
+		}
+		r := delta / Point(times[i]-times[i-1])
+		if opts != nil && opts.ResetValue != 0 && r > Point(opts.ResetValue) {
+			r = 0
+		}
+		out[times[i]] = r
+	}
+	return out
+}
+
+// aggregateSeries merges all with the named aggregator at every timestamp
+// present in at least one of them.
+func aggregateSeries(agg string, all []DPmap) (DPmap, error) {
+	values := map[Epoch][]Point{}
+	for _, dps := range all {
+		for t, v := range dps {
+			values[t] = append(values[t], v)
+		}
+	}
+	out := DPmap{}
+	for t, vals := range values {
+		v, err := Aggregate(agg, vals)
+		if err != nil {
+			return nil, err
+		}
+		out[t] = v
+	}
+	return out, nil
+}
+
+// commonTags returns the tags that have the same value in every set, and the
+// sorted keys of the remaining tags.
+func commonTags(sets []TagSet) (TagSet, []string) {
+	common := TagSet{}
+	agg := []string{}
+	if len(sets) == 0 {
+		return common, agg
+	}
+	seen := map[string]bool{}
+	for _, ts := range sets {
+		for k := range ts {
+			seen[k] = true
+		}
+	}
+	for k := range seen {
+		v, ok := sets[0][k]
+		for _, ts := range sets[1:] {
+			if ov, found := ts[k]; !found || ov != v {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			common[k] = v
+		} else {
+			agg = append(agg, k)
+		}
+	}
+	sort.Strings(agg)
+	return common, agg
+}
@@ -0,0 +1,70 @@
+package opentsdb
+
+import "testing"
+
+func TestMemContext(t *testing.T) {
+	c := NewMemContext()
+	c.AddSeries("sys.cpu", TagSet{"host": "a", "dc": "x"}, DPmap{100: 1, 110: 2, 120: 3, 200: 9})
+	c.AddSeries("sys.cpu", TagSet{"host": "b", "dc": "x"}, DPmap{100: 10, 110: 20, 120: 30})
+	c.AddSeries("sys.cpu", TagSet{"host": "c", "dc": "y"}, DPmap{100: 100})
+	c.AddSeries("sys.mem", TagSet{"host": "a", "dc": "x"}, DPmap{100: 5})
+
+	tests := []struct {
+		q      string
+		series int
+		check  func(ResponseSet) bool
+	}{
+		{"sum:sys.cpu", 1, func(rs ResponseSet) bool {
+			return rs[0].DPS[100] == 111 && len(rs[0].AggregateTags) == 2
+		}},
+		{"sum:sys.cpu{dc=x}", 1, func(rs ResponseSet) bool {
+			return rs[0].DPS[110] == 22 && rs[0].Tags["dc"] == "x" && rs[0].AggregateTags[0] == "host"
+		}},
+		{"max:sys.cpu{host=*}", 3, nil},
+		{"sum:sys.cpu{}{host=wildcard(a*)}", 1, func(rs ResponseSet) bool {
+			return rs[0].DPS[120] == 3
+		}},
+		{"sum:sys.cpu{dc=literal_or(x)}{host=not_literal_or(a)}", 1, func(rs ResponseSet) bool {
+			return rs[0].DPS[100] == 10
+		}},
+		{"avg:30s-sum:sys.cpu{host=a}", 1, func(rs ResponseSet) bool {
+			return rs[0].DPS[90] == 3 && rs[0].DPS[120] == 3 && len(rs[0].DPS) == 2
+		}},
+		{"sum:0all-sum:sys.cpu{host=a}", 1, func(rs ResponseSet) bool {
+			return rs[0].DPS[90] == 6 && len(rs[0].DPS) == 1
+		}},
+		{"sum:30s-sum-zero:sys.cpu{host=c}", 1, func(rs ResponseSet) bool {
+			return rs[0].DPS[90] == 100 && rs[0].DPS[120] == 0 && rs[0].DPS[150] == 0 && len(rs[0].DPS) == 3
+		}},
+		{"sum:rate:sys.cpu{host=a}", 1, func(rs ResponseSet) bool {
+			return rs[0].DPS[110] == 0.1 && len(rs[0].DPS) == 2
+		}},
+		{"none:sys.cpu{dc=x}", 2, nil},
+	}
+	for _, test := range tests {
+		r, err := ParseRequest("start=90&end=150&m="+test.q, Version2_2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs, err := c.Query(r)
+		if err != nil {
+			t.Errorf("%s: %v", test.q, err)
+			continue
+		}
+		if len(rs) != test.series {
+			t.Errorf("%s: expected %d series, got %d", test.q, test.series, len(rs))
+			continue
+		}
+		if test.check != nil && !test.check(rs) {
+			t.Errorf("%s: unexpected result %v", test.q, rs[0])
+		}
+	}
+
+	r, err := ParseRequest("start=90&end=150&m=sum:30s-sum-bogus:sys.cpu", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query(r); err == nil {
+		t.Error("unknown fill policy accepted")
+	}
+}
@@ -0,0 +1,133 @@
+package opentsdb
+
+import (
+	"fmt"
+	"math"
+)
+
+// MergePolicy decides how MultiContext merges the points that several
+// backends return for the same series and timestamp.
+type MergePolicy int
+
+const (
+	// MergeQueryAggregator combines points with the aggregator of the
+	// query. It is the default.
+	MergeQueryAggregator MergePolicy = iota
+	// MergePreferFirst keeps the point of the first backend, in the order
+	// of Hosts.
+	MergePreferFirst
+	MergeSum
+	MergeMax
+	// MergeWeightedAvg averages the points of the backends, each weighted
+	// by the number of points of the series its backend returned, so that
+	// a backend holding a series partially counts less.
+	MergeWeightedAvg
+	// MergeErrorOnConflict fails the query with ErrMergeConflict when
+	// backends return different values for the same point.
+	MergeErrorOnConflict
+)
+
+func (p MergePolicy) String() string {
+	switch p {
+	case MergeQueryAggregator:
+		return "query-aggregator"
+	case MergePreferFirst:
+		return "prefer-first"
+	case MergeSum:
+		return "sum"
+	case MergeMax:
+		return "max"
+	case MergeWeightedAvg:
+		return "weighted-avg"
+	case MergeErrorOnConflict:
+		return "error-on-conflict"
+	}
+	return fmt.Sprintf("MergePolicy(%d)", int(p))
+}
+
+// mergeWeights are the weights of the points of a series merged with
+// MergeWeightedAvg: the number of points of the backend series each point
+// came from, summed over the backends merged into it.
+type mergeWeights struct {
+	base   float64 // weight of the points of the first backend
+	points map[Epoch]float64
+}
+
+func (w *mergeWeights) get(t Epoch) float64 {
+	if v, ok := w.points[t]; ok {
+		return v
+	}
+	return w.base
+}
+
+// join merges the points of src into those of r. weights, only used by
+// MergeWeightedAvg, are the weights of the points of r so far.
+func (p MergePolicy) join(r, src *Response, weights *mergeWeights) error {
+	dst := r.DPS
+	if p == MergeQueryAggregator {
+		dst.Join(src.DPS, src.Query.Aggregator)
+		return nil
+	}
+	weight := float64(len(src.DPS))
+	for t, v := range src.DPS {
+		old, ok := dst[t]
+		if !ok {
+			dst[t] = v
+			if weights != nil {
+				weights.points[t] = weight
+			}
+			continue
+		}
+		switch p {
+		case MergePreferFirst:
+		case MergeSum:
+			dst[t] = old + v
+		case MergeMax:
+			dst[t] = Point(math.Max(float64(old), float64(v)))
+		case MergeWeightedAvg:
+			w := weights.get(t)
+			dst[t] = Point((float64(old)*w + float64(v)*weight) / (w + weight))
+			weights.points[t] = w + weight
+		case MergeErrorOnConflict:
+			if old != v && !(math.IsNaN(float64(old)) && math.IsNaN(float64(v))) {
+				return fmt.Errorf("%w: %s at %d: %v and %v", ErrMergeConflict, stableKey(r), t, old, v)
+			}
+		default:
+			return fmt.Errorf("opentsdb: unknown merge policy %v", p)
+		}
+	}
+	return nil
+}
+
+// snapResponses snaps the points of rs to the downsample buckets of the
+// queries of request, so that points of the same bucket returned at
+// slightly different timestamps by several backends merge. The query of a
+// response is known from its Query with ShowQuery, or else when all queries
+// of the request downsample alike.
+func snapResponses(request *Request, rs ResponseSet) error {
+	var common string
+	for i, q := range request.Queries {
+		if i > 0 && q.Downsample != common {
+			common = ""
+			break
+		}
+		common = q.Downsample
+	}
+	for _, r := range rs {
+		d := common
+		if r.Query.Downsample != "" {
+			d = r.Query.Downsample
+		}
+		if d == "" {
+			continue
+		}
+		spec, err := ParseDownsampleSpec(d)
+		if err != nil {
+			return err
+		}
+		if r.DPS, err = r.DPS.Snap(spec.Interval, spec.Aggregator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package opentsdb
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMergePolicy(t *testing.T) {
+	sets := func(values ...Point) []ResponseSet {
+		var sets []ResponseSet
+		for _, v := range values {
+			r := &Response{Metric: "m", Tags: TagSet{}, Query: Query{Aggregator: "avg"}, DPS: DPmap{60: v}}
+			sets = append(sets, ResponseSet{r})
+		}
+		return sets
+	}
+	tests := []struct {
+		policy MergePolicy
+		want   Point
+	}{
+		{MergeQueryAggregator, 3.75}, // (1+2)/2, then (1.5+6)/2
+		{MergePreferFirst, 1},
+		{MergeSum, 9},
+		{MergeMax, 6},
+		{MergeWeightedAvg, 3},
+	}
+	for _, test := range tests {
+		rs, err := mergeResponseSets(sets(1, 2, 6), false, test.policy)
+		if err != nil {
+			t.Errorf("%v: %v", test.policy, err)
+			continue
+		}
+		if got := rs[0].DPS[60]; got != test.want {
+			t.Errorf("%v: got %v, want %v", test.policy, got, test.want)
+		}
+	}
+
+	// backends weighted by their points: 1 point, 3 points, 1 point
+	a := ResponseSet{{Metric: "m", Tags: TagSet{}, DPS: DPmap{60: 1}}}
+	b := ResponseSet{{Metric: "m", Tags: TagSet{}, DPS: DPmap{0: 5, 60: 5, 120: 5}}}
+	c := ResponseSet{{Metric: "m", Tags: TagSet{}, DPS: DPmap{0: 9, 60: 9}}}
+	rs, err := mergeResponseSets([]ResponseSet{a, b, c}, false, MergeWeightedAvg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DPmap{0: (5*3 + 9*2) / 5.0, 60: (1 + 5*3 + 9*2) / 6.0, 120: 5}
+	for ts, v := range want {
+		if got := rs[0].DPS[ts]; math.Abs(float64(got-v)) > 1e-9 {
+			t.Errorf("weighted avg at %d: got %v, want %v", ts, got, v)
+		}
+	}
+
+	if _, err := mergeResponseSets(sets(1, 1), false, MergeErrorOnConflict); err != nil {
+		t.Errorf("equal points: %v", err)
+	}
+	if _, err := mergeResponseSets(sets(1, 2), false, MergeErrorOnConflict); !errors.Is(err, ErrMergeConflict) {
+		t.Errorf("conflicting points: got %v", err)
+	}
+}
+
+func TestSnapTimestamps(t *testing.T) {
+	m, err := (DPmap{59: 1, 61: 2, 62: 4, 125: 3}).Snap(Minute, "avg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 3 || m[0] != 1 || m[60] != 3 || m[120] != 3 {
+		t.Errorf("got %v", m)
+	}
+
+	request := &Request{Queries: []*Query{{Metric: "m", Aggregator: "sum", Downsample: "1m-sum"}}}
+	a := ResponseSet{{Metric: "m", Tags: TagSet{}, DPS: DPmap{60: 1}}}
+	b := ResponseSet{{Metric: "m", Tags: TagSet{}, DPS: DPmap{61: 2}}}
+	if err := snapResponses(request, a); err != nil {
+		t.Fatal(err)
+	}
+	snapResponses(request, b)
+	rs, _ := mergeResponseSets([]ResponseSet{a, b}, false, MergeSum)
+	if len(rs[0].DPS) != 1 || rs[0].DPS[60] != 3 {
+		t.Errorf("merged: got %v", rs[0].DPS)
+	}
+}
@@ -0,0 +1,164 @@
+package opentsdb
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MetaCache lazily resolves and caches metadata from a Client: whether
+// metrics, tag keys and tag values exist, name suggestions and series
+// metadata. Entries expire after TTL and the least recently used are
+// evicted beyond MaxSize entries, so that validation, autocompletion and
+// auditing tools don't hammer the TSD. Errors aren't cached. It is safe
+// for concurrent use.
+type MetaCache struct {
+	Client *Client
+	// TTL is how long entries are kept, forever if zero.
+	TTL time.Duration
+	// MaxSize bounds the number of entries, unbounded if zero.
+	MaxSize int
+
+	mu      sync.Mutex
+	entries map[metaKey]*list.Element
+	lru     list.List // of *metaEntry, most recent first
+	now     func() time.Time
+}
+
+type metaKey struct {
+	kind, typ, name string
+	max             int
+}
+
+type metaEntry struct {
+	key     metaKey
+	value   interface{}
+	fetched time.Time
+}
+
+// NewMetaCache returns a cache of the metadata of c.
+func NewMetaCache(c *Client, ttl time.Duration, maxSize int) *MetaCache {
+	return &MetaCache{Client: c, TTL: ttl, MaxSize: maxSize}
+}
+
+func (m *MetaCache) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
+
+// get returns the cached value of key, or the one returned by fetch.
+func (m *MetaCache) get(key metaKey, fetch func() (interface{}, error)) (interface{}, error) {
+	now := m.clock()
+	m.mu.Lock()
+	if el, ok := m.entries[key]; ok {
+		e := el.Value.(*metaEntry)
+		if m.TTL <= 0 || now.Sub(e.fetched) < m.TTL {
+			m.lru.MoveToFront(el)
+			m.mu.Unlock()
+			return e.value, nil
+		}
+		m.lru.Remove(el)
+		delete(m.entries, key)
+	}
+	m.mu.Unlock()
+
+	v, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entries == nil {
+		m.entries = map[metaKey]*list.Element{}
+	}
+	if el, ok := m.entries[key]; ok {
+		m.lru.Remove(el)
+	}
+	m.entries[key] = m.lru.PushFront(&metaEntry{key, v, now})
+	for m.MaxSize > 0 && m.lru.Len() > m.MaxSize {
+		el := m.lru.Back()
+		m.lru.Remove(el)
+		delete(m.entries, el.Value.(*metaEntry).key)
+	}
+	return v, nil
+}
+
+// Len returns the number of cached entries, including expired ones not
+// yet evicted.
+func (m *MetaCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// Purge removes all entries.
+func (m *MetaCache) Purge() {
+	m.mu.Lock()
+	m.entries = nil
+	m.lru.Init()
+	m.mu.Unlock()
+}
+
+// Suggest returns the names Client.Suggest returns for typ, prefix and max.
+func (m *MetaCache) Suggest(ctx context.Context, typ, prefix string, max int) ([]string, error) {
+	v, err := m.get(metaKey{"suggest", typ, prefix, max}, func() (interface{}, error) {
+		return m.Client.Suggest(ctx, typ, prefix, max)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]string), nil
+}
+
+// Exists reports whether name exists as a metric, tag key or tag value,
+// as typ is metrics, tagk or tagv.
+func (m *MetaCache) Exists(ctx context.Context, typ, name string) (bool, error) {
+	v, err := m.get(metaKey{"exists", typ, name, 0}, func() (interface{}, error) {
+		// suggestions are sorted, so name comes first if it exists
+		names, err := m.Client.Suggest(ctx, typ, name, 1)
+		return err == nil && len(names) > 0 && names[0] == name, err
+	})
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+// MetricExists reports whether the metric exists.
+func (m *MetaCache) MetricExists(ctx context.Context, metric string) (bool, error) {
+	return m.Exists(ctx, "metrics", metric)
+}
+
+// TagKeyExists reports whether the tag key exists.
+func (m *MetaCache) TagKeyExists(ctx context.Context, tagk string) (bool, error) {
+	return m.Exists(ctx, "tagk", tagk)
+}
+
+// TagValueExists reports whether the tag value exists.
+func (m *MetaCache) TagValueExists(ctx context.Context, tagv string) (bool, error) {
+	return m.Exists(ctx, "tagv", tagv)
+}
+
+// TSMeta returns the metadata of all the series matching the search query,
+// e.g. "name:sys.cpu.user".
+func (m *MetaCache) TSMeta(ctx context.Context, query string) ([]TSMeta, error) {
+	v, err := m.get(metaKey{"tsmeta", "", query, 0}, func() (interface{}, error) {
+		var metas []TSMeta
+		it := m.Client.SearchAll(ctx, SearchTSMetaEndpoint, SearchQuery{Query: query})
+		for it.Next() {
+			var meta TSMeta
+			if err := it.Scan(&meta); err != nil {
+				return nil, err
+			}
+			metas = append(metas, meta)
+		}
+		return metas, it.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]TSMeta), nil
+}
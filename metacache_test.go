@@ -0,0 +1,75 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetaCache(t *testing.T) {
+	names := []string{"cpu", "cpu.user", "mem"}
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		var q struct {
+			Q   string `json:"q"`
+			Max int    `json:"max"`
+		}
+		json.NewDecoder(req.Body).Decode(&q)
+		matched := []string{}
+		for _, n := range names {
+			if strings.HasPrefix(n, q.Q) && len(matched) < q.Max {
+				matched = append(matched, n)
+			}
+		}
+		sort.Strings(matched)
+		json.NewEncoder(w).Encode(matched)
+	}))
+	defer ts.Close()
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	m := NewMetaCache(c, time.Minute, 2)
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name string
+		want bool
+	}{{"cpu", true}, {"cp", false}, {"cpu", true}} {
+		if ok, err := m.MetricExists(ctx, tc.name); err != nil || ok != tc.want {
+			t.Errorf("%s: got %v, %v", tc.name, ok, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("%d calls, want 2", calls)
+	}
+
+	m.MetricExists(ctx, "mem")
+	if m.Len() != 2 {
+		t.Errorf("%d entries, want 2", m.Len())
+	}
+	// cp was the least recently used
+	m.MetricExists(ctx, "cpu")
+	if calls != 3 {
+		t.Errorf("%d calls, want 3", calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	m.MetricExists(ctx, "cpu")
+	if calls != 4 {
+		t.Errorf("expired entry not refreshed, %d calls", calls)
+	}
+
+	got, err := m.Suggest(ctx, "metrics", "cpu", 10)
+	if err != nil || len(got) != 2 {
+		t.Errorf("Suggest: got %v, %v", got, err)
+	}
+}
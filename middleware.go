@@ -0,0 +1,144 @@
+package opentsdb
+
+import (
+	"fmt"
+	"sort"
+)
+
+// QueryMiddleware wraps a Context, typically to enforce a policy on the
+// requests passed to it.
+type QueryMiddleware func(Context) Context
+
+// Chain wraps c with mw. The first middleware sees requests first.
+func Chain(c Context, mw ...QueryMiddleware) Context {
+	for i := len(mw) - 1; i >= 0; i-- {
+		c = mw[i](c)
+	}
+	return c
+}
+
+type rewriteContext struct {
+	Context
+	rewrite func(r *Request, v Version) error
+}
+
+func (c *rewriteContext) Query(r *Request) (ResponseSet, error) {
+	r = r.Clone()
+	if err := c.rewrite(r, c.Version()); err != nil {
+		return nil, err
+	}
+	return c.Context.Query(r)
+}
+
+// RewriteMiddleware returns a middleware applying f to a deep copy of every
+// request. An error from f rejects the request.
+func RewriteMiddleware(f func(r *Request, v Version) error) QueryMiddleware {
+	return func(c Context) Context {
+		return &rewriteContext{Context: c, rewrite: f}
+	}
+}
+
+// InjectTags forces every query to only read series carrying tags,
+// replacing any tag or filter the query has on the same keys.
+func InjectTags(tags TagSet) QueryMiddleware {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return RewriteMiddleware(func(r *Request, v Version) error {
+		for _, q := range r.Queries {
+			qtags := TagSet{}
+			for k, val := range q.Tags {
+				if _, ok := tags[k]; !ok {
+					qtags[k] = val
+				}
+			}
+			filters := Filters{}
+			for _, f := range q.Filters {
+				if _, ok := tags[f.TagK]; !ok {
+					filters = append(filters, f)
+				}
+			}
+			for _, k := range keys {
+				if v.FilterSupport() {
+					filters = append(filters, Filter{Type: "literal_or", TagK: k, Filter: tags[k]})
+				} else {
+					qtags[k] = tags[k]
+				}
+			}
+			q.Tags, q.Filters = qtags, filters
+		}
+		return nil
+	})
+}
+
+// AllowMetrics rejects queries for metrics matching none of patterns.
+// Patterns may use '*' wildcards.
+func AllowMetrics(patterns ...string) QueryMiddleware {
+	return metricPolicy(patterns, true)
+}
+
+// DenyMetrics rejects queries for metrics matching any of patterns.
+// Patterns may use '*' wildcards.
+func DenyMetrics(patterns ...string) QueryMiddleware {
+	return metricPolicy(patterns, false)
+}
+
+func metricPolicy(patterns []string, allow bool) QueryMiddleware {
+	return RewriteMiddleware(func(r *Request, v Version) error {
+		for _, q := range r.Queries {
+			if matchAny(patterns, q.Metric) != allow {
+				return fmt.Errorf("%w: %s", ErrMetricDenied, q.Metric)
+			}
+		}
+		return nil
+	})
+}
+
+// SubstituteAggregators replaces the aggregators of queries and their
+// downsamplers according to m, e.g. to map "none" to "sum".
+func SubstituteAggregators(m map[string]string) QueryMiddleware {
+	return RewriteMiddleware(func(r *Request, v Version) error {
+		for _, q := range r.Queries {
+			if agg, ok := m[q.Aggregator]; ok {
+				q.Aggregator = agg
+			}
+			if q.Downsample == "" {
+				continue
+			}
+			ds, err := ParseDownsampleSpec(q.Downsample)
+			if err != nil {
+				return err
+			}
+			if agg, ok := m[ds.Aggregator]; ok {
+				ds.Aggregator = agg
+				q.Downsample = ds.String()
+			}
+		}
+		return nil
+	})
+}
+
+// CapDownsample makes every query downsample to intervals of at least min.
+// Finer downsamplers are coarsened, keeping their aggregator and fill
+// policy, and queries without one are downsampled with agg.
+func CapDownsample(min Duration, agg string) QueryMiddleware {
+	return RewriteMiddleware(func(r *Request, v Version) error {
+		for _, q := range r.Queries {
+			ds := DownsampleSpec{Interval: min, Aggregator: agg}
+			if q.Downsample != "" {
+				var err error
+				if ds, err = ParseDownsampleSpec(q.Downsample); err != nil {
+					return err
+				}
+				if ds.Interval >= min {
+					continue
+				}
+				ds.Interval = min
+			}
+			q.Downsample = ds.String()
+		}
+		return nil
+	})
+}
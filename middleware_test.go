@@ -0,0 +1,65 @@
+package opentsdb
+
+import (
+	"errors"
+	"testing"
+)
+
+type captureContext struct {
+	version Version
+	last    *Request
+}
+
+func (c *captureContext) Version() Version { return c.version }
+
+func (c *captureContext) Query(r *Request) (ResponseSet, error) {
+	c.last = r
+	return ResponseSet{}, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		mw      []QueryMiddleware
+		version Version
+		m       string
+		want    string
+		err     error
+	}{
+		{[]QueryMiddleware{InjectTags(TagSet{"env": "prod"})}, Version2_2, "sum:a{host=*}{env=dev}", "sum:a{host=wildcard(*)}{env=literal_or(prod)}", nil},
+		{[]QueryMiddleware{InjectTags(TagSet{"env": "prod"})}, Version2_1, "sum:a{env=dev,host=*}", "sum:a{env=prod,host=*}", nil},
+		{[]QueryMiddleware{AllowMetrics("os.*")}, Version2_2, "sum:os.cpu", "sum:os.cpu", nil},
+		{[]QueryMiddleware{AllowMetrics("os.*")}, Version2_2, "sum:app.cpu", "", ErrMetricDenied},
+		{[]QueryMiddleware{DenyMetrics("*.secret")}, Version2_2, "sum:db.secret", "", ErrMetricDenied},
+		{[]QueryMiddleware{SubstituteAggregators(map[string]string{"none": "sum", "dev": "avg"})}, Version2_2, "none:1m-dev:a", "sum:1m-avg:a", nil},
+		{[]QueryMiddleware{CapDownsample(5*Minute, "avg")}, Version2_2, "sum:1m-max-nan:a", "sum:5m-max-nan:a", nil},
+		{[]QueryMiddleware{CapDownsample(5*Minute, "avg")}, Version2_2, "sum:a", "sum:5m-avg:a", nil},
+		{[]QueryMiddleware{CapDownsample(5*Minute, "avg")}, Version2_2, "sum:1h-max:a", "sum:1h-max:a", nil},
+		{[]QueryMiddleware{DenyMetrics("a"), CapDownsample(5*Minute, "avg")}, Version2_2, "sum:a", "", ErrMetricDenied},
+	}
+	for i, test := range tests {
+		inner := &captureContext{version: test.version}
+		c := Chain(inner, test.mw...)
+		r, err := ParseRequest("start=1h-ago&m="+test.m, test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig := r.Queries[0].String()
+		_, err = c.Query(r)
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("test %d: expected %v, got %v", i, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if got := inner.last.Queries[0].String(); got != test.want {
+			t.Errorf("test %d: got %s, want %s", i, got, test.want)
+		}
+		if r.Queries[0].String() != orig {
+			t.Errorf("test %d: caller's request was modified", i)
+		}
+	}
+}
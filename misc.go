@@ -1,29 +1,81 @@
 package opentsdb
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
 	"sort"
+	"sync"
 )
 
+// stableKey returns the metric followed by the sorted aggregate tags and
+// k=v tag pairs of r, separated by spaces. Decoded responses carry their
+// key, built once by rekey; stableKey never stores it, so that responses
+// may be keyed concurrently.
 func stableKey(r *Response) string {
-	key := r.Metric
-	tags := []string{}
+	if r.key != "" {
+		return r.key
+	}
+	return buildStableKey(r)
+}
+
+// rekey stores the stable key of r in it. Code changing the metric, tags
+// or aggregate tags of a response must call it.
+func (r *Response) rekey() {
+	r.key = buildStableKey(r)
+}
+
+func buildStableKey(r *Response) string {
+	kb := keyBufs.Get().(*keyBuf)
+	kb.reset()
 	for _, k := range r.AggregateTags {
-		tags = append(tags, k)
+		kb.add(k, "", false)
 	}
 	for k, v := range r.Tags {
-		tags = append(tags, k+"="+v)
+		kb.add(k, v, true)
 	}
-	sort.Strings(tags)
+	sort.Sort(kb)
 
-	for _, k := range tags {
-		key += " " + k
+	kb.out = append(kb.out, r.Metric...)
+	for _, sp := range kb.spans {
+		kb.out = append(kb.out, ' ')
+		kb.out = append(kb.out, kb.scratch[sp[0]:sp[1]]...)
 	}
-
+	key := string(kb.out)
+	keyBufs.Put(kb)
 	return key
 }
 
+// keyBuf holds the rendered parts of a key while they are sorted.
+type keyBuf struct {
+	scratch []byte
+	spans   [][2]int
+	out     []byte
+}
+
+var keyBufs = sync.Pool{New: func() interface{} { return new(keyBuf) }}
+
+func (kb *keyBuf) reset() {
+	kb.scratch, kb.spans, kb.out = kb.scratch[:0], kb.spans[:0], kb.out[:0]
+}
+
+func (kb *keyBuf) add(k, v string, pair bool) {
+	start := len(kb.scratch)
+	kb.scratch = append(kb.scratch, k...)
+	if pair {
+		kb.scratch = append(kb.scratch, '=')
+		kb.scratch = append(kb.scratch, v...)
+	}
+	kb.spans = append(kb.spans, [2]int{start, len(kb.scratch)})
+}
+
+func (kb *keyBuf) Len() int      { return len(kb.spans) }
+func (kb *keyBuf) Swap(i, j int) { kb.spans[i], kb.spans[j] = kb.spans[j], kb.spans[i] }
+func (kb *keyBuf) Less(i, j int) bool {
+	a, b := kb.spans[i], kb.spans[j]
+	return bytes.Compare(kb.scratch[a[0]:a[1]], kb.scratch[b[0]:b[1]]) < 0
+}
+
 func dump(v interface{}, name string) error {
 
 	enc := json.NewEncoder(os.Stdout)
@@ -0,0 +1,132 @@
+package opentsdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// naiveStableKey is the concatenating implementation stableKey replaced,
+// kept as a reference.
+func naiveStableKey(r *Response) string {
+	key := r.Metric
+	tags := []string{}
+	tags = append(tags, r.AggregateTags...)
+	for k, v := range r.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+	for _, k := range tags {
+		key += " " + k
+	}
+	return key
+}
+
+func TestStableKey(t *testing.T) {
+	rs := []*Response{
+		{Metric: "m"},
+		{Metric: "m", Tags: TagSet{"host": "a"}},
+		{Metric: "m", Tags: TagSet{"host": "a", "dc": "x"}, AggregateTags: []string{"host", "az"}},
+		{Metric: "m", Tags: TagSet{"a": "=b", "a=": "b"}},
+	}
+	for _, r := range rs {
+		want := naiveStableKey(r)
+		if got := stableKey(r); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		r.rekey()
+		if got := stableKey(r); got != want {
+			t.Errorf("cached: got %q, want %q", got, want)
+		}
+	}
+
+	rs2, err := DecodeResponseSet(strings.NewReader(`[{"metric":"m","tags":{"host":"a"},"dps":{}}]`))
+	if err != nil || rs2[0].key != "m host=a" {
+		t.Fatalf("decoded key %q, %v", rs2[0].key, err)
+	}
+	rs2, _ = RenameMetric("m", "n")(nil, rs2)
+	if got := stableKey(rs2[0]); got != "n host=a" {
+		t.Errorf("after renaming: got %q", got)
+	}
+
+	// keys are only read, so shared responses may be keyed concurrently
+	shared := ResponseSet{{Metric: "m", Tags: TagSet{"host": "a"}, DPS: DPmap{1: 1}}}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			DiffResponseSets(shared, shared, 0)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMergeResponseSets(t *testing.T) {
+	q := Query{Aggregator: "sum"}
+	a := ResponseSet{{Metric: "m", Tags: TagSet{"host": "a"}, DPS: DPmap{1: 1}, Query: q}}
+	b := ResponseSet{
+		{Metric: "m", Tags: TagSet{"host": "b"}, DPS: DPmap{1: 2}, Query: q},
+		{Metric: "m", Tags: TagSet{"host": "a"}, DPS: DPmap{2: 1}, Query: q},
+	}
+	c := ResponseSet{{Metric: "m", Tags: TagSet{"host": "b"}, DPS: DPmap{2: 2}, Query: q}}
+	rs, _ := mergeResponseSets([]ResponseSet{a, b, c}, false, MergeQueryAggregator)
+	if len(rs) != 2 || len(rs[0].DPS) != 2 || len(rs[1].DPS) != 2 {
+		t.Errorf("unexpected merge result %v", rs)
+	}
+}
+
+// benchmarkSets returns response sets of hosts with series each, keyed as
+// decoded responses are.
+func benchmarkSets(hosts, series int) []ResponseSet {
+	sets := make([]ResponseSet, hosts)
+	for h := range sets {
+		for i := 0; i < series; i++ {
+			r := &Response{
+				Metric:        "sys.cpu",
+				Tags:          TagSet{"host": fmt.Sprintf("host%d", i), "dc": "x", "env": "prod"},
+				AggregateTags: []string{"core"},
+				Query:         Query{Aggregator: "sum"},
+				DPS:           DPmap{Epoch(h): 1},
+			}
+			r.rekey()
+			sets[h] = append(sets[h], r)
+		}
+	}
+	return sets
+}
+
+func BenchmarkStableKey(b *testing.B) {
+	r := benchmarkSets(1, 1)[0][0]
+	b.Run("naive", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			naiveStableKey(r)
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buildStableKey(r)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		r.rekey()
+		for i := 0; i < b.N; i++ {
+			stableKey(r)
+		}
+	})
+}
+
+func BenchmarkMergeResponseSets(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		sets := benchmarkSets(3, 5000)
+		b.StartTimer()
+		mergeResponseSets(sets, false, MergeQueryAggregator)
+	}
+}
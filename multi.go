@@ -1,25 +1,47 @@
 package opentsdb
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
-	"fmt"
 	"io"
-	"log"
 	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // SynContext is a context that enables limiting response size and filtering tags
 type SynContext struct {
-	Host        string
-	Limit       int64   // Limit limits response size in bytes
-	FilterTags  bool    // FilterTags removes tagks from results if that tagk was not in the request
-	TSDBVersion Version // Use the version to see if groupby and filters are supported
-	Synth       TagSet  // Synthetic Tags
+	Host          string
+	Limit         int64         // Limit limits response size in bytes
+	MaxSeries     int           // MaxSeries, if positive, limits the number of series of a response
+	MaxDataPoints int64         // MaxDataPoints, if positive, limits the number of datapoints of a response
+	FilterTags    bool          // FilterTags removes tagks from results if that tagk was not in the request
+	TSDBVersion   Version       // Use the version to see if groupby and filters are supported
+	Synth         TagSet        // Synthetic Tags
+	Pool          *TagPool      // Pool, if set, interns the tags of responses
+	Signer        RequestSigner // Signer, if set, signs the requests to the host
+	Pipeline      Pipeline      // Pipeline post-processes results, after FilterTags
+
+	// Warn, if set, receives the warnings of converting requests for a
+	// host whose TSDBVersion doesn't support filters.
+	Warn func(ConversionWarning)
 }
 
 type MultiContext struct {
 	Hosts []*SynContext
+	// Merge is how points returned by several hosts for the same series
+	// are merged.
+	Merge MergePolicy
+	// SnapTimestamps moves points to the start of their downsample bucket
+	// before merging.
+	SnapTimestamps bool
+	// Gzip compresses the query body sent to the hosts.
+	Gzip bool
+	// HTTPClient is used for the requests to all hosts, DefaultClient if
+	// nil.
+	HTTPClient *http.Client
 }
 
 func (_ *SynContext) Version() Version {
@@ -62,29 +84,87 @@ func (ctx *SynContext) Query(r *Request) (ResponseSet, error) {
 }
 
 func (ctx *SynContext) QueryWithHeaders(r *Request, headers http.Header) (ResponseSet, error) {
+	b, err := encodeQuery(r, false)
+	if err != nil {
+		return nil, err
+	}
+	tr, _, err := ctx.query(r, b, headers, withTimeout(DefaultClient, r.Timeout))
+	return tr, err
+}
+
+// queryBody is a request encoded once for all hosts.
+type queryBody struct {
+	json, gz []byte
+}
+
+func encodeQuery(r *Request, gz bool) (queryBody, error) {
+	var b queryBody
+	var err error
+	if b.json, err = json.Marshal(r); err != nil || !gz {
+		return b, err
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b.json)
+	if err := w.Close(); err != nil {
+		return b, err
+	}
+	b.gz = buf.Bytes()
+	return b, nil
+}
+
+// convert returns r, encoded as b, converted for the TSDBVersion of the
+// host if it is set and doesn't support filters.
+func (ctx *SynContext) convert(r *Request, b queryBody) (*Request, queryBody, error) {
+	if ctx.TSDBVersion == (Version{}) || ctx.TSDBVersion.FilterSupport() {
+		return r, b, nil
+	}
+	r, warnings := ConvertRequest(r, ctx.TSDBVersion)
+	if ctx.Warn != nil {
+		for _, w := range warnings {
+			ctx.Warn(w)
+		}
+	}
+	b, err := encodeQuery(r, b.gz != nil)
+	return r, b, err
+}
 
-	tr := ResponseSet{}
+// query performs r, encoded as b, also returning the stats of the host.
+func (ctx *SynContext) query(r *Request, b queryBody, headers http.Header, client *http.Client) (ResponseSet, HostStats, error) {
+	start := time.Now()
+	stats := HostStats{Host: ctx.Host}
 
-	resp, err := r.QueryResponseWithHeaders(ctx.Host, nil, headers)
+	r, b, err := ctx.convert(r, b)
 	if err != nil {
-		return nil, err
+		return nil, stats, err
 	}
-	defer resp.Body.Close()
 
-	lr := &io.LimitedReader{R: resp.Body, N: ctx.Limit}
-	err = json.NewDecoder(lr).Decode(&tr)
-	if lr.N == 0 {
-		err = fmt.Errorf("TSDB response too large: limited to %E bytes", float64(ctx.Limit))
-		log.Print(err)
-		return nil, err
+	resp, err := postQuery(r.Context(), ctx.Host, b.json, b.gz, sender{client: client, signer: ctx.Signer}, headers)
+	if err != nil {
+		stats.Wall = time.Since(start)
+		return nil, stats, err
 	}
+	defer closeBody(resp.Body)
+
+	cr := &countingReader{R: resp.Body}
+	tr, err := decodeLimited(cr, responseLimits{ctx.Limit, ctx.MaxSeries, ctx.MaxDataPoints})
+	stats.Bytes = cr.N
 	if err != nil {
-		return nil, err
+		stats.Wall = time.Since(start)
+		return nil, stats, err
+	}
+	stats.add(tr)
+	stats.Wall = time.Since(start)
+	if ctx.Pool != nil {
+		tr.InternTags(ctx.Pool)
 	}
 	if ctx.FilterTags {
 		FilterTags(r, tr)
 	}
-	return tr, nil
+	if tr, err = ctx.Pipeline.Apply(r, tr); err != nil {
+		return nil, stats, err
+	}
+	return tr, stats, nil
 }
 
 func (ctx *MultiContext) Query(request *Request) (ResponseSet, error) {
@@ -92,41 +172,142 @@ func (ctx *MultiContext) Query(request *Request) (ResponseSet, error) {
 }
 
 func (ctx *MultiContext) QueryWithHeaders(request *Request, headers http.Header) (ResponseSet, error) {
+	result, _, err := ctx.QueryWithStats(request, headers)
+	return result, err
+}
+
+// QueryWithStats performs the request like QueryWithHeaders and also returns
+// the stats of each host, in the order of Hosts. On error the stats of the
+// hosts queried so far are returned, the last one being the host that failed.
+func (ctx *MultiContext) QueryWithStats(request *Request, headers http.Header) (ResponseSet, []HostStats, error) {
 
-	resultsIdx := map[string]int{}
-	result := ResponseSet{}
 	responses := []ResponseSet{}
+	stats := []HostStats{}
+
+	// The request is encoded once for all hosts.
+	b, err := encodeQuery(request, ctx.Gzip)
+	if err != nil {
+		return nil, stats, err
+	}
+	client := ctx.HTTPClient
+	if client == nil {
+		client = DefaultClient
+	}
+	client = withTimeout(client, request.Timeout)
 
 	for _, host := range ctx.Hosts {
-		tr, err := host.QueryWithHeaders(request, headers)
+		tr, hs, err := host.query(request, b, headers, client)
+		stats = append(stats, hs)
 		if err != nil {
-			return nil, err
+			return nil, stats, err
+		}
+		if ctx.SnapTimestamps {
+			if err := snapResponses(request, tr); err != nil {
+				return nil, stats, err
+			}
 		}
 		responses = append(responses, tr)
 	}
 
+	result, err := mergeResponseSets(responses, request.ShowQuery, ctx.Merge)
+	if err != nil {
+		return nil, stats, err
+	}
+	if request.ShowQuery {
+		result.SortByQueryIndex()
+	} else {
+		result.Sort()
+	}
+	return result, stats, nil
+}
+
+// mergeResponseSets joins the datapoints of series present in several sets
+// according to policy. With byQuery, series are only joined if they answer
+// the same query.
+func mergeResponseSets(responses []ResponseSet, byQuery bool, policy MergePolicy) (ResponseSet, error) {
+	result := ResponseSet{}
 	if len(responses) < 1 {
 		return result, nil
 	}
+	resultsIdx := make(map[string]int, len(responses[0]))
+	var weights map[int]*mergeWeights
+	if policy == MergeWeightedAvg {
+		weights = map[int]*mergeWeights{}
+	}
 
 	for _, r := range responses[0] {
-		resKey := stableKey(r)
+		resKey := mergeKey(r, byQuery)
 		result = append(result, r)
 		resultsIdx[resKey] = len(result) - 1
 	}
 
 	for i := 1; i < len(responses); i++ {
 		for _, r := range responses[i] {
-			resKey := stableKey(r)
+			resKey := mergeKey(r, byQuery)
 			idx, ok := resultsIdx[resKey]
 			if !ok {
 				result = append(result, r)
-				resultsIdx[resKey] = len(result)
+				resultsIdx[resKey] = len(result) - 1
 				continue
 			}
-			result[idx].DPS.Join(r.DPS, r.Query.Aggregator)
+			if weights != nil && weights[idx] == nil {
+				weights[idx] = &mergeWeights{
+					base:   float64(len(result[idx].DPS)),
+					points: map[Epoch]float64{},
+				}
+			}
+			if err := policy.join(result[idx], r, weights[idx]); err != nil {
+				return nil, err
+			}
 		}
 	}
 
 	return result, nil
 }
+
+// mergeKey returns the key identifying r among the responses to merge,
+// prefixed with the index of its query when byQuery is set.
+func mergeKey(r *Response, byQuery bool) string {
+	if !byQuery {
+		return stableKey(r)
+	}
+	return strconv.Itoa(r.Query.Index) + " " + stableKey(r)
+}
+
+// HostStats describe the query of one host of a MultiContext. ScanTime and
+// EmittedDPs come from the statsSummary of the response when the request
+// has ShowSummary, or else from the stats of each series with ShowStats.
+type HostStats struct {
+	Host       string
+	Series     int
+	ScanTime   float64 // milliseconds
+	EmittedDPs int64
+	Bytes      int64
+	Wall       time.Duration
+}
+
+func (s *HostStats) add(rs ResponseSet) {
+	s.Series = len(rs)
+	if sum := rs.Summary(); sum != nil {
+		s.ScanTime, s.EmittedDPs = sum.AvgQueryScanTime, sum.EmittedDPs
+		return
+	}
+	for _, r := range rs {
+		if r.Stats != nil {
+			s.ScanTime += r.Stats.QueryScanTime
+			s.EmittedDPs += int64(r.Stats.EmittedDPS)
+		}
+	}
+}
+
+// countingReader counts the bytes read from R.
+type countingReader struct {
+	R io.Reader
+	N int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.R.Read(p)
+	r.N += int64(n)
+	return n, err
+}
@@ -0,0 +1,100 @@
+package opentsdb
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMultiContextStats(t *testing.T) {
+	bodies := []string{
+		`[{"metric":"m","tags":{"host":"a"},"aggregateTags":[],"dps":{"60":1},"stats":{"queryScanTime":2,"emittedDPs":1}}]`,
+		`[{"metric":"m","tags":{"host":"a"},"aggregateTags":[],"query":{"aggregator":"sum"},"dps":{"120":2}},` +
+			`{"statsSummary":{"avgQueryScanTime":5,"emittedDPs":4}}]`,
+	}
+	var hosts []*SynContext
+	for _, body := range bodies {
+		body := body
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		defer ts.Close()
+		hosts = append(hosts, NewSynContext(ts.URL, -1))
+	}
+
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	rs, stats, err := NewMultiContext(hosts...).QueryWithStats(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || len(rs[0].DPS) != 2 {
+		t.Errorf("merged: got %v", rs)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("got %d host stats", len(stats))
+	}
+	for i, want := range []HostStats{{ScanTime: 2, EmittedDPs: 1}, {ScanTime: 5, EmittedDPs: 4}} {
+		s := stats[i]
+		if s.Host != hosts[i].Host || s.Series != 1 || s.ScanTime != want.ScanTime || s.EmittedDPs != want.EmittedDPs ||
+			s.Bytes != int64(len(bodies[i])) || s.Wall <= 0 {
+			t.Errorf("host %d: got %+v", i, s)
+		}
+	}
+}
+
+func TestMergeByQuery(t *testing.T) {
+	series := func(index int, t Epoch) *Response {
+		return &Response{Metric: "m", Tags: TagSet{"host": "a"}, Query: Query{Aggregator: "sum", Index: index}, DPS: DPmap{t: 1}}
+	}
+	sets := func() []ResponseSet {
+		return []ResponseSet{{series(0, 60), series(1, 60)}, {series(0, 120), series(1, 120)}}
+	}
+
+	if rs, _ := mergeResponseSets(sets(), false, MergeQueryAggregator); len(rs[0].DPS) != 1 {
+		t.Errorf("without ShowQuery: got %v", rs)
+	}
+	rs, _ := mergeResponseSets(sets(), true, MergeQueryAggregator)
+	if len(rs) != 2 || len(rs[0].DPS) != 2 || len(rs[1].DPS) != 2 {
+		t.Fatalf("with ShowQuery: got %v", rs)
+	}
+	groups := rs.GroupByQuery()
+	if len(groups) != 2 || len(groups[0]) != 1 || groups[1][0].Query.Index != 1 {
+		t.Errorf("groups: got %v", groups)
+	}
+}
+
+func TestMultiContextGzip(t *testing.T) {
+	var queries []*Request
+	var hosts []*SynContext
+	for i := 0; i < 3; i++ {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Content-Encoding") != "gzip" {
+				t.Errorf("got encoding %q", r.Header.Get("Content-Encoding"))
+			}
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(zr)
+			q, err := RequestFromJSON(b)
+			if err != nil {
+				t.Error(err)
+			}
+			queries = append(queries, q)
+			w.Write([]byte(`[]`))
+		}))
+		defer ts.Close()
+		hosts = append(hosts, NewSynContext(ts.URL, -1))
+	}
+	mc := NewMultiContext(hosts...)
+	mc.Gzip = true
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	if _, err := mc.Query(r); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 3 || queries[2].Queries[0].Metric != "m" {
+		t.Errorf("got %v", queries)
+	}
+}
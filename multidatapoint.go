@@ -0,0 +1,96 @@
+package opentsdb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Append adds a point of metric at ts with value and a copy of tags.
+func (m *MultiDataPoint) Append(metric string, ts Epoch, value interface{}, tags TagSet) *DataPoint {
+	d := &DataPoint{Metric: metric, Timestamp: ts, Value: value, Tags: tags.Copy()}
+	*m = append(*m, d)
+	return d
+}
+
+// Chunk splits m, in order, into batches of at most maxPoints points whose
+// /api/put body is at most maxBytes as estimated by TotalBytes. Zero limits
+// are not enforced. A point larger than maxBytes gets a batch of its own.
+func (m MultiDataPoint) Chunk(maxPoints, maxBytes int) []MultiDataPoint {
+	var chunks []MultiDataPoint
+	start, size := 0, 2
+	for i, d := range m {
+		n := pointSize(d)
+		full := maxPoints > 0 && i-start >= maxPoints ||
+			maxBytes > 0 && i > start && size+1+n > maxBytes
+		if full {
+			chunks = append(chunks, m[start:i:i])
+			start, size = i, 2
+		}
+		if i > start {
+			size++
+		}
+		size += n
+	}
+	if start < len(m) {
+		chunks = append(chunks, m[start:])
+	}
+	return chunks
+}
+
+// Dedup returns the points of m with distinct metric, tags and timestamp,
+// keeping the last of duplicates at the position of the first.
+func (m MultiDataPoint) Dedup() MultiDataPoint {
+	seen := make(map[string]int, len(m))
+	out := make(MultiDataPoint, 0, len(m))
+	for _, d := range m {
+		key := d.Metric + d.Tags.String() + strconv.FormatInt(int64(d.Timestamp), 10)
+		if i, ok := seen[key]; ok {
+			out[i] = d
+			continue
+		}
+		seen[key] = len(out)
+		out = append(out, d)
+	}
+	return out
+}
+
+// SortByTime sorts m by timestamp, keeping the order of points at the same
+// time.
+func (m MultiDataPoint) SortByTime() {
+	sort.SliceStable(m, func(i, j int) bool { return m[i].Timestamp < m[j].Timestamp })
+}
+
+// TotalBytes estimates the size of m as an /api/put body, without the
+// escaping of special characters.
+func (m MultiDataPoint) TotalBytes() int {
+	n := 2
+	for i, d := range m {
+		if i > 0 {
+			n++
+		}
+		n += pointSize(d)
+	}
+	return n
+}
+
+// pointSize estimates the size of d in JSON.
+func pointSize(d *DataPoint) int {
+	n := len(`{"metric":"","timestamp":"","value":,"tags":{}}`) + len(d.Metric)
+	n += len(strconv.FormatInt(int64(d.Timestamp), 10))
+	switch v := d.Value.(type) {
+	case string:
+		n += len(v) + 2
+	case nil:
+		n += len("null")
+	default:
+		n += len(fmt.Sprint(v))
+	}
+	for k, v := range d.Tags {
+		n += len(k) + len(v) + len(`"":"",`)
+	}
+	if len(d.Tags) > 0 {
+		n--
+	}
+	return n
+}
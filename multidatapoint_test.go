@@ -0,0 +1,60 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMultiDataPoint(t *testing.T) {
+	var m MultiDataPoint
+	tags := TagSet{"host": "a", "dc": "lga"}
+	m.Append("cpu", 3, 1.5, tags)
+	m.Append("cpu", 1, int64(2), tags)
+	m.Append("mem", 3, 7, TagSet{"host": "a"})
+	m.Append("cpu", 3, 4.25, tags)
+	tags["host"] = "b"
+	if m[0].Tags["host"] != "a" {
+		t.Error("Append kept the caller's tags")
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.TotalBytes() != len(b) {
+		t.Errorf("TotalBytes %d, marshaled %d", m.TotalBytes(), len(b))
+	}
+
+	d := m.Dedup()
+	if len(d) != 3 || d[0].Value != 4.25 || d[2].Metric != "mem" {
+		t.Errorf("Dedup: got %v", d)
+	}
+
+	d.SortByTime()
+	if d[0].Timestamp != 1 || d[1].Value != 4.25 || d[2].Metric != "mem" {
+		t.Errorf("SortByTime: got %v", d)
+	}
+
+	for _, tc := range []struct {
+		points, bytes int
+		want          []int
+	}{
+		{0, 0, []int{4}},
+		{3, 0, []int{3, 1}},
+		{0, MultiDataPoint(m[:2]).TotalBytes(), []int{2, 2}},
+		{0, 10, []int{1, 1, 1, 1}},
+		{1, 1 << 20, []int{1, 1, 1, 1}},
+	} {
+		var got []int
+		for _, c := range m.Chunk(tc.points, tc.bytes) {
+			got = append(got, len(c))
+			if tc.bytes > 10 && c.TotalBytes() > tc.bytes {
+				t.Errorf("chunk of %d bytes over %d", c.TotalBytes(), tc.bytes)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Chunk(%d, %d): got %v, want %v", tc.points, tc.bytes, got, tc.want)
+		}
+	}
+}
@@ -13,11 +13,14 @@ type openTsdbNameConfig struct {
 	basicValidator         name.RuneLevelValidator
 }
 
+// isTSDBRune reports whether r may appear in OpenTSDB metric and tag names.
+func isTSDBRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' || r == '/'
+}
+
 // NewOpenTsdbNameProcessor constructs a new name.RuneLevelProcessor which can work with the OpenTSDB name format
 func NewOpenTsdbNameProcessor(invalidRuneReplacement string) (name.RuneLevelProcessor, error) {
-	bv, err := name.NewBasicValidator(false, func(r rune) bool {
-		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' || r == '/'
-	})
+	bv, err := name.NewBasicValidator(false, isTSDBRune)
 
 	if err != nil {
 		//return nil, errors.Wrap(err, "Failed to construct basic validator")
@@ -0,0 +1,433 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NonFinitePolicy says how NaN and infinite points are encoded to JSON,
+// which has no literal for them. Points and DPmaps marshal with
+// NonFiniteNull; an Encoder applies another policy.
+type NonFinitePolicy int
+
+const (
+	// NonFiniteNull encodes them as null, which decodes back to NaN. It is
+	// the default.
+	NonFiniteNull NonFinitePolicy = iota
+	// NonFiniteString encodes them as "NaN", "Infinity" and "-Infinity".
+	NonFiniteString
+	// NonFiniteDrop leaves them out of DPmaps. Single points are encoded
+	// as null.
+	NonFiniteDrop
+	// NonFiniteError fails the encoding like encoding/json does.
+	NonFiniteError
+)
+
+var errNonFinite = errors.New("opentsdb: cannot encode non-finite point")
+
+func (policy NonFinitePolicy) appendPoint(b []byte, p Point) ([]byte, error) {
+	f := float64(p)
+	if !math.IsNaN(f) && !math.IsInf(f, 0) {
+		// same format as encoding/json
+		format := byte('f')
+		if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+			format = 'e'
+		}
+		b = strconv.AppendFloat(b, f, format, -1, 64)
+		if n := len(b); format == 'e' && n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+		return b, nil
+	}
+	switch policy {
+	case NonFiniteString:
+		switch {
+		case math.IsNaN(f):
+			return append(b, `"NaN"`...), nil
+		case f > 0:
+			return append(b, `"Infinity"`...), nil
+		default:
+			return append(b, `"-Infinity"`...), nil
+		}
+	case NonFiniteError:
+		return nil, errNonFinite
+	}
+	return append(b, "null"...), nil
+}
+
+// MarshalJSON encodes p as a number, or as null if it is NaN or infinite.
+func (p Point) MarshalJSON() ([]byte, error) {
+	return NonFiniteNull.appendPoint(nil, p)
+}
+
+// UnmarshalJSON decodes a number, null, which is NaN, or the NaN, Infinity
+// and -Infinity literals OpenTSDB emits, quoted or not.
+func (p *Point) UnmarshalJSON(b []byte) error {
+	if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+		*p = Point(f)
+		return nil
+	}
+	switch string(bytes.Trim(b, `"`)) {
+	case "null", "NaN":
+		*p = Point(math.NaN())
+	case "Infinity", "+Infinity":
+		*p = Point(math.Inf(1))
+	case "-Infinity":
+		*p = Point(math.Inf(-1))
+	default:
+		return errors.New("opentsdb: invalid point " + string(b))
+	}
+	return nil
+}
+
+// MarshalJSON encodes dps as an object sorted by timestamp. Non-finite
+// points are encoded as null.
+func (dps DPmap) MarshalJSON() ([]byte, error) {
+	return NonFiniteNull.marshalDPmap(dps)
+}
+
+func (policy NonFinitePolicy) marshalDPmap(dps DPmap) ([]byte, error) {
+	if dps == nil {
+		return []byte("null"), nil
+	}
+	times := make([]Epoch, 0, len(dps))
+	for t := range dps {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	b := make([]byte, 0, 2+len(dps)*24)
+	b = append(b, '{')
+	first := true
+	for _, t := range times {
+		v := float64(dps[t])
+		if policy == NonFiniteDrop && (math.IsNaN(v) || math.IsInf(v, 0)) {
+			continue
+		}
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = append(b, '"')
+		b = strconv.AppendInt(b, int64(t), 10)
+		b = append(b, '"', ':')
+		var err error
+		if b, err = policy.appendPoint(b, dps[t]); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// Encoder writes JSON values to a stream like json.Encoder, encoding the
+// non-finite points of the ResponseSets, Responses, DPmaps and Points it is
+// given according to its policy.
+type Encoder struct {
+	enc    *json.Encoder
+	policy NonFinitePolicy
+}
+
+// NewEncoder returns an Encoder writing to w with policy.
+func NewEncoder(w io.Writer, policy NonFinitePolicy) *Encoder {
+	return &Encoder{enc: json.NewEncoder(w), policy: policy}
+}
+
+// Encode writes v followed by a newline.
+func (e *Encoder) Encode(v interface{}) error {
+	return e.enc.Encode(e.policy.wrap(v))
+}
+
+// wrap returns v with its points encoded according to policy.
+func (policy NonFinitePolicy) wrap(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Point:
+		return policyPoint{v, policy}
+	case DPmap:
+		return policyDPmap{v, policy}
+	case *Response:
+		if v == nil {
+			return v
+		}
+		return policyResponse{v, policyDPmap{v.DPS, policy}}
+	case ResponseSet:
+		if v == nil {
+			return v
+		}
+		out := make([]interface{}, len(v))
+		for i, r := range v {
+			out[i] = policy.wrap(r)
+		}
+		return out
+	}
+	return v
+}
+
+type policyPoint struct {
+	p      Point
+	policy NonFinitePolicy
+}
+
+func (p policyPoint) MarshalJSON() ([]byte, error) {
+	return p.policy.appendPoint(nil, p.p)
+}
+
+type policyDPmap struct {
+	dps    DPmap
+	policy NonFinitePolicy
+}
+
+func (m policyDPmap) MarshalJSON() ([]byte, error) {
+	return m.policy.marshalDPmap(m.dps)
+}
+
+// policyResponse encodes a Response with its DPS, which shadows that of
+// the embedded Response, encoded according to a policy.
+type policyResponse struct {
+	*Response
+	DPS policyDPmap `json:"dps"`
+}
+
+// DecodeResponseSet decodes an /api/query response, accepting the bare
+// NaN and Infinity literals OpenTSDB may emit. Responses are decoded one at
+// a time; on error the ones decoded before it are returned with it.
+//
+// The statsSummary element OpenTSDB appends with showSummary is not
+// returned as a series; it is set on every response instead, see
+// ResponseSet.Summary. A response with a summary but no series decodes to
+// the summary element alone, so that the summary is not lost.
+func DecodeResponseSet(r io.Reader) (ResponseSet, error) {
+	return decodeResponseSet(r, nil)
+}
+
+// decodeResponseSet decodes like DecodeResponseSet. check, if not nil, is
+// called with the numbers of series and points decoded so far after every
+// point and before every response is added, so that limits stop decoding
+// as soon as they are exceeded rather than after a whole series.
+func decodeResponseSet(r io.Reader, check func(series int, points int64) error) (ResponseSet, error) {
+	dec := json.NewDecoder(NewNonFiniteReader(r))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if tok != json.Delim('[') {
+		return nil, decodeError(fmt.Errorf("unexpected %v, expected a response array", tok))
+	}
+	rs := ResponseSet{}
+	var summary *QueryStatsSummary
+	var points int64
+	var checkErr error
+	point := func() error {
+		points++
+		if check != nil {
+			checkErr = check(len(rs)+1, points)
+		}
+		return checkErr
+	}
+	for dec.More() {
+		var resp Response
+		if err := decodeResponse(dec, &resp, point); err != nil {
+			if checkErr != nil {
+				return rs, checkErr
+			}
+			return rs, decodeError(err)
+		}
+		if resp.isSummary() {
+			summary = resp.StatsSummary
+			continue
+		}
+		if check != nil {
+			if err := check(len(rs)+1, points); err != nil {
+				return rs, err
+			}
+		}
+		rs = append(rs, &resp)
+	}
+	if _, err := dec.Token(); err != nil {
+		return rs, decodeError(err)
+	}
+	if summary != nil && len(rs) == 0 {
+		return ResponseSet{{StatsSummary: summary}}, nil
+	}
+	if summary != nil {
+		for _, resp := range rs {
+			resp.StatsSummary = summary
+		}
+	}
+	return rs, nil
+}
+
+// decodeResponse decodes the next response of dec into resp. Its points
+// are decoded one at a time, calling point after each; decoding stops at
+// the first error point returns.
+func decodeResponse(dec *json.Decoder, resp *Response, point func() error) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("unexpected %v, expected a response", tok)
+	}
+	// the fields other than dps are gathered and decoded as usual
+	rest := []byte{'{'}
+	var dps DPmap
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		if strings.EqualFold(key, "dps") {
+			if dps, err = decodeDPS(dec, point); err != nil {
+				return err
+			}
+			continue
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		if len(rest) > 1 {
+			rest = append(rest, ',')
+		}
+		k, _ := json.Marshal(key)
+		rest = append(append(append(rest, k...), ':'), v...)
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(append(rest, '}'), resp); err != nil {
+		return err
+	}
+	resp.DPS = dps
+	resp.rekey()
+	return nil
+}
+
+// decodeDPS decodes the dps object of a response from dec, calling point
+// after each point.
+func decodeDPS(dec *json.Decoder, point func() error) (DPmap, error) {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("unexpected %v, expected dps", tok)
+	}
+	dps := DPmap{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var t Epoch
+		if err := t.UnmarshalText([]byte(tok.(string))); err != nil {
+			return nil, err
+		}
+		var p Point
+		if err := dec.Decode(&p); err != nil {
+			return nil, err
+		}
+		dps[t] = p
+		if err := point(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return dps, nil
+}
+
+// NewNonFiniteReader returns a reader quoting the bare NaN, Infinity and
+// -Infinity literals of the JSON read from r, so that encoding/json
+// accepts it.
+func NewNonFiniteReader(r io.Reader) io.Reader {
+	return &nonFiniteReader{r: r, buf: make([]byte, 32*1024)}
+}
+
+type nonFiniteReader struct {
+	r        io.Reader
+	buf      []byte
+	out      []byte
+	err      error
+	inString bool
+	escape   bool
+	minus    bool // a '-' held back until the next byte is known
+	literal  int  // letters left in the current literal
+}
+
+func (n *nonFiniteReader) Read(p []byte) (int, error) {
+	for len(n.out) == 0 {
+		if n.err != nil {
+			if n.minus {
+				n.minus = false
+				n.out = append(n.out, '-')
+				break
+			}
+			return 0, n.err
+		}
+		var m int
+		m, n.err = n.r.Read(n.buf)
+		n.out = n.transform(n.out[:0], n.buf[:m])
+	}
+	c := copy(p, n.out)
+	n.out = n.out[c:]
+	return c, nil
+}
+
+func (n *nonFiniteReader) transform(out, in []byte) []byte {
+	for _, c := range in {
+		if n.literal > 0 {
+			out = append(out, c)
+			if n.literal--; n.literal == 0 {
+				out = append(out, '"')
+			}
+			continue
+		}
+		if n.minus {
+			n.minus = false
+			if c == 'I' {
+				out = append(out, '"', '-', c)
+				n.literal = len("nfinity")
+				continue
+			}
+			out = append(out, '-')
+		}
+		switch {
+		case n.inString:
+			switch {
+			case n.escape:
+				n.escape = false
+			case c == '\\':
+				n.escape = true
+			case c == '"':
+				n.inString = false
+			}
+		case c == '"':
+			n.inString = true
+		case c == '-':
+			n.minus = true
+			continue
+		case c == 'N':
+			out = append(out, '"', c)
+			n.literal = len("aN")
+			continue
+		case c == 'I':
+			out = append(out, '"', c)
+			n.literal = len("nfinity")
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecodeNonFinite(t *testing.T) {
+	body := `[{"metric":"m-Infinity","tags":{"k":"NaN \"N"},"aggregateTags":[],"dps":{"1":NaN,"2":Infinity,"3":-Infinity,"4":-1.5,"5":null,"6":"NaN"}}]`
+	// one byte reads exercise literals split across reads
+	rs, err := DecodeResponseSet(iotest.OneByteReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rs[0]
+	if r.Metric != "m-Infinity" || r.Tags["k"] != `NaN "N` {
+		t.Errorf("strings were modified: %q %q", r.Metric, r.Tags["k"])
+	}
+	dps := r.DPS
+	if !math.IsNaN(float64(dps[1])) || !math.IsInf(float64(dps[2]), 1) || !math.IsInf(float64(dps[3]), -1) ||
+		dps[4] != -1.5 || !math.IsNaN(float64(dps[5])) || !math.IsNaN(float64(dps[6])) {
+		t.Errorf("got %v", dps)
+	}
+
+	b, _ := io.ReadAll(NewNonFiniteReader(strings.NewReader(`[1,-2,-`)))
+	if string(b) != `[1,-2,-` {
+		t.Errorf("got %s", b)
+	}
+}
+
+func TestEncodeNonFinite(t *testing.T) {
+	dps := DPmap{10: Point(math.NaN()), 2: Point(math.Inf(1)), 3: 1e21, 1: 0.5}
+	b, err := json.Marshal(dps)
+	if want := `{"1":0.5,"2":null,"3":1e+21,"10":null}`; err != nil || string(b) != want {
+		t.Errorf("default: got %s, %v, want %s", b, err, want)
+	}
+	tests := []struct {
+		policy NonFinitePolicy
+		want   string
+	}{
+		{NonFiniteNull, `{"1":0.5,"2":null,"3":1e+21,"10":null}`},
+		{NonFiniteString, `{"1":0.5,"2":"Infinity","3":1e+21,"10":"NaN"}`},
+		{NonFiniteDrop, `{"1":0.5,"3":1e+21}`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := NewEncoder(&buf, test.policy).Encode(dps)
+		if got := strings.TrimSpace(buf.String()); err != nil || got != test.want {
+			t.Errorf("policy %d: got %s, %v, want %s", test.policy, got, err, test.want)
+		}
+	}
+	if err := NewEncoder(io.Discard, NonFiniteError).Encode(dps); err == nil {
+		t.Error("expected error")
+	}
+
+	rs := ResponseSet{{Metric: "m", Tags: TagSet{"host": "a"}, AggregateTags: []string{}, DPS: DPmap{1: Point(math.Inf(-1))}}}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf, NonFiniteString).Encode(rs); err != nil {
+		t.Fatal(err)
+	}
+	def, _ := json.Marshal(rs)
+	want := strings.Replace(string(def), `"dps":{"1":null}`, `"dps":{"1":"-Infinity"}`, 1)
+	if got := strings.TrimSpace(buf.String()); got != want {
+		t.Errorf("response set: got %s, want %s", got, want)
+	}
+
+	for _, f := range []float64{0, 1, -3.25, 1e-7, 123456789, 1e20} {
+		got, _ := json.Marshal(Point(f))
+		want, _ := json.Marshal(f)
+		if string(got) != string(want) {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestDecodeStatsSummary(t *testing.T) {
+	body := `[{"metric":"a","tags":{},"aggregateTags":[],"dps":{"1":1}},` +
+		`{"metric":"b","tags":{},"aggregateTags":[],"dps":{"1":2}},` +
+		`{"statsSummary":{"avgAggregationTime":0.5,"queryIdx_00":{"emittedDPs":2}}}]`
+	rs, err := DecodeResponseSet(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 2 || rs[0].Metric != "a" || rs[1].Metric != "b" {
+		t.Fatalf("got %v", rs)
+	}
+	if s := rs.Summary(); s == nil || s.AvgAggregationTime != 0.5 {
+		t.Errorf("summary: got %v", s)
+	}
+}
+
+func TestDecodeStatsSummaryOnly(t *testing.T) {
+	body := `[{"statsSummary":{"avgAggregationTime":0.5}}]`
+	rs, err := DecodeResponseSet(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := rs.Summary(); s == nil || s.AvgAggregationTime != 0.5 {
+		t.Errorf("summary: got %v", s)
+	}
+	if rs, _ := DecodeResponseSet(strings.NewReader(`[]`)); len(rs) != 0 {
+		t.Errorf("empty: got %v", rs)
+	}
+}
@@ -0,0 +1,149 @@
+package opentsdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxNDJSONLine is the longest line NDJSONDecoder accepts.
+var MaxNDJSONLine = 16 << 20
+
+// NDJSONEncoder writes values as newline delimited JSON, one per line, for
+// piping between processes or over message queues.
+type NDJSONEncoder struct {
+	enc *json.Encoder
+}
+
+// NewNDJSONEncoder returns an encoder writing to w.
+func NewNDJSONEncoder(w io.Writer) *NDJSONEncoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &NDJSONEncoder{enc: enc}
+}
+
+// Encode writes v, typically a *DataPoint or a *Response, on its own line.
+func (e *NDJSONEncoder) Encode(v interface{}) error {
+	return e.enc.Encode(v)
+}
+
+// EncodeDataPoints writes every point of dps on its own line.
+func (e *NDJSONEncoder) EncodeDataPoints(dps MultiDataPoint) error {
+	for _, dp := range dps {
+		if err := e.Encode(dp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeResponses writes every response of rs on its own line.
+func (e *NDJSONEncoder) EncodeResponses(rs ResponseSet) error {
+	for _, resp := range rs {
+		if err := e.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NDJSONLineError is returned by NDJSONDecoder for a line that does not
+// decode. The decoder can keep going with the next line.
+type NDJSONLineError struct {
+	Line int
+	Err  error
+}
+
+func (e *NDJSONLineError) Error() string {
+	return fmt.Sprintf("opentsdb: line %d: %v", e.Line, e.Err)
+}
+
+func (e *NDJSONLineError) Unwrap() error { return e.Err }
+
+func (e *NDJSONLineError) Is(target error) bool { return target == ErrDecode }
+
+// NDJSONDecoder reads newline delimited JSON values. Blank lines are
+// skipped.
+type NDJSONDecoder struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// NewNDJSONDecoder returns a decoder reading from r.
+func NewNDJSONDecoder(r io.Reader) *NDJSONDecoder {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, MaxNDJSONLine)
+	return &NDJSONDecoder{s: s}
+}
+
+// Decode decodes the next line into v. It returns an *NDJSONLineError
+// if the line is malformed, after which Decode may be called again, and
+// io.EOF at the end of the input.
+func (d *NDJSONDecoder) Decode(v interface{}) error {
+	for d.s.Scan() {
+		d.line++
+		b := bytes.TrimSpace(d.s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return &NDJSONLineError{Line: d.line, Err: err}
+		}
+		return nil
+	}
+	if err := d.s.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// ReadNDJSONDataPoints decodes all data points of r. Malformed lines are
+// skipped and reported together in the returned error.
+func ReadNDJSONDataPoints(r io.Reader) (MultiDataPoint, error) {
+	var dps MultiDataPoint
+	var errs []error
+	d := NewNDJSONDecoder(r)
+	for {
+		dp := &DataPoint{}
+		err := d.Decode(dp)
+		var lerr *NDJSONLineError
+		switch {
+		case err == nil:
+			dps = append(dps, dp)
+			continue
+		case errors.As(err, &lerr):
+			errs = append(errs, err)
+			continue
+		case err != io.EOF:
+			errs = append(errs, err)
+		}
+		return dps, errors.Join(errs...)
+	}
+}
+
+// ReadNDJSONResponses decodes all responses of r. Malformed lines are
+// skipped and reported together in the returned error.
+func ReadNDJSONResponses(r io.Reader) (ResponseSet, error) {
+	var rs ResponseSet
+	var errs []error
+	d := NewNDJSONDecoder(r)
+	for {
+		resp := &Response{}
+		err := d.Decode(resp)
+		var lerr *NDJSONLineError
+		switch {
+		case err == nil:
+			rs = append(rs, resp)
+			continue
+		case errors.As(err, &lerr):
+			errs = append(errs, err)
+			continue
+		case err != io.EOF:
+			errs = append(errs, err)
+		}
+		return rs, errors.Join(errs...)
+	}
+}
@@ -0,0 +1,42 @@
+package opentsdb
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewNDJSONEncoder(&buf)
+	err := enc.EncodeDataPoints(MultiDataPoint{
+		{Metric: "a", Timestamp: 1, Value: 1, Tags: TagSet{"host": "x"}},
+		{Metric: "b", Timestamp: 2, Value: 2.5, Tags: TagSet{"host": "y"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Fatalf("got %d lines: %s", n, buf.String())
+	}
+	in := buf.String() + "\n{not json}\n" + `{"metric":"c","timestamp":3,"value":3,"tags":{"host":"z"}}` + "\n"
+	dps, err := ReadNDJSONDataPoints(strings.NewReader(in))
+	if len(dps) != 3 || dps[2].Metric != "c" || dps[1].Value != 2.5 {
+		t.Errorf("got %v", dps)
+	}
+	var lerr *NDJSONLineError
+	if !errors.As(err, &lerr) || lerr.Line != 4 || !errors.Is(err, ErrDecode) {
+		t.Errorf("got %v", err)
+	}
+
+	buf.Reset()
+	rs := ResponseSet{{Metric: "a", Tags: TagSet{}, AggregateTags: []string{}, DPS: DPmap{1: 1, 2: 2}}}
+	if err := NewNDJSONEncoder(&buf).EncodeResponses(rs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadNDJSONResponses(&buf)
+	if err != nil || len(got) != 1 || got[0].DPS[2] != 2 {
+		t.Errorf("got %v %v", got, err)
+	}
+}
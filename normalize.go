@@ -0,0 +1,85 @@
+package opentsdb
+
+import "strings"
+
+// Normalize brings the queries of r into canonical form for the version v
+// of their target, see Query.Normalize.
+func (r *Request) Normalize(v Version) {
+	for _, q := range r.Queries {
+		q.Normalize(v)
+	}
+}
+
+// Normalize brings q into canonical form for the version v of its target.
+// For versions supporting filters, legacy Tags are promoted to group by
+// Filters as OpenTSDB does; for older ones, group by filters that have a
+// Tags equivalent are demoted to Tags. Other filters are kept, for
+// Validate to report. GroupByTags is then derived from the tags and
+// filters, as ParseQuery does for m queries.
+func (q *Query) Normalize(v Version) {
+	if v.FilterSupport() {
+		for _, k := range q.Tags.Keys() {
+			q.Filters = append(q.Filters, legacyFilter(k, q.Tags[k]))
+		}
+		q.Tags = nil
+	} else {
+		var kept Filters
+		for _, f := range q.Filters {
+			tag, ok := f.legacyTag()
+			if _, dup := q.Tags[f.TagK]; !ok || dup {
+				kept = append(kept, f)
+				continue
+			}
+			if q.Tags == nil {
+				q.Tags = TagSet{}
+			}
+			q.Tags[f.TagK] = tag
+		}
+		q.Filters = kept
+	}
+
+	q.GroupByTags = nil
+	for k := range q.Tags {
+		q.groupBy(k)
+	}
+	for _, f := range q.Filters {
+		if f.GroupBy {
+			q.groupBy(f.TagK)
+		}
+	}
+}
+
+func (q *Query) groupBy(k string) {
+	if q.GroupByTags == nil {
+		q.GroupByTags = TagSet{}
+	}
+	q.GroupByTags[k] = ""
+}
+
+// legacyFilter returns the group by filter OpenTSDB 2.2 and later use for
+// the legacy tag k=v.
+func legacyFilter(k, v string) Filter {
+	f := Filter{Type: "literal_or", TagK: k, Filter: v, GroupBy: true}
+	switch {
+	case v == "*":
+		f.Type = "wildcard"
+	case strings.Contains(v, "*"):
+		f.Type = "iwildcard"
+	}
+	return f
+}
+
+// legacyTag returns the value of the legacy tag equivalent to f, which
+// OpenTSDB 2.1 understands, if there is one.
+func (f Filter) legacyTag() (string, bool) {
+	if !f.GroupBy {
+		return "", false
+	}
+	switch f.Type {
+	case "literal_or":
+		return f.Filter, f.Filter != "" && !strings.Contains(f.Filter, "*")
+	case "wildcard", "iwildcard":
+		return "*", f.Filter == "*"
+	}
+	return "", false
+}
@@ -0,0 +1,42 @@
+package opentsdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRequestNormalize(t *testing.T) {
+	r, err := RequestFromJSON([]byte(`{"start":"1h-ago","queries":[{"metric":"m","aggregator":"sum",
+		"tags":{"dc":"*"},
+		"filters":[{"type":"literal_or","tagk":"host","filter":"a|b","groupBy":true},
+			{"type":"regexp","tagk":"env","filter":"prod.*","groupBy":false}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v22 := r.Clone()
+	v22.Normalize(Version2_2)
+	q := v22.Queries[0]
+	if len(q.Tags) != 0 || len(q.Filters) != 3 {
+		t.Fatalf("2.2: tags %v, filters %v", q.Tags, q.Filters)
+	}
+	if want := (Filter{Type: "wildcard", TagK: "dc", Filter: "*", GroupBy: true}); q.Filters[2] != want {
+		t.Errorf("2.2: promoted %+v, want %+v", q.Filters[2], want)
+	}
+	if want := (TagSet{"dc": "", "host": ""}); !reflect.DeepEqual(q.GroupByTags, want) {
+		t.Errorf("2.2: group by %v, want %v", q.GroupByTags, want)
+	}
+
+	v21 := r.Clone()
+	v21.Normalize(Version2_1)
+	q = v21.Queries[0]
+	if want := (TagSet{"dc": "*", "host": "a|b"}); !reflect.DeepEqual(q.Tags, want) {
+		t.Errorf("2.1: tags %v, want %v", q.Tags, want)
+	}
+	if len(q.Filters) != 1 || q.Filters[0].TagK != "env" {
+		t.Errorf("2.1: kept filters %v", q.Filters)
+	}
+	if want := (TagSet{"dc": "", "host": ""}); !reflect.DeepEqual(q.GroupByTags, want) {
+		t.Errorf("2.1: group by %v, want %v", q.GroupByTags, want)
+	}
+}
@@ -0,0 +1,106 @@
+package opentsdbtest
+
+import (
+	"testing"
+
+	"github.com/the-cloud-source/opentsdb"
+)
+
+// Builder builds ResponseSet fixtures.
+type Builder struct {
+	set opentsdb.ResponseSet
+}
+
+// NewResponseSet returns an empty Builder.
+func NewResponseSet() *Builder {
+	return &Builder{set: opentsdb.ResponseSet{}}
+}
+
+// Add appends a series to the set.
+func (b *Builder) Add(metric string, tags opentsdb.TagSet, dps opentsdb.DPmap) *Builder {
+	if tags == nil {
+		tags = opentsdb.TagSet{}
+	}
+	if dps == nil {
+		dps = opentsdb.DPmap{}
+	}
+	b.set = append(b.set, &opentsdb.Response{
+		Metric:        metric,
+		Tags:          tags,
+		AggregateTags: []string{},
+		DPS:           dps,
+	})
+	return b
+}
+
+// Build returns the accumulated ResponseSet.
+func (b *Builder) Build() opentsdb.ResponseSet {
+	return b.set
+}
+
+// Points returns a DPmap with values placed every step seconds from start.
+func Points(start opentsdb.Epoch, step int64, values ...float64) opentsdb.DPmap {
+	dps := make(opentsdb.DPmap, len(values))
+	for i, v := range values {
+		dps[start+opentsdb.Epoch(int64(i)*step)] = opentsdb.Point(v)
+	}
+	return dps
+}
+
+// FindSeries returns the response of rs with the given metric and tags, or nil.
+func FindSeries(rs opentsdb.ResponseSet, metric string, tags opentsdb.TagSet) *opentsdb.Response {
+	for _, r := range rs {
+		if r.Metric == metric && r.Tags.Equal(tags) {
+			return r
+		}
+	}
+	return nil
+}
+
+// AssertSeriesCount fails t unless rs holds n series.
+func AssertSeriesCount(t testing.TB, rs opentsdb.ResponseSet, n int) {
+	t.Helper()
+	if len(rs) != n {
+		t.Errorf("expected %d series, got %d", n, len(rs))
+	}
+}
+
+// AssertHasSeries fails t unless rs holds a series with metric and tags, and
+// returns it.
+func AssertHasSeries(t testing.TB, rs opentsdb.ResponseSet, metric string, tags opentsdb.TagSet) *opentsdb.Response {
+	t.Helper()
+	r := FindSeries(rs, metric, tags)
+	if r == nil {
+		t.Errorf("series %s%s not found", metric, tags)
+	}
+	return r
+}
+
+// AssertPoint fails t unless r holds value v at ts.
+func AssertPoint(t testing.TB, r *opentsdb.Response, ts opentsdb.Epoch, v opentsdb.Point) {
+	t.Helper()
+	if r == nil {
+		t.Errorf("no series to check point %d", ts)
+		return
+	}
+	got, ok := r.DPS[ts]
+	if !ok {
+		t.Errorf("%s%s: no point at %d", r.Metric, r.Tags, ts)
+		return
+	}
+	if got != v {
+		t.Errorf("%s%s: point at %d is %v, expected %v", r.Metric, r.Tags, ts, got, v)
+	}
+}
+
+// AssertPut fails t unless the server received at least one datapoint for
+// metric whose tags include tags.
+func AssertPut(t testing.TB, s *Server, metric string, tags opentsdb.TagSet) {
+	t.Helper()
+	for _, dp := range s.Puts() {
+		if dp.Metric == metric && dp.Tags.Subset(tags) {
+			return
+		}
+	}
+	t.Errorf("no datapoint put for %s%s", metric, tags)
+}
@@ -0,0 +1,213 @@
+// Package opentsdbtest provides a fake OpenTSDB server and fixture helpers
+// for testing code built on the opentsdb package without a live TSD.
+package opentsdbtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/the-cloud-source/opentsdb"
+)
+
+// QueryFunc computes the response of the fake server to a query. A returned
+// error is sent to the client as a 400 OpenTSDB error.
+type QueryFunc func(r *opentsdb.Request) (opentsdb.ResponseSet, error)
+
+// Server is an httptest based fake TSD answering /api/query, /api/put and
+// /api/suggest.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	response    opentsdb.ResponseSet
+	queryFunc   QueryFunc
+	queries     []*opentsdb.Request
+	puts        opentsdb.MultiDataPoint
+	suggestions map[string][]string
+}
+
+// NewServer starts a fake TSD. Callers should Close it when done.
+func NewServer() *Server {
+	s := &Server{suggestions: map[string][]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/query", s.handleQuery)
+	mux.HandleFunc("/api/put", s.handlePut)
+	mux.HandleFunc("/api/suggest", s.handleSuggest)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Host returns the address of the server in a form accepted by the opentsdb
+// package.
+func (s *Server) Host() string {
+	return s.URL
+}
+
+// SetResponse makes every query return a copy of rs.
+func (s *Server) SetResponse(rs opentsdb.ResponseSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.response = rs
+	s.queryFunc = nil
+}
+
+// SetQueryFunc makes queries answered by f instead of a canned response.
+func (s *Server) SetQueryFunc(f QueryFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queryFunc = f
+}
+
+// SetSuggestions sets the values returned by /api/suggest for typ, one of
+// metrics, tagk or tagv.
+func (s *Server) SetSuggestions(typ string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := append([]string(nil), values...)
+	sort.Strings(v)
+	s.suggestions[typ] = v
+}
+
+// Queries returns the requests received so far.
+func (s *Server) Queries() []*opentsdb.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*opentsdb.Request(nil), s.queries...)
+}
+
+// Puts returns the datapoints received so far.
+func (s *Server) Puts() opentsdb.MultiDataPoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append(opentsdb.MultiDataPoint(nil), s.puts...)
+}
+
+// Reset forgets received queries and datapoints.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = nil
+	s.puts = nil
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, req *http.Request) {
+	var r *opentsdb.Request
+	var err error
+	if req.Method == http.MethodGet {
+		r, err = opentsdb.ParseRequest(req.URL.RawQuery, opentsdb.Version2_4)
+	} else {
+		var b []byte
+		if b, err = io.ReadAll(req.Body); err == nil {
+			r, err = opentsdb.RequestFromJSON(b)
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.queries = append(s.queries, r)
+	f, rs := s.queryFunc, s.response.Copy()
+	s.mu.Unlock()
+
+	if f != nil {
+		if rs, err = f(r); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if rs == nil {
+		rs = opentsdb.ResponseSet{}
+	}
+	writeJSON(w, http.StatusOK, rs)
+}
+
+func (s *Server) handlePut(w http.ResponseWriter, req *http.Request) {
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var dps opentsdb.MultiDataPoint
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '{' {
+		dp := &opentsdb.DataPoint{}
+		err = json.Unmarshal(b, dp)
+		dps = append(dps, dp)
+	} else {
+		err = json.Unmarshal(b, &dps)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.mu.Lock()
+	s.puts = append(s.puts, dps...)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSuggest(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	typ, prefix, max := q.Get("type"), q.Get("q"), 25
+	if m, err := strconv.Atoi(q.Get("max")); err == nil {
+		max = m
+	}
+	if req.Method == http.MethodPost {
+		body := struct {
+			Type string `json:"type"`
+			Q    string `json:"q"`
+			Max  int    `json:"max"`
+		}{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		typ, prefix = body.Type, body.Q
+		if body.Max > 0 {
+			max = body.Max
+		}
+	}
+
+	s.mu.Lock()
+	all, ok := s.suggestions[typ]
+	s.mu.Unlock()
+	if !ok && typ != "metrics" && typ != "tagk" && typ != "tagv" {
+		writeError(w, http.StatusBadRequest, errString("invalid suggest type "+typ))
+		return
+	}
+	res := []string{}
+	for _, v := range all {
+		if len(res) >= max {
+			break
+		}
+		if strings.HasPrefix(v, prefix) {
+			res = append(res, v)
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+type errString string
+
+func (e errString) Error() string { return string(e) }
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	e := opentsdb.RequestError{}
+	e.Err.Code = code
+	e.Err.Message = err.Error()
+	writeJSON(w, code, &e)
+}
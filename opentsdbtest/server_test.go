@@ -0,0 +1,70 @@
+package opentsdbtest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/the-cloud-source/opentsdb"
+)
+
+func TestServerQuery(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetResponse(NewResponseSet().
+		Add("sys.cpu", opentsdb.TagSet{"host": "a"}, Points(100, 10, 1, 2, 3)).
+		Build())
+
+	c, err := opentsdb.NewClient(s.Host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &opentsdb.Request{Start: "1h-ago", Queries: []*opentsdb.Query{{Metric: "sys.cpu", Aggregator: "sum"}}}
+	rs, err := c.Query(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertSeriesCount(t, rs, 1)
+	AssertPoint(t, AssertHasSeries(t, rs, "sys.cpu", opentsdb.TagSet{"host": "a"}), 120, 3)
+	if len(s.Queries()) != 1 {
+		t.Errorf("expected 1 recorded query, got %d", len(s.Queries()))
+	}
+
+	s.SetQueryFunc(func(*opentsdb.Request) (opentsdb.ResponseSet, error) {
+		return nil, errors.New("no such name")
+	})
+	_, err = c.Query(r)
+	var re *opentsdb.RequestError
+	if !errors.As(err, &re) || re.Err.Code != 400 {
+		t.Errorf("expected request error, got %v", err)
+	}
+}
+
+func TestServerPutAndSuggest(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetSuggestions("metrics", "sys.mem", "sys.cpu", "app.req")
+
+	c, err := opentsdb.NewClient(s.Host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Put(opentsdb.MultiDataPoint{{Metric: "sys.cpu", Timestamp: 1600000000, Value: 1, Tags: opentsdb.TagSet{"host": "a"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertPut(t, s, "sys.cpu", opentsdb.TagSet{"host": "a"})
+
+	resp, err := s.Client().Get(s.URL + "/api/suggest?type=metrics&q=sys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got []string
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "sys.cpu" || got[1] != "sys.mem" {
+		t.Errorf("unexpected suggestions %v", got)
+	}
+}
@@ -0,0 +1,263 @@
+package opentsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// Parquet physical types, converted types and encodings used by
+// WriteParquet, as numbered by the Parquet format.
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+var errParquetSize = errors.New("opentsdb: column too large for a parquet page")
+
+// parquetColumn is a plain encoded column of a Parquet file.
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32
+	data      []byte
+}
+
+// parquetChunk is a column written to a Parquet file, at offset and of
+// size bytes with its page header.
+type parquetChunk struct {
+	parquetColumn
+	offset, size int64
+}
+
+// WriteParquet writes c to w as a Parquet file of one row group, with the
+// columns metric, timestamp (milliseconds, UTC), value and one per tag
+// key, as WriteCSV. Columns are required, tags missing from a series being
+// empty, and plain encoded without compression, so the file is read as is
+// by Arrow, Spark or DuckDB.
+func (c *Columns) WriteParquet(w io.Writer) error {
+	keys, err := c.columnKeys()
+	if err != nil {
+		return err
+	}
+	cols := []parquetColumn{
+		{"metric", parquetByteArray, parquetUTF8, plainStrings(c.Metric)},
+		{"timestamp", parquetInt64, parquetTimestampMillis, plainInt64s(c.Timestamp)},
+		{"value", parquetDouble, -1, plainFloat64s(c.Value)},
+	}
+	for _, k := range keys {
+		cols = append(cols, parquetColumn{k, parquetByteArray, parquetUTF8, plainStrings(c.Tags[k])})
+	}
+	n := int64(c.Len())
+
+	if _, err := io.WriteString(w, "PAR1"); err != nil {
+		return err
+	}
+	offset := int64(len("PAR1"))
+	chunks := make([]parquetChunk, 0, len(cols))
+	for _, col := range cols {
+		if len(col.data) > math.MaxInt32 {
+			return errParquetSize
+		}
+		var h thriftWriter
+		h.i32(1, 0) // DATA_PAGE
+		h.i32(2, int32(len(col.data)))
+		h.i32(3, int32(len(col.data)))
+		h.begin(5)
+		h.i32(1, int32(n))
+		h.i32(2, parquetPlain)
+		h.i32(3, parquetRLE)
+		h.i32(4, parquetRLE)
+		h.end()
+		h.stop()
+		size := int64(len(h.b) + len(col.data))
+		chunks = append(chunks, parquetChunk{parquetColumn: col, offset: offset, size: size})
+		offset += size
+		if _, err := w.Write(h.b); err != nil {
+			return err
+		}
+		if _, err := w.Write(col.data); err != nil {
+			return err
+		}
+	}
+
+	var m thriftWriter
+	m.i32(1, 1)
+	m.list(2, thriftStruct, len(cols)+1)
+	m.elem()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(cols)))
+	m.end()
+	for _, col := range cols {
+		m.elem()
+		m.i32(1, col.typ)
+		m.i32(3, 0) // REQUIRED
+		m.binary(4, col.name)
+		if col.converted >= 0 {
+			m.i32(6, col.converted)
+		}
+		m.end()
+	}
+	m.i64(3, n)
+	m.list(4, thriftStruct, 1)
+	m.elem()
+	m.list(1, thriftStruct, len(chunks))
+	for _, ch := range chunks {
+		m.elem()
+		m.i64(2, ch.offset)
+		m.begin(3)
+		m.i32(1, ch.typ)
+		m.list(2, thriftI32, 1)
+		m.listI32(parquetPlain)
+		m.list(3, thriftBinary, 1)
+		m.listBinary(ch.name)
+		m.i32(4, 0) // UNCOMPRESSED
+		m.i64(5, n)
+		m.i64(6, ch.size)
+		m.i64(7, ch.size)
+		m.i64(9, ch.offset)
+		m.end()
+		m.end()
+	}
+	m.i64(2, offset-int64(len("PAR1")))
+	m.i64(3, n)
+	m.end()
+	m.binary(6, "github.com/the-cloud-source/opentsdb")
+	m.stop()
+
+	b := append(m.b, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[len(m.b):], uint32(len(m.b)))
+	b = append(b, "PAR1"...)
+	_, err = w.Write(b)
+	return err
+}
+
+// plainStrings returns s plain encoded as Parquet byte arrays.
+func plainStrings(s []string) []byte {
+	size := 0
+	for _, v := range s {
+		size += 4 + len(v)
+	}
+	b := make([]byte, 0, size)
+	for _, v := range s {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(v)))
+		b = append(b, v...)
+	}
+	return b
+}
+
+// plainInt64s returns s as little endian 64 bit integers.
+func plainInt64s(s []int64) []byte {
+	b := make([]byte, 0, 8*len(s))
+	for _, v := range s {
+		b = binary.LittleEndian.AppendUint64(b, uint64(v))
+	}
+	return b
+}
+
+// plainFloat64s returns s as little endian IEEE 754 doubles.
+func plainFloat64s(s []float64) []byte {
+	b := make([]byte, 0, 8*len(s))
+	for _, v := range s {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	}
+	return b
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, in which
+// the Parquet metadata is written.
+type thriftWriter struct {
+	b     []byte
+	id    int16   // last field id of the current struct
+	outer []int16 // last field ids of the enclosing structs
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if d := id - t.id; d > 0 && d <= 15 {
+		t.b = append(t.b, byte(d)<<4|typ)
+	} else {
+		t.b = append(t.b, typ)
+		t.varint(int64(id))
+	}
+	t.id = id
+}
+
+func (t *thriftWriter) varint(v int64) {
+	t.b = binary.AppendUvarint(t.b, uint64(v<<1^v>>63))
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listBinary(s)
+}
+
+// list starts the list field id of n elements of type typ, to be followed
+// by the elements.
+func (t *thriftWriter) list(id int16, typ byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.b = append(t.b, byte(n)<<4|typ)
+	} else {
+		t.b = append(t.b, 0xf0|typ)
+		t.b = binary.AppendUvarint(t.b, uint64(n))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) listBinary(s string) {
+	t.b = binary.AppendUvarint(t.b, uint64(len(s)))
+	t.b = append(t.b, s...)
+}
+
+// begin starts the struct field id, ended by end.
+func (t *thriftWriter) begin(id int16) {
+	t.field(id, thriftStruct)
+	t.elem()
+}
+
+// elem starts a struct element of a list, ended by end.
+func (t *thriftWriter) elem() {
+	t.outer = append(t.outer, t.id)
+	t.id = 0
+}
+
+func (t *thriftWriter) end() {
+	t.stop()
+	t.id = t.outer[len(t.outer)-1]
+	t.outer = t.outer[:len(t.outer)-1]
+}
+
+// stop ends the top level struct.
+func (t *thriftWriter) stop() {
+	t.b = append(t.b, 0)
+}
@@ -0,0 +1,225 @@
+package opentsdb
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// The m query syntax is parsed by a small lexer rather than regular
+// expressions so that filter arguments may contain separators as long as
+// they are nested in parentheses, braces or quotes, e.g.
+// host=regexp(web{1,3}) or host=literal_or("a:b").
+
+var errUnbalanced = errors.New("opentsdb: unbalanced quotes or brackets")
+
+// scanQuote returns the index of the quote closing the one at s[i].
+// Backslash escapes the next character.
+func scanQuote(s string, i int) (int, error) {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case q:
+			return j, nil
+		}
+	}
+	return 0, errUnbalanced
+}
+
+// matchClose returns the index of the bracket closing the one at s[i],
+// skipping nested brackets and quoted strings.
+func matchClose(s string, i int) (int, error) {
+	var stack []byte
+	for j := i; j < len(s); j++ {
+		switch c := s[j]; c {
+		case '"', '\'':
+			end, err := scanQuote(s, j)
+			if err != nil {
+				return 0, err
+			}
+			j = end
+		case '(':
+			stack = append(stack, ')')
+		case '{':
+			stack = append(stack, '}')
+		case ')', '}':
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				return 0, errUnbalanced
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return j, nil
+			}
+		}
+	}
+	return 0, errUnbalanced
+}
+
+// indexTopLevel returns the index of the first sep in s that is not nested
+// in brackets or quotes, or -1.
+func indexTopLevel(s string, sep byte) (int, error) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == sep:
+			return i, nil
+		case c == '"' || c == '\'':
+			end, err := scanQuote(s, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		case c == '(' || c == '{':
+			end, err := matchClose(s, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end
+		case c == ')' || c == '}':
+			return 0, errUnbalanced
+		}
+	}
+	return -1, nil
+}
+
+// splitTopLevel splits s at every sep that is not nested in brackets or
+// quotes.
+func splitTopLevel(s string, sep byte) ([]string, error) {
+	var parts []string
+	for {
+		i, err := indexTopLevel(s, sep)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			return append(parts, s), nil
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// unquote removes the quotes around s and resolves its escapes. Strings that
+// aren't entirely quoted are returned unchanged.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' && s[0] != '\'' {
+		return s
+	}
+	end, err := scanQuote(s, 0)
+	if err != nil || end != len(s)-1 {
+		return s
+	}
+	b := strings.Builder{}
+	for i := 1; i < end; i++ {
+		if s[i] == '\\' {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// quote quotes s so that unquote returns it.
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// isNameRune reports whether r may appear in an unquoted metric or tag name.
+// This is more permissive than OpenTSDB so that names cleaned with a custom
+// replacement still parse.
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_./%#@~^ ", r)
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !isNameRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteName quotes s if it can't be written unquoted.
+func quoteName(s string) string {
+	if isName(s) && strings.TrimSpace(s) == s {
+		return s
+	}
+	return quote(s)
+}
+
+// quoteArg quotes a filter argument if it would otherwise not parse back.
+func quoteArg(s string) string {
+	if strings.ContainsAny(s, `"'`) {
+		return quote(s)
+	}
+	if !balanced(s) {
+		return quote(s)
+	}
+	return s
+}
+
+// balanced reports whether the brackets and quotes of s are balanced.
+func balanced(s string) bool {
+	_, err := splitTopLevel(s, ',')
+	return err == nil
+}
+
+// splitFunc splits a filter value of the form name(args).
+func splitFunc(v string) (name, args string, ok bool) {
+	i := strings.IndexByte(v, '(')
+	if i < 1 {
+		return "", "", false
+	}
+	for _, r := range v[:i] {
+		if !(r >= 'a' && r <= 'z' || r == '_') {
+			return "", "", false
+		}
+	}
+	end, err := matchClose(v, i)
+	if err != nil || end != len(v)-1 {
+		return "", "", false
+	}
+	return v[:i], unquote(v[i+1 : end]), true
+}
+
+// splitMetric splits the last part of an m query into the metric name and
+// the contents of the following brace groups.
+func splitMetric(s string) (metric string, groups []string, err error) {
+	i := 0
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		if i, err = scanQuote(s, 0); err != nil {
+			return "", nil, err
+		}
+		i++
+		metric = unquote(s[:i])
+	} else {
+		for i < len(s) && s[i] != '{' {
+			i++
+		}
+		metric = s[:i]
+		if !isName(metric) {
+			return "", nil, errors.New("opentsdb: invalid metric")
+		}
+	}
+	if metric == "" {
+		return "", nil, errors.New("opentsdb: missing metric")
+	}
+	for rest := s[i:]; rest != ""; {
+		if rest[0] != '{' {
+			return "", nil, errors.New("opentsdb: unexpected characters after metric")
+		}
+		end, err := matchClose(rest, 0)
+		if err != nil {
+			return "", nil, err
+		}
+		groups = append(groups, rest[1:end])
+		rest = rest[end+1:]
+	}
+	return metric, groups, nil
+}
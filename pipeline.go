@@ -0,0 +1,112 @@
+package opentsdb
+
+// ResponseTransform is a stage of a Pipeline, transforming the responses
+// to r. It may modify rs and its responses in place; maps shared with
+// other responses, such as interned tags, must be copied first.
+type ResponseTransform func(r *Request, rs ResponseSet) (ResponseSet, error)
+
+// Pipeline post-processes responses with its stages, in order.
+type Pipeline []ResponseTransform
+
+// Apply runs rs, the responses to r, through the stages of p.
+func (p Pipeline) Apply(r *Request, rs ResponseSet) (ResponseSet, error) {
+	for _, stage := range p {
+		var err error
+		if rs, err = stage(r, rs); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+type pipelineContext struct {
+	Context
+	p Pipeline
+}
+
+func (c *pipelineContext) Query(r *Request) (ResponseSet, error) {
+	rs, err := c.Context.Query(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.p.Apply(r, rs)
+}
+
+// Middleware returns a middleware applying p to the responses of the
+// wrapped context. As stages modify responses, it shouldn't wrap a context
+// returning shared responses, such as a CacheContext.
+func (p Pipeline) Middleware() QueryMiddleware {
+	return func(c Context) Context {
+		return &pipelineContext{Context: c, p: p}
+	}
+}
+
+// FilterTagsStage removes the tags that the request didn't ask for, as
+// FilterTags does.
+func FilterTagsStage() ResponseTransform {
+	return func(r *Request, rs ResponseSet) (ResponseSet, error) {
+		FilterTags(r, rs)
+		return rs, nil
+	}
+}
+
+// RenameMetric renames the responses of metric from to to.
+func RenameMetric(from, to string) ResponseTransform {
+	return func(_ *Request, rs ResponseSet) (ResponseSet, error) {
+		for _, resp := range rs {
+			if resp.Metric == from {
+				resp.Metric = to
+				resp.rekey()
+			}
+		}
+		return rs, nil
+	}
+}
+
+// RenameTags renames the tag keys of responses found in keys, from old to
+// new names, including aggregated tags.
+func RenameTags(keys map[string]string) ResponseTransform {
+	return RemapTags(&TagRemap{Keys: keys})
+}
+
+// ScaleValues multiplies every point by f.
+func ScaleValues(f float64) ResponseTransform {
+	return func(_ *Request, rs ResponseSet) (ResponseSet, error) {
+		for _, resp := range rs {
+			dps := make(DPmap, len(resp.DPS))
+			for t, v := range resp.DPS {
+				dps[t] = v * Point(f)
+			}
+			resp.DPS = dps
+		}
+		return rs, nil
+	}
+}
+
+// DropEmpty removes responses without points.
+func DropEmpty() ResponseTransform {
+	return func(_ *Request, rs ResponseSet) (ResponseSet, error) {
+		out := rs[:0]
+		for _, resp := range rs {
+			if len(resp.DPS) > 0 {
+				out = append(out, resp)
+			}
+		}
+		return out, nil
+	}
+}
+
+// Resample downsamples the points of responses to interval buckets with
+// the named aggregator, as DPmap.Snap.
+func Resample(interval Duration, agg string) ResponseTransform {
+	return func(_ *Request, rs ResponseSet) (ResponseSet, error) {
+		for _, resp := range rs {
+			dps, err := resp.DPS.Snap(interval, agg)
+			if err != nil {
+				return nil, err
+			}
+			resp.DPS = dps
+		}
+		return rs, nil
+	}
+}
@@ -0,0 +1,50 @@
+package opentsdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPipeline(t *testing.T) {
+	shared := TagSet{"fqdn": "a.example", "dc": "1", "extra": "x"}
+	backend := funcContext(func(*Request) (ResponseSet, error) {
+		return ResponseSet{
+			{Metric: "old.cpu", Tags: shared, AggregateTags: []string{"core"}, DPS: DPmap{100: 1, 130: 3, 160: 5}},
+			{Metric: "old.cpu", Tags: TagSet{}, AggregateTags: []string{}, DPS: DPmap{}},
+		}, nil
+	})
+	p := Pipeline{
+		FilterTagsStage(),
+		RenameMetric("old.cpu", "cpu"),
+		RenameTags(map[string]string{"fqdn": "host", "core": "cpu"}),
+		ScaleValues(10),
+		DropEmpty(),
+		Resample(Duration(time.Minute), "sum"),
+	}
+	c := Chain(backend, p.Middleware())
+	r := &Request{Start: "1", Queries: []*Query{{Metric: "old.cpu", Aggregator: "sum", Tags: TagSet{"fqdn": "*", "dc": "*"}}}}
+	rs, err := c.Query(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 {
+		t.Fatalf("got %d responses, want 1", len(rs))
+	}
+	got := rs[0]
+	if got.Metric != "cpu" {
+		t.Errorf("metric %q", got.Metric)
+	}
+	if want := (TagSet{"host": "a.example", "dc": "1"}); !reflect.DeepEqual(got.Tags, want) {
+		t.Errorf("tags %v, want %v", got.Tags, want)
+	}
+	if want := []string{"cpu"}; !reflect.DeepEqual(got.AggregateTags, want) {
+		t.Errorf("aggregate tags %v, want %v", got.AggregateTags, want)
+	}
+	if want := (DPmap{60: 10, 120: 80}); !reflect.DeepEqual(got.DPS, want) {
+		t.Errorf("dps %v, want %v", got.DPS, want)
+	}
+	if len(shared) != 3 || shared["fqdn"] == "" {
+		t.Errorf("shared tags modified: %v", shared)
+	}
+}
@@ -0,0 +1,157 @@
+package opentsdb
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Poller re-executes a request on an interval and returns only the points
+// that are new since the previous poll, giving live tail semantics without
+// repeated full queries. After the first poll the start of the request is
+// moved to the oldest of the latest points of its series, less Overlap.
+// Series with no point within MaxLookback are forgotten, so a series that
+// stopped reporting does not hold back the start of every later poll.
+//
+// Points whose value changes after they have been returned are not
+// returned again.
+type Poller struct {
+	Context Context
+	Request *Request
+	// Overlap is how far before the latest points seen later polls
+	// start, to pick up points written late.
+	Overlap Duration
+	// MaxLookback is how far before now later polls start at most. It
+	// defaults to DefaultPollLookback.
+	MaxLookback Duration
+
+	mu   sync.Mutex
+	last map[string]Epoch
+	err  error
+}
+
+// DefaultPollLookback is the MaxLookback of a Poller that does not set one.
+const DefaultPollLookback = Hour
+
+// NewPoller returns a Poller of r against c.
+func NewPoller(c Context, r *Request) *Poller {
+	return &Poller{Context: c, Request: r}
+}
+
+// Poll queries the points up to now and returns the series with points
+// newer than those returned by previous polls, holding only those points.
+func (p *Poller) Poll(now time.Time) (ResponseSet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := p.Request.Clone()
+	if p.last != nil {
+		r.Start = TimeSpec(strconv.FormatInt(p.start(now), 10))
+	}
+	r.End = TimeSpec(strconv.FormatInt(now.Unix(), 10))
+	rs, err := p.Context.Query(r)
+	if err != nil {
+		return nil, err
+	}
+	if p.last == nil {
+		p.last = map[string]Epoch{}
+	}
+	delta := ResponseSet{}
+	for _, resp := range rs {
+		key := mergeKey(resp, true)
+		last, seen := p.last[key]
+		if !seen {
+			last = math.MinInt64
+		}
+		newest := last
+		dps := DPmap{}
+		for t, v := range resp.DPS {
+			if t > last {
+				dps[t] = v
+				if t > newest {
+					newest = t
+				}
+			}
+		}
+		if len(dps) > 0 {
+			p.last[key] = newest
+			resp.DPS = dps
+			delta = append(delta, resp)
+		}
+	}
+	return delta, nil
+}
+
+// start returns the start, in seconds, of the next poll, forgetting the
+// series whose latest point is older than the lookback.
+func (p *Poller) start(now time.Time) int64 {
+	lookback := p.MaxLookback
+	if lookback <= 0 {
+		lookback = DefaultPollLookback
+	}
+	oldest := now.Unix() - lookback.SecondsInt64()
+	start := now.Unix()
+	for key, t := range p.last {
+		s := int64(t)
+		if t > 0xffffffff {
+			s /= 1000
+		}
+		if s < oldest {
+			delete(p.last, key)
+			s = oldest
+		}
+		if s < start {
+			start = s
+		}
+	}
+	return start - p.Overlap.SecondsInt64()
+}
+
+// Run polls every period until ctx is done, calling f with every non empty
+// delta. It returns the first error of a poll.
+func (p *Poller) Run(ctx context.Context, period time.Duration, f func(ResponseSet)) error {
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		delta, err := p.Poll(time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if len(delta) > 0 {
+			f(delta)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// Updates runs the poller in the background and delivers its deltas on the
+// returned channel, which is closed when ctx is done or a poll fails. Err
+// then returns the error of the poll.
+func (p *Poller) Updates(ctx context.Context, period time.Duration) <-chan ResponseSet {
+	ch := make(chan ResponseSet)
+	go func() {
+		defer close(ch)
+		err := p.Run(ctx, period, func(delta ResponseSet) {
+			select {
+			case ch <- delta:
+			case <-ctx.Done():
+			}
+		})
+		p.mu.Lock()
+		p.err = err
+		p.mu.Unlock()
+	}()
+	return ch
+}
+
+// Err returns the error that stopped Updates, if any.
+func (p *Poller) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
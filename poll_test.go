@@ -0,0 +1,91 @@
+package opentsdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPoller(t *testing.T) {
+	mem := NewMemContext()
+	mem.AddSeries("m", TagSet{"host": "a"}, DPmap{100: 1, 160: 2})
+	r, _ := ParseRequest("start=50&m=sum:m{host=*}", Version2_2)
+	p := NewPoller(mem, r)
+	p.Overlap = Minute
+
+	poll := func(now int64) DPmap {
+		t.Helper()
+		rs, err := p.Poll(time.Unix(now, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rs) == 0 {
+			return nil
+		}
+		return rs[0].DPS
+	}
+	if got := poll(200); !reflect.DeepEqual(got, DPmap{100: 1, 160: 2}) {
+		t.Errorf("first poll: got %v", got)
+	}
+	if got := poll(210); got != nil {
+		t.Errorf("no new points: got %v", got)
+	}
+	mem.AddSeries("m", TagSet{"host": "a"}, DPmap{220: 3, 150: 9})
+	if got := poll(230); !reflect.DeepEqual(got, DPmap{220: 3}) {
+		t.Errorf("new points: got %v", got)
+	}
+	if start := fmt.Sprint(p.Request.Start); start != "50" {
+		t.Errorf("request modified: start %v", start)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mem.AddSeries("m", TagSet{"host": "b"}, DPmap{Epoch(time.Now().Unix()) - 5: 1})
+	select {
+	case delta := <-p.Updates(ctx, time.Hour):
+		if len(delta) != 1 || delta[0].Tags["host"] != "b" {
+			t.Errorf("update: got %v", delta)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update")
+	}
+	cancel()
+	if err := p.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPollerLookback(t *testing.T) {
+	var starts []string
+	mem := NewMemContext()
+	mem.AddSeries("m", TagSet{"host": "stale"}, DPmap{100: 1})
+	mem.AddSeries("m", TagSet{"host": "live"}, DPmap{100: 1})
+	c := funcContext(func(r *Request) (ResponseSet, error) {
+		starts = append(starts, fmt.Sprint(r.Start))
+		return mem.Query(r)
+	})
+	r, _ := ParseRequest("start=50&m=sum:m{host=*}", Version2_2)
+	p := NewPoller(c, r)
+	p.MaxLookback = 10 * Minute
+
+	if _, err := p.Poll(time.Unix(200, 0)); err != nil {
+		t.Fatal(err)
+	}
+	mem.AddSeries("m", TagSet{"host": "live"}, DPmap{1000: 2})
+	if _, err := p.Poll(time.Unix(1000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	mem.AddSeries("m", TagSet{"host": "live"}, DPmap{1500: 3})
+	rs, err := p.Poll(time.Unix(1500, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || !reflect.DeepEqual(rs[0].DPS, DPmap{1500: 3}) {
+		t.Errorf("got %v", rs)
+	}
+	if want := []string{"50", "400", "1000"}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("starts %v, want %v", starts, want)
+	}
+}
@@ -0,0 +1,102 @@
+package opentsdb
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WritePrometheus writes the latest point of every series of rs to w in
+// the Prometheus text exposition format. Metric names and tag keys are
+// sanitized with PrometheusName and PrometheusLabel, and tags become
+// labels. Series without points are skipped.
+func WritePrometheus(w io.Writer, rs ResponseSet) error {
+	sorted := append(ResponseSet(nil), rs...)
+	sorted.Sort()
+	// metrics sanitized to the same name, e.g. a.b and a_b, must be
+	// written together under a single TYPE line
+	names := make([]string, len(sorted))
+	for i, resp := range sorted {
+		names[i] = PrometheusName(resp.Metric)
+	}
+	sort.Stable(prometheusOrder{sorted, names})
+	bw := bufio.NewWriter(w)
+	last := ""
+	for i, resp := range sorted {
+		times := resp.DPS.GetSortedTimes()
+		if len(times) == 0 {
+			continue
+		}
+		t := times[len(times)-1]
+		name := names[i]
+		if name != last {
+			bw.WriteString("# TYPE " + name + " untyped\n")
+			last = name
+		}
+		bw.WriteString(name)
+		if len(resp.Tags) > 0 {
+			bw.WriteByte('{')
+			for i, k := range resp.Tags.Keys() {
+				if i > 0 {
+					bw.WriteByte(',')
+				}
+				bw.WriteString(PrometheusLabel(k))
+				bw.WriteString(`="`)
+				bw.WriteString(prometheusEscaper.Replace(resp.Tags[k]))
+				bw.WriteByte('"')
+			}
+			bw.WriteByte('}')
+		}
+		bw.WriteByte(' ')
+		bw.WriteString(strconv.FormatFloat(float64(resp.DPS[t]), 'g', -1, 64))
+		bw.WriteByte(' ')
+		bw.WriteString(strconv.FormatInt(epochTime(t).UnixMilli(), 10))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// prometheusOrder sorts series by their sanitized metric names.
+type prometheusOrder struct {
+	rs    ResponseSet
+	names []string
+}
+
+func (o prometheusOrder) Len() int           { return len(o.rs) }
+func (o prometheusOrder) Less(i, j int) bool { return o.names[i] < o.names[j] }
+func (o prometheusOrder) Swap(i, j int) {
+	o.rs[i], o.rs[j] = o.rs[j], o.rs[i]
+	o.names[i], o.names[j] = o.names[j], o.names[i]
+}
+
+var prometheusEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PrometheusName returns s as a valid Prometheus metric name, replacing
+// every character other than letters, digits, underscores and colons with
+// an underscore, e.g. sys.cpu.user becomes sys_cpu_user.
+func PrometheusName(s string) string {
+	return prometheusSanitize(s, true)
+}
+
+// PrometheusLabel returns s as a valid Prometheus label name. It is
+// sanitized as PrometheusName does, except that colons are replaced too.
+func PrometheusLabel(s string) string {
+	return prometheusSanitize(s, false)
+}
+
+func prometheusSanitize(s string, colon bool) string {
+	var b strings.Builder
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		b.WriteByte('_')
+	}
+	for _, r := range s {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' && colon {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
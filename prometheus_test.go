@@ -0,0 +1,47 @@
+package opentsdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	rs := ResponseSet{
+		{Metric: "sys.cpu.user", Tags: TagSet{"host": "web-1", "dc": `a"b`}, DPS: DPmap{100: 1, 160: 2.5}},
+		{Metric: "9.disk", Tags: TagSet{}, DPS: DPmap{1700000000000: 3}},
+		{Metric: "sys.cpu.user", Tags: TagSet{"host": "web-2", "dc": "x"}, DPS: DPmap{}},
+	}
+	var buf bytes.Buffer
+	if err := WritePrometheus(&buf, rs); err != nil {
+		t.Fatal(err)
+	}
+	want := "# TYPE _9_disk untyped\n" +
+		"_9_disk 3 1700000000000\n" +
+		"# TYPE sys_cpu_user untyped\n" +
+		`sys_cpu_user{dc="a\"b",host="web-1"} 2.5 160000` + "\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), want)
+	}
+
+	// a.b and a_b share a name once sanitized, and a.c sorts between them
+	rs = ResponseSet{
+		{Metric: "a_b", Tags: TagSet{"host": "2"}, DPS: DPmap{1: 2}},
+		{Metric: "a.b", Tags: TagSet{"host": "1"}, DPS: DPmap{1: 1}},
+		{Metric: "a.c", Tags: TagSet{}, DPS: DPmap{1: 3}},
+	}
+	buf.Reset()
+	if err := WritePrometheus(&buf, rs); err != nil {
+		t.Fatal(err)
+	}
+	want = "# TYPE a_b untyped\n" +
+		`a_b{host="1"} 1 1000` + "\n" +
+		`a_b{host="2"} 2 1000` + "\n" +
+		"# TYPE a_c untyped\n" +
+		"a_c 3 1000\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), want)
+	}
+	if got := PrometheusLabel("os:type"); got != "os_type" {
+		t.Errorf("got %s", got)
+	}
+}
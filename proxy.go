@@ -0,0 +1,39 @@
+package opentsdb
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// WithProxyURL routes the client's requests through the proxy at rawURL,
+// instead of the one given by the environment. The http, https and socks5
+// schemes are supported. Like the TLS options it configures the client's
+// transport and has no effect with WithHTTPClient.
+func WithProxyURL(rawURL string) ClientOption {
+	return func(c *Client) error {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("opentsdb: invalid proxy URL: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("opentsdb: unsupported proxy scheme %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("opentsdb: proxy URL %q has no host", rawURL)
+		}
+		c.transport.Proxy = http.ProxyURL(u)
+		return nil
+	}
+}
+
+// WithNoProxy makes the client connect directly, ignoring the proxy
+// environment variables.
+func WithNoProxy() ClientOption {
+	return func(c *Client) error {
+		c.transport.Proxy = nil
+		return nil
+	}
+}
@@ -0,0 +1,42 @@
+package opentsdb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		proxied = req.URL.String()
+		w.Write([]byte(`[]`))
+	}))
+	defer proxy.Close()
+
+	c, err := NewClient("tsdb.invalid:4242", WithProxyURL(proxy.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	if _, err := c.Query(r); err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://tsdb.invalid:4242/api/query"; proxied != want {
+		t.Errorf("proxied %q, want %q", proxied, want)
+	}
+
+	c, err = NewClient("tsdb.invalid:4242", WithProxyURL(proxy.URL), WithNoProxy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.transport.Proxy != nil {
+		t.Error("WithNoProxy kept a proxy")
+	}
+
+	for _, u := range []string{"ftp://proxy:21", "http://", "://x"} {
+		if _, err := NewClient("h", WithProxyURL(u)); err == nil {
+			t.Errorf("%q: expected an error", u)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package opentsdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sync/atomic"
+)
+
+// PutPolicy filters and scrubs datapoints before they are sent by a Client.
+// Metric patterns may use '*' wildcards.
+type PutPolicy struct {
+	// AllowMetrics, if not empty, drops points of metrics matching none
+	// of its patterns.
+	AllowMetrics []string
+	// MetricRules are applied in order to the metric of each allowed
+	// point; the first matching rule wins.
+	MetricRules []MetricRule
+	// Remap, if set, renames and maps the tags of the remaining points,
+	// before they are redacted.
+	Remap *TagRemap
+	// Redact rules are applied to every tag of the remaining points.
+	Redact []RedactRule
+	// Salt is prepended to tag values before they are hashed.
+	Salt string
+	// Cardinality, if set, checks the tag values of the remaining points
+	// against cardinality budgets. Points it drops count as dropped.
+	Cardinality *CardinalityGuard
+
+	dropped  int64
+	renamed  int64
+	redacted int64
+}
+
+// MetricRule renames points of metrics matching Pattern to Rename, or drops
+// them if Rename is empty.
+type MetricRule struct {
+	Pattern string
+	Rename  string
+}
+
+// RedactRule replaces the values of tags whose key matches TagK and whose
+// value matches Value. Values are replaced by Replacement, or by a hash of
+// the value if Hash is set, which keeps distinct values distinct.
+type RedactRule struct {
+	TagK        string
+	Value       *regexp.Regexp
+	Hash        bool
+	Replacement string
+}
+
+// PutPolicyStats counts the points a PutPolicy changed.
+type PutPolicyStats struct {
+	Dropped  int64
+	Renamed  int64
+	Redacted int64
+}
+
+// Common patterns of sensitive tag values.
+var (
+	IPv4Pattern  = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	EmailPattern = regexp.MustCompile(`[^@\s]+@[^@\s]+\.[A-Za-z]+`)
+	UUIDPattern  = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+)
+
+// WithPutPolicy makes the client apply p to the datapoints passed to Put.
+func WithPutPolicy(p *PutPolicy) ClientOption {
+	return func(c *Client) error {
+		c.PutPolicy = p
+		return nil
+	}
+}
+
+// Apply returns the points of dps allowed by p, renamed and redacted. Points
+// that need changing are copied; dps is left untouched.
+func (p *PutPolicy) Apply(dps MultiDataPoint) MultiDataPoint {
+	out := make(MultiDataPoint, 0, len(dps))
+	for _, d := range dps {
+		if d = p.apply(d); d != nil {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func (p *PutPolicy) apply(d *DataPoint) *DataPoint {
+	if len(p.AllowMetrics) > 0 && !matchAny(p.AllowMetrics, d.Metric) {
+		atomic.AddInt64(&p.dropped, 1)
+		return nil
+	}
+	for _, rule := range p.MetricRules {
+		if !matchWildcard(rule.Pattern, d.Metric) {
+			continue
+		}
+		if rule.Rename == "" {
+			atomic.AddInt64(&p.dropped, 1)
+			return nil
+		}
+		c := *d
+		c.Metric = rule.Rename
+		d = &c
+		atomic.AddInt64(&p.renamed, 1)
+		break
+	}
+	if p.Remap != nil {
+		d = p.Remap.dataPoint(d)
+	}
+
+	var tags TagSet
+	for k, v := range d.Tags {
+		for _, rule := range p.Redact {
+			if rule.TagK != "" && !matchWildcard(rule.TagK, k) || rule.Value != nil && !rule.Value.MatchString(v) {
+				continue
+			}
+			if tags == nil {
+				tags = d.Tags.Copy()
+			}
+			if rule.Hash {
+				sum := sha256.Sum256([]byte(p.Salt + v))
+				tags[k] = hex.EncodeToString(sum[:8])
+			} else {
+				tags[k] = rule.Replacement
+			}
+			break
+		}
+	}
+	if tags != nil {
+		c := *d
+		c.Tags = tags
+		d = &c
+		atomic.AddInt64(&p.redacted, 1)
+	}
+	if p.Cardinality != nil && !p.Cardinality.Check(d) && p.Cardinality.Drop {
+		atomic.AddInt64(&p.dropped, 1)
+		return nil
+	}
+	return d
+}
+
+// Stats returns the number of points p dropped, renamed and redacted.
+func (p *PutPolicy) Stats() PutPolicyStats {
+	return PutPolicyStats{
+		Dropped:  atomic.LoadInt64(&p.dropped),
+		Renamed:  atomic.LoadInt64(&p.renamed),
+		Redacted: atomic.LoadInt64(&p.redacted),
+	}
+}
+
+func matchAny(patterns []string, v string) bool {
+	for _, p := range patterns {
+		if matchWildcard(p, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package opentsdb
+
+import "testing"
+
+func TestPutPolicy(t *testing.T) {
+	p := &PutPolicy{
+		AllowMetrics: []string{"app.*", "sys.*"},
+		MetricRules: []MetricRule{
+			{Pattern: "app.debug.*"},
+			{Pattern: "sys.cpu.old", Rename: "sys.cpu"},
+		},
+		Redact: []RedactRule{
+			{TagK: "user", Hash: true},
+			{Value: IPv4Pattern, Replacement: "redacted"},
+		},
+	}
+	dps := MultiDataPoint{
+		{Metric: "other", Tags: TagSet{"host": "a"}},
+		{Metric: "app.debug.x", Tags: TagSet{"host": "a"}},
+		{Metric: "sys.cpu.old", Tags: TagSet{"host": "a"}},
+		{Metric: "app.login", Tags: TagSet{"user": "bob", "client": "10.0.0.1"}},
+	}
+	out := p.Apply(dps)
+	if len(out) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(out))
+	}
+	if out[0].Metric != "sys.cpu" || dps[2].Metric != "sys.cpu.old" {
+		t.Errorf("rename: got %s, original %s", out[0].Metric, dps[2].Metric)
+	}
+	tags := out[1].Tags
+	if tags["client"] != "redacted" || tags["user"] == "bob" || len(tags["user"]) != 16 {
+		t.Errorf("unexpected tags %v", tags)
+	}
+	if dps[3].Tags["user"] != "bob" {
+		t.Error("original tags were modified")
+	}
+	if again := p.Apply(dps[3:]); again[0].Tags["user"] != tags["user"] {
+		t.Error("hash is not stable")
+	}
+	want := PutPolicyStats{Dropped: 2, Renamed: 1, Redacted: 2}
+	if s := p.Stats(); s != want {
+		t.Errorf("got stats %+v, want %+v", s, want)
+	}
+}
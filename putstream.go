@@ -0,0 +1,252 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// DataPointIterator yields data points until Next returns io.EOF.
+type DataPointIterator interface {
+	Next() (*DataPoint, error)
+}
+
+type sliceIterator struct {
+	dps MultiDataPoint
+	i   int
+}
+
+// IterateDataPoints returns an iterator over dps.
+func IterateDataPoints(dps MultiDataPoint) DataPointIterator {
+	return &sliceIterator{dps: dps}
+}
+
+func (it *sliceIterator) Next() (*DataPoint, error) {
+	if it.i >= len(it.dps) {
+		return nil, io.EOF
+	}
+	it.i++
+	return it.dps[it.i-1], nil
+}
+
+// PutStreamOptions configure Client.PutStream.
+type PutStreamOptions struct {
+	// ChunkSize is the number of points per request, 500 by default.
+	ChunkSize int
+	// Concurrency is the number of requests in flight, 4 by default.
+	Concurrency int
+	// Resume skips that many points of the iterator, typically the
+	// Checkpoint of the report of an interrupted stream.
+	Resume int64
+	// Progress, if set, is called after every chunk. Calls are serialized.
+	Progress func(PutReport)
+}
+
+// PutReport summarizes a PutStream.
+type PutReport struct {
+	Sent    int64 // points accepted by OpenTSDB
+	Failed  int64 // points rejected or not delivered
+	Dropped int64 // points dropped by the PutPolicy of the client
+	Chunks  int   // chunks completed
+	// Checkpoint is the number of leading points of the iterator that
+	// were processed, including skipped ones. Chunks that failed or of
+	// which OpenTSDB rejected points hold it back, so resuming from it
+	// retries them.
+	Checkpoint int64
+	Failures   []PutFailure
+}
+
+// PutFailure describes points that were not stored. Offset is the position
+// of the first point in the iterator. DataPoint is set when OpenTSDB
+// rejected a single point; otherwise the whole chunk of Count points
+// failed.
+type PutFailure struct {
+	Offset    int64
+	Count     int
+	DataPoint *DataPoint
+	Err       error
+}
+
+// putDetails is the response of /api/put?details.
+type putDetails struct {
+	Success int64 `json:"success"`
+	Failed  int64 `json:"failed"`
+	Errors  []struct {
+		DataPoint *DataPoint `json:"datapoint"`
+		Error     string     `json:"error"`
+	} `json:"errors"`
+}
+
+type putChunk struct {
+	index  int
+	offset int64
+	dps    MultiDataPoint
+}
+
+// PutStream sends the points of iter to /api/put in chunks, with bounded
+// concurrency, asking OpenTSDB for the details of rejected points. Failures
+// are collected in the report rather than stopping the stream; the
+// returned error is set when iter or ctx fail.
+func (c *Client) PutStream(ctx context.Context, iter DataPointIterator, opts PutStreamOptions) (*PutReport, error) {
+	size := opts.ChunkSize
+	if size <= 0 {
+		size = 500
+	}
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = 4
+	}
+	report := &PutReport{Checkpoint: opts.Resume}
+	for i := int64(0); i < opts.Resume; i++ {
+		if _, err := iter.Next(); err != nil {
+			if err == io.EOF {
+				return report, nil
+			}
+			return report, err
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	done := map[int]int64{} // chunks completed ahead of the checkpoint
+	next := 0               // the chunk the checkpoint waits for
+	finish := func(ch putChunk, sent, dropped int64, failures []PutFailure, ok bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		report.Sent += sent
+		report.Dropped += dropped
+		report.Chunks++
+		for _, f := range failures {
+			report.Failed += int64(f.Count)
+		}
+		report.Failures = append(report.Failures, failures...)
+		// a failed chunk is never done, which stops the checkpoint
+		if ok {
+			done[ch.index] = int64(len(ch.dps))
+		}
+		for n, ok := done[next]; ok; n, ok = done[next] {
+			report.Checkpoint += n
+			delete(done, next)
+			next++
+		}
+		if opts.Progress != nil {
+			opts.Progress(*report)
+		}
+	}
+
+	chunks := make(chan putChunk)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ch := range chunks {
+				sent, dropped, failures, ok := c.putChunk(ctx, ch)
+				finish(ch, sent, dropped, failures, ok)
+			}
+		}()
+	}
+
+	var err error
+	offset := opts.Resume
+	cur := putChunk{offset: offset}
+	for err == nil {
+		var d *DataPoint
+		if d, err = iter.Next(); err != nil {
+			break
+		}
+		offset++
+		cur.dps = append(cur.dps, d)
+		if len(cur.dps) < size {
+			continue
+		}
+		select {
+		case chunks <- cur:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		cur = putChunk{index: cur.index + 1, offset: offset}
+	}
+	if err == io.EOF {
+		err = nil
+		if len(cur.dps) > 0 {
+			select {
+			case chunks <- cur:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+	}
+	close(chunks)
+	wg.Wait()
+	return report, err
+}
+
+// putChunk sends ch and returns the number of points stored and dropped by
+// the PutPolicy, the failures and whether every point was delivered and
+// accepted. The points of ch are cleaned on copies, leaving those of the
+// caller untouched.
+func (c *Client) putChunk(ctx context.Context, ch putChunk) (int64, int64, []PutFailure, bool) {
+	var failures []PutFailure
+	cleaned := make(MultiDataPoint, len(ch.dps)) // nil for invalid points
+	valid := make(MultiDataPoint, 0, len(ch.dps))
+	for i, d := range ch.dps {
+		clean := *d
+		clean.Tags = d.Tags.Copy()
+		if err := clean.Clean(); err != nil {
+			failures = append(failures, PutFailure{Offset: ch.offset + int64(i), Count: 1, DataPoint: d, Err: err})
+			if c.Rejects != nil {
+				c.Rejects.Reject(d, err)
+			}
+			continue
+		}
+		cleaned[i] = &clean
+		valid = append(valid, &clean)
+	}
+	var dropped int64
+	if c.PutPolicy != nil {
+		n := len(valid)
+		valid = c.PutPolicy.Apply(valid)
+		dropped = int64(n - len(valid))
+	}
+	if len(valid) == 0 {
+		return 0, dropped, failures, true
+	}
+	chunkFailure := func(err error) (int64, int64, []PutFailure, bool) {
+		return 0, dropped, append(failures, PutFailure{Offset: ch.offset, Count: len(valid), Err: err}), false
+	}
+	b, err := json.Marshal(valid)
+	if err != nil {
+		return chunkFailure(err)
+	}
+	resp, err := c.send(ctx, "/api/put", url.Values{"details": {""}}, b, c.putTimeout(), nil)
+	if err != nil {
+		return chunkFailure(err)
+	}
+	defer closeBody(resp.Body)
+	var details putDetails
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusBadRequest {
+		return chunkFailure(responseError(resp, nil))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		if resp.StatusCode/100 == 2 {
+			// servers may answer 204 without details
+			return int64(len(valid)), dropped, failures, true
+		}
+		return chunkFailure(fmt.Errorf("opentsdb: put status=%d: %v", resp.StatusCode, err))
+	}
+	for _, e := range details.Errors {
+		offset := ch.offset
+		for i, d := range cleaned {
+			if d != nil && e.DataPoint != nil && d.Metric == e.DataPoint.Metric && d.Timestamp == e.DataPoint.Timestamp && d.Tags.Equal(e.DataPoint.Tags) {
+				offset += int64(i)
+				break
+			}
+		}
+		failures = append(failures, PutFailure{Offset: offset, Count: 1, DataPoint: e.DataPoint, Err: fmt.Errorf("opentsdb: %s", e.Error)})
+	}
+	return details.Success, dropped, failures, len(details.Errors) == 0 && details.Failed == 0
+}
@@ -0,0 +1,102 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestPutStream(t *testing.T) {
+	var mu sync.Mutex
+	stored := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := req.URL.Query()["details"]; !ok {
+			t.Error("details not requested")
+		}
+		var dps []map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&dps)
+		var d putDetails
+		for _, dp := range dps {
+			switch dp["metric"] {
+			case "boom":
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			case "bad":
+				d.Failed++
+				d.Errors = append(d.Errors, struct {
+					DataPoint *DataPoint `json:"datapoint"`
+					Error     string     `json:"error"`
+				}{&DataPoint{Metric: "bad", Timestamp: 1, Value: 3, Tags: TagSet{"i": fmt.Sprint(dp["tags"].(map[string]interface{})["i"])}}, "Unknown metric"})
+			default:
+				d.Success++
+			}
+		}
+		mu.Lock()
+		stored += int(d.Success)
+		mu.Unlock()
+		if d.Failed > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(d)
+	}))
+	defer ts.Close()
+
+	var dps MultiDataPoint
+	for i := 0; i < 10; i++ {
+		metric := "good"
+		switch i {
+		case 3:
+			metric = "bad"
+		case 6:
+			metric = "boom"
+		case 8:
+			metric = ""
+		}
+		dps = append(dps, &DataPoint{Metric: metric, Timestamp: 1, Value: i, Tags: TagSet{"i": fmt.Sprint(i)}})
+	}
+	dps[1].Tags["i"] = "1!" // cleaned to 1 on a copy
+
+	c, _ := NewClient(ts.URL)
+	progress := 0
+	opts := PutStreamOptions{ChunkSize: 3, Concurrency: 1, Progress: func(PutReport) { progress++ }}
+	report, err := c.PutStream(context.Background(), IterateDataPoints(dps), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// chunks: [0 1 2] [3 4 5] [6 7 8] [9]
+	if report.Sent != 6 || report.Failed != 4 || report.Chunks != 4 || progress != 4 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	// the server rejected point 3, so its chunk is not done
+	if report.Checkpoint != 3 {
+		t.Errorf("checkpoint %d, want 3", report.Checkpoint)
+	}
+	if dps[1].Tags["i"] != "1!" {
+		t.Errorf("caller's point cleaned: %v", dps[1].Tags)
+	}
+	offsets := map[int64]int{}
+	for _, f := range report.Failures {
+		offsets[f.Offset] = f.Count
+	}
+	if offsets[3] != 1 || offsets[8] != 1 || offsets[6] != 2 {
+		t.Errorf("unexpected failures %+v", report.Failures)
+	}
+
+	dps[3].Metric = "fixed"
+	dps[6].Metric = "fixed"
+	opts.Resume = report.Checkpoint
+	report, err = c.PutStream(context.Background(), IterateDataPoints(dps), opts)
+	if err != nil || report.Sent != 6 || report.Checkpoint != 10 {
+		t.Errorf("resume: got %+v, %v", report, err)
+	}
+
+	c.PutPolicy = &PutPolicy{MetricRules: []MetricRule{{Pattern: "fixed"}}}
+	report, err = c.PutStream(context.Background(), IterateDataPoints(dps), opts)
+	if err != nil || report.Sent != 4 || report.Dropped != 2 || report.Checkpoint != 10 {
+		t.Errorf("policy: got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,119 @@
+package opentsdb
+
+import (
+	"math"
+	"sort"
+)
+
+// Interpolation says how a quantile falling between two values is
+// estimated.
+type Interpolation int
+
+const (
+	// InterpolateLinear interpolates linearly between the two values, as
+	// OpenTSDB's percentile aggregators do.
+	InterpolateLinear Interpolation = iota
+	// InterpolateLower takes the lower value.
+	InterpolateLower
+	// InterpolateHigher takes the higher value.
+	InterpolateHigher
+	// InterpolateNearest takes the nearest value, the lower one on ties.
+	InterpolateNearest
+	// InterpolateMidpoint takes the mean of the two values.
+	InterpolateMidpoint
+)
+
+// Quantile returns the q quantile, 0 <= q <= 1, of values. NaN values are
+// ignored, and NaN is returned if no value is left or q is out of range.
+func Quantile(values []Point, q float64, method Interpolation) Point {
+	return Quantiles(values, method, q)[0]
+}
+
+// Quantiles is Quantile for several quantiles, sorting values once.
+func Quantiles(values []Point, method Interpolation, qs ...float64) []Point {
+	s := make([]float64, 0, len(values))
+	for _, v := range values {
+		if !math.IsNaN(float64(v)) {
+			s = append(s, float64(v))
+		}
+	}
+	sort.Float64s(s)
+	out := make([]Point, len(qs))
+	for i, q := range qs {
+		if len(s) == 0 || q < 0 || q > 1 {
+			out[i] = Point(math.NaN())
+			continue
+		}
+		out[i] = Point(sortedQuantile(s, q, method))
+	}
+	return out
+}
+
+func sortedQuantile(s []float64, q float64, method Interpolation) float64 {
+	rank := q * float64(len(s)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	frac := rank - float64(lo)
+	switch method {
+	case InterpolateLower:
+		return s[lo]
+	case InterpolateHigher:
+		return s[hi]
+	case InterpolateNearest:
+		if frac > 0.5 {
+			return s[hi]
+		}
+		return s[lo]
+	case InterpolateMidpoint:
+		return (s[lo] + s[hi]) / 2
+	}
+	return s[lo] + (s[hi]-s[lo])*frac
+}
+
+// Quantile returns the q quantile of the values of m over time.
+func (m DPmap) Quantile(q float64, method Interpolation) Point {
+	values := make([]Point, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return Quantile(values, q, method)
+}
+
+// Quantiles returns the quantiles qs of the values of m over time.
+func (m DPmap) Quantiles(method Interpolation, qs ...float64) []Point {
+	values := make([]Point, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return Quantiles(values, method, qs...)
+}
+
+// Quantile returns, at every timestamp present in r, the q quantile of
+// the values of the series of r at that timestamp. Timestamps where all
+// values are NaN are left out.
+func (r ResponseSet) Quantile(q float64, method Interpolation) DPmap {
+	return r.Quantiles(method, q)[0]
+}
+
+// Quantiles is Quantile for several quantiles, returning one DPmap per
+// quantile of qs.
+func (r ResponseSet) Quantiles(method Interpolation, qs ...float64) []DPmap {
+	values := map[Epoch][]Point{}
+	for _, resp := range r {
+		for t, v := range resp.DPS {
+			values[t] = append(values[t], v)
+		}
+	}
+	out := make([]DPmap, len(qs))
+	for i := range out {
+		out[i] = make(DPmap, len(values))
+	}
+	for t, vals := range values {
+		for i, v := range Quantiles(vals, method, qs...) {
+			if !math.IsNaN(float64(v)) {
+				out[i][t] = v
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package opentsdb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantile(t *testing.T) {
+	values := []Point{4, 1, 3, 2, Point(math.NaN())}
+	tests := []struct {
+		q      float64
+		method Interpolation
+		want   Point
+	}{
+		{0.5, InterpolateLinear, 2.5},
+		{0.5, InterpolateLower, 2},
+		{0.5, InterpolateHigher, 3},
+		{0.5, InterpolateNearest, 2},
+		{0.5, InterpolateMidpoint, 2.5},
+		{0.9, InterpolateLinear, 3.7},
+		{1, InterpolateLinear, 4},
+	}
+	for _, test := range tests {
+		if got := Quantile(values, test.q, test.method); math.Abs(float64(got-test.want)) > 1e-9 {
+			t.Errorf("q=%v method=%d: got %v, expected %v", test.q, test.method, got, test.want)
+		}
+	}
+	if got := Quantile(nil, 0.5, InterpolateLinear); !math.IsNaN(float64(got)) {
+		t.Errorf("empty: got %v", got)
+	}
+
+	rs := ResponseSet{
+		{DPS: DPmap{60: 1, 120: 10}},
+		{DPS: DPmap{60: 3, 120: Point(math.NaN())}},
+		{DPS: DPmap{60: 2}},
+	}
+	qs := rs.Quantiles(InterpolateLinear, 0.5, 1)
+	if qs[0][60] != 2 || qs[0][120] != 10 || qs[1][60] != 3 {
+		t.Errorf("got %v", qs)
+	}
+	if got := rs[0].DPS.Quantile(0.5, InterpolateLinear); got != 5.5 {
+		t.Errorf("over time: got %v", got)
+	}
+}
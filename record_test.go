@@ -0,0 +1,40 @@
+package opentsdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	mem := NewMemContext()
+	mem.AddSeries("sys.cpu", TagSet{"host": "a"}, DPmap{100: 1, 110: 2})
+
+	rec, err := NewRecordingContext(mem, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseRequest("start=90&end=150&m=sum:sys.cpu{host=*}", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := rec.Query(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewReplayContext(dir)
+	r2, _ := ParseRequest("start=90&end=150&m=sum:sys.cpu{host=*}", Version2_2)
+	got, err := replay.Query(r2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].DPS[110] != want[0].DPS[110] || !got[0].Tags.Equal(want[0].Tags) {
+		t.Errorf("replayed %v, recorded %v", got, want)
+	}
+
+	r2.End = "160"
+	if _, err := replay.Query(r2); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("expected ErrNotRecorded, got %v", err)
+	}
+}
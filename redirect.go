@@ -0,0 +1,114 @@
+package opentsdb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// RedirectPolicy says how a Client handles redirect responses.
+type RedirectPolicy int
+
+const (
+	// RedirectDefault leaves redirects to the http.Client, which turns
+	// POSTs redirected with 301, 302 or 303 into body-less GETs.
+	RedirectDefault RedirectPolicy = iota
+	// RedirectQueries re-sends read only requests, such as queries, with
+	// their body to the redirect location. Writes such as puts are never
+	// replayed and fail with the redirect response.
+	RedirectQueries
+	// RedirectNever fails every redirected request.
+	RedirectNever
+)
+
+// maxRedirects is the most redirects followed for a request, as in
+// net/http.
+const maxRedirects = 10
+
+var errTooManyRedirects = errors.New("opentsdb: stopped after 10 redirects")
+
+// WithRedirectPolicy sets how the client handles redirects.
+func WithRedirectPolicy(p RedirectPolicy) ClientOption {
+	return func(c *Client) error {
+		c.Redirects = p
+		return nil
+	}
+}
+
+// readOnly reports whether requests to endpoint may safely be replayed.
+func readOnly(endpoint string) bool {
+	for _, p := range []string{"/api/query", "/api/suggest", "/api/search"} {
+		if strings.HasPrefix(endpoint, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// sender sends requests, signing them and handling redirects.
+type sender struct {
+	client    *http.Client
+	signer    RequestSigner
+	redirects RedirectPolicy
+}
+
+// do signs and sends req, whose body is body. Redirects are followed as
+// set by the redirect policy, replaying the request only if replay is
+// true. Redirects that aren't followed are returned as the response.
+func (s sender) do(req *http.Request, body []byte, replay bool) (*http.Response, error) {
+	client := s.client
+	if client == nil {
+		client = DefaultClient
+	}
+	if s.redirects != RedirectDefault {
+		c := *client
+		c.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		client = &c
+	}
+	for i := 0; ; i++ {
+		if err := sign(s.signer, req, body); err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, transportError(err)
+		}
+		if s.redirects != RedirectQueries || !replay || !isRedirect(resp.StatusCode) {
+			return resp, nil
+		}
+		loc, err := resp.Location()
+		closeBody(resp.Body)
+		if err != nil {
+			return nil, transportError(err)
+		}
+		if i == maxRedirects {
+			return nil, transportError(errTooManyRedirects)
+		}
+		next := req.Clone(req.Context())
+		next.URL = loc
+		next.Host = ""
+		next.Body = io.NopCloser(bytes.NewReader(body))
+		next.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		if loc.Host != req.URL.Host {
+			// as net/http, don't leak credentials to another host
+			next.Header.Del("Authorization")
+			next.Header.Del("Cookie")
+		}
+		req = next
+	}
+}
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
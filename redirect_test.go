@@ -0,0 +1,74 @@
+package opentsdb
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientRedirects(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, "/new") {
+			http.Redirect(w, req, "/new"+req.URL.Path, http.StatusFound)
+			return
+		}
+		b, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, req.Method+" "+req.URL.Path+" "+string(b))
+		if req.URL.Path == "/new/api/query" {
+			w.Write([]byte(`[]`))
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	body, _ := r.MarshalJSON()
+	dps := MultiDataPoint{{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"host": "a"}}}
+
+	c, err := NewClient(ts.URL, WithRedirectPolicy(RedirectQueries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query(r); err != nil {
+		t.Fatal(err)
+	}
+	if want := "POST /new/api/query " + string(body); len(bodies) != 1 || bodies[0] != want {
+		t.Errorf("got %q, want %q", bodies, want)
+	}
+	var te *TransportError
+	if err := c.Put(dps); !errors.As(err, &te) || te.Code != http.StatusFound {
+		t.Errorf("put: got %v, want the redirect status", err)
+	}
+	if len(bodies) != 1 {
+		t.Errorf("put was replayed: %q", bodies[1:])
+	}
+
+	c.Redirects = RedirectNever
+	if _, err := c.Query(r); !errors.As(err, &te) || te.Code != http.StatusFound {
+		t.Errorf("query: got %v, want the redirect status", err)
+	}
+	if len(bodies) != 1 {
+		t.Errorf("query followed with RedirectNever: %q", bodies[1:])
+	}
+}
+
+func TestClientRedirectLoop(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, req.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL, WithRedirectPolicy(RedirectQueries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	if _, err := c.Query(r); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,139 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// RejectHandler receives the datapoints a Client drops because they fail
+// Clean, with the reason. The datapoint is the one given to Put, before
+// any cleaning.
+type RejectHandler interface {
+	Reject(dp *DataPoint, reason error)
+}
+
+// RejectFunc adapts a function to a RejectHandler.
+type RejectFunc func(dp *DataPoint, reason error)
+
+func (f RejectFunc) Reject(dp *DataPoint, reason error) { f(dp, reason) }
+
+// WithRejectHandler makes Put and PutStream drop the datapoints failing
+// Clean, passing them to h, instead of failing the whole put.
+func WithRejectHandler(h RejectHandler) ClientOption {
+	return func(c *Client) error {
+		c.Rejects = h
+		return nil
+	}
+}
+
+// LogRejects returns a RejectHandler logging rejects to l, or to the
+// standard logger if l is nil.
+func LogRejects(l *log.Logger) RejectHandler {
+	if l == nil {
+		l = log.Default()
+	}
+	return RejectFunc(func(dp *DataPoint, reason error) {
+		l.Printf("opentsdb: rejected datapoint %s%s at %d: %v", dp.Metric, dp.Tags, dp.Timestamp, reason)
+	})
+}
+
+// RejectCounter is a RejectHandler counting rejects by reason.
+type RejectCounter struct {
+	mu      sync.Mutex
+	total   int64
+	reasons map[string]int64
+}
+
+func (c *RejectCounter) Reject(dp *DataPoint, reason error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reasons == nil {
+		c.reasons = map[string]int64{}
+	}
+	c.total++
+	c.reasons[reason.Error()]++
+}
+
+// Count returns the number of rejects.
+func (c *RejectCounter) Count() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// Reasons returns the number of rejects by reason.
+func (c *RejectCounter) Reasons() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := make(map[string]int64, len(c.reasons))
+	for k, v := range c.reasons {
+		m[k] = v
+	}
+	return m
+}
+
+// RejectWriter is a RejectHandler writing rejects to W as JSON lines of
+// the form {"datapoint":{...},"reason":"..."} for later inspection.
+// Datapoints are written as given, without the validation of
+// DataPoint.MarshalJSON.
+type RejectWriter struct {
+	W io.Writer
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewRejectFile returns a RejectWriter appending to the file at path.
+func NewRejectFile(path string) (*RejectWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &RejectWriter{W: f}, nil
+}
+
+// rawDataPoint marshals like DataPoint without cleaning it first.
+type rawDataPoint DataPoint
+
+func (w *RejectWriter) Reject(dp *DataPoint, reason error) {
+	b, err := json.Marshal(struct {
+		DataPoint *rawDataPoint `json:"datapoint"`
+		Reason    string        `json:"reason"`
+	}{(*rawDataPoint)(dp), reason.Error()})
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		_, err = w.W.Write(append(b, '\n'))
+	}
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+// Err returns the first error met writing rejects.
+func (w *RejectWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close closes W if it is an io.Closer.
+func (w *RejectWriter) Close() error {
+	if c, ok := w.W.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// cleanRejecting cleans dps, passing the datapoints failing to h and
+// returning the others.
+func cleanRejecting(dps MultiDataPoint, h RejectHandler) MultiDataPoint {
+	valid, rejected := CleanBatch(dps, 1)
+	for _, r := range rejected {
+		h.Reject(r.DataPoint, r.Err)
+	}
+	return valid
+}
@@ -0,0 +1,53 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRejectHandler(t *testing.T) {
+	var sent MultiDataPoint
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &sent)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	counter := &RejectCounter{}
+	var buf bytes.Buffer
+	file := &RejectWriter{W: &buf}
+	var got []*DataPoint
+	h := RejectFunc(func(dp *DataPoint, reason error) {
+		got = append(got, dp)
+		counter.Reject(dp, reason)
+		file.Reject(dp, reason)
+	})
+	c, _ := NewClient(ts.URL, WithRejectHandler(h))
+	dps := MultiDataPoint{
+		{Metric: "ok", Timestamp: 100, Value: 1, Tags: TagSet{"host": "a"}},
+		{Metric: "bad", Timestamp: 100, Value: "x", Tags: TagSet{"host": "a"}},
+		{Metric: "bad", Timestamp: 100, Value: 1, Tags: TagSet{"host": "!!"}},
+	}
+	if err := c.Put(dps); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || sent[0].Metric != "ok" {
+		t.Errorf("sent %v", sent)
+	}
+	if len(got) != 2 || got[1].Tags["host"] != "!!" {
+		t.Errorf("rejected %v", got)
+	}
+	if counter.Count() != 2 || len(counter.Reasons()) != 2 {
+		t.Errorf("counter: %d %v", counter.Count(), counter.Reasons())
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"value":"x"`) || !strings.Contains(lines[0], "Unparseable") || file.Err() != nil {
+		t.Errorf("reject file: %s", buf.String())
+	}
+}
@@ -0,0 +1,33 @@
+package opentsdb
+
+import (
+	"io"
+	"time"
+)
+
+// QueryReport is the client side timing of a query, complementing the
+// server side stats OpenTSDB returns with ShowStats and ShowSummary.
+type QueryReport struct {
+	// Build is the time spent preparing the request, including metric
+	// expansion and encoding.
+	Build time.Duration
+	// Network is the time from sending the request until the response
+	// headers arrived, including redirects and retries.
+	Network time.Duration
+	// Decode is the time spent reading and decoding the response body.
+	Decode time.Duration
+	// Total is the wall time of the whole query.
+	Total time.Duration
+	// Bytes is the size of the response body read.
+	Bytes int64
+}
+
+// decode decodes body with dec, recording its time and size in rep.
+func (rep *QueryReport) decode(body io.Reader, dec func(io.Reader) (ResponseSet, error)) (ResponseSet, error) {
+	start := time.Now()
+	cr := &countingReader{R: body}
+	rs, err := dec(cr)
+	rep.Decode = time.Since(start)
+	rep.Bytes = cr.N
+	return rs, err
+}
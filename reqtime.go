@@ -0,0 +1,60 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SetStartTime sets the start of r to t.
+func (r *Request) SetStartTime(t time.Time) { r.Start = epochSpec(t) }
+
+// SetEndTime sets the end of r to t.
+func (r *Request) SetEndTime(t time.Time) { r.End = epochSpec(t) }
+
+// SetRelativeStart sets the start of r to d before now, e.g. 1h30m-ago.
+func (r *Request) SetRelativeStart(d time.Duration) { r.Start = relativeTime(d) }
+
+// SetRelativeEnd sets the end of r to d before now.
+func (r *Request) SetRelativeEnd(d time.Duration) { r.End = relativeTime(d) }
+
+// SetTimeRange sets the start and end of r to from and to.
+func (r *Request) SetTimeRange(from, to time.Time) {
+	r.SetStartTime(from)
+	r.SetEndTime(to)
+}
+
+// epochSpec returns t as an epoch in seconds, or in milliseconds if t has
+// a fraction of a second.
+func epochSpec(t time.Time) int64 {
+	if t.Nanosecond() >= int(time.Millisecond) {
+		return t.UnixMilli()
+	}
+	return t.Unix()
+}
+
+func relativeTime(d time.Duration) string {
+	return Duration(d).HumanString() + "-ago"
+}
+
+// wireTime returns the start or end value v as sent to OpenTSDB. Values
+// of type time.Time, which may be set directly, become epochs and a zero
+// time.Time is left out.
+func wireTime(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok {
+		if t.IsZero() {
+			return nil
+		}
+		return epochSpec(t)
+	}
+	return v
+}
+
+// MarshalJSON encodes r, writing a Start or End of type time.Time as an
+// epoch.
+func (r Request) MarshalJSON() ([]byte, error) {
+	type plain Request
+	p := plain(r)
+	p.Start = wireTime(p.Start)
+	p.End = wireTime(p.End)
+	return json.Marshal(p)
+}
@@ -0,0 +1,35 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeHelpers(t *testing.T) {
+	r := &Request{Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}
+	r.SetRelativeStart(90 * time.Minute)
+	if r.Start != "90m-ago" {
+		t.Errorf("got %v", r.Start)
+	}
+	from := time.Unix(1700000000, 0)
+	r.SetTimeRange(from, from.Add(1500*time.Millisecond))
+	if r.Start != int64(1700000000) || r.End != int64(1700000001500) {
+		t.Errorf("got %v %v", r.Start, r.End)
+	}
+
+	r.Start = from
+	r.End = time.Time{}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"start":1700000000,`) || strings.Contains(string(b), `"end"`) {
+		t.Errorf("got %s", b)
+	}
+	start, end, err := r.timeRange(from.Add(time.Hour))
+	if err != nil || !start.Equal(from) || !end.Equal(from.Add(time.Hour)) {
+		t.Errorf("got %v %v %v", start, end, err)
+	}
+}
@@ -0,0 +1,267 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RollupPoint is a pre-aggregated data point for the /api/rollup route of
+// OpenTSDB 2.4.
+type RollupPoint struct {
+	DataPoint
+	Interval          string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Aggregator        string `json:"aggregator,omitempty" yaml:"aggregator,omitempty"`
+	GroupByAggregator string `json:"groupByAggregator,omitempty" yaml:"groupByAggregator,omitempty"`
+}
+
+// MarshalJSON cleans the data point like DataPoint.MarshalJSON and checks
+// that it is a rollup, with an interval and aggregator, or a pre-aggregate,
+// with a group by aggregator.
+func (p *RollupPoint) MarshalJSON() ([]byte, error) {
+	if err := p.Clean(); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.Interval == "" && p.GroupByAggregator == "":
+		return nil, errors.New("rollup interval or group by aggregator missing")
+	case p.Interval != "" && p.Aggregator == "":
+		return nil, errors.New("rollup aggregator missing")
+	case p.Interval != "":
+		if _, err := ParseDuration(p.Interval); err != nil {
+			return nil, fmt.Errorf("rollup interval %q: %s", p.Interval, err)
+		}
+	}
+	return json.Marshal(struct {
+		Metric            string      `json:"metric"`
+		Timestamp         Epoch       `json:"timestamp"`
+		Value             interface{} `json:"value"`
+		Tags              TagSet      `json:"tags"`
+		Interval          string      `json:"interval,omitempty"`
+		Aggregator        string      `json:"aggregator,omitempty"`
+		GroupByAggregator string      `json:"groupByAggregator,omitempty"`
+	}{p.Metric, p.Timestamp, p.Value, p.Tags, p.Interval, p.Aggregator, p.GroupByAggregator})
+}
+
+// PutRollup sends rps to the /api/rollup endpoint of the client's host.
+// Points without an interval but with a GroupByAggregator are stored as
+// pre-aggregates.
+func (c *Client) PutRollup(rps []*RollupPoint) error {
+	return c.post("/api/rollup", rps, nil, c.putTimeout())
+}
+
+// RollupAggregators are the aggregates a RollupWriter maintains.
+var RollupAggregators = []string{"sum", "count", "min", "max"}
+
+// RollupWriter pre-aggregates raw data points into rollups. Every interval
+// it is configured with gets sum, count, min and max aggregates per series,
+// which are sent when the interval is over: to /api/rollup for OpenTSDB 2.4
+// and later, and to suffixed metrics through /api/put otherwise.
+type RollupWriter struct {
+	Client    *Client
+	Intervals []Duration
+	// Delay is how long after the end of an interval late points are still
+	// accepted before it is flushed.
+	Delay time.Duration
+	// SuffixFormat names the metrics written to versions without
+	// /api/rollup from the metric, interval and aggregator. It defaults to
+	// "%s.%s-%s", e.g. sys.cpu.1h-sum.
+	SuffixFormat string
+
+	mu      sync.Mutex
+	buckets map[rollupKey]*rollupBucket
+}
+
+type rollupKey struct {
+	series   string
+	interval Duration
+	start    Epoch
+}
+
+type rollupBucket struct {
+	metric               string
+	tags                 TagSet
+	sum, count, min, max float64
+}
+
+// NewRollupWriter returns a writer sending rollups of intervals to c.
+func NewRollupWriter(c *Client, intervals ...Duration) *RollupWriter {
+	return &RollupWriter{
+		Client:    c,
+		Intervals: intervals,
+		buckets:   map[rollupKey]*rollupBucket{},
+	}
+}
+
+// Add aggregates dps. Points with a value that isn't a number are
+// rejected. Points arriving after their interval was flushed start a new
+// rollup for it, which overwrites the first one in OpenTSDB.
+func (w *RollupWriter) Add(dps ...*DataPoint) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buckets == nil {
+		w.buckets = map[rollupKey]*rollupBucket{}
+	}
+	for _, d := range dps {
+		v, err := strconv.ParseFloat(fmt.Sprint(d.Value), 64)
+		if err != nil || math.IsNaN(v) {
+			return fmt.Errorf("opentsdb: rollup of %s: invalid value %v", d.Metric, d.Value)
+		}
+		ts := d.Timestamp
+		if ts > 0xffffffff {
+			ts /= 1000
+		}
+		series := d.Metric + d.Tags.String()
+		for _, iv := range w.Intervals {
+			step := Epoch(iv.SecondsInt64())
+			if step < 1 {
+				return fmt.Errorf("opentsdb: rollup interval %s too small", iv.HumanString())
+			}
+			k := rollupKey{series: series, interval: iv, start: ts - ts%step}
+			b, ok := w.buckets[k]
+			if !ok {
+				b = &rollupBucket{metric: d.Metric, tags: d.Tags.Copy(), min: v, max: v}
+				w.buckets[k] = b
+			}
+			b.sum += v
+			b.count++
+			b.min = math.Min(b.min, v)
+			b.max = math.Max(b.max, v)
+		}
+	}
+	return nil
+}
+
+// Flush sends the rollups of intervals that ended at least Delay before
+// now.
+func (w *RollupWriter) Flush(now time.Time) error {
+	cutoff := Epoch(now.Add(-w.Delay).Unix())
+	return w.flush(func(k rollupKey) bool {
+		return k.start+Epoch(k.interval.SecondsInt64()) <= cutoff
+	})
+}
+
+// Close sends all pending rollups, including those of unfinished
+// intervals.
+func (w *RollupWriter) Close() error {
+	return w.flush(func(rollupKey) bool { return true })
+}
+
+// Run flushes the writer every period until ctx is done, then closes it.
+func (w *RollupWriter) Run(ctx context.Context, period time.Duration) error {
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return w.Close()
+		case now := <-t.C:
+			if err := w.Flush(now); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (w *RollupWriter) flush(due func(rollupKey) bool) error {
+	w.mu.Lock()
+	var keys []rollupKey
+	for k := range w.buckets {
+		if due(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].start != keys[j].start {
+			return keys[i].start < keys[j].start
+		}
+		return keys[i].series < keys[j].series
+	})
+	buckets := make([]*rollupBucket, len(keys))
+	for i, k := range keys {
+		buckets[i] = w.buckets[k]
+		delete(w.buckets, k)
+	}
+	w.mu.Unlock()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	rps := make([]*RollupPoint, 0, len(keys)*len(RollupAggregators))
+	for i, k := range keys {
+		b := buckets[i]
+		for _, agg := range RollupAggregators {
+			rps = append(rps, &RollupPoint{
+				DataPoint:  DataPoint{Metric: b.metric, Timestamp: k.start, Value: b.value(agg), Tags: b.tags},
+				Interval:   k.interval.HumanString(),
+				Aggregator: strings.ToUpper(agg),
+			})
+		}
+	}
+	if err := w.send(rps); err != nil {
+		w.restore(keys, buckets)
+		return err
+	}
+	return nil
+}
+
+func (w *RollupWriter) send(rps []*RollupPoint) error {
+	if w.Client.Version().AtLeast(Version2_4) {
+		return w.Client.PutRollup(rps)
+	}
+	format := w.SuffixFormat
+	if format == "" {
+		format = "%s.%s-%s"
+	}
+	dps := make(MultiDataPoint, len(rps))
+	for i, rp := range rps {
+		d := rp.DataPoint
+		d.Metric = fmt.Sprintf(format, d.Metric, rp.Interval, strings.ToLower(rp.Aggregator))
+		dps[i] = &d
+	}
+	return w.Client.Put(dps)
+}
+
+// restore puts back buckets that failed to be sent, merging them with
+// points added since, so that the next flush retries them.
+func (w *RollupWriter) restore(keys []rollupKey, buckets []*rollupBucket) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, k := range keys {
+		b := buckets[i]
+		if cur, ok := w.buckets[k]; ok {
+			b.sum += cur.sum
+			b.count += cur.count
+			b.min = math.Min(b.min, cur.min)
+			b.max = math.Max(b.max, cur.max)
+		}
+		w.buckets[k] = b
+	}
+}
+
+func (b *rollupBucket) value(agg string) float64 {
+	switch agg {
+	case "sum":
+		return b.sum
+	case "count":
+		return b.count
+	case "min":
+		return b.min
+	default:
+		return b.max
+	}
+}
+
+// Pending returns the number of series intervals waiting to be flushed.
+func (w *RollupWriter) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.buckets)
+}
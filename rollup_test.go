@@ -0,0 +1,93 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRollupWriter(t *testing.T) {
+	bodies := map[string][]map[string]interface{}{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body []map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		bodies[req.URL.Path] = append(bodies[req.URL.Path], body...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL)
+	w := NewRollupWriter(c, Hour)
+	err := w.Add(
+		&DataPoint{Metric: "sys.cpu", Timestamp: 3600, Value: 1, Tags: TagSet{"host": "a"}},
+		&DataPoint{Metric: "sys.cpu", Timestamp: 3700, Value: "3", Tags: TagSet{"host": "a"}},
+		&DataPoint{Metric: "sys.cpu", Timestamp: 7300000, Value: 5.5, Tags: TagSet{"host": "a"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(&DataPoint{Metric: "sys.cpu", Timestamp: 1, Value: "x"}); err == nil {
+		t.Error("expected invalid value error")
+	}
+	if err := w.Flush(time.Unix(7199, 0)); err != nil || len(bodies) != 0 {
+		t.Fatalf("flushed unfinished interval: %v %v", bodies, err)
+	}
+	if err := w.Flush(time.Unix(7200, 0)); err != nil {
+		t.Fatal(err)
+	}
+	got := bodies["/api/rollup"]
+	if len(got) != 4 || w.Pending() != 1 {
+		t.Fatalf("got %v, %d pending", got, w.Pending())
+	}
+	want := map[string]float64{"SUM": 4, "COUNT": 2, "MIN": 1, "MAX": 3}
+	for _, p := range got {
+		if p["value"].(float64) != want[p["aggregator"].(string)] || p["interval"] != "1h" || p["timestamp"] != "3600" {
+			t.Errorf("unexpected rollup %v", p)
+		}
+	}
+
+	c.TSDBVersion = Version2_3
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if put := bodies["/api/put"]; len(put) != 4 || put[0]["metric"] != "sys.cpu.1h-sum" || put[0]["value"].(float64) != 5.5 {
+		t.Errorf("unexpected put %v", put)
+	}
+}
+
+func TestRollupWriterRetry(t *testing.T) {
+	fail := true
+	var sums []float64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body []map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		for _, p := range body {
+			if p["aggregator"] == "SUM" {
+				sums = append(sums, p["value"].(float64))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	c, _ := NewClient(ts.URL)
+	w := NewRollupWriter(c, Hour)
+	w.Add(&DataPoint{Metric: "m", Timestamp: 3600, Value: 1, Tags: TagSet{"host": "a"}})
+	if err := w.Flush(time.Unix(7200, 0)); err == nil || w.Pending() != 1 {
+		t.Fatalf("failed flush: %v, %d pending", err, w.Pending())
+	}
+	w.Add(&DataPoint{Metric: "m", Timestamp: 3700, Value: 2, Tags: TagSet{"host": "a"}})
+	fail = false
+	if err := w.Flush(time.Unix(7200, 0)); err != nil || w.Pending() != 0 {
+		t.Fatalf("retry: %v, %d pending", err, w.Pending())
+	}
+	if len(sums) != 1 || sums[0] != 3 {
+		t.Errorf("got sums %v, want [3]", sums)
+	}
+}
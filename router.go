@@ -0,0 +1,143 @@
+package opentsdb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RouteRule sends the queries of metrics starting with Prefix, or matching
+// Pattern when it is set, to Context.
+type RouteRule struct {
+	Prefix  string
+	Pattern *regexp.Regexp
+	Context Context
+}
+
+func (rule *RouteRule) match(metric string) bool {
+	if rule.Pattern != nil {
+		return rule.Pattern.MatchString(metric)
+	}
+	return strings.HasPrefix(metric, rule.Prefix)
+}
+
+// RouterContext federates several backends by metric. The queries of a
+// request are split by the first rule matching their metric, each backend
+// is queried with its share, and the responses are reassembled in the order
+// of the original queries. Queries matching no rule go to Default.
+type RouterContext struct {
+	Rules   []RouteRule
+	Default Context
+}
+
+// Version returns the oldest version of the backends, so that requests
+// built for it work everywhere.
+func (c *RouterContext) Version() Version {
+	var v Version
+	first := true
+	for _, ctx := range c.contexts() {
+		if cv := ctx.Version(); first || !cv.AtLeast(v) {
+			v, first = cv, false
+		}
+	}
+	return v
+}
+
+func (c *RouterContext) contexts() []Context {
+	var all []Context
+	for _, rule := range c.Rules {
+		all = append(all, rule.Context)
+	}
+	if c.Default != nil {
+		all = append(all, c.Default)
+	}
+	return all
+}
+
+// route returns the context answering queries of metric.
+func (c *RouterContext) route(metric string) (Context, error) {
+	for i := range c.Rules {
+		if c.Rules[i].match(metric) {
+			return c.Rules[i].Context, nil
+		}
+	}
+	if c.Default == nil {
+		return nil, fmt.Errorf("%w: no route for metric %s", ErrBadQuery, metric)
+	}
+	return c.Default, nil
+}
+
+// routedRequest is the share of a request sent to one backend, with the
+// index in the original request of each of its queries.
+type routedRequest struct {
+	ctx     Context
+	req     *Request
+	indexes []int
+	rs      ResponseSet
+	err     error
+}
+
+// Query splits r across the backends and queries them concurrently. The
+// responses keep the query indexes of r.
+func (c *RouterContext) Query(r *Request) (ResponseSet, error) {
+	var routes []*routedRequest
+	byCtx := map[Context]*routedRequest{}
+	for i, q := range r.Queries {
+		ctx, err := c.route(q.Metric)
+		if err != nil {
+			return nil, err
+		}
+		rr, ok := byCtx[ctx]
+		if !ok {
+			req := r.Clone()
+			req.Queries = nil
+			// The query index of responses tells which query they answer.
+			req.ShowQuery = true
+			rr = &routedRequest{ctx: ctx, req: req}
+			byCtx[ctx] = rr
+			routes = append(routes, rr)
+		}
+		rr.req.Queries = append(rr.req.Queries, q.Clone())
+		rr.indexes = append(rr.indexes, i)
+	}
+
+	var wg sync.WaitGroup
+	for _, rr := range routes {
+		wg.Add(1)
+		go func(rr *routedRequest) {
+			defer wg.Done()
+			rr.rs, rr.err = rr.ctx.Query(rr.req)
+		}(rr)
+	}
+	wg.Wait()
+
+	var errs []error
+	byQuery := make([]ResponseSet, len(r.Queries))
+	for _, rr := range routes {
+		if rr.err != nil {
+			errs = append(errs, rr.err)
+			continue
+		}
+		for _, resp := range rr.rs {
+			i := resp.Query.Index
+			if i < 0 || i >= len(rr.indexes) {
+				return nil, fmt.Errorf("opentsdb: response for unknown query %d", i)
+			}
+			resp.Query.Index = rr.indexes[i]
+			if !r.ShowQuery {
+				resp.Query = Query{}
+			}
+			byQuery[rr.indexes[i]] = append(byQuery[rr.indexes[i]], resp)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	rs := ResponseSet{}
+	for _, set := range byQuery {
+		rs = append(rs, set...)
+	}
+	return rs, nil
+}
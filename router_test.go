@@ -0,0 +1,53 @@
+package opentsdb
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestRouterContext(t *testing.T) {
+	web, db, other := NewMemContext(), NewMemContext(), NewMemContext()
+	web.AddSeries("web.hits", TagSet{"host": "a"}, DPmap{100: 1})
+	db.AddSeries("db.reads", TagSet{"host": "b"}, DPmap{100: 2})
+	db.AddSeries("mysql.reads", TagSet{"host": "c"}, DPmap{100: 3})
+	other.AddSeries("sys.cpu", TagSet{"host": "d"}, DPmap{100: 4})
+	c := &RouterContext{
+		Rules: []RouteRule{
+			{Prefix: "web.", Context: web},
+			{Pattern: regexp.MustCompile(`^(db|mysql)\.`), Context: db},
+		},
+		Default: other,
+	}
+
+	r, err := ParseRequest("start=90&end=150&m=sum:db.reads&m=sum:sys.cpu&m=sum:web.hits&m=sum:mysql.reads", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := c.Query(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"db.reads", "sys.cpu", "web.hits", "mysql.reads"}
+	if len(rs) != len(want) {
+		t.Fatalf("got %d series", len(rs))
+	}
+	for i, m := range want {
+		if rs[i].Metric != m || rs[i].Query.Index != 0 {
+			t.Errorf("%d: got %s, query %+v", i, rs[i].Metric, rs[i].Query)
+		}
+	}
+
+	r.ShowQuery = true
+	rs, _ = c.Query(r)
+	for i := range rs {
+		if rs[i].Query.Index != i || rs[i].Query.Metric != want[i] {
+			t.Errorf("%d: got query %+v", i, rs[i].Query)
+		}
+	}
+
+	c.Default = nil
+	if _, err := c.Query(r); !errors.Is(err, ErrBadQuery) {
+		t.Errorf("unrouted metric: got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// LookupTag is a tag pair of a lookup query, either side may be "*".
+type LookupTag struct {
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// LookupQuery is the body of /api/search/lookup:
+// http://opentsdb.net/docs/build/html/api_http/search/lookup.html.
+type LookupQuery struct {
+	Metric     string      `json:"metric" yaml:"metric"`
+	Tags       []LookupTag `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Limit      int         `json:"limit,omitempty" yaml:"limit,omitempty"`
+	StartIndex int         `json:"startIndex,omitempty" yaml:"startIndex,omitempty"`
+	UseMeta    bool        `json:"useMeta,omitempty" yaml:"useMeta,omitempty"`
+}
+
+// LookupResult is a time series matched by a lookup.
+type LookupResult struct {
+	TSUID  string `json:"tsuid" yaml:"tsuid"`
+	Metric string `json:"metric" yaml:"metric"`
+	Tags   TagSet `json:"tags" yaml:"tags"`
+}
+
+// LookupResponse is the response of /api/search/lookup.
+type LookupResponse struct {
+	Type         string         `json:"type" yaml:"type"`
+	Metric       string         `json:"metric" yaml:"metric"`
+	Limit        int            `json:"limit" yaml:"limit"`
+	Time         float64        `json:"time" yaml:"time"`
+	StartIndex   int            `json:"startIndex" yaml:"startIndex"`
+	TotalResults int            `json:"totalResults" yaml:"totalResults"`
+	Results      []LookupResult `json:"results" yaml:"results"`
+}
+
+// Lookup runs a /api/search/lookup query.
+func (c *Client) Lookup(lq *LookupQuery) (*LookupResponse, error) {
+	var lr LookupResponse
+	if err := c.post("/api/search/lookup", lq, &lr, c.queryTimeout(nil)); err != nil {
+		return nil, err
+	}
+	return &lr, nil
+}
+
+// maxSuggest bounds the number of names Suggest asks for while paging.
+const maxSuggest = 1 << 20
+
+// Suggest returns up to max names of type typ, one of metrics, tagk or
+// tagv, starting with prefix, from /api/suggest.
+func (c *Client) Suggest(ctx context.Context, typ, prefix string, max int) ([]string, error) {
+	b, err := json.Marshal(map[string]interface{}{"type": typ, "q": prefix, "max": max})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(ctx, "/api/suggest", nil, b, c.queryTimeout(nil), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return nil, responseError(resp, b)
+	}
+	var names []string
+	if err := json.NewDecoder(resp.Body).Decode(&names); err != nil {
+		return nil, decodeError(err)
+	}
+	return names, nil
+}
+
+// ExpandMetrics returns the sorted metric names matching pattern, in which
+// * matches any run of characters. The metrics sharing the prefix of
+// pattern before its first * are listed with Suggest, asking for more until
+// all are returned.
+func (c *Client) ExpandMetrics(ctx context.Context, pattern string) ([]string, error) {
+	prefix, _, _ := strings.Cut(pattern, "*")
+	var names []string
+	for max := 1000; ; max *= 2 {
+		var err error
+		if names, err = c.Suggest(ctx, "metrics", prefix, max); err != nil {
+			return nil, err
+		}
+		if len(names) < max || max >= maxSuggest {
+			break
+		}
+	}
+	matched := []string{}
+	for _, n := range names {
+		if matchWildcard(pattern, n) {
+			matched = append(matched, n)
+		}
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// expandMetrics returns a copy of r in which every query of a metric
+// pattern is replaced by a query of each matching metric. Patterns
+// matching nothing are left in place.
+func (c *Client) expandMetrics(ctx context.Context, r *Request) (*Request, error) {
+	n := r.Clone()
+	n.Queries = nil
+	for _, q := range r.Queries {
+		if !strings.Contains(q.Metric, "*") {
+			n.Queries = append(n.Queries, q.Clone())
+			continue
+		}
+		metrics, err := c.ExpandMetrics(ctx, q.Metric)
+		if err != nil {
+			return nil, err
+		}
+		if len(metrics) == 0 {
+			n.Queries = append(n.Queries, q.Clone())
+		}
+		for _, m := range metrics {
+			eq := q.Clone()
+			eq.Metric = m
+			n.Queries = append(n.Queries, eq)
+		}
+	}
+	return n, nil
+}
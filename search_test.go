@@ -0,0 +1,80 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExpandMetrics(t *testing.T) {
+	metrics := []string{"sys.cpu.user", "sys.cpu.system", "sys.mem.free", "web.hits"}
+	for i := 0; i < 1500; i++ {
+		metrics = append(metrics, fmt.Sprintf("sys.cpu.core%04d", i))
+	}
+	sort.Strings(metrics)
+	var queried *Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/api/suggest":
+			var q struct {
+				Q   string `json:"q"`
+				Max int    `json:"max"`
+			}
+			json.Unmarshal(b, &q)
+			res := []string{}
+			for _, m := range metrics {
+				if strings.HasPrefix(m, q.Q) && len(res) < q.Max {
+					res = append(res, m)
+				}
+			}
+			json.NewEncoder(w).Encode(res)
+		case "/api/query":
+			var err error
+			if queried, err = RequestFromJSON(b); err != nil {
+				t.Error(err)
+			}
+			w.Write([]byte("[]"))
+		}
+	}))
+	defer ts.Close()
+	c, _ := NewClient(ts.URL)
+
+	got, err := c.ExpandMetrics(context.Background(), "sys.cpu.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1502 {
+		t.Errorf("got %d metrics", len(got))
+	}
+	got, _ = c.ExpandMetrics(context.Background(), "sys.*.free")
+	if !reflect.DeepEqual(got, []string{"sys.mem.free"}) {
+		t.Errorf("got %v", got)
+	}
+
+	r := &Request{
+		Start:         "1h-ago",
+		Queries:       []*Query{{Metric: "sys.cpu.s*", Aggregator: "sum"}, {Metric: "web.hits", Aggregator: "sum"}},
+		ExpandMetrics: true,
+	}
+	if _, err := c.Query(r); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, q := range queried.Queries {
+		names = append(names, q.Metric)
+	}
+	if !reflect.DeepEqual(names, []string{"sys.cpu.system", "web.hits"}) {
+		t.Errorf("expanded to %v", names)
+	}
+	if r.Queries[0].Metric != "sys.cpu.s*" {
+		t.Error("request modified")
+	}
+}
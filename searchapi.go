@@ -0,0 +1,200 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// SearchQuery is the body of the /api/search endpoints:
+// http://opentsdb.net/docs/build/html/api_http/search/index.html. Query
+// uses the syntax of the search plugin, e.g. "name:sys.cpu.*".
+type SearchQuery struct {
+	Query      string `json:"query" yaml:"query"`
+	Limit      int    `json:"limit,omitempty" yaml:"limit,omitempty"`
+	StartIndex int    `json:"startIndex,omitempty" yaml:"startIndex,omitempty"`
+}
+
+// SearchPage describes the page of results returned by a search.
+type SearchPage struct {
+	Limit        int     `json:"limit" yaml:"limit"`
+	StartIndex   int     `json:"startIndex" yaml:"startIndex"`
+	TotalResults int     `json:"totalResults" yaml:"totalResults"`
+	Time         float64 `json:"time" yaml:"time"`
+}
+
+// UIDMeta is the metadata of a metric, tag key or tag value:
+// http://opentsdb.net/docs/build/html/api_http/uid/uidmeta.html.
+type UIDMeta struct {
+	UID         string            `json:"uid" yaml:"uid"`
+	Type        string            `json:"type" yaml:"type"`
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description" yaml:"description"`
+	Notes       string            `json:"notes" yaml:"notes"`
+	Created     int64             `json:"created" yaml:"created"`
+	Custom      map[string]string `json:"custom" yaml:"custom"`
+	DisplayName string            `json:"displayName" yaml:"displayName"`
+}
+
+// TSMeta is the metadata of a time series:
+// http://opentsdb.net/docs/build/html/api_http/uid/tsmeta.html.
+type TSMeta struct {
+	TSUID           string            `json:"tsuid" yaml:"tsuid"`
+	Metric          UIDMeta           `json:"metric" yaml:"metric"`
+	Tags            []UIDMeta         `json:"tags" yaml:"tags"`
+	Description     string            `json:"description" yaml:"description"`
+	Notes           string            `json:"notes" yaml:"notes"`
+	Created         int64             `json:"created" yaml:"created"`
+	Units           string            `json:"units" yaml:"units"`
+	DataType        string            `json:"dataType" yaml:"dataType"`
+	Retention       int               `json:"retention" yaml:"retention"`
+	Max             float64           `json:"max" yaml:"max"`
+	Min             float64           `json:"min" yaml:"min"`
+	DisplayName     string            `json:"displayName" yaml:"displayName"`
+	LastReceived    int64             `json:"lastReceived" yaml:"lastReceived"`
+	TotalDatapoints int64             `json:"totalDatapoints" yaml:"totalDatapoints"`
+	Custom          map[string]string `json:"custom" yaml:"custom"`
+}
+
+// TagSet returns the tags of the series, as pairs of tag key and value
+// names.
+func (m *TSMeta) TagSet() TagSet {
+	ts := TagSet{}
+	for i := 0; i+1 < len(m.Tags); i += 2 {
+		ts[m.Tags[i].Name] = m.Tags[i+1].Name
+	}
+	return ts
+}
+
+// Search endpoints.
+const (
+	SearchTSMetaEndpoint  = "/api/search/tsmeta"
+	SearchTSUIDsEndpoint  = "/api/search/tsuids"
+	SearchUIDMetaEndpoint = "/api/search/uidmeta"
+)
+
+// search runs sq at endpoint, decoding the results into results, a
+// pointer to a slice.
+func (c *Client) search(ctx context.Context, endpoint string, sq *SearchQuery, results interface{}) (SearchPage, error) {
+	b, err := json.Marshal(sq)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	resp, err := c.send(ctx, endpoint, nil, b, c.queryTimeout(nil), nil)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	defer closeBody(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return SearchPage{}, responseError(resp, b)
+	}
+	sr := struct {
+		SearchPage
+		Results interface{} `json:"results"`
+	}{Results: results}
+	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return SearchPage{}, decodeError(err)
+	}
+	return sr.SearchPage, nil
+}
+
+// SearchTSMeta returns a page of the series metadata matching sq.
+func (c *Client) SearchTSMeta(ctx context.Context, sq *SearchQuery) ([]TSMeta, SearchPage, error) {
+	var res []TSMeta
+	page, err := c.search(ctx, SearchTSMetaEndpoint, sq, &res)
+	return res, page, err
+}
+
+// SearchTSUIDs returns a page of the TSUIDs of the series matching sq.
+func (c *Client) SearchTSUIDs(ctx context.Context, sq *SearchQuery) ([]string, SearchPage, error) {
+	var res []string
+	page, err := c.search(ctx, SearchTSUIDsEndpoint, sq, &res)
+	return res, page, err
+}
+
+// SearchUIDMeta returns a page of the UID metadata matching sq.
+func (c *Client) SearchUIDMeta(ctx context.Context, sq *SearchQuery) ([]UIDMeta, SearchPage, error) {
+	var res []UIDMeta
+	page, err := c.search(ctx, SearchUIDMetaEndpoint, sq, &res)
+	return res, page, err
+}
+
+// defaultSearchPage is the page size of SearchIterator unless the query
+// sets one.
+const defaultSearchPage = 1000
+
+// SearchIterator walks all the pages of results of a search, fetching them
+// as needed. It is used like bufio.Scanner:
+//
+//	it := c.SearchAll(ctx, SearchTSMetaEndpoint, SearchQuery{Query: "name:sys.*"})
+//	for it.Next() {
+//		var m TSMeta
+//		if err := it.Scan(&m); err != nil {
+//			...
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type SearchIterator struct {
+	c        *Client
+	ctx      context.Context
+	endpoint string
+	q        SearchQuery
+
+	page  []json.RawMessage
+	i     int
+	total int
+	done  bool
+	err   error
+}
+
+// SearchAll returns an iterator over all the results of sq at endpoint,
+// one of the Search*Endpoint constants, starting at sq.StartIndex.
+func (c *Client) SearchAll(ctx context.Context, endpoint string, sq SearchQuery) *SearchIterator {
+	if sq.Limit <= 0 {
+		sq.Limit = defaultSearchPage
+	}
+	return &SearchIterator{c: c, ctx: ctx, endpoint: endpoint, q: sq, i: -1}
+}
+
+// Next advances to the next result, fetching the next page when needed,
+// and reports whether there is one.
+func (it *SearchIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.i++
+	for it.i >= len(it.page) {
+		if it.done {
+			return false
+		}
+		var results []json.RawMessage
+		page, err := it.c.search(it.ctx, it.endpoint, &it.q, &results)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.i, it.total = results, 0, page.TotalResults
+		it.q.StartIndex += len(results)
+		// servers may cap pages below Limit, so only an empty page or the
+		// total ends the results
+		it.done = len(results) == 0 || it.q.StartIndex >= page.TotalResults
+	}
+	return true
+}
+
+// Scan decodes the current result into v, a *TSMeta, *string or *UIDMeta
+// depending on the endpoint.
+func (it *SearchIterator) Scan(v interface{}) error {
+	return decodeError(json.Unmarshal(it.page[it.i], v))
+}
+
+// Total returns the total number of results reported by the last page.
+func (it *SearchIterator) Total() int {
+	return it.total
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *SearchIterator) Err() error {
+	return it.err
+}
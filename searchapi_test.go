@@ -0,0 +1,82 @@
+package opentsdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSearchAll(t *testing.T) {
+	const total = 7
+	var requests []SearchQuery
+	maxPage := 0 // page size cap of the server, if any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != SearchTSMetaEndpoint {
+			t.Errorf("path %s", req.URL.Path)
+		}
+		var sq SearchQuery
+		json.NewDecoder(req.Body).Decode(&sq)
+		requests = append(requests, sq)
+		var results []TSMeta
+		limit := sq.Limit
+		if maxPage > 0 && limit > maxPage {
+			limit = maxPage
+		}
+		for i := sq.StartIndex; i < total && i < sq.StartIndex+limit; i++ {
+			results = append(results, TSMeta{
+				TSUID:  fmt.Sprintf("%06d", i),
+				Metric: UIDMeta{Name: "m", Type: "METRIC"},
+				Tags:   []UIDMeta{{Name: "host", Type: "TAGK"}, {Name: fmt.Sprint("h", i), Type: "TAGV"}},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type": "TSMETA", "limit": sq.Limit, "startIndex": sq.StartIndex, "totalResults": total, "results": results,
+		})
+	}))
+	defer ts.Close()
+	c, err := NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := c.SearchAll(context.Background(), SearchTSMetaEndpoint, SearchQuery{Query: "name:m", Limit: 3})
+	var got []string
+	for it.Next() {
+		var m TSMeta
+		if err := it.Scan(&m); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m.TagSet()["host"])
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != total || got[6] != "h6" || it.Total() != total {
+		t.Errorf("got %v", got)
+	}
+	if len(requests) != 3 || requests[2].StartIndex != 6 {
+		t.Errorf("requests %+v", requests)
+	}
+
+	maxPage = 2
+	it = c.SearchAll(context.Background(), SearchTSMetaEndpoint, SearchQuery{Query: "name:m", Limit: 5})
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if n != total || it.Err() != nil {
+		t.Errorf("capped pages: got %d results, %v", n, it.Err())
+	}
+	maxPage = 0
+
+	metas, page, err := c.SearchTSMeta(context.Background(), &SearchQuery{Query: "name:m", Limit: 5, StartIndex: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 2 || page.TotalResults != total || metas[0].TSUID != "000005" {
+		t.Errorf("got %+v, %+v", metas, page)
+	}
+}
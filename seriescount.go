@@ -0,0 +1,122 @@
+package opentsdb
+
+import (
+	"sort"
+	"sync"
+)
+
+// SeriesCounter counts distinct time series approximately, in total and
+// per metric, with HyperLogLog sketches of its precision. Series are
+// identified by their metric and tags. It is safe for concurrent use.
+type SeriesCounter struct {
+	precision uint8
+
+	mu      sync.Mutex
+	total   *HyperLogLog
+	metrics map[string]*HyperLogLog
+}
+
+// NewSeriesCounter returns an empty counter whose sketches have the given
+// precision, see NewHyperLogLog.
+func NewSeriesCounter(precision uint8) *SeriesCounter {
+	total := NewHyperLogLog(precision)
+	return &SeriesCounter{precision: total.p, total: total, metrics: map[string]*HyperLogLog{}}
+}
+
+// AddSeries counts the series of metric with tags.
+func (c *SeriesCounter) AddSeries(metric string, tags TagSet) {
+	x := hashString(metric + tags.String())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total.add(x)
+	s, ok := c.metrics[metric]
+	if !ok {
+		s = NewHyperLogLog(c.precision)
+		c.metrics[metric] = s
+	}
+	s.add(x)
+}
+
+// AddDataPoints counts the series of dps.
+func (c *SeriesCounter) AddDataPoints(dps MultiDataPoint) {
+	for _, d := range dps {
+		c.AddSeries(d.Metric, d.Tags)
+	}
+}
+
+// AddResponses counts the series of rs. Aggregated responses count as the
+// series of their remaining tags.
+func (c *SeriesCounter) AddResponses(rs ResponseSet) {
+	for _, r := range rs {
+		c.AddSeries(r.Metric, r.Tags)
+	}
+}
+
+// Count returns the estimated number of distinct series.
+func (c *SeriesCounter) Count() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total.Count()
+}
+
+// Metric returns the estimated number of distinct series of metric.
+func (c *SeriesCounter) Metric(metric string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.metrics[metric]; ok {
+		return s.Count()
+	}
+	return 0
+}
+
+// Metrics returns the estimated number of distinct series of every metric.
+func (c *SeriesCounter) Metrics() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := make(map[string]uint64, len(c.metrics))
+	for metric, s := range c.metrics {
+		m[metric] = s.Count()
+	}
+	return m
+}
+
+// MetricNames returns the sorted metrics counted.
+func (c *SeriesCounter) MetricNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.metrics))
+	for m := range c.metrics {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Merge adds the series counted by o, e.g. by another collector, which
+// must have the same precision.
+func (c *SeriesCounter) Merge(o *SeriesCounter) error {
+	if c == o {
+		return nil
+	}
+	o.mu.Lock()
+	total := o.total.Clone()
+	metrics := make(map[string]*HyperLogLog, len(o.metrics))
+	for m, s := range o.metrics {
+		metrics[m] = s.Clone()
+	}
+	o.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.total.Merge(total); err != nil {
+		return err
+	}
+	for m, s := range metrics {
+		if cs, ok := c.metrics[m]; ok {
+			cs.merge(s)
+		} else {
+			c.metrics[m] = s
+		}
+	}
+	return nil
+}
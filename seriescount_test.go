@@ -0,0 +1,55 @@
+package opentsdb
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000} {
+		s := NewHyperLogLog(14)
+		for i := 0; i < n; i++ {
+			s.AddString(strconv.Itoa(i))
+		}
+		if n > 0 && s.AddString("0") {
+			t.Errorf("%d: sketch changed by a value already added", n)
+		}
+		if got := float64(s.Count()); got < 0.97*float64(n) || got > 1.03*float64(n) {
+			t.Errorf("counted %v, want %d", got, n)
+		}
+	}
+	if err := NewHyperLogLog(10).Merge(NewHyperLogLog(12)); err == nil {
+		t.Error("merged sketches of different precision")
+	}
+}
+
+func TestSeriesCounter(t *testing.T) {
+	a, b := NewSeriesCounter(12), NewSeriesCounter(12)
+	var dps MultiDataPoint
+	for i := 0; i < 500; i++ {
+		for ts := Epoch(1); ts <= 3; ts++ {
+			dps = append(dps, &DataPoint{Metric: "cpu", Timestamp: ts, Value: 1, Tags: TagSet{"host": strconv.Itoa(i)}})
+		}
+	}
+	a.AddDataPoints(dps)
+	b.AddResponses(ResponseSet{
+		{Metric: "mem", Tags: TagSet{"host": "1"}},
+		{Metric: "mem", Tags: TagSet{"host": "2"}},
+		{Metric: "cpu", Tags: TagSet{"host": "1"}},
+	})
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if n := a.Metric("cpu"); n < 490 || n > 510 {
+		t.Errorf("cpu: counted %d, want about 500", n)
+	}
+	if m := a.Metrics(); m["mem"] != 2 || len(m) != 2 {
+		t.Errorf("got %v", m)
+	}
+	if n := a.Count(); n < 492 || n > 512 {
+		t.Errorf("counted %d, want about 502", n)
+	}
+	if err := a.Merge(NewSeriesCounter(10)); err == nil {
+		t.Error("merged counters of different precision")
+	}
+}
@@ -0,0 +1,156 @@
+// Package server exposes an opentsdb.Context over an OpenTSDB compatible
+// HTTP API, so that translating, limiting or multi-cluster proxies can be
+// built with the opentsdb package and net/http alone.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/the-cloud-source/opentsdb"
+)
+
+// Putter receives the datapoints sent to /api/put. *opentsdb.Client is a
+// Putter.
+type Putter interface {
+	Put(opentsdb.MultiDataPoint) error
+}
+
+// DefaultMaxPutBodySize is the largest /api/put body a Handler reads when
+// MaxPutBodySize is not set.
+const DefaultMaxPutBodySize = 16 << 20
+
+// Handler serves /api/query from Context and, when Putter is set, passes
+// /api/put through to it. /api/version reports the version of Context.
+type Handler struct {
+	Context opentsdb.Context
+	Putter  Putter
+	// MaxPutBodySize is the largest /api/put body read, larger ones being
+	// answered with 413. It defaults to DefaultMaxPutBodySize.
+	MaxPutBodySize int64
+	// NonFinite is how NaN and infinite points of query responses are
+	// encoded, as null by default.
+	NonFinite opentsdb.NonFinitePolicy
+
+	once sync.Once
+	mux  *http.ServeMux
+}
+
+// NewHandler returns a Handler serving queries from c.
+func NewHandler(c opentsdb.Context) *Handler {
+	return &Handler{Context: c}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	h.once.Do(func() {
+		h.mux = http.NewServeMux()
+		h.mux.HandleFunc("/api/query", h.handleQuery)
+		h.mux.HandleFunc("/api/put", h.handlePut)
+		h.mux.HandleFunc("/api/version", h.handleVersion)
+	})
+	h.mux.ServeHTTP(w, req)
+}
+
+func (h *Handler) handleQuery(w http.ResponseWriter, req *http.Request) {
+	r, err := opentsdb.ParseQueryRequest(req)
+	if err != nil {
+		writeError(w, StatusCode(err), err)
+		return
+	}
+	rs, err := h.Context.Query(r)
+	if err != nil {
+		writeError(w, StatusCode(err), err)
+		return
+	}
+	if rs == nil {
+		rs = opentsdb.ResponseSet{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	opentsdb.NewEncoder(w, h.NonFinite).Encode(rs)
+}
+
+func (h *Handler) handlePut(w http.ResponseWriter, req *http.Request) {
+	if h.Putter == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("put is not supported"))
+		return
+	}
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	limit := h.MaxPutBodySize
+	if limit <= 0 {
+		limit = DefaultMaxPutBodySize
+	}
+	b, err := io.ReadAll(http.MaxBytesReader(w, req.Body, limit))
+	if err != nil {
+		code := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, code, err)
+		return
+	}
+	var dps opentsdb.MultiDataPoint
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '{' {
+		dp := &opentsdb.DataPoint{}
+		err = json.Unmarshal(b, dp)
+		dps = append(dps, dp)
+	} else {
+		err = json.Unmarshal(b, &dps)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.Putter.Put(dps); err != nil {
+		writeError(w, StatusCode(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleVersion(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"version": h.Context.Version().String()})
+}
+
+// StatusCode returns the HTTP status matching the kind of err. Errors from
+// an upstream TSD and from parsing the request keep their status.
+func StatusCode(err error) int {
+	var re *opentsdb.RequestError
+	var qe *opentsdb.QueryRequestError
+	switch {
+	case errors.As(err, &re) && re.Err.Code != 0:
+		return re.Err.Code
+	case errors.As(err, &qe):
+		return qe.Status
+	case errors.Is(err, opentsdb.ErrBadQuery):
+		return http.StatusBadRequest
+	case errors.Is(err, opentsdb.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, opentsdb.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, opentsdb.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	e := opentsdb.RequestError{}
+	e.Err.Code = code
+	e.Err.Message = err.Error()
+	writeJSON(w, code, &e)
+}
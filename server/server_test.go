@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/the-cloud-source/opentsdb"
+)
+
+type putRecorder struct {
+	dps opentsdb.MultiDataPoint
+}
+
+func (p *putRecorder) Put(dps opentsdb.MultiDataPoint) error {
+	p.dps = append(p.dps, dps...)
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	mem := opentsdb.NewMemContext()
+	mem.AddSeries("sys.cpu", opentsdb.TagSet{"host": "a"}, opentsdb.DPmap{100: 1, 110: 2})
+	h := NewHandler(mem)
+	puts := &putRecorder{}
+	h.Putter = puts
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	c, err := opentsdb.NewClient(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := opentsdb.ParseRequest("start=90&end=150&m=sum:sys.cpu{host=a}", opentsdb.Version2_4)
+	rs, err := c.Query(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].DPS[110] != 2 {
+		t.Errorf("got %v", rs)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/query?start=90&end=150&m=sum:sys.cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET: status %d", resp.StatusCode)
+	}
+
+	mem.AddSeries("sys.nan", opentsdb.TagSet{"host": "a"}, opentsdb.DPmap{100: opentsdb.Point(math.NaN())})
+	h.NonFinite = opentsdb.NonFiniteString
+	resp, err = http.Get(ts.URL + "/api/query?start=90&end=150&m=sum:sys.nan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"dps":{"100":"NaN"}`) {
+		t.Errorf("NaN point: got %s", body)
+	}
+
+	resp, err = http.Post(ts.URL+"/api/query", "application/json", strings.NewReader("{"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid JSON: status %d", resp.StatusCode)
+	}
+
+	dp := &opentsdb.DataPoint{Metric: "m", Timestamp: 100, Value: 1, Tags: opentsdb.TagSet{"host": "a"}}
+	if err := c.Put(opentsdb.MultiDataPoint{dp}); err != nil {
+		t.Fatal(err)
+	}
+	if len(puts.dps) != 1 || puts.dps[0].Metric != "m" {
+		t.Errorf("put: got %v", puts.dps)
+	}
+
+	h.MaxPutBodySize = 64
+	large := `[` + strings.Repeat(`{"metric":"m","timestamp":100,"value":1,"tags":{"host":"a"}},`, 10) + `]`
+	resp, err = http.Post(ts.URL+"/api/put", "application/json", strings.NewReader(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || len(puts.dps) != 1 {
+		t.Errorf("large put: status %d, %d points", resp.StatusCode, len(puts.dps))
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{opentsdb.ErrTimeout, http.StatusGatewayTimeout},
+		{opentsdb.ErrUnavailable, http.StatusServiceUnavailable},
+		{&opentsdb.ResponseTooLargeError{}, http.StatusRequestEntityTooLarge},
+		{&opentsdb.ValidationError{}, http.StatusBadRequest},
+		{errors.New("x"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		if got := StatusCode(test.err); got != test.code {
+			t.Errorf("%v: got %d, want %d", test.err, got, test.code)
+		}
+	}
+}
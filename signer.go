@@ -0,0 +1,35 @@
+package opentsdb
+
+import "net/http"
+
+// RequestSigner signs requests to OpenTSDB, for instance for gateways
+// requiring AWS SigV4 or HMAC authentication.
+type RequestSigner interface {
+	// Sign is called just before req is sent, with its body as sent on
+	// the wire. It may add headers or query parameters to req. An error
+	// fails the request without sending it.
+	Sign(req *http.Request, body []byte) error
+}
+
+// RequestSignerFunc adapts a function to a RequestSigner.
+type RequestSignerFunc func(req *http.Request, body []byte) error
+
+func (f RequestSignerFunc) Sign(req *http.Request, body []byte) error {
+	return f(req, body)
+}
+
+// WithSigner makes the client sign every request with s.
+func WithSigner(s RequestSigner) ClientOption {
+	return func(c *Client) error {
+		c.Signer = s
+		return nil
+	}
+}
+
+// sign signs req with s unless s is nil.
+func sign(s RequestSigner, req *http.Request, body []byte) error {
+	if s == nil {
+		return nil
+	}
+	return s.Sign(req, body)
+}
@@ -0,0 +1,105 @@
+package opentsdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// SLOReport is the availability of a service level objective over a window
+// and how fast its error budget is being spent.
+type SLOReport struct {
+	Target       float64 // e.g. 0.999
+	Good, Total  float64
+	Availability float64 // Good / Total, NaN without events
+	// BudgetRemaining is the fraction of the error budget, 1 - Target,
+	// left over the whole window. It is negative once the budget is spent.
+	BudgetRemaining float64
+	BurnRates       []BurnRate
+}
+
+// BurnRate is the rate at which the error budget is spent over the last
+// Window: 1 spends exactly the budget over the SLO window, 10 ten times
+// faster.
+type BurnRate struct {
+	Window       Duration
+	Availability float64
+	Rate         float64
+}
+
+// SLO computes the report of target from good and total, which count the
+// good and all events per timestamp, e.g. downsampled with sum. The burn
+// rates are computed over the given windows ending at the last timestamp
+// of total.
+func SLO(good, total DPmap, target float64, windows ...Duration) (*SLOReport, error) {
+	if target <= 0 || target >= 1 {
+		return nil, fmt.Errorf("opentsdb: invalid SLO target %v", target)
+	}
+	budget := 1 - target
+	rep := &SLOReport{Target: target}
+	rep.Good, rep.Total = sumSince(good, time.Time{}), sumSince(total, time.Time{})
+	rep.Availability = availability(rep.Good, rep.Total)
+	rep.BudgetRemaining = 1 - (1-rep.Availability)/budget
+
+	times := total.GetSortedTimes()
+	if len(times) == 0 {
+		return rep, nil
+	}
+	end := epochTime(times[len(times)-1])
+	for _, w := range windows {
+		// points are at the start of their interval, so the window
+		// holds those after end - w
+		since := end.Add(-time.Duration(w))
+		a := availability(sumSince(good, since), sumSince(total, since))
+		rep.BurnRates = append(rep.BurnRates, BurnRate{Window: w, Availability: a, Rate: (1 - a) / budget})
+	}
+	return rep, nil
+}
+
+// QuerySLO runs the good and total requests against c, sums the series of
+// each and computes their SLO report.
+func QuerySLO(c Context, good, total *Request, target float64, windows ...Duration) (*SLOReport, error) {
+	g, err := querySum(c, good)
+	if err != nil {
+		return nil, err
+	}
+	t, err := querySum(c, total)
+	if err != nil {
+		return nil, err
+	}
+	return SLO(g, t, target, windows...)
+}
+
+func querySum(c Context, r *Request) (DPmap, error) {
+	rs, err := c.Query(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, errors.New("opentsdb: SLO query returned no series")
+	}
+	all := make([]DPmap, len(rs))
+	for i, resp := range rs {
+		all[i] = resp.DPS
+	}
+	return aggregateSeries("sum", all)
+}
+
+// sumSince sums the values of m after since, ignoring NaN.
+func sumSince(m DPmap, since time.Time) float64 {
+	var s float64
+	for t, v := range m {
+		if !math.IsNaN(float64(v)) && epochTime(t).After(since) {
+			s += float64(v)
+		}
+	}
+	return s
+}
+
+func availability(good, total float64) float64 {
+	if total == 0 {
+		return math.NaN()
+	}
+	return good / total
+}
@@ -0,0 +1,40 @@
+package opentsdb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSLO(t *testing.T) {
+	good, total := DPmap{}, DPmap{}
+	for i := Epoch(1); i <= 10; i++ {
+		total[i*3600] = 1000
+		good[i*3600] = 1000
+	}
+	good[10*3600] = 990 // 10 errors in the last hour
+
+	rep, err := SLO(good, total, 0.99, Hour, 5*Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if rep.Total != 10000 || !near(rep.Availability, 0.999) || !near(rep.BudgetRemaining, 0.9) {
+		t.Errorf("got %+v", rep)
+	}
+	if len(rep.BurnRates) != 2 || !near(rep.BurnRates[0].Rate, 1) || !near(rep.BurnRates[1].Rate, 0.2) {
+		t.Errorf("got %+v", rep.BurnRates)
+	}
+	if _, err := SLO(good, total, 1); err == nil {
+		t.Error("expected error")
+	}
+
+	c := NewMemContext()
+	c.AddSeries("req.good", TagSet{"host": "a"}, DPmap{100: 5})
+	c.AddSeries("req.good", TagSet{"host": "b"}, DPmap{100: 4})
+	c.AddSeries("req.total", TagSet{"host": "a"}, DPmap{100: 10})
+	g, _ := ParseRequest("start=50&end=150&m=sum:req.good{host=*}", Version2_2)
+	tr, _ := ParseRequest("start=50&end=150&m=sum:req.total", Version2_2)
+	if rep, err := QuerySLO(c, g, tr, 0.5); err != nil || !near(rep.Availability, 0.9) {
+		t.Errorf("got %+v %v", rep, err)
+	}
+}
@@ -0,0 +1,63 @@
+package opentsdb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// snapshotMagic starts every snapshot written by ResponseSet.Save. It is
+// followed by a format version byte.
+const snapshotMagic = "OTSDBRS"
+
+// SnapshotVersion is the snapshot format version written by Save. Version
+// 1 is a gzip compressed JSON response array as returned by /api/query.
+const SnapshotVersion = 1
+
+// Save writes rs to w as a snapshot that LoadResponseSet reads back, so
+// that expensive results can be checkpointed. Non-finite points are
+// encoded as strings, so that they load back unchanged.
+func (rs ResponseSet) Save(w io.Writer) error {
+	if _, err := io.WriteString(w, snapshotMagic); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{SnapshotVersion}); err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	if rs == nil {
+		rs = ResponseSet{}
+	}
+	if err := NewEncoder(zw, NonFiniteString).Encode(rs); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// LoadResponseSet reads a snapshot written by ResponseSet.Save. Input that
+// isn't a snapshot, or has an unknown version, fails with
+// ErrSnapshotFormat.
+func LoadResponseSet(r io.Reader) (ResponseSet, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, head); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrSnapshotFormat
+		}
+		return nil, err
+	}
+	if !bytes.Equal(head[:len(snapshotMagic)], []byte(snapshotMagic)) {
+		return nil, ErrSnapshotFormat
+	}
+	if v := head[len(snapshotMagic)]; v != SnapshotVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrSnapshotFormat, v)
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	defer zr.Close()
+	return DecodeResponseSet(zr)
+}
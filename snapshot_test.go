@@ -0,0 +1,44 @@
+package opentsdb
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	rs := ResponseSet{
+		{Metric: "cpu", Tags: TagSet{"host": "a"}, AggregateTags: []string{"core"}, DPS: DPmap{100: 1, 110: 2.5}},
+		{Metric: "mem", Tags: TagSet{}, AggregateTags: []string{}, DPS: DPmap{100: -3}},
+	}
+	var buf bytes.Buffer
+	if err := rs.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadResponseSet(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(rs) {
+		t.Fatalf("got %d responses, want %d", len(got), len(rs))
+	}
+	for i := range rs {
+		if got[i].Metric != rs[i].Metric || !reflect.DeepEqual(got[i].Tags, rs[i].Tags) ||
+			!reflect.DeepEqual(got[i].AggregateTags, rs[i].AggregateTags) || !reflect.DeepEqual(got[i].DPS, rs[i].DPS) {
+			t.Errorf("response %d: got %+v, want %+v", i, got[i], rs[i])
+		}
+	}
+}
+
+func TestLoadResponseSetFormat(t *testing.T) {
+	for _, s := range []string{"", "OTS", `[{"metric":"cpu"}]`, "OTSDBRS\x09xxxx"} {
+		if _, err := LoadResponseSet(strings.NewReader(s)); !errors.Is(err, ErrSnapshotFormat) {
+			t.Errorf("%q: got %v, want ErrSnapshotFormat", s, err)
+		}
+	}
+	if _, err := LoadResponseSet(strings.NewReader("OTSDBRS\x01garbage")); !errors.Is(err, ErrDecode) {
+		t.Errorf("got %v, want ErrDecode", err)
+	}
+}
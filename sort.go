@@ -0,0 +1,71 @@
+package opentsdb
+
+import (
+	"sort"
+	"strings"
+)
+
+// Sort orders r by metric, then tags, then aggregate tags. Responses that
+// compare equal keep their relative order.
+func (r ResponseSet) Sort() {
+	keys := r.sortKeys()
+	sort.Stable(responseSorter{r, keys, false})
+}
+
+// SortByQueryIndex orders r by the index of the query that produced each
+// response, then as Sort does. The index is only set when the request had
+// ShowQuery enabled.
+func (r ResponseSet) SortByQueryIndex() {
+	keys := r.sortKeys()
+	sort.Stable(responseSorter{r, keys, true})
+}
+
+// GroupByQuery splits r by the index of the query that produced each
+// response. The set at position i holds the responses of query i, in the
+// order of r. The index is only set when the request had ShowQuery enabled.
+func (r ResponseSet) GroupByQuery() []ResponseSet {
+	var groups []ResponseSet
+	for _, resp := range r {
+		i := resp.Query.Index
+		if i < 0 {
+			continue
+		}
+		for len(groups) <= i {
+			groups = append(groups, ResponseSet{})
+		}
+		groups[i] = append(groups[i], resp)
+	}
+	return groups
+}
+
+func (r ResponseSet) sortKeys() []string {
+	keys := make([]string, len(r))
+	for i, resp := range r {
+		keys[i] = canonicalTags(resp.Tags) + "|" + strings.Join(resp.AggregateTags, ",")
+	}
+	return keys
+}
+
+type responseSorter struct {
+	rs      ResponseSet
+	keys    []string
+	byIndex bool
+}
+
+func (s responseSorter) Len() int { return len(s.rs) }
+
+func (s responseSorter) Swap(i, j int) {
+	s.rs[i], s.rs[j] = s.rs[j], s.rs[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+func (s responseSorter) Less(i, j int) bool {
+	a, b := s.rs[i], s.rs[j]
+	if s.byIndex && a.Query.Index != b.Query.Index {
+		return a.Query.Index < b.Query.Index
+	}
+	if a.Metric != b.Metric {
+		return a.Metric < b.Metric
+	}
+	return s.keys[i] < s.keys[j]
+}
@@ -0,0 +1,31 @@
+package opentsdb
+
+import "testing"
+
+func TestResponseSetSort(t *testing.T) {
+	rs := ResponseSet{
+		{Metric: "b", Tags: TagSet{"host": "a"}, Query: Query{Index: 0}},
+		{Metric: "a", Tags: TagSet{"host": "b"}, Query: Query{Index: 1}},
+		{Metric: "a", Tags: TagSet{"host": "a", "dc": "x"}, Query: Query{Index: 1}},
+		{Metric: "a", Tags: TagSet{"host": "a"}, Query: Query{Index: 0}},
+	}
+	order := func() (s []string) {
+		for _, r := range rs {
+			s = append(s, r.Metric+r.Tags.String())
+		}
+		return s
+	}
+	check := func(want ...string) {
+		t.Helper()
+		got := order()
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		}
+	}
+	rs.Sort()
+	check("a{dc=x,host=a}", "a{host=a}", "a{host=b}", "b{host=a}")
+	rs.SortByQueryIndex()
+	check("a{host=a}", "b{host=a}", "a{dc=x,host=a}", "a{host=b}")
+}
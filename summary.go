@@ -0,0 +1,190 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QueryStageStats are the timings and counts OpenTSDB reports for the
+// stages of a query with showSummary. Times are in milliseconds.
+type QueryStageStats struct {
+	AvgAggregationTime        float64 `json:"avgAggregationTime,omitempty" yaml:"avgAggregationTime,omitempty"`
+	AvgHBaseTime              float64 `json:"avgHBaseTime,omitempty" yaml:"avgHBaseTime,omitempty"`
+	AvgQueryScanTime          float64 `json:"avgQueryScanTime,omitempty" yaml:"avgQueryScanTime,omitempty"`
+	AvgScannerTime            float64 `json:"avgScannerTime,omitempty" yaml:"avgScannerTime,omitempty"`
+	AvgScannerUidToStringTime float64 `json:"avgScannerUidToStringTime,omitempty" yaml:"avgScannerUidToStringTime,omitempty"`
+	AvgSerializationTime      float64 `json:"avgSerializationTime,omitempty" yaml:"avgSerializationTime,omitempty"`
+	MaxAggregationTime        float64 `json:"maxAggregationTime,omitempty" yaml:"maxAggregationTime,omitempty"`
+	MaxHBaseTime              float64 `json:"maxHBaseTime,omitempty" yaml:"maxHBaseTime,omitempty"`
+	MaxQueryScanTime          float64 `json:"maxQueryScanTime,omitempty" yaml:"maxQueryScanTime,omitempty"`
+	MaxScannerUidToStringTime float64 `json:"maxScannerUidToStringTime,omitempty" yaml:"maxScannerUidToStringTime,omitempty"`
+	MaxSerializationTime      float64 `json:"maxSerializationTime,omitempty" yaml:"maxSerializationTime,omitempty"`
+	MaxUidToStringTime        float64 `json:"maxUidToStringTime,omitempty" yaml:"maxUidToStringTime,omitempty"`
+	UidToStringTime           float64 `json:"uidToStringTime,omitempty" yaml:"uidToStringTime,omitempty"`
+	EmittedDPs                int64   `json:"emittedDPs,omitempty" yaml:"emittedDPs,omitempty"`
+	DPsPreFilter              int64   `json:"dpsPreFilter,omitempty" yaml:"dpsPreFilter,omitempty"`
+	DPsPostFilter             int64   `json:"dpsPostFilter,omitempty" yaml:"dpsPostFilter,omitempty"`
+	RowsPreFilter             int64   `json:"rowsPreFilter,omitempty" yaml:"rowsPreFilter,omitempty"`
+	RowsPostFilter            int64   `json:"rowsPostFilter,omitempty" yaml:"rowsPostFilter,omitempty"`
+	SuccessfulScan            int64   `json:"successfulScan,omitempty" yaml:"successfulScan,omitempty"`
+	UidPairsResolved          int64   `json:"uidPairsResolved,omitempty" yaml:"uidPairsResolved,omitempty"`
+}
+
+// QueryStatsSummary is the statsSummary element OpenTSDB appends to a
+// response with showSummary. Queries holds the breakdown of each query by
+// index, from the queryIdx_NN fields, and Extra the fields not known to
+// this package.
+type QueryStatsSummary struct {
+	QueryStageStats        `yaml:",inline"`
+	ProcessingPreWriteTime float64                  `json:"processingPreWriteTime,omitempty" yaml:"processingPreWriteTime,omitempty"`
+	Queries                map[int]*QueryStageStats `json:"-" yaml:"queries,omitempty"`
+	Extra                  map[string]any           `json:"-" yaml:"extra,omitempty"`
+}
+
+const queryIdxPrefix = "queryIdx_"
+
+type queryStatsSummary QueryStatsSummary
+
+// summaryFields are the JSON names of the fields of QueryStatsSummary.
+var summaryFields = jsonFields(reflect.TypeOf(queryStatsSummary{}))
+
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			for k := range jsonFields(f.Type) {
+				fields[k] = true
+			}
+			continue
+		}
+		if name, _, _ := strings.Cut(f.Tag.Get("json"), ","); name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// UnmarshalJSON decodes a statsSummary, keeping unknown fields in Extra.
+func (s *QueryStatsSummary) UnmarshalJSON(b []byte) error {
+	var known queryStatsSummary
+	if err := json.Unmarshal(b, &known); err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return err
+	}
+	for k, v := range all {
+		switch {
+		case summaryFields[k]:
+		case strings.HasPrefix(k, queryIdxPrefix):
+			i, err := strconv.Atoi(strings.TrimPrefix(k, queryIdxPrefix))
+			if err != nil {
+				return fmt.Errorf("opentsdb: invalid summary field %q", k)
+			}
+			var qs QueryStageStats
+			if err := json.Unmarshal(v, &qs); err != nil {
+				return err
+			}
+			if known.Queries == nil {
+				known.Queries = map[int]*QueryStageStats{}
+			}
+			known.Queries[i] = &qs
+		default:
+			var e any
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if known.Extra == nil {
+				known.Extra = map[string]any{}
+			}
+			known.Extra[k] = e
+		}
+	}
+	*s = QueryStatsSummary(known)
+	return nil
+}
+
+// MarshalJSON encodes s as OpenTSDB does, with the per query breakdown in
+// queryIdx_NN fields.
+func (s *QueryStatsSummary) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal((*queryStatsSummary)(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Queries) == 0 && len(s.Extra) == 0 {
+		return b, nil
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range s.Extra {
+		m[k] = v
+	}
+	for i, qs := range s.Queries {
+		m[fmt.Sprintf("%s%02d", queryIdxPrefix, i)] = qs
+	}
+	return json.Marshal(m)
+}
+
+// Query returns the stats of the query with index i, or nil.
+func (s *QueryStatsSummary) Query(i int) *QueryStageStats {
+	if s == nil {
+		return nil
+	}
+	return s.Queries[i]
+}
+
+// QueryIndexes returns the sorted indexes of the queries in s.
+func (s *QueryStatsSummary) QueryIndexes() []int {
+	var idx []int
+	if s == nil {
+		return idx
+	}
+	for i := range s.Queries {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	return idx
+}
+
+// Copy returns a deep copy of s.
+func (s *QueryStatsSummary) Copy() *QueryStatsSummary {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	if s.Queries != nil {
+		c.Queries = make(map[int]*QueryStageStats, len(s.Queries))
+		for i, qs := range s.Queries {
+			q := *qs
+			c.Queries[i] = &q
+		}
+	}
+	if s.Extra != nil {
+		c.Extra = copyJSONValue(s.Extra).(map[string]any)
+	}
+	return &c
+}
+
+// isSummary reports whether r is the statsSummary element of a response
+// rather than a series.
+func (r *Response) isSummary() bool {
+	return r.Metric == "" && r.StatsSummary != nil
+}
+
+// Summary returns the statsSummary of the response, or nil.
+func (r ResponseSet) Summary() *QueryStatsSummary {
+	for _, resp := range r {
+		if resp.StatsSummary != nil {
+			return resp.StatsSummary
+		}
+	}
+	return nil
+}
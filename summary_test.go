@@ -0,0 +1,36 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestQueryStatsSummaryJSON(t *testing.T) {
+	in := `{"avgAggregationTime":0.5,"maxUidToStringTime":3,"emittedDPs":120,"processingPreWriteTime":7,` +
+		`"queryIdx_00":{"avgQueryScanTime":2.5,"emittedDPs":100},"queryIdx_01":{"emittedDPs":20},"newStat":"x"}`
+	var s QueryStatsSummary
+	if err := json.Unmarshal([]byte(in), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.AvgAggregationTime != 0.5 || s.MaxUidToStringTime != 3 || s.EmittedDPs != 120 || s.ProcessingPreWriteTime != 7 {
+		t.Errorf("got %+v", s)
+	}
+	if !reflect.DeepEqual(s.QueryIndexes(), []int{0, 1}) || s.Query(0).AvgQueryScanTime != 2.5 || s.Query(1).EmittedDPs != 20 {
+		t.Errorf("queries: got %+v", s.Queries)
+	}
+	if s.Extra["newStat"] != "x" || len(s.Extra) != 1 {
+		t.Errorf("extra: got %v", s.Extra)
+	}
+
+	b, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got map[string]any
+	json.Unmarshal([]byte(in), &want)
+	json.Unmarshal(b, &got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip: got %s", b)
+	}
+}
@@ -0,0 +1,118 @@
+package opentsdb
+
+// TagRemap renames tag keys and maps tag values, for organizations
+// migrating between naming schemes. It is used as a pipeline stage with
+// RemapTags and on the put path with PutPolicy.Remap.
+type TagRemap struct {
+	// Keys maps old tag keys to new ones, applied to all tags at once so
+	// that keys may be swapped. A renamed tag replaces a tag already
+	// having the new key; of several tags renamed to the same key, the
+	// one whose old key sorts first is kept.
+	Keys map[string]string
+	// Values maps, for a tag key after renaming, old values to new ones,
+	// e.g. {"dc": {"dc1": "us-east-1"}}.
+	Values map[string]map[string]string
+}
+
+// Tags returns tags remapped by m. tags is returned as is if nothing
+// changes and is never modified.
+func (m *TagRemap) Tags(tags TagSet) TagSet {
+	out, _ := m.remap(tags)
+	return out
+}
+
+// remap returns tags remapped by m, and whether they changed. The result is
+// built from the original tags, so renames may swap keys. Each value is
+// mapped under the key it ends up with. When several tags end up with the
+// same key, a renamed tag wins over one that kept its key, and among
+// renamed tags the one whose original key sorts first wins.
+func (m *TagRemap) remap(tags TagSet) (TagSet, bool) {
+	changed := false
+	for k, v := range tags {
+		nk, renamed := m.Keys[k]
+		if !renamed {
+			nk = k
+		}
+		if _, mapped := m.Values[nk][v]; renamed || mapped {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return tags, false
+	}
+	out := make(TagSet, len(tags))
+	value := func(k, v string) string {
+		if nv, ok := m.Values[k][v]; ok {
+			return nv
+		}
+		return v
+	}
+	keys := tags.Keys()
+	for _, k := range keys {
+		if _, renamed := m.Keys[k]; !renamed {
+			out[k] = value(k, tags[k])
+		}
+	}
+	fromRename := map[string]bool{}
+	for _, k := range keys {
+		nk, renamed := m.Keys[k]
+		if !renamed || fromRename[nk] {
+			continue
+		}
+		fromRename[nk] = true
+		out[nk] = value(nk, tags[k])
+	}
+	return out, true
+}
+
+// DataPoints returns dps with the tags of every point remapped. Points
+// that need changing are copied; dps is left untouched.
+func (m *TagRemap) DataPoints(dps MultiDataPoint) MultiDataPoint {
+	out := make(MultiDataPoint, len(dps))
+	for i, d := range dps {
+		out[i] = m.dataPoint(d)
+	}
+	return out
+}
+
+func (m *TagRemap) dataPoint(d *DataPoint) *DataPoint {
+	tags, changed := m.remap(d.Tags)
+	if !changed {
+		return d
+	}
+	c := *d
+	c.Tags = tags
+	return &c
+}
+
+// response remaps the tags and aggregated tag keys of resp.
+func (m *TagRemap) response(resp *Response) {
+	tags, changed := m.remap(resp.Tags)
+	if changed {
+		resp.Tags = tags
+	}
+	copied := false
+	for i, k := range resp.AggregateTags {
+		if nk, ok := m.Keys[k]; ok {
+			if !copied {
+				resp.AggregateTags = append([]string(nil), resp.AggregateTags...)
+				copied = true
+			}
+			resp.AggregateTags[i] = nk
+		}
+	}
+	if changed || copied {
+		resp.rekey()
+	}
+}
+
+// RemapTags remaps the tags of responses with m.
+func RemapTags(m *TagRemap) ResponseTransform {
+	return func(_ *Request, rs ResponseSet) (ResponseSet, error) {
+		for _, resp := range rs {
+			m.response(resp)
+		}
+		return rs, nil
+	}
+}
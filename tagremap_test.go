@@ -0,0 +1,67 @@
+package opentsdb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagRemap(t *testing.T) {
+	m := &TagRemap{
+		Keys:   map[string]string{"fqdn": "host"},
+		Values: map[string]map[string]string{"dc": {"dc1": "us-east-1"}, "host": {"a.example": "a"}},
+	}
+	for _, tc := range []struct {
+		in, want TagSet
+	}{
+		{TagSet{"fqdn": "a.example", "dc": "dc1"}, TagSet{"host": "a", "dc": "us-east-1"}},
+		{TagSet{"fqdn": "b.example", "dc": "dc2"}, TagSet{"host": "b.example", "dc": "dc2"}},
+		{TagSet{"host": "a.example"}, TagSet{"host": "a"}},
+		{TagSet{"other": "x"}, TagSet{"other": "x"}},
+	} {
+		in := tc.in.Copy()
+		if got := m.Tags(in); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v: got %v, want %v", tc.in, got, tc.want)
+		}
+		if !reflect.DeepEqual(in, tc.in) {
+			t.Errorf("%v: input modified to %v", tc.in, in)
+		}
+	}
+
+	for _, tc := range []struct {
+		m        *TagRemap
+		in, want TagSet
+	}{
+		{&TagRemap{Keys: map[string]string{"a": "b", "b": "a"}}, TagSet{"a": "1", "b": "2"}, TagSet{"a": "2", "b": "1"}},
+		{&TagRemap{Keys: map[string]string{"a": "b"}, Values: map[string]map[string]string{"b": {"2": "x"}}}, TagSet{"a": "1", "b": "2"}, TagSet{"b": "1"}},
+		{&TagRemap{Keys: map[string]string{"a": "c", "b": "c"}}, TagSet{"a": "1", "b": "2", "c": "3"}, TagSet{"c": "1"}},
+	} {
+		for i := 0; i < 50; i++ {
+			if got := tc.m.Tags(tc.in); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("%v with %v: got %v, want %v", tc.in, tc.m.Keys, got, tc.want)
+			}
+		}
+	}
+	swapped, _ := RenameTags(map[string]string{"a": "b", "b": "a"})(nil, ResponseSet{{Metric: "m", Tags: TagSet{"a": "1", "b": "2"}}})
+	if !reflect.DeepEqual(swapped[0].Tags, TagSet{"a": "2", "b": "1"}) {
+		t.Errorf("RenameTags swap: got %v", swapped[0].Tags)
+	}
+
+	rs := ResponseSet{{Metric: "m", Tags: TagSet{"dc": "dc1"}, AggregateTags: []string{"fqdn"}}}
+	rs, _ = RemapTags(m)(nil, rs)
+	if rs[0].Tags["dc"] != "us-east-1" || rs[0].AggregateTags[0] != "host" {
+		t.Errorf("response not remapped: %+v", rs[0])
+	}
+
+	p := &PutPolicy{Remap: m}
+	dps := MultiDataPoint{
+		{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"fqdn": "a.example"}},
+		{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"host": "b"}},
+	}
+	out := p.Apply(dps)
+	if out[0].Tags["host"] != "a" || dps[0].Tags["fqdn"] != "a.example" {
+		t.Errorf("put remap: got %v from %v", out[0].Tags, dps[0].Tags)
+	}
+	if out[1] != dps[1] {
+		t.Error("unchanged point was copied")
+	}
+}
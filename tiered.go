@@ -0,0 +1,94 @@
+package opentsdb
+
+import (
+	"strconv"
+	"time"
+)
+
+// TieredContext splits requests between a hot cluster holding recent data
+// and a cold one, such as a rollup cluster, holding older data. The part
+// of a request before Boundary ago goes to Cold and the rest to Hot; series
+// answered by both are stitched together, preferring the points of Hot
+// where the two overlap.
+type TieredContext struct {
+	Hot, Cold Context
+	Boundary  Duration
+	// ColdDownsample, if positive, coarsens the downsampling of queries
+	// sent to Cold to at least this interval, using ColdAggregator for
+	// queries without one, as CapDownsample does.
+	ColdDownsample Duration
+	ColdAggregator string
+
+	now func() time.Time
+}
+
+// Version returns the oldest version of Hot and Cold.
+func (c *TieredContext) Version() Version {
+	v := c.Hot.Version()
+	if cv := c.Cold.Version(); !cv.AtLeast(v) {
+		return cv
+	}
+	return v
+}
+
+// Query sends r to Hot, Cold or both depending on its time range.
+func (c *TieredContext) Query(r *Request) (ResponseSet, error) {
+	now := time.Now().UTC()
+	if c.now != nil {
+		now = c.now()
+	}
+	start, end, err := r.timeRange(now)
+	if err != nil {
+		return nil, err
+	}
+	cold := c.Cold
+	if c.ColdDownsample > 0 {
+		cold = CapDownsample(c.ColdDownsample, c.ColdAggregator)(cold)
+	}
+	cut := now.Add(-time.Duration(c.Boundary))
+	switch {
+	case !start.Before(cut):
+		return c.Hot.Query(r)
+	case !end.After(cut):
+		return cold.Query(r)
+	}
+
+	// Both parts are queried with ShowQuery so that series are stitched
+	// with those of the same query.
+	split := func(from, to time.Time) *Request {
+		req := r.Clone()
+		req.Start = TimeSpec(strconv.FormatInt(from.Unix(), 10))
+		req.End = TimeSpec(strconv.FormatInt(to.Unix(), 10))
+		req.ShowQuery = true
+		return req
+	}
+	type result struct {
+		rs  ResponseSet
+		err error
+	}
+	coldDone := make(chan result, 1)
+	go func() {
+		rs, err := cold.Query(split(start, cut))
+		coldDone <- result{rs, err}
+	}()
+	hot, err := c.Hot.Query(split(cut, end))
+	old := <-coldDone
+	if err != nil {
+		return nil, err
+	}
+	if old.err != nil {
+		return nil, old.err
+	}
+
+	rs, err := mergeResponseSets([]ResponseSet{hot, old.rs}, true, MergePreferFirst)
+	if err != nil {
+		return nil, err
+	}
+	rs.SortByQueryIndex()
+	if !r.ShowQuery {
+		for _, resp := range rs {
+			resp.Query = Query{}
+		}
+	}
+	return rs, nil
+}
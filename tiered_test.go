@@ -0,0 +1,50 @@
+package opentsdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTieredContext(t *testing.T) {
+	now := time.Unix(100000, 0).UTC()
+	hot, cold := NewMemContext(), NewMemContext()
+	hot.AddSeries("m", TagSet{"host": "a"}, DPmap{96400: 10, 99000: 11})
+	hot.AddSeries("m", TagSet{"host": "b"}, DPmap{99000: 12})
+	cold.AddSeries("m", TagSet{"host": "a"}, DPmap{90000: 1, 93600: 2, 96400: 3})
+	c := &TieredContext{Hot: hot, Cold: cold, Boundary: Hour, now: func() time.Time { return now }}
+
+	tests := []struct {
+		q    string
+		want map[string]DPmap
+	}{
+		{"start=99000&m=sum:m{host=*}", map[string]DPmap{"a": {99000: 11}, "b": {99000: 12}}},
+		{"start=80000&end=95000&m=sum:m{host=*}", map[string]DPmap{"a": {90000: 1, 93600: 2}}},
+		{"start=80000&m=sum:m{host=*}", map[string]DPmap{"a": {90000: 1, 93600: 2, 96400: 10, 99000: 11}, "b": {99000: 12}}},
+	}
+	for _, test := range tests {
+		r, err := ParseRequest(test.q, Version2_2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs, err := c.Query(r)
+		if err != nil {
+			t.Fatalf("%s: %v", test.q, err)
+		}
+		if len(rs) != len(test.want) {
+			t.Fatalf("%s: got %d series", test.q, len(rs))
+		}
+		for _, resp := range rs {
+			if !reflect.DeepEqual(resp.DPS, test.want[resp.Tags["host"]]) || resp.Query.Metric != "" {
+				t.Errorf("%s: host %s got %v", test.q, resp.Tags["host"], resp.DPS)
+			}
+		}
+	}
+
+	c.ColdDownsample, c.ColdAggregator = 4*Hour, "max"
+	r, _ := ParseRequest("start=80000&end=95000&m=sum:m{host=*}", Version2_2)
+	rs, _ := c.Query(r)
+	if len(rs) != 1 || !reflect.DeepEqual(rs[0].DPS, DPmap{86400: 2}) {
+		t.Errorf("cold downsample: got %v", rs)
+	}
+}
@@ -0,0 +1,71 @@
+package opentsdb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// tlsConfig returns the TLS configuration of the client's transport,
+// creating it when needed.
+func (c *Client) tlsConfig() *tls.Config {
+	if c.transport.TLSClientConfig == nil {
+		c.transport.TLSClientConfig = &tls.Config{}
+	}
+	return c.transport.TLSClientConfig
+}
+
+// WithTLSConfig replaces the TLS configuration of the client's transport.
+// cfg is cloned, later TLS options apply on top of it.
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(c *Client) error {
+		c.transport.TLSClientConfig = cfg.Clone()
+		return nil
+	}
+}
+
+// WithCACertFile adds the PEM encoded certificates in file to the pool used
+// to verify the server. The system pool is used as a base when available.
+func WithCACertFile(file string) ClientOption {
+	return func(c *Client) error {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("opentsdb: reading CA file: %w", err)
+		}
+		cfg := c.tlsConfig()
+		if cfg.RootCAs == nil {
+			if cfg.RootCAs, err = x509.SystemCertPool(); err != nil {
+				cfg.RootCAs = x509.NewCertPool()
+			}
+		}
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("opentsdb: no certificates found in %s", file)
+		}
+		return nil
+	}
+}
+
+// WithClientCert makes the client present the given certificate and key for
+// mutual TLS.
+func WithClientCert(certFile, keyFile string) ClientOption {
+	return func(c *Client) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("opentsdb: loading client certificate: %w", err)
+		}
+		cfg := c.tlsConfig()
+		cfg.Certificates = append(cfg.Certificates, cert)
+		return nil
+	}
+}
+
+// WithInsecureSkipVerify disables verification of the server certificate.
+// Verification is on by default; only use this for testing or with servers
+// whose certificates can't be fixed.
+func WithInsecureSkipVerify() ClientOption {
+	return func(c *Client) error {
+		c.tlsConfig().InsecureSkipVerify = true
+		return nil
+	}
+}
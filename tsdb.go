@@ -3,11 +3,10 @@ package opentsdb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"math"
 	"math/big"
 	"net/http"
@@ -42,13 +41,18 @@ type DPmap map[Epoch]Point
 // Response is a query response:
 // http://opentsdb.net/docs/build/html/api_http/query/index.html#response.
 type Response struct {
-	Metric        string            `json:"metric" yaml:"metric"`
-	Tags          TagSet            `json:"tags" yaml:"tags"`
-	AggregateTags []string          `json:"aggregateTags" yaml:"aggregateTags"`
-	Query         Query             `json:"query,omitempty" yaml:"query,omitempty"`
-	DPS           DPmap             `json:"dps" yaml:"dps"`
-	Stats         *QueryStats       `json:"stats,omitempty" yaml:"stats,omitempty"`
-	StatsSummary  QueryStatsSummary `json:"statsSummary,omitempty" yaml:"statsSummary,omitempty"`
+	Metric        string             `json:"metric" yaml:"metric"`
+	Tags          TagSet             `json:"tags" yaml:"tags"`
+	AggregateTags []string           `json:"aggregateTags" yaml:"aggregateTags"`
+	Query         Query              `json:"query,omitempty" yaml:"query,omitempty"`
+	DPS           DPmap              `json:"dps" yaml:"dps"`
+	Stats         *QueryStats        `json:"stats,omitempty" yaml:"stats,omitempty"`
+	StatsSummary  *QueryStatsSummary `json:"statsSummary,omitempty" yaml:"statsSummary,omitempty"`
+	// Unit is the unit of the points, set by AnnotateUnits and
+	// ConvertUnits for renderers. OpenTSDB doesn't return it.
+	Unit string `json:"unit,omitempty" yaml:"unit,omitempty"`
+
+	key string // cached stableKey
 	//missing "annotations": [...]
 	//missing "annotations": [...]
 	//missing "tsuids": [...]
@@ -57,9 +61,6 @@ type Response struct {
 	// SQL string `json:"sql,omitempty"`
 }
 
-// StatsSummary is that lastelemt of the json array response when it exists
-type QueryStatsSummary map[string]any
-
 // QueryStats are optional stats returned with the response
 type QueryStats struct {
 	Index                int     `json:"queryIndex" yaml:"queryIndex"`
@@ -72,15 +73,26 @@ type QueryStats struct {
 	UidToStringTime      float64 `json:"uidToStringTime" yaml:"uidToStringTime"`
 }
 
+// Copy returns a deep copy of r.
 func (r *Response) Copy() *Response {
 	newR := Response{}
 	newR.Metric = r.Metric
 	newR.Tags = r.Tags.Copy()
-	copy(newR.AggregateTags, r.AggregateTags)
+	if r.AggregateTags != nil {
+		newR.AggregateTags = append(make([]string, 0, len(r.AggregateTags)), r.AggregateTags...)
+	}
+	newR.Query = *r.Query.Clone()
 	newR.DPS = DPmap{}
 	for k, v := range r.DPS {
 		newR.DPS[k] = v
 	}
+	if r.Stats != nil {
+		stats := *r.Stats
+		newR.Stats = &stats
+	}
+	newR.StatsSummary = r.StatsSummary.Copy()
+	newR.Unit = r.Unit
+	newR.key = r.key
 	return &newR
 }
 
@@ -202,11 +214,7 @@ func (t TagSet) String() string {
 
 // Tags is identical to String() but without { and }.
 func (t TagSet) Tags() string {
-	var keys []string
-	for k := range t {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
+	keys := t.Keys()
 	b := &bytes.Buffer{}
 	for i, k := range keys {
 		if i > 0 {
@@ -217,13 +225,52 @@ func (t TagSet) Tags() string {
 	return b.String()
 }
 
-func (t TagSet) AllSubsets() []string {
-	var keys []string
+// Keys returns the sorted tag keys of t.
+func (t TagSet) Keys() []string {
+	keys := make([]string, 0, len(t))
 	for k := range t {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
-	return t.allSubsets("", 0, keys)
+	return keys
+}
+
+// Values returns the tag values of t in the order of Keys.
+func (t TagSet) Values() []string {
+	keys := t.Keys()
+	for i, k := range keys {
+		keys[i] = t[k]
+	}
+	return keys
+}
+
+// SortedIter calls f with the tags of t in key order until f returns false.
+func (t TagSet) SortedIter(f func(k, v string) bool) {
+	for _, k := range t.Keys() {
+		if !f(k, t[k]) {
+			return
+		}
+	}
+}
+
+// DefaultMaxTags is the default limit of tags per series of OpenTSDB, its
+// tsd.storage.max_tags setting.
+const DefaultMaxTags = 8
+
+// CheckNumTags returns an error wrapping ErrTooManyTags if t has more than
+// max tags, or DefaultMaxTags if max is not positive.
+func (t TagSet) CheckNumTags(max int) error {
+	if max <= 0 {
+		max = DefaultMaxTags
+	}
+	if len(t) > max {
+		return fmt.Errorf("%w: %d tags, limit is %d", ErrTooManyTags, len(t), max)
+	}
+	return nil
+}
+
+func (t TagSet) AllSubsets() []string {
+	return t.allSubsets("", 0, t.Keys())
 }
 
 func (t TagSet) allSubsets(base string, start int, keys []string) []string {
@@ -269,44 +316,11 @@ func (t TagSet) Valid() bool {
 }
 
 func (d *DataPoint) Clean() error {
-	if err := d.Tags.Clean(); err != nil {
-		return fmt.Errorf("cleaning tags for metric %s: %s", d.Metric, err)
-	}
-	m, err := Clean(d.Metric)
+	c, err := newCleaner()
 	if err != nil {
-		return fmt.Errorf("cleaning metric %s: %s", d.Metric, err)
-	}
-	if d.Metric != m {
-		d.Metric = m
-	}
-	switch v := d.Value.(type) {
-	case string:
-		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
-			d.Value = i
-		} else if f, err := strconv.ParseFloat(v, 64); err == nil {
-			d.Value = f
-		} else {
-			return fmt.Errorf("Unparseable number %v", v)
-		}
-	case uint64:
-		if v > math.MaxInt64 {
-			d.Value = float64(v)
-		}
-	case *big.Int:
-		if bigMaxInt64.Cmp(v) < 0 {
-			if f, err := strconv.ParseFloat(v.String(), 64); err == nil {
-				d.Value = f
-			}
-		}
-	}
-	// if timestamp bigger than 32 bits, likely in milliseconds
-	if d.Timestamp > 0xffffffff {
-		d.Timestamp /= 1000
-	}
-	if !d.Valid() {
-		return fmt.Errorf("datapoint is invalid")
+		return err
 	}
-	return nil
+	return c.dataPoint(d)
 }
 
 var bigMaxInt64 = big.NewInt(math.MaxInt64)
@@ -314,24 +328,11 @@ var bigMaxInt64 = big.NewInt(math.MaxInt64)
 // Clean removes characters from t that are invalid for OpenTSDB metric and tag
 // values. An error is returned if a resulting tag is empty.
 func (t TagSet) Clean() error {
-	for k, v := range t {
-		kc, err := Clean(k)
-		if err != nil {
-			return fmt.Errorf("cleaning tag %s: %s", k, err)
-		}
-		vc, err := Clean(v)
-		if err != nil {
-			return fmt.Errorf("cleaning value %s for tag %s: %s", v, k, err)
-		}
-		if kc == "" || vc == "" {
-			return fmt.Errorf("cleaning value [%s] for tag [%s] result in an empty string", v, k)
-		}
-		if kc != k || vc != v {
-			delete(t, k)
-			t[kc] = vc
-		}
+	c, err := newCleaner()
+	if err != nil {
+		return err
 	}
-	return nil
+	return c.tags(t)
 }
 
 // Clean is Replace with an empty replacement string.
@@ -387,6 +388,30 @@ type Request struct {
 	Delete            bool        `json:"delete,omitempty" yaml:"delete,omitempty"`
 	UseCalendar       bool        `json:"useCalendar,omitempty" yaml:"useCalendar,omitempty"`
 	Timezone          string      `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+
+	// Timeout overrides the client timeout for this request when non-zero.
+	Timeout time.Duration `json:"-" yaml:"-"`
+	// ExpandMetrics makes Client replace each query whose metric contains
+	// the * wildcard by one query per matching metric before sending it.
+	ExpandMetrics bool `json:"-" yaml:"-"`
+
+	ctx context.Context
+}
+
+// Context returns the context of r, which cancels the HTTP requests made
+// for it. It defaults to context.Background.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of r with its context changed to ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	n := *r
+	n.ctx = ctx
+	return &n
 }
 
 // RequestFromJSON creates a new request from JSON.
@@ -395,8 +420,12 @@ func RequestFromJSON(b []byte) (*Request, error) {
 	if err := json.Unmarshal(b, &r); err != nil {
 		return nil, err
 	}
-	r.Start = TryParseAbsTime(r.Start)
-	r.End = TryParseAbsTime(r.End)
+	loc, err := r.location()
+	if err != nil {
+		return nil, err
+	}
+	r.Start = tryParseAbsTimeIn(r.Start, loc)
+	r.End = tryParseAbsTimeIn(r.End, loc)
 	return &r, nil
 }
 
@@ -414,11 +443,13 @@ type Query struct {
 	TSUIDs       []string     `json:"tsuids" yaml:"tsuids"`
 	GroupByTags  TagSet       `json:"-" yaml:"-"`
 	Index        int          `json:"index" yaml:"index"`
+	// Percentiles and ShowHistogramBuckets apply to histogram metrics of
+	// OpenTSDB 2.4, see GroupHistograms.
+	Percentiles          []float64 `json:"percentiles,omitempty" yaml:"percentiles,omitempty"`
+	ShowHistogramBuckets bool      `json:"showHistogramBuckets,omitempty" yaml:"showHistogramBuckets,omitempty"`
 	//HistogramQuery       bool         `json:"histogramQuery" yaml:"histogramQuery"`
 	//PreAggregate         bool         `json:"preAggregate" yaml:"preAggregate"`
-	//ShowHistogramBuckets bool         `json:"showHistogramBuckets" yaml:"showHistogramBuckets"`
 	//"rollupUsage"
-	//percentiles
 	//rollupUsage
 	G_alias                string `json:"alias" yaml:"alias"`
 	G_currentTagKey        string `json:"currentTagKey" yaml:"currentTagKey"`
@@ -442,7 +473,7 @@ type Filter struct {
 }
 
 func (f Filter) String() string {
-	return fmt.Sprintf("%s=%s(%s)", f.TagK, f.Type, f.Filter)
+	return fmt.Sprintf("%s=%s(%s)", quoteName(f.TagK), f.Type, quoteArg(f.Filter))
 }
 
 type Filters []Filter
@@ -504,6 +535,7 @@ func ParseRequest(req string, version Version) (*Request, error) {
 	if e := v.Get("end"); e != "" {
 		r.End = TimeSpec(e)
 	}
+	r.Timezone = v.Get("tz")
 	for _, m := range v["m"] {
 		q, err := ParseQuery(m, version)
 		if err != nil {
@@ -517,112 +549,86 @@ func ParseRequest(req string, version Version) (*Request, error) {
 	return &r, nil
 }
 
-var qRE2_1 = regexp.MustCompile(`^(?P<aggregator>\w+):(?:(?P<downsample>\w+-\w+):)?(?:(?P<rate>rate.*):)?(?P<metric>[\w./-]+)(?:\{([\w./,=*-|]+)\})?$`)
-var qRE2_2a = regexp.MustCompile(
-	`` +
-		`^(?P<aggregator>\w+):` + // aggregation
-		`(?:(?P<downsample>\w+-\w+(?:-(?:\w+))?):)?` + // downsampling agg
-		`(?:(?P<rate>rate(?:[{].*[}])?):)?` + // rate options
-		`(?P<metric>[\w./-]+)` + //metric name
-		`(?:\{([^}]+)?\})?` + // groupping tags
-		`(?:\{([^}]+)?\})?$` + // non groupping tags
-		``)
-
-var qRE2_2b = regexp.MustCompile(
-	`` +
-		`^(?P<aggregator>\w+):` + // aggregation
-		`(?:(?P<rate>rate(?:[{].*[}])?):)?` + // rate options
-		`(?:(?P<downsample>\w+-\w+(?:-(?:\w+))?):)?` + // downsampling agg
-		`(?P<metric>[\w./-]+)` + //metric name
-		`(?:\{([^}]+)?\})?` + // groupping tags
-		`(?:\{([^}]+)?\})?$` + // non groupping tags
-		``)
+var (
+	aggregatorRE   = regexp.MustCompile(`^\w+$`)
+	downsampleRE   = regexp.MustCompile(`^\w+-\w+$`)
+	downsampleRE22 = regexp.MustCompile(`^\w+-\w+(?:-\w+)?$`)
+)
 
 // ParseQuery parses OpenTSDB queries of the form: avg:rate:cpu{k=v}. Validation
 // errors will be returned along with a valid Query.
+//
+// Metrics, tag keys and filter values may be quoted with " or ' to include
+// characters that are otherwise part of the syntax.
 func ParseQuery(query string, version Version) (q *Query, err error) {
-	var regExp = qRE2_1
 	q = new(Query)
-	if version.FilterSupport() {
-		regExp = qRE2_2a
-	}
-
-	m := regExp.FindStringSubmatch(query)
-	if len(m) < 1 && version.FilterSupport() {
-		regExp = qRE2_2b
-		m = regExp.FindStringSubmatch(query)
-	}
-
-	if m == nil || len(m) < 1 {
+	parts, err := splitTopLevel(query, ':')
+	if err != nil || len(parts) < 2 || !aggregatorRE.MatchString(parts[0]) {
 		return nil, fmt.Errorf("opentsdb: bad query format: %s", query)
 	}
+	q.Aggregator = parts[0]
 
-	result := make(map[string]string)
-	for i, name := range regExp.SubexpNames() {
-		if i != 0 && i < len(m) {
-			result[name] = m[i]
-		}
-	}
-
-	q.Aggregator = result["aggregator"]
-	q.Downsample = result["downsample"]
-	q.Rate = strings.HasPrefix(result["rate"], "rate")
-	if q.Rate && len(result["rate"]) > 4 {
-		if q.RateOptions == nil {
-			q.RateOptions = &RateOptions{}
-		}
-		s := result["rate"][4:]
-		if !strings.HasSuffix(s, "}") || !strings.HasPrefix(s, "{") {
-			err = fmt.Errorf("opentsdb: invalid rate options")
-			return
-		}
-		sp := strings.Split(s[1:len(s)-1], ",")
-		q.RateOptions.Counter = sp[0] == "counter" || sp[0] == "dropcounter"
-		q.RateOptions.DropResets = sp[0] == "dropcounter"
-		if len(sp) > 1 {
-			if sp[1] != "" {
-				if q.RateOptions.CounterMax, err = strconv.ParseInt(sp[1], 10, 64); err != nil {
+	dsRE := downsampleRE
+	if version.FilterSupport() {
+		dsRE = downsampleRE22
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		switch {
+		case !q.Rate && strings.HasPrefix(part, "rate"):
+			q.Rate = true
+			if len(part) > 4 {
+				if err = parseRateOptions(part[4:], q); err != nil {
 					return
 				}
 			}
-		}
-		if len(sp) > 2 {
-			if q.RateOptions.ResetValue, err = strconv.ParseInt(sp[2], 10, 64); err != nil {
-				return
-			}
+		case !q.ExplicitTags && version.FilterSupport() && part == "explicit_tags":
+			q.ExplicitTags = true
+		case q.Downsample == "" && !q.Rate && dsRE.MatchString(part):
+			q.Downsample = part
+		case q.Downsample == "" && version.FilterSupport() && dsRE.MatchString(part):
+			// OpenTSDB 2.2 also accepts the downsampler after the rate
+			q.Downsample = part
+		default:
+			return nil, fmt.Errorf("opentsdb: bad query format: %s", query)
 		}
 	}
-	q.Metric = result["metric"]
 
-	if !version.FilterSupport() && len(m) > 5 && m[5] != "" {
-		tags, e := ParseTags(m[5])
-		if e != nil {
-			err = e
-			if tags == nil {
-				return
-			}
-		}
-		q.Tags = tags
+	metric, groups, err := splitMetric(parts[len(parts)-1])
+	if err != nil {
+		return nil, fmt.Errorf("opentsdb: bad query format: %s", query)
 	}
+	q.Metric = metric
 
 	if !version.FilterSupport() {
+		if len(groups) > 1 || len(groups) == 1 && groups[0] == "" {
+			return nil, fmt.Errorf("opentsdb: bad query format: %s", query)
+		}
+		if len(groups) == 1 {
+			tags, e := ParseTags(groups[0])
+			if e != nil {
+				err = e
+				if tags == nil {
+					return
+				}
+			}
+			q.Tags = tags
+		}
 		return
 	}
+	if len(groups) > 2 {
+		return nil, fmt.Errorf("opentsdb: bad query format: %s", query)
+	}
 
 	// OpenTSDB Greater than 2.2, treating as filters
 	q.GroupByTags = make(TagSet)
 	q.Filters = make([]Filter, 0)
-	if m[5] != "" {
-		f, err := ParseFilters(m[5], true, q)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to parse filter(s): %s", m[5])
+	for i, g := range groups {
+		if g == "" {
+			continue
 		}
-		q.Filters = append(q.Filters, f...)
-	}
-	if m[6] != "" {
-		f, err := ParseFilters(m[6], false, q)
+		f, err := ParseFilters(g, i == 0, q)
 		if err != nil {
-			return nil, fmt.Errorf("Failed to parse filter(s): %s", m[6])
+			return nil, fmt.Errorf("Failed to parse filter(s): %s", g)
 		}
 		q.Filters = append(q.Filters, f...)
 	}
@@ -630,39 +636,67 @@ func ParseQuery(query string, version Version) (q *Query, err error) {
 	return
 }
 
-var filterValueRe = regexp.MustCompile(`([a-z_]+)\((.*)\)$`)
+// parseRateOptions parses the {counter,max,reset} suffix of rate.
+func parseRateOptions(s string, q *Query) (err error) {
+	if q.RateOptions == nil {
+		q.RateOptions = &RateOptions{}
+	}
+	if !strings.HasSuffix(s, "}") || !strings.HasPrefix(s, "{") {
+		return fmt.Errorf("opentsdb: invalid rate options")
+	}
+	sp := strings.Split(s[1:len(s)-1], ",")
+	q.RateOptions.Counter = sp[0] == "counter" || sp[0] == "dropcounter"
+	q.RateOptions.DropResets = sp[0] == "dropcounter"
+	if len(sp) > 1 {
+		if sp[1] != "" {
+			if q.RateOptions.CounterMax, err = strconv.ParseInt(sp[1], 10, 64); err != nil {
+				return
+			}
+		}
+	}
+	if len(sp) > 2 {
+		if q.RateOptions.ResetValue, err = strconv.ParseInt(sp[2], 10, 64); err != nil {
+			return
+		}
+	}
+	return nil
+}
 
 // ParseFilters parses filters in the form of `tagk=filterFunc(...),...`
 // It also mimics OpenTSDB's promotion of queries with a * or no
 // function to iwildcard and literal_or respectively
 func ParseFilters(rawFilters string, grouping bool, q *Query) ([]Filter, error) {
 	var filters []Filter
-	for _, rawFilter := range strings.Split(rawFilters, ",") {
-		splitRawFilter := strings.SplitN(rawFilter, "=", 2)
-		if len(splitRawFilter) != 2 {
+	rawList, err := splitTopLevel(rawFilters, ',')
+	if err != nil {
+		return nil, fmt.Errorf("opentsdb: bad filter format: %s", rawFilters)
+	}
+	for _, rawFilter := range rawList {
+		i, err := indexTopLevel(rawFilter, '=')
+		if err != nil || i < 0 {
 			return nil, fmt.Errorf("opentsdb: bad filter format: %s", rawFilter)
 		}
 		filter := Filter{}
-		filter.TagK = splitRawFilter[0]
-		if grouping {
+		filter.TagK = unquote(strings.TrimSpace(rawFilter[:i]))
+		if filter.TagK == "" {
+			return nil, fmt.Errorf("opentsdb: bad filter format: %s", rawFilter)
+		}
+		value := strings.TrimSpace(rawFilter[i+1:])
+		if grouping && q != nil {
+			if q.GroupByTags == nil {
+				q.GroupByTags = make(TagSet)
+			}
 			q.GroupByTags[filter.TagK] = ""
 		}
 		// See if we have a filter function, if not we have to use legacy parsing defined in
 		// filter conversions of http://opentsdb.net/docs/build/html/api_http/query/index.html
-		m := filterValueRe.FindStringSubmatch(splitRawFilter[1])
-		if m != nil {
-			filter.Type = m[1]
-			filter.Filter = m[2]
+		if fn, args, ok := splitFunc(value); ok {
+			filter.Type = fn
+			filter.Filter = args
 		} else {
 			// Legacy Conversion
-			filter.Type = "literal_or"
-			if strings.Contains(splitRawFilter[1], "*") {
-				filter.Type = "iwildcard"
-			}
-			if splitRawFilter[1] == "*" {
-				filter.Type = "wildcard"
-			}
-			filter.Filter = splitRawFilter[1]
+			lf := legacyFilter(filter.TagK, unquote(value))
+			filter.Type, filter.Filter = lf.Type, lf.Filter
 		}
 		filter.GroupBy = grouping
 		filters = append(filters, filter)
@@ -770,12 +804,17 @@ func (q Query) String() string {
 		}
 		s += ":"
 	}
-	s += q.Metric
-	if len(q.Tags) > 0 {
-		s += q.Tags.String()
+	if q.ExplicitTags {
+		s += "explicit_tags:"
 	}
-	if len(q.Filters) > 0 {
-		s += q.Filters.String()
+	s += quoteName(q.Metric)
+	switch {
+	case len(q.Filters) > 0:
+		// tags can't be expressed next to filters, send them as the
+		// equivalent group by filters
+		s += q.tagFilters().String()
+	case len(q.Tags) > 0:
+		s += q.Tags.String()
 	}
 	return s
 }
@@ -788,12 +827,15 @@ func (r *Request) String() string {
 func (r *Request) Encode() string {
 	v := make(url.Values)
 
-	if start, err := CanonicalTime(r.Start); err == nil {
+	if start, err := r.canonicalTime(r.Start); err == nil {
 		v.Add("start", start)
 	}
-	if end, err := CanonicalTime(r.End); err == nil {
+	if end, err := r.canonicalTime(r.End); err == nil {
 		v.Add("end", end)
 	}
+	if r.Timezone != "" {
+		v.Add("tz", r.Timezone)
+	}
 
 	for _, q := range r.Queries {
 		v.Add("m", q.String())
@@ -801,6 +843,30 @@ func (r *Request) Encode() string {
 	return v.Encode()
 }
 
+// getQuery returns the query string of a GET /api/query request for r: the
+// parameters of Encode with the flags of r.
+func (r *Request) getQuery() string {
+	s := r.Encode()
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{r.MsResolution, "ms"},
+		{r.ShowTSUIDs, "show_tsuids"},
+		{r.NoAnnotations, "no_annotations"},
+		{r.GlobalAnnotations, "global_annotations"},
+		{r.ShowSummary, "show_summary"},
+		{r.ShowStats, "show_stats"},
+		{r.ShowQuery, "show_query"},
+		{r.UseCalendar, "use_calendar"},
+	} {
+		if f.set {
+			s += "&" + f.name
+		}
+	}
+	return s
+}
+
 // Search returns a string suitable for OpenTSDB's `/` route.
 func (r *Request) Search() string {
 	// OpenTSDB uses the URL hash, not search parameters, to do this. The values are
@@ -843,18 +909,38 @@ func CanonicalTime(v interface{}) (string, error) {
 	return t.Format(TSDBTimeFormat), nil
 }
 
+// canonicalTime is CanonicalTime in the request's time zone.
+func (r *Request) canonicalTime(v interface{}) (string, error) {
+	loc, err := r.location()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := relativeSpec(v); ok {
+		return fmt.Sprint(v), nil
+	}
+	t, err := parseTimeIn(v, time.Now().UTC(), loc)
+	if err != nil {
+		return "", err
+	}
+	return t.In(loc).Format(TSDBTimeFormat), nil
+}
+
 // TryParseAbsTime attempts to parse v as an absolute time. It may be a string
 // in the format of TSDBTimeFormat or a float64 of seconds since epoch. If so,
 // the epoch as an int64 is returned. Otherwise, v is returned.
 func TryParseAbsTime(v interface{}) interface{} {
+	return tryParseAbsTimeIn(v, time.UTC)
+}
+
+func tryParseAbsTimeIn(v interface{}, loc *time.Location) interface{} {
 	switch v := v.(type) {
 	case TimeSpec:
-		d, err := ParseAbsTime(v.String())
+		d, err := ParseAbsTimeIn(v.String(), loc)
 		if err == nil {
 			return d.Unix()
 		}
 	case string:
-		d, err := ParseAbsTime(v)
+		d, err := ParseAbsTimeIn(v, loc)
 		if err == nil {
 			return d.Unix()
 		}
@@ -873,8 +959,14 @@ func TryParseAbsTime(v interface{}) interface{} {
 }
 
 // ParseAbsTime returns the time of s, which must be of any non-relative (not
-// "X-ago") format supported by OpenTSDB.
+// "X-ago") format supported by OpenTSDB. Wall clock formats are read as UTC.
 func ParseAbsTime(s string) (time.Time, error) {
+	return ParseAbsTimeIn(s, time.UTC)
+}
+
+// ParseAbsTimeIn is like ParseAbsTime but reads wall clock formats in loc,
+// the way OpenTSDB reads them in its configured time zone.
+func ParseAbsTimeIn(s string, loc *time.Location) (time.Time, error) {
 	var t time.Time
 	tFormats := [7]string{
 		"2006/01/02-15:04:05",
@@ -887,7 +979,7 @@ func ParseAbsTime(s string) (time.Time, error) {
 	}
 	for _, f := range tFormats {
 		if len(f) == len(s) {
-			if t, err := time.Parse(f, s); err == nil {
+			if t, err := time.ParseInLocation(f, s, loc); err == nil {
 				return t, nil
 			}
 		}
@@ -905,7 +997,16 @@ func ParseAbsTime(s string) (time.Time, error) {
 // ParseTime returns the time of v, which can be of any format supported by
 // OpenTSDB.
 func ParseTime(v interface{}) (time.Time, error) {
-	now := time.Now().UTC()
+	return ParseTimeAt(v, time.Now().UTC())
+}
+
+// ParseTimeAt is like ParseTime but resolves relative times against now.
+func ParseTimeAt(v interface{}, now time.Time) (time.Time, error) {
+	return parseTimeIn(v, now, time.UTC)
+}
+
+// parseTimeIn is ParseTimeAt reading wall clock formats in loc.
+func parseTimeIn(v interface{}, now time.Time, loc *time.Location) (time.Time, error) {
 	const max32 int64 = 9999999999 //0xffffffff
 	switch i := v.(type) {
 	case TimeSpec:
@@ -921,7 +1022,7 @@ func ParseTime(v interface{}) (time.Time, error) {
 			if strings.ToLower(i.String()) == "now" {
 				return now, nil
 			}
-			return ParseAbsTime(i.String())
+			return ParseAbsTimeIn(i.String(), loc)
 		}
 		return now, nil
 	case string:
@@ -937,7 +1038,7 @@ func ParseTime(v interface{}) (time.Time, error) {
 			if strings.ToLower(i) == "now" {
 				return now, nil
 			}
-			return ParseAbsTime(i)
+			return ParseAbsTimeIn(i, loc)
 		}
 		return now, nil
 	case int64:
@@ -951,6 +1052,8 @@ func ParseTime(v interface{}) (time.Time, error) {
 			i2 /= 1000
 		}
 		return time.Unix(i2, 0).UTC(), nil
+	case time.Time:
+		return i.UTC(), nil
 	default:
 		return time.Time{}, fmt.Errorf("type must be string or int64, got: %v", v)
 	}
@@ -974,30 +1077,25 @@ func (r *Request) GetEnd() (TimeSpec, error) {
 	return TimeSpec(strconv.FormatInt(end.Unix(), 10)), nil
 }
 
-// GetDuration returns the duration from the request's start to end.
+// GetDuration returns the duration from the request's start to end. With
+// UseCalendar set, relative times use calendar units in the request's time
+// zone, so 1n-ago spans the actual length of the previous month.
 func GetDuration(r *Request) (Duration, error) {
 	var t Duration
 	if r.Start == "" {
 		return t, ErrMissingStartTime
 	}
-	start, err := ParseTime(r.Start)
+	start, end, err := r.timeRange(time.Now().UTC())
 	if err != nil {
 		return t, err
 	}
-	var end time.Time
-	if r.End != nil && r.End != "" {
-		end, err = ParseTime(r.End)
-		if err != nil {
-			return t, err
-		}
-	} else {
-		end = time.Now()
-	}
 	t = Duration(end.Sub(start))
 	return t, nil
 }
 
 // AutoDownsample sets the avg downsample aggregator to produce l points.
+// With UseCalendar set the interval is rounded up to a whole number of the
+// largest calendar unit it spans, so buckets align with days or hours.
 func (r *Request) AutoDownsample(l int) error {
 	if l == 0 {
 		return ErrInvalidAutoDownsample
@@ -1010,6 +1108,9 @@ func (r *Request) AutoDownsample(l int) error {
 	ds := ""
 	if d > Duration(time.Second)*15 {
 		ds = fmt.Sprintf("%ds-avg", int64(d.Seconds()))
+		if r.UseCalendar {
+			ds = calendarInterval(d).HumanString() + "-avg"
+		}
 	}
 	for _, q := range r.Queries {
 		q.Downsample = ds
@@ -1017,22 +1118,45 @@ func (r *Request) AutoDownsample(l int) error {
 	return nil
 }
 
+// calendarInterval rounds d up to a whole number of days, hours, minutes or
+// seconds, whichever is the largest unit d spans.
+func calendarInterval(d Duration) Duration {
+	for _, u := range []Duration{Day, Hour, Minute, Second} {
+		if d >= u {
+			return (d + u - 1) / u * u
+		}
+	}
+	return Second
+}
+
 // SetTime adjusts the start and end time of the request to assume t is now.
 // Relative times ("1m-ago") are changed to absolute times. Existing absolute
 // times are adjusted by the difference between time.Now() and t.
 func (r *Request) SetTime(t time.Time) error {
-	diff := -time.Since(t)
-	start, err := ParseTime(r.Start)
+	now := time.Now().UTC()
+	diff := t.Sub(now)
+	shift := func(v interface{}) (TimeSpec, error) {
+		var tm time.Time
+		var err error
+		if _, ok := relativeSpec(v); ok || strings.EqualFold(fmt.Sprint(v), "now") {
+			tm, err = r.parseTimeAt(v, t)
+		} else {
+			tm, err = r.parseTimeAt(v, now)
+			tm = tm.Add(diff)
+		}
+		return TimeSpec(strconv.FormatInt(tm.Unix(), 10)), err
+	}
+	start, err := shift(r.Start)
 	if err != nil {
 		return err
 	}
-	r.Start = TimeSpec(strconv.FormatInt(start.Add(diff).Unix(), 10))
-	if r.End != "" {
-		end, err := ParseTime(r.End)
+	r.Start = start
+	if hasTime(r.End) {
+		end, err := shift(r.End)
 		if err != nil {
 			return err
 		}
-		r.End = TimeSpec(strconv.FormatInt(end.Add(diff).Unix(), 10))
+		r.End = end
 	} else {
 		r.End = TimeSpec(strconv.FormatInt(t.UTC().Unix(), 10))
 	}
@@ -1046,12 +1170,8 @@ func (r *Request) Query(host string) (ResponseSet, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	var tr ResponseSet
-	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
-		return nil, err
-	}
-	return tr, nil
+	defer closeBody(resp.Body)
+	return DecodeResponseSet(resp.Body)
 }
 
 func (r *Request) QueryResponse(host string, client *http.Client) (*http.Response, error) {
@@ -1062,23 +1182,6 @@ func (r *Request) QueryResponse(host string, client *http.Client) (*http.Respons
 // be of the form hostname:port. A nil client uses DefaultClient.
 func (r *Request) QueryResponseWithHeaders(host string, client *http.Client, headers http.Header) (*http.Response, error) {
 
-	u := url.URL{
-		Scheme: "http",
-		Host:   host,
-		Path:   "/api/query",
-	}
-
-	pu, err := url.Parse(host)
-	if err == nil && pu.Scheme != "" && pu.Host != "" {
-		u.Scheme = pu.Scheme
-		u.Host = pu.Host
-		if pu.Path != "" {
-			u.Path = pu.Path
-		}
-	}
-	u.ForceQuery = true
-	u.RawQuery = pu.RawQuery
-
 	b, err := json.Marshal(&r)
 	if err != nil {
 		return nil, err
@@ -1086,42 +1189,87 @@ func (r *Request) QueryResponseWithHeaders(host string, client *http.Client, hea
 	if client == nil {
 		client = DefaultClient
 	}
+	return postQuery(r.Context(), host, b, nil, sender{client: withTimeout(client, r.Timeout)}, headers)
+}
 
-	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(b))
+// postQuery posts the JSON query b to host. If gz is not nil it is sent
+// instead, as the gzip compressed b, with s.
+func postQuery(ctx context.Context, host string, b, gz []byte, s sender, headers http.Header) (*http.Response, error) {
+	u := queryURL(host)
+	body := b
+	if gz != nil {
+		body = gz
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Add("Content-Type", "application/json")
-	if userAgent != "" {
-		req.Header.Add("User-Agent", userAgent)
+	if gz != nil {
+		req.Header.Add("Content-Encoding", "gzip")
 	}
-
 	for k, a := range headers {
 		for _, v := range a {
 			req.Header.Add(k, v)
 		}
 	}
+	setUserAgent(req, GetUserAgent())
 
-	resp, err := client.Do(req)
+	resp, err := s.do(req, body, true)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		e := RequestError{Request: string(b)}
-		defer resp.Body.Close()
-		body, _ := ioutil.ReadAll(resp.Body)
-		if err := json.NewDecoder(bytes.NewBuffer(body)).Decode(&e); err == nil {
-			return nil, &e
-		}
-		te := &TransportError{Code: resp.StatusCode}
-		if len(body) > 0 {
-			te.Body = body
-		}
-		return nil, te
+		defer closeBody(resp.Body)
+		return nil, responseError(resp, b)
 	}
 	return resp, nil
 }
 
+// apiURL returns the URL of endpoint on host. host may be of the form
+// hostname:port or a full URL, in which case its scheme and query are kept.
+func apiURL(host, endpoint string) url.URL {
+	u := url.URL{
+		Scheme: "http",
+		Host:   host,
+		Path:   endpoint,
+	}
+
+	pu, err := url.Parse(host)
+	if err == nil && pu.Scheme != "" && pu.Host != "" {
+		u.Scheme = pu.Scheme
+		u.Host = pu.Host
+		u.RawQuery = pu.RawQuery
+	}
+	return u
+}
+
+// queryURL returns the /api/query URL for host. A path given in a full URL
+// host replaces /api/query.
+func queryURL(host string) url.URL {
+	u := apiURL(host, "/api/query")
+	pu, err := url.Parse(host)
+	if err == nil && pu.Scheme != "" && pu.Host != "" && pu.Path != "" {
+		u.Path = pu.Path
+	}
+	return u
+}
+
+// responseError builds the error for a non successful response. req is the
+// body that was sent.
+func responseError(resp *http.Response, req []byte) error {
+	e := RequestError{Request: string(req)}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if err := json.NewDecoder(bytes.NewBuffer(body)).Decode(&e); err == nil {
+		return &e
+	}
+	te := &TransportError{Code: resp.StatusCode}
+	if len(body) > 0 {
+		te.Body = body
+	}
+	return te
+}
+
 // TransportError is the error structure for errors
 type TransportError struct {
 	Code int    `json:"code" yaml:"code"`
@@ -1132,6 +1280,11 @@ func (r TransportError) Error() string {
 	return fmt.Sprintf("opentsdb: status=%d", r.Code)
 }
 
+// Is reports whether target is the error kind of the status code.
+func (r TransportError) Is(target error) bool {
+	return target != nil && statusKind(r.Code) == target
+}
+
 // RequestError is the error structure for request errors.
 type RequestError struct {
 	Request string `json:"request" yaml:"request"`
@@ -1146,6 +1299,11 @@ func (r RequestError) Error() string {
 	return fmt.Sprintf("opentsdb: status=%d req='%s' msg=%s", r.Err.Code, r.Request, r.Err.Message)
 }
 
+// Is reports whether target is the error kind of the status code.
+func (r RequestError) Is(target error) bool {
+	return target != nil && statusKind(r.Err.Code) == target
+}
+
 // Context is the interface for querying an OpenTSDB server.
 type Context interface {
 	Query(*Request) (ResponseSet, error)
@@ -1187,7 +1345,7 @@ func (v *Version) UnmarshalText(text []byte) error {
 	if err != nil {
 		return fmt.Errorf("could not parse major version number for opentsdb version: %v", split[0])
 	}
-	v.Minor, err = strconv.ParseInt(split[0], 10, 64)
+	v.Minor, err = strconv.ParseInt(split[1], 10, 64)
 	if err != nil {
 		return fmt.Errorf("could not parse minor version number for opentsdb version: %v", split[1])
 	}
@@ -1195,7 +1353,16 @@ func (v *Version) UnmarshalText(text []byte) error {
 }
 
 func (v Version) FilterSupport() bool {
-	return v.Major >= 2 && v.Minor >= 2
+	return v.AtLeast(Version2_2)
+}
+
+// AtLeast returns true if v is o or a later version.
+func (v Version) AtLeast(o Version) bool {
+	return v.Major > o.Major || v.Major == o.Major && v.Minor >= o.Minor
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
 }
 
 // LimitContext is a context that enables limiting response size and filtering tags
@@ -1203,8 +1370,14 @@ type LimitContext struct {
 	Host string
 	// Limit limits response size in bytes
 	Limit int64
+	// MaxSeries and MaxDataPoints, if positive, limit the number of series
+	// and datapoints of a response
+	MaxSeries     int
+	MaxDataPoints int64
 	// FilterTags removes tagks from results if that tagk was not in the request
 	FilterTags bool
+	// Pipeline post-processes results, after FilterTags.
+	Pipeline Pipeline
 	// Use the version to see if groupby and filters are supported
 	TSDBVersion Version
 }
@@ -1231,45 +1404,89 @@ func (c *LimitContext) Query(r *Request) (tr ResponseSet, err error) {
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	lr := &io.LimitedReader{R: resp.Body, N: c.Limit}
-	err = json.NewDecoder(lr).Decode(&tr)
-	if lr.N == 0 {
-		err = fmt.Errorf("TSDB response too large: limited to %E bytes", float64(c.Limit))
-		log.Print(err)
-		return
-	}
-	if err != nil {
-		return
+	defer closeBody(resp.Body)
+	if tr, err = decodeLimited(resp.Body, responseLimits{c.Limit, c.MaxSeries, c.MaxDataPoints}); err != nil {
+		return nil, err
 	}
 	if c.FilterTags {
 		FilterTags(r, tr)
 	}
-	return
+	return c.Pipeline.Apply(r, tr)
 }
 
-// FilterTags removes tagks in tr not present in r. Does nothing in the event of
-// multiple queries in the request.
+// FilterTags removes the tags of the responses in tr that their query in r
+// didn't ask for: tags of keys neither in its Tags nor in a group by
+// filter. Keys filtered on with ExplicitTags, and keys pinned to a single
+// value by a literal_or filter, are kept too.
+//
+// With several queries, a response is matched to its query by the query
+// index returned with ShowQuery, or else by metric; responses whose query
+// can't be told are left alone.
 func FilterTags(r *Request, tr ResponseSet) {
-	if len(r.Queries) != 1 {
-		return
+	keep := make([]map[string]bool, len(r.Queries))
+	for i, q := range r.Queries {
+		keep[i] = q.askedTagKeys()
 	}
 	for _, resp := range tr {
+		i := r.responseQuery(resp)
+		if i < 0 {
+			continue
+		}
+		var tags TagSet
 		for k := range resp.Tags {
-			_, inTags := r.Queries[0].Tags[k]
-			inGroupBy := false
-			for _, filter := range r.Queries[0].Filters {
-				if filter.GroupBy && filter.TagK == k {
-					inGroupBy = true
-					break
-				}
-			}
-			if inTags || inGroupBy {
+			if keep[i][k] {
 				continue
 			}
-			delete(resp.Tags, k)
+			// copy before deleting so interned tags are never modified
+			if tags == nil {
+				tags = resp.Tags.Copy()
+			}
+			delete(tags, k)
+		}
+		if tags != nil {
+			resp.Tags = tags
+			resp.rekey()
+		}
+	}
+}
+
+// askedTagKeys returns the tag keys FilterTags keeps for q.
+func (q *Query) askedTagKeys() map[string]bool {
+	keys := map[string]bool{}
+	for k := range q.Tags {
+		keys[k] = true
+	}
+	for _, f := range q.Filters {
+		pinned := f.Type == "literal_or" && f.Filter != "" && !strings.Contains(f.Filter, "|")
+		if f.GroupBy || q.ExplicitTags || pinned {
+			keys[f.TagK] = true
+		}
+	}
+	return keys
+}
+
+// responseQuery returns the index of the query of r resp answers, or -1 if
+// it can't be told.
+func (r *Request) responseQuery(resp *Response) int {
+	switch {
+	case len(r.Queries) == 1:
+		return 0
+	case r.ShowQuery && resp.Query.Metric != "":
+		if i := resp.Query.Index; i >= 0 && i < len(r.Queries) {
+			return i
+		}
+		return -1
+	}
+	found := -1
+	for i, q := range r.Queries {
+		if q.Metric == resp.Metric {
+			if found >= 0 {
+				return -1
+			}
+			found = i
 		}
 	}
+	return found
 }
 
 func (dps DPmap) GetSortedTimes() []Epoch {
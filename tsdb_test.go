@@ -2,7 +2,7 @@ package opentsdb
 
 import (
 	"bytes"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"net/url"
 	"testing"
@@ -480,7 +480,7 @@ func TestQueryResponseUrlParsing(t *testing.T) {
 	r := Request{}
 	stockResponse := http.Response{
 		StatusCode: 200,
-		Body:       ioutil.NopCloser(bytes.NewBufferString(`OK`)),
+		Body:       io.NopCloser(bytes.NewBufferString(`OK`)),
 		Header:     make(http.Header),
 	}
 
@@ -506,3 +506,121 @@ func BenchmarkReplace_Something(b *testing.B) {
 		Replace("abcdef&hij@@$$opq#stuvw*yz", "")
 	}
 }
+
+func TestQueryFilterRoundTrip(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"sum:10m-avg:proc.stat.cpu{t=v,o=k}", "sum:10m-avg:proc.stat.cpu{t=literal_or(v),o=literal_or(k)}"},
+		{"sum:proc.stat.cpu{}{t=wildcard(v*)}", "sum:proc.stat.cpu{}{t=wildcard(v*)}"},
+		{"sum:proc.stat.cpu{t=v}{o=iwildcard(foo*),z=regexp(a.*)}", "sum:proc.stat.cpu{t=literal_or(v)}{o=iwildcard(foo*),z=regexp(a.*)}"},
+		{"sum:explicit_tags:proc.stat.cpu{t=v}", "sum:explicit_tags:proc.stat.cpu{t=literal_or(v)}"},
+		{"sum:1m-avg-zero:rate{counter,1,2}:explicit_tags:cpu{}{t=v}", "sum:1m-avg-zero:rate{counter,1,2}:explicit_tags:cpu{}{t=literal_or(v)}"},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.in, Version2_3)
+		if err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+		if s := q.String(); s != test.out {
+			t.Errorf("got %s, expected %s", s, test.out)
+		}
+		q2, err := ParseQuery(q.String(), Version2_3)
+		if err != nil {
+			t.Errorf("%s: %v", q.String(), err)
+			continue
+		}
+		if q2.String() != q.String() || q2.ExplicitTags != q.ExplicitTags || len(q2.Filters) != len(q.Filters) {
+			t.Errorf("round trip of %s gave %s", q, q2)
+		}
+		for i := range q.Filters {
+			if q.Filters[i] != q2.Filters[i] {
+				t.Errorf("round trip of %s changed filter %v into %v", test.in, q.Filters[i], q2.Filters[i])
+			}
+		}
+		if !q.GroupByTags.Equal(q2.GroupByTags) {
+			t.Errorf("round trip of %s changed group by tags", test.in)
+		}
+	}
+
+	// tags set next to filters are sent as group by filters
+	q := Query{Aggregator: "sum", Metric: "m", Tags: TagSet{"host": "*"}, Filters: Filters{{Type: "literal_or", TagK: "dc", Filter: "x"}}}
+	if s := q.String(); s != "sum:m{host=wildcard(*)}{dc=literal_or(x)}" {
+		t.Errorf("got %s", s)
+	}
+
+	r, err := ParseRequest("start=1h-ago&m=sum:explicit_tags:cpu{}{t=v}", Version2_3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := ParseRequest(r.Encode(), Version2_3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.Encode() != r.Encode() || !r2.Queries[0].ExplicitTags {
+		t.Errorf("request round trip: %s != %s", r2, r)
+	}
+}
+
+func TestParseQuerySpecialCharacters(t *testing.T) {
+	tests := []struct {
+		query   string
+		metric  string
+		filters Filters
+	}{
+		{"sum:app%requests#total{host=web 01}", "app%requests#total",
+			Filters{{Type: "literal_or", TagK: "host", Filter: "web 01", GroupBy: true}}},
+		{"sum:m{host=regexp(web{1,3}),dc=x}", "m",
+			Filters{{Type: "regexp", TagK: "host", Filter: "web{1,3}", GroupBy: true}, {Type: "literal_or", TagK: "dc", Filter: "x", GroupBy: true}}},
+		{"sum:m{}{path=regexp((a|b),c)}", "m",
+			Filters{{Type: "regexp", TagK: "path", Filter: "(a|b),c"}}},
+		{`sum:"m:with{braces}"{k="a,b=c"}`, "m:with{braces}",
+			Filters{{Type: "literal_or", TagK: "k", Filter: "a,b=c", GroupBy: true}}},
+		{`sum:m{k=regexp("a)b")}`, "m",
+			Filters{{Type: "regexp", TagK: "k", Filter: "a)b", GroupBy: true}}},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query, Version2_2)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		if q.Metric != test.metric {
+			t.Errorf("%s: metric %q, expected %q", test.query, q.Metric, test.metric)
+		}
+		if len(q.Filters) != len(test.filters) {
+			t.Errorf("%s: filters %v, expected %v", test.query, q.Filters, test.filters)
+			continue
+		}
+		for i := range q.Filters {
+			if q.Filters[i] != test.filters[i] {
+				t.Errorf("%s: filter %+v, expected %+v", test.query, q.Filters[i], test.filters[i])
+			}
+		}
+		q2, err := ParseQuery(q.String(), Version2_2)
+		if err != nil || q2.String() != q.String() || q2.Metric != q.Metric {
+			t.Errorf("%s: round trip through %s failed: %v", test.query, q, err)
+		}
+	}
+
+	for _, bad := range []string{"sum:m{k=regexp(a}", `sum:m{k="a}`, "sum:m{a=b}{c=d}{e=f}", "sum:m{a=b}x"} {
+		if _, err := ParseQuery(bad, Version2_2); err == nil {
+			t.Errorf("expected error: %s", bad)
+		}
+	}
+}
+
+func TestTagSetKeys(t *testing.T) {
+	ts := TagSet{"host": "a", "dc": "x", "app": "web"}
+	assert.Equal(t, []string{"app", "dc", "host"}, ts.Keys())
+	assert.Equal(t, []string{"web", "x", "a"}, ts.Values())
+	var seen []string
+	ts.SortedIter(func(k, v string) bool {
+		seen = append(seen, k+"="+v)
+		return k != "dc"
+	})
+	assert.Equal(t, []string{"app=web", "dc=x"}, seen)
+	assert.NoError(t, ts.CheckNumTags(0))
+	assert.ErrorIs(t, ts.CheckNumTags(2), ErrTooManyTags)
+}
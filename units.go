@@ -0,0 +1,182 @@
+package opentsdb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Unit is a unit of measure of metric values. Units of the same Dimension
+// convert into each other by their Factor, the value of one unit in the
+// base unit of the dimension.
+type Unit struct {
+	Name      string
+	Dimension string
+	Factor    float64
+}
+
+// Units of the common dimensions.
+var (
+	Bytes = Unit{"B", "bytes", 1}
+	KiB   = Unit{"KiB", "bytes", 1 << 10}
+	MiB   = Unit{"MiB", "bytes", 1 << 20}
+	GiB   = Unit{"GiB", "bytes", 1 << 30}
+	TiB   = Unit{"TiB", "bytes", 1 << 40}
+	KB    = Unit{"kB", "bytes", 1e3}
+	MB    = Unit{"MB", "bytes", 1e6}
+	GB    = Unit{"GB", "bytes", 1e9}
+
+	Nanoseconds  = Unit{"ns", "seconds", 1e-9}
+	Microseconds = Unit{"us", "seconds", 1e-6}
+	Milliseconds = Unit{"ms", "seconds", 1e-3}
+	Seconds      = Unit{"s", "seconds", 1}
+	Minutes      = Unit{"min", "seconds", 60}
+	Hours        = Unit{"h", "seconds", 3600}
+
+	Ratio   = Unit{"ratio", "ratio", 1}
+	Percent = Unit{"%", "ratio", 0.01}
+
+	PerSecond = Unit{"/s", "rate", 1}
+	PerMinute = Unit{"/min", "rate", 1.0 / 60}
+)
+
+var units = map[string]Unit{}
+
+func init() {
+	for _, u := range []Unit{Bytes, KiB, MiB, GiB, TiB, KB, MB, GB,
+		Nanoseconds, Microseconds, Milliseconds, Seconds, Minutes, Hours,
+		Ratio, Percent, PerSecond, PerMinute} {
+		units[u.Name] = u
+	}
+}
+
+// LookupUnit returns the predefined unit named name.
+func LookupUnit(name string) (Unit, bool) {
+	u, ok := units[name]
+	return u, ok
+}
+
+func (u Unit) String() string { return u.Name }
+
+// Convert converts v from u to the unit to. Units of different dimensions
+// fail with ErrUnitMismatch.
+func (u Unit) Convert(v float64, to Unit) (float64, error) {
+	if u.Dimension != to.Dimension {
+		return 0, fmt.Errorf("%w: %s to %s", ErrUnitMismatch, u.Name, to.Name)
+	}
+	if u.Factor == to.Factor {
+		return v, nil
+	}
+	return v * u.Factor / to.Factor, nil
+}
+
+// UnitRegistry records the units of metrics. Metric patterns may use '*'
+// wildcards. It is safe for concurrent use.
+type UnitRegistry struct {
+	mu       sync.RWMutex
+	exact    map[string]Unit
+	patterns []string
+	byPat    map[string]Unit
+	names    map[string]Unit // units set or converted to, by name
+}
+
+// NewUnitRegistry returns an empty registry.
+func NewUnitRegistry() *UnitRegistry {
+	return &UnitRegistry{exact: map[string]Unit{}, byPat: map[string]Unit{}, names: map[string]Unit{}}
+}
+
+// Set records u as the unit of the metrics matching pattern. Patterns are
+// tried in the order they were first set, after exact names.
+func (r *UnitRegistry) Set(pattern string, u Unit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names[u.Name] = u
+	if !strings.ContainsRune(pattern, '*') {
+		r.exact[pattern] = u
+		return
+	}
+	if _, ok := r.byPat[pattern]; !ok {
+		r.patterns = append(r.patterns, pattern)
+	}
+	r.byPat[pattern] = u
+}
+
+// Unit returns the unit of metric.
+func (r *UnitRegistry) Unit(metric string) (Unit, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if u, ok := r.exact[metric]; ok {
+		return u, true
+	}
+	for _, p := range r.patterns {
+		if matchWildcard(p, metric) {
+			return r.byPat[p], true
+		}
+	}
+	return Unit{}, false
+}
+
+// named returns the unit named name, predefined or known to r.
+func (r *UnitRegistry) named(name string) (Unit, bool) {
+	if u, ok := LookupUnit(name); ok {
+		return u, true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.names[name]
+	return u, ok
+}
+
+// remember makes u known to r by its name.
+func (r *UnitRegistry) remember(u Unit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names[u.Name] = u
+}
+
+// responseUnit returns the unit of resp: its Unit if set, else the unit of
+// its metric in r. A Unit r does not know is not guessed from the metric.
+func (r *UnitRegistry) responseUnit(resp *Response) (Unit, bool) {
+	if resp.Unit != "" {
+		return r.named(resp.Unit)
+	}
+	return r.Unit(resp.Metric)
+}
+
+// AnnotateUnits sets the Unit of responses of metrics with a unit in reg.
+func AnnotateUnits(reg *UnitRegistry) ResponseTransform {
+	return func(_ *Request, rs ResponseSet) (ResponseSet, error) {
+		for _, resp := range rs {
+			if u, ok := reg.Unit(resp.Metric); ok {
+				resp.Unit = u.Name
+			}
+		}
+		return rs, nil
+	}
+}
+
+// ConvertUnits converts the points of responses whose unit, their Unit
+// or else the unit of their metric in reg, has the dimension of to. Their
+// Unit is set to to. Other responses are left alone, as are those whose
+// Unit is neither predefined nor set or converted to in reg.
+func ConvertUnits(reg *UnitRegistry, to Unit) ResponseTransform {
+	reg.remember(to)
+	return func(_ *Request, rs ResponseSet) (ResponseSet, error) {
+		for _, resp := range rs {
+			from, ok := reg.responseUnit(resp)
+			if !ok || from.Dimension != to.Dimension {
+				continue
+			}
+			if from.Factor != to.Factor {
+				f := Point(from.Factor / to.Factor)
+				dps := make(DPmap, len(resp.DPS))
+				for t, v := range resp.DPS {
+					dps[t] = v * f
+				}
+				resp.DPS = dps
+			}
+			resp.Unit = to.Name
+		}
+		return rs, nil
+	}
+}
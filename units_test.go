@@ -0,0 +1,83 @@
+package opentsdb
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestUnitConvert(t *testing.T) {
+	for _, tc := range []struct {
+		v        float64
+		from, to Unit
+		want     float64
+	}{
+		{3 << 30, Bytes, GiB, 3},
+		{0.25, Ratio, Percent, 25},
+		{1500, Milliseconds, Seconds, 1.5},
+		{120, PerMinute, PerSecond, 2},
+		{2, MB, KB, 2000},
+	} {
+		got, err := tc.from.Convert(tc.v, tc.to)
+		if err != nil || math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%v %s to %s: got %v, %v, want %v", tc.v, tc.from, tc.to, got, err, tc.want)
+		}
+	}
+	if _, err := Bytes.Convert(1, Seconds); !errors.Is(err, ErrUnitMismatch) {
+		t.Errorf("got %v, want ErrUnitMismatch", err)
+	}
+}
+
+func TestUnitTransforms(t *testing.T) {
+	reg := NewUnitRegistry()
+	reg.Set("mem.*", Bytes)
+	reg.Set("mem.util", Ratio)
+	reg.Set("cpu", Percent)
+
+	if u, _ := reg.Unit("mem.util"); u != Ratio {
+		t.Errorf("exact name: got %v", u)
+	}
+	if u, _ := reg.Unit("mem.used"); u != Bytes {
+		t.Errorf("pattern: got %v", u)
+	}
+
+	rs := ResponseSet{
+		{Metric: "mem.used", DPS: DPmap{1: 2 << 30}},
+		{Metric: "mem.util", DPS: DPmap{1: 0.5}},
+		{Metric: "disk", DPS: DPmap{1: 7}},
+	}
+	rs, err := Pipeline{AnnotateUnits(reg), ConvertUnits(reg, GiB), ConvertUnits(reg, Percent)}.Apply(nil, rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []struct {
+		unit string
+		v    Point
+	}{{"GiB", 2}, {"%", 50}, {"", 7}} {
+		if rs[i].Unit != want.unit || rs[i].DPS[1] != want.v {
+			t.Errorf("%s: got %v %q, want %v %q", rs[i].Metric, rs[i].DPS[1], rs[i].Unit, want.v, want.unit)
+		}
+	}
+}
+
+func TestConvertUnitsCustom(t *testing.T) {
+	pages := Unit{"pages", "bytes", 4096}
+	blocks := Unit{"blocks", "bytes", 512}
+	reg := NewUnitRegistry()
+	reg.Set("mem.*", pages)
+
+	rs := ResponseSet{
+		{Metric: "mem.used", DPS: DPmap{1: 2}},
+		{Metric: "mem.free", Unit: "quux", DPS: DPmap{1: 3}},
+	}
+	rs, err := Pipeline{ConvertUnits(reg, blocks), ConvertUnits(reg, KiB)}.Apply(nil, rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs[0].Unit != "KiB" || rs[0].DPS[1] != 8 {
+		t.Errorf("got %v %q, want 8 KiB", rs[0].DPS[1], rs[0].Unit)
+	}
+	if rs[1].Unit != "quux" || rs[1].DPS[1] != 3 {
+		t.Errorf("unknown unit: got %v %q", rs[1].DPS[1], rs[1].Unit)
+	}
+}
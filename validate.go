@@ -0,0 +1,221 @@
+package opentsdb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError is a problem found by Request.Validate. Query is the index
+// of the offending query, or -1 for problems with the request itself.
+type ValidationError struct {
+	Query   int
+	Field   string
+	Message string
+}
+
+// Is matches the ErrBadQuery kind.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrBadQuery
+}
+
+func (e *ValidationError) Error() string {
+	if e.Query < 0 {
+		return fmt.Sprintf("opentsdb: %s: %s", e.Field, e.Message)
+	}
+	return fmt.Sprintf("opentsdb: query %d: %s: %s", e.Query, e.Field, e.Message)
+}
+
+// aggregatorVersions maps the aggregators known to OpenTSDB to the version
+// that introduced them.
+var aggregatorVersions = map[string]Version{
+	"sum": {2, 0}, "min": {2, 0}, "max": {2, 0}, "avg": {2, 0}, "dev": {2, 0},
+	"zimsum": {2, 0}, "mimmin": {2, 0}, "mimmax": {2, 0},
+	"count": Version2_2,
+	"p50":   Version2_2, "p75": Version2_2, "p90": Version2_2, "p95": Version2_2, "p99": Version2_2, "p999": Version2_2,
+	"ep50r3": Version2_2, "ep50r7": Version2_2, "ep75r3": Version2_2, "ep75r7": Version2_2,
+	"ep90r3": Version2_2, "ep90r7": Version2_2, "ep95r3": Version2_2, "ep95r7": Version2_2,
+	"ep99r3": Version2_2, "ep99r7": Version2_2, "ep999r3": Version2_2, "ep999r7": Version2_2,
+	"first": Version2_3, "last": Version2_3, "none": Version2_3,
+}
+
+// filterVersions maps the filter types known to OpenTSDB to the version that
+// introduced them.
+var filterVersions = map[string]Version{
+	"literal_or": Version2_2, "iliteral_or": Version2_2,
+	"not_literal_or": Version2_2, "not_iliteral_or": Version2_2,
+	"wildcard": Version2_2, "iwildcard": Version2_2, "regexp": Version2_2,
+	"not_key": Version2_3,
+}
+
+var fillPolicies = map[string]bool{"none": true, "nan": true, "null": true, "zero": true}
+
+// ValidAggregator returns true if agg is an aggregator supported by v.
+func ValidAggregator(agg string, v Version) bool {
+	min, ok := aggregatorVersions[agg]
+	return ok && v.AtLeast(min)
+}
+
+// Validate checks r against what version v of OpenTSDB accepts and returns
+// every problem found, or nil.
+func (r *Request) Validate(v Version) []error {
+	var errs []error
+	add := func(q int, field, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Query: q, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if r.Start == nil || r.Start == "" || r.Start == TimeSpec("") {
+		add(-1, "start", "%s", ErrMissingStartTime)
+	} else if _, err := r.parseTimeAt(r.Start, time.Now()); err != nil {
+		add(-1, "start", "%s", err)
+	}
+	if r.End != nil && r.End != "" && r.End != TimeSpec("") {
+		if _, err := r.parseTimeAt(r.End, time.Now()); err != nil {
+			add(-1, "end", "%s", err)
+		}
+	}
+	if _, err := r.location(); err != nil {
+		add(-1, "timezone", "%s", err)
+	}
+	if len(r.Queries) == 0 {
+		add(-1, "queries", "no queries")
+	}
+
+	for i, q := range r.Queries {
+		if q.Metric == "" && len(q.TSUIDs) == 0 {
+			add(i, "metric", "missing metric")
+		} else if q.Metric != "" && !ValidTSDBString(q.Metric) {
+			add(i, "metric", "invalid character in %q", q.Metric)
+		}
+		if !ValidAggregator(q.Aggregator, v) {
+			add(i, "aggregator", "%q is not supported by OpenTSDB %s", q.Aggregator, v)
+		}
+		if q.Downsample != "" {
+			spec, err := ParseDownsampleSpec(q.Downsample)
+			switch {
+			case err != nil:
+				add(i, "downsample", "invalid downsample %q", q.Downsample)
+			case !ValidAggregator(spec.Aggregator, v) || spec.Aggregator == "none":
+				add(i, "downsample", "%q is not a valid downsample aggregator", spec.Aggregator)
+			case spec.Fill != "" && !v.FilterSupport():
+				add(i, "downsample", "fill policies require OpenTSDB 2.2")
+			case spec.Fill != "" && !fillPolicies[spec.Fill]:
+				add(i, "downsample", "unknown fill policy %q", spec.Fill)
+			}
+		}
+		if len(q.Tags) > 0 && len(q.Filters) > 0 {
+			add(i, "filters", "tags and filters can't be used together")
+		}
+		for k, tv := range q.Tags {
+			if !ValidTSDBString(k) {
+				add(i, "tags", "invalid tag key %q", k)
+			}
+			for _, s := range strings.Split(tv, "|") {
+				if s != "*" && !ValidTSDBString(strings.ReplaceAll(s, "*", "")) {
+					add(i, "tags", "invalid value %q for tag %s", tv, k)
+					break
+				}
+			}
+		}
+		if len(q.Filters) > 0 && !v.FilterSupport() {
+			add(i, "filters", "filters require OpenTSDB 2.2")
+		}
+		for _, f := range q.Filters {
+			if !ValidTSDBString(f.TagK) {
+				add(i, "filters", "invalid tag key %q", f.TagK)
+			}
+			min, ok := filterVersions[f.Type]
+			if !ok {
+				add(i, "filters", "unknown filter type %q", f.Type)
+				continue
+			}
+			if !v.AtLeast(min) {
+				add(i, "filters", "filter type %s requires OpenTSDB %s", f.Type, min)
+			}
+			if f.Type == "regexp" {
+				if _, err := regexp.Compile(f.Filter); err != nil {
+					add(i, "filters", "invalid regexp %q: %s", f.Filter, err)
+				}
+			}
+		}
+		if q.ExplicitTags && !v.AtLeast(Version2_3) {
+			add(i, "explicitTags", "explicitTags requires OpenTSDB 2.3")
+		}
+	}
+	return errs
+}
+
+// NameError describes an invalid metric name, tag key or tag value. Pos is
+// the byte offset of the offending rune in Name; it is -1 for empty names.
+type NameError struct {
+	Kind string
+	Name string
+	Rune rune
+	Pos  int
+}
+
+func (e *NameError) Error() string {
+	if e.Pos < 0 {
+		return fmt.Sprintf("opentsdb: empty %s", e.Kind)
+	}
+	return fmt.Sprintf("opentsdb: invalid %s %q: character %q at position %d", e.Kind, e.Name, e.Rune, e.Pos)
+}
+
+func validateName(kind, s string) error {
+	if s == "" {
+		return &NameError{Kind: kind, Pos: -1}
+	}
+	for i, r := range s {
+		if !isTSDBRune(r) {
+			return &NameError{Kind: kind, Name: s, Rune: r, Pos: i}
+		}
+	}
+	return nil
+}
+
+// ValidateMetric returns a *NameError if m is not a valid metric name.
+func ValidateMetric(m string) error { return validateName("metric", m) }
+
+// ValidateTagKey returns a *NameError if k is not a valid tag key.
+func ValidateTagKey(k string) error { return validateName("tag key", k) }
+
+// ValidateTagValue returns a *NameError if v is not a valid tag value.
+func ValidateTagValue(v string) error { return validateName("tag value", v) }
+
+// Validate returns every problem making d invalid, joined, or nil. It
+// checks what Valid does without cleaning d first.
+func (d *DataPoint) Validate() error {
+	var errs []error
+	if err := ValidateMetric(d.Metric); err != nil {
+		errs = append(errs, err)
+	}
+	if d.Timestamp == 0 {
+		errs = append(errs, ErrMissingTimestamp)
+	}
+	if d.Value == nil {
+		errs = append(errs, fmt.Errorf("%w: missing", ErrInvalidValue))
+	} else if f, err := strconv.ParseFloat(fmt.Sprint(d.Value), 64); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %v is not a number", ErrInvalidValue, d.Value))
+	} else if math.IsNaN(f) {
+		errs = append(errs, fmt.Errorf("%w: NaN", ErrInvalidValue))
+	}
+	keys := make([]string, 0, len(d.Tags))
+	for k := range d.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := ValidateTagKey(k); err != nil {
+			errs = append(errs, err)
+		}
+		if err := ValidateTagValue(d.Tags[k]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,75 @@
+package opentsdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRequestValidate(t *testing.T) {
+	tests := []struct {
+		r       Request
+		version Version
+		errors  int
+	}{
+		{Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}, Version2_1, 0},
+		{Request{Queries: []*Query{{Metric: "m", Aggregator: "sum"}}}, Version2_4, 1},
+		{Request{Start: "1h-ago"}, Version2_4, 1},
+		{Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "bogus", Downsample: "1x-avg"}}}, Version2_4, 2},
+		{Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "none"}}}, Version2_2, 1},
+		{Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum", Downsample: "1m-avg-zero"}}}, Version2_1, 1},
+		{Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum", Downsample: "1m-avg-blah"}}}, Version2_4, 1},
+		{Request{Start: "1h-ago", Queries: []*Query{{
+			Metric:       "m",
+			Aggregator:   "sum",
+			Tags:         TagSet{"host": "a|b"},
+			Filters:      Filters{{Type: "regexp", TagK: "dc", Filter: "("}, {Type: "not_key", TagK: "x"}},
+			ExplicitTags: true,
+		}}}, Version2_2, 4},
+		{Request{Start: "1h-ago", Queries: []*Query{{Metric: "m", Aggregator: "sum", Tags: TagSet{"host": "a=b"}}}}, Version2_4, 1},
+	}
+	for i, test := range tests {
+		errs := test.r.Validate(test.version)
+		if len(errs) != test.errors {
+			t.Errorf("test %d: expected %d errors, got %v", i, test.errors, errs)
+		}
+	}
+}
+
+func TestVersionUnmarshal(t *testing.T) {
+	var v Version
+	if err := v.UnmarshalText([]byte("2.3")); err != nil || v != Version2_3 {
+		t.Errorf("got %v %v", v, err)
+	}
+	if !(Version{3, 0}).FilterSupport() {
+		t.Error("3.0 supports filters")
+	}
+}
+
+func TestValidateNames(t *testing.T) {
+	var ne *NameError
+	if err := ValidateMetric("sys.cpu"); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateTagKey("ho st"); !errors.As(err, &ne) || ne.Pos != 2 || ne.Rune != ' ' || ne.Kind != "tag key" {
+		t.Errorf("got %v", err)
+	}
+	if err := ValidateTagValue("é!"); !errors.As(err, &ne) || ne.Pos != 2 || ne.Rune != '!' {
+		t.Errorf("got %v", err)
+	}
+	if err := ValidateMetric(""); !errors.As(err, &ne) || ne.Pos != -1 {
+		t.Errorf("got %v", err)
+	}
+
+	dp := &DataPoint{Metric: "a b", Value: "x", Tags: TagSet{"host": "a:b", "ok": "v"}}
+	err := dp.Validate()
+	if err == nil || dp.Valid() {
+		t.Fatal("invalid datapoint accepted")
+	}
+	if n := len(err.(interface{ Unwrap() []error }).Unwrap()); n != 4 {
+		t.Errorf("got %d errors: %v", n, err)
+	}
+	dp = &DataPoint{Metric: "m", Timestamp: 1, Value: 1, Tags: TagSet{"host": "a"}}
+	if err := dp.Validate(); err != nil || !dp.Valid() {
+		t.Errorf("valid datapoint: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package opentsdb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AlertState is the state of a watched series.
+type AlertState int
+
+const (
+	StateOK AlertState = iota
+	StateAlert
+)
+
+func (s AlertState) String() string {
+	if s == StateAlert {
+		return "ALERT"
+	}
+	return "OK"
+}
+
+// Condition is a threshold watched by a Watcher. Each series returned by
+// Query breaches it when its value is above Threshold, or below it with
+// Below. A series alerts once it has breached for For and, to damp
+// flapping, only recovers once it has not breached for ClearAfter.
+type Condition struct {
+	Name      string
+	Query     *Query
+	Threshold float64
+	Below     bool
+	For       Duration
+	// ClearAfter defaults to For.
+	ClearAfter Duration
+	// Window is how much data each check queries. It defaults to twice
+	// the longer of For and ClearAfter, and at least five minutes.
+	Window Duration
+}
+
+func (c *Condition) breached(v Point) bool {
+	if c.Below {
+		return float64(v) < c.Threshold
+	}
+	return float64(v) > c.Threshold
+}
+
+func (c *Condition) clearAfter() Duration {
+	if c.ClearAfter > 0 {
+		return c.ClearAfter
+	}
+	return c.For
+}
+
+func (c *Condition) window() Duration {
+	if c.Window > 0 {
+		return c.Window
+	}
+	w := c.For
+	if ca := c.clearAfter(); ca > w {
+		w = ca
+	}
+	if w *= 2; w < 5*Minute {
+		w = 5 * Minute
+	}
+	return w
+}
+
+// Transition is a change of state of a series of a condition. Value is the
+// latest point of the series and Time its timestamp.
+type Transition struct {
+	Condition *Condition
+	Metric    string
+	Tags      TagSet
+	From, To  AlertState
+	Time      time.Time
+	Value     Point
+}
+
+// Watcher evaluates conditions against periodic query results and calls
+// OnTransition when a series changes state. Series start OK.
+type Watcher struct {
+	Context      Context
+	OnTransition func(Transition)
+
+	mu         sync.Mutex
+	conditions []*Condition
+	states     map[*Condition]map[string]AlertState
+}
+
+// NewWatcher returns a Watcher querying c and calling f on transitions.
+func NewWatcher(c Context, f func(Transition)) *Watcher {
+	return &Watcher{Context: c, OnTransition: f}
+}
+
+// Add registers c with the watcher.
+func (w *Watcher) Add(c *Condition) error {
+	if c.Query == nil || c.Query.Metric == "" {
+		return errors.New("opentsdb: condition without query")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conditions = append(w.conditions, c)
+	return nil
+}
+
+// Check evaluates every condition at now. Errors of a condition do not
+// stop the others from being checked; they are joined in the result.
+func (w *Watcher) Check(now time.Time) error {
+	w.mu.Lock()
+	conditions := append([]*Condition(nil), w.conditions...)
+	w.mu.Unlock()
+	var errs []error
+	for _, c := range conditions {
+		if err := w.check(c, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *Watcher) check(c *Condition, now time.Time) error {
+	r := &Request{
+		Start:   TimeSpec(strconv.FormatInt(now.Add(-time.Duration(c.window())).Unix(), 10)),
+		End:     TimeSpec(strconv.FormatInt(now.Unix(), 10)),
+		Queries: []*Query{c.Query.Clone()},
+	}
+	rs, err := w.Context.Query(r)
+	if err != nil {
+		return err
+	}
+	var transitions []Transition
+	w.mu.Lock()
+	if w.states == nil {
+		w.states = map[*Condition]map[string]AlertState{}
+	}
+	states := w.states[c]
+	if states == nil {
+		states = map[string]AlertState{}
+		w.states[c] = states
+	}
+	for _, resp := range rs {
+		times := resp.DPS.GetSortedTimes()
+		if len(times) == 0 {
+			continue
+		}
+		latest := times[len(times)-1]
+		breached := c.breached(resp.DPS[latest])
+		// since is the start of the run of points ending with the latest
+		// that all breach, or all do not.
+		since := latest
+		for i := len(times) - 2; i >= 0 && c.breached(resp.DPS[times[i]]) == breached; i-- {
+			since = times[i]
+		}
+		held := epochSpan(times, c.For)
+		if !breached {
+			held = epochSpan(times, c.clearAfter())
+		}
+
+		key := resp.Metric + resp.Tags.String()
+		from, to := states[key], states[key]
+		switch {
+		case from == StateOK && breached && latest-since >= held:
+			to = StateAlert
+		case from == StateAlert && !breached && latest-since >= held:
+			to = StateOK
+		}
+		if to == from {
+			continue
+		}
+		states[key] = to
+		transitions = append(transitions, Transition{
+			Condition: c,
+			Metric:    resp.Metric,
+			Tags:      resp.Tags,
+			From:      from,
+			To:        to,
+			Time:      epochTime(latest),
+			Value:     resp.DPS[latest],
+		})
+	}
+	w.mu.Unlock()
+	if w.OnTransition != nil {
+		for _, t := range transitions {
+			w.OnTransition(t)
+		}
+	}
+	return nil
+}
+
+// State returns the state of the series of c with metric and tags.
+func (w *Watcher) State(c *Condition, metric string, tags TagSet) AlertState {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.states[c][metric+tags.String()]
+}
+
+// Run checks the conditions every period until ctx is done. Errors are
+// passed to onError, if not nil, and do not stop the watcher.
+func (w *Watcher) Run(ctx context.Context, period time.Duration, onError func(error)) {
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		if err := w.Check(time.Now().UTC()); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// epochTime converts t, in seconds or milliseconds, to a time.
+func epochTime(t Epoch) time.Time {
+	if t > 0xffffffff {
+		return time.UnixMilli(int64(t)).UTC()
+	}
+	return time.Unix(int64(t), 0).UTC()
+}
@@ -0,0 +1,54 @@
+package opentsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	mem := NewMemContext()
+	var got []Transition
+	w := NewWatcher(mem, func(tr Transition) { got = append(got, tr) })
+	c := &Condition{
+		Name:       "cpu",
+		Query:      &Query{Metric: "cpu", Aggregator: "sum", Tags: TagSet{"host": "*"}},
+		Threshold:  90,
+		For:        2 * Minute,
+		ClearAfter: 3 * Minute,
+	}
+	if err := w.Add(c); err != nil {
+		t.Fatal(err)
+	}
+	if w.Add(&Condition{}) == nil {
+		t.Error("condition without query accepted")
+	}
+
+	tags := TagSet{"host": "a"}
+	steps := []struct {
+		at    Epoch
+		value Point
+		want  AlertState
+	}{
+		{1000, 95, StateOK},
+		{1060, 95, StateOK},
+		{1120, 95, StateAlert}, // breached for 2m
+		{1180, 50, StateAlert},
+		{1240, 95, StateAlert}, // flap does not clear
+		{1300, 50, StateAlert},
+		{1360, 50, StateAlert},
+		{1420, 50, StateAlert},
+		{1480, 50, StateOK}, // clear for 3m
+	}
+	for _, s := range steps {
+		mem.AddSeries("cpu", tags, DPmap{s.at: s.value})
+		if err := w.Check(time.Unix(int64(s.at), 0)); err != nil {
+			t.Fatal(err)
+		}
+		if st := w.State(c, "cpu", tags); st != s.want {
+			t.Errorf("at %d: state %v, want %v", s.at, st, s.want)
+		}
+	}
+	if len(got) != 2 || got[0].To != StateAlert || got[0].Time.Unix() != 1120 || got[1].From != StateAlert || got[1].Value != 50 {
+		t.Errorf("transitions: %+v", got)
+	}
+}
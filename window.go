@@ -0,0 +1,118 @@
+package opentsdb
+
+import (
+	"fmt"
+	"math"
+)
+
+// MovingWindow replaces every point of dps by the named aggregate of the
+// points in the trailing window (t-window, t]. Any aggregator supported by
+// Aggregate can be used. A window shorter than the resolution of the
+// timestamps holds only the point itself.
+func (dps DPmap) MovingWindow(window Duration, agg string) (DPmap, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("opentsdb: moving window of %v", window)
+	}
+	times := dps.GetSortedTimes()
+	w := epochSpan(times, window)
+	out := make(DPmap, len(dps))
+	values := make([]Point, 0, len(times))
+	start := 0
+	for i, t := range times {
+		for start < i && times[start] <= t-w {
+			start++
+		}
+		values = values[:0]
+		for _, s := range times[start:] {
+			if s > t {
+				break
+			}
+			values = append(values, dps[s])
+		}
+		v, err := Aggregate(agg, values)
+		if err != nil {
+			return nil, err
+		}
+		out[t] = v
+	}
+	return out, nil
+}
+
+// MovingAverage is MovingWindow with the avg aggregator.
+func (dps DPmap) MovingAverage(window Duration) DPmap {
+	out, _ := dps.MovingWindow(window, "avg")
+	return out
+}
+
+// MovingMedian is MovingWindow with the median aggregator.
+func (dps DPmap) MovingMedian(window Duration) DPmap {
+	out, _ := dps.MovingWindow(window, "median")
+	return out
+}
+
+// MovingMax is MovingWindow with the max aggregator.
+func (dps DPmap) MovingMax(window Duration) DPmap {
+	out, _ := dps.MovingWindow(window, "max")
+	return out
+}
+
+// EWMA returns the exponentially weighted moving average of dps, where
+// alpha in (0, 1] is the weight of the newest point.
+func (dps DPmap) EWMA(alpha float64) DPmap {
+	out := make(DPmap, len(dps))
+	var avg Point
+	for i, t := range dps.GetSortedTimes() {
+		if i == 0 {
+			avg = dps[t]
+		} else {
+			avg = Point(alpha)*dps[t] + Point(1-alpha)*avg
+		}
+		out[t] = avg
+	}
+	return out
+}
+
+// Derivative returns the per second rate of change of dps. Unlike a
+// counter rate it keeps negative values.
+func (dps DPmap) Derivative() DPmap {
+	times := dps.GetSortedTimes()
+	out := make(DPmap, len(times))
+	scale := Point(1)
+	if epochSpan(times, Second) > 1 {
+		scale = 1000
+	}
+	for i := 1; i < len(times); i++ {
+		dt := Point(times[i] - times[i-1])
+		out[times[i]] = (dps[times[i]] - dps[times[i-1]]) / dt * scale
+	}
+	return out
+}
+
+// CumulativeSum returns the running total of dps. NaN points are skipped.
+func (dps DPmap) CumulativeSum() DPmap {
+	out := make(DPmap, len(dps))
+	var sum Point
+	for _, t := range dps.GetSortedTimes() {
+		if v := dps[t]; !math.IsNaN(float64(v)) {
+			sum += v
+		}
+		out[t] = sum
+	}
+	return out
+}
+
+// Transform returns copies of the responses of r with f applied to their
+// datapoints.
+func (r ResponseSet) Transform(f func(DPmap) (DPmap, error)) (ResponseSet, error) {
+	out := make(ResponseSet, len(r))
+	for i, resp := range r {
+		dps, err := f(resp.DPS)
+		if err != nil {
+			return nil, err
+		}
+		c := *resp
+		c.DPS = dps
+		out[i] = &c
+	}
+	return out, nil
+}
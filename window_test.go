@@ -0,0 +1,44 @@
+package opentsdb
+
+import "testing"
+
+func TestMovingWindows(t *testing.T) {
+	dps := DPmap{0: 1, 60: 3, 120: 5, 180: 1, 240: 9}
+	check := func(name string, got, want DPmap) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+			return
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s: got %v, want %v", name, got, want)
+				return
+			}
+		}
+	}
+	check("avg", dps.MovingAverage(2*Minute), DPmap{0: 1, 60: 2, 120: 4, 180: 3, 240: 5})
+	check("max", dps.MovingMax(3*Minute), DPmap{0: 1, 60: 3, 120: 5, 180: 5, 240: 9})
+	check("median", dps.MovingMedian(3*Minute), DPmap{0: 1, 60: 2, 120: 3, 180: 3, 240: 5})
+	check("ewma", dps.EWMA(0.5), DPmap{0: 1, 60: 2, 120: 3.5, 180: 2.25, 240: 5.625})
+	check("derivative", dps.Derivative(), DPmap{60: 2.0 / 60, 120: 2.0 / 60, 180: -4.0 / 60, 240: 8.0 / 60})
+	check("cumsum", dps.CumulativeSum(), DPmap{0: 1, 60: 4, 120: 9, 180: 10, 240: 19})
+	check("ms derivative", DPmap{1600000000000: 0, 1600000000500: 1}.Derivative(), DPmap{1600000000500: 2})
+
+	if _, err := dps.MovingWindow(Minute, "bogus"); err == nil {
+		t.Error("expected unknown aggregator error")
+	}
+	if sub, err := dps.MovingWindow(500*Millisecond, "sum"); err != nil {
+		t.Error(err)
+	} else {
+		check("sub-second", sub, dps)
+	}
+	if _, err := dps.MovingWindow(0, "sum"); err == nil {
+		t.Error("expected error for an empty window")
+	}
+	rs := ResponseSet{{Metric: "m", DPS: dps}}
+	out, err := rs.Transform(func(d DPmap) (DPmap, error) { return d.CumulativeSum(), nil })
+	if err != nil || out[0].DPS[240] != 19 || rs[0].DPS[240] != 9 {
+		t.Errorf("transform: got %v, %v", out, err)
+	}
+}
@@ -0,0 +1,91 @@
+package opentsdb
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalYAML writes v as a plain number.
+func (v Epoch) MarshalYAML() (interface{}, error) {
+	return int64(v), nil
+}
+
+// UnmarshalYAML reads v from a number, quoted or not.
+func (v *Epoch) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.ScalarNode {
+		return fmt.Errorf("opentsdb: line %d: epoch must be a scalar", n.Line)
+	}
+	return v.UnmarshalText([]byte(n.Value))
+}
+
+// MarshalYAML writes t as a string.
+func (t TimeSpec) MarshalYAML() (interface{}, error) {
+	return string(t), nil
+}
+
+// UnmarshalYAML reads t from any scalar, so both 1600000000 and 1h-ago
+// are accepted.
+func (t *TimeSpec) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.ScalarNode {
+		return fmt.Errorf("opentsdb: line %d: time must be a scalar", n.Line)
+	}
+	*t = TimeSpec(n.Value)
+	return nil
+}
+
+// MarshalYAML writes d in OpenTSDB duration syntax, e.g. 5m.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.HumanString(), nil
+}
+
+// UnmarshalYAML reads d in OpenTSDB duration syntax.
+func (d *Duration) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.ScalarNode {
+		return fmt.Errorf("opentsdb: line %d: duration must be a scalar", n.Line)
+	}
+	v, err := ParseDuration(n.Value)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// UnmarshalYAML decodes r and converts absolute start and end times to
+// epochs like RequestFromJSON.
+func (r *Request) UnmarshalYAML(n *yaml.Node) error {
+	type plain Request
+	var p plain
+	if err := n.Decode(&p); err != nil {
+		return err
+	}
+	*r = Request(p)
+	loc, err := r.location()
+	if err != nil {
+		return err
+	}
+	r.Start = tryParseAbsTimeIn(yamlTime(r.Start), loc)
+	r.End = tryParseAbsTimeIn(yamlTime(r.End), loc)
+	return nil
+}
+
+// yamlTime converts the integers YAML decodes numbers into to int64.
+func yamlTime(v interface{}) interface{} {
+	switch i := v.(type) {
+	case int:
+		return int64(i)
+	case uint64:
+		return int64(i)
+	}
+	return v
+}
+
+// RequestFromYAML creates a new request from YAML.
+func RequestFromYAML(b []byte) (*Request, error) {
+	var r Request
+	if err := yaml.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,66 @@
+package opentsdb
+
+import (
+	"math"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAMLRoundTrip(t *testing.T) {
+	r, err := ParseRequest("start=2023/01/30-00:00:00&end=1h-ago&m=sum:1m-avg:rate:a{host=*}&tz=Europe/Paris", Version2_2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := yaml.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := RequestFromYAML(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.Start != int64(1675033200) || r2.End != "1h-ago" || r2.Timezone != "Europe/Paris" {
+		t.Errorf("unexpected times %#v %#v", r2.Start, r2.End)
+	}
+	if r2.Queries[0].String() != r.Queries[0].String() {
+		t.Errorf("got %s, want %s", r2.Queries[0], r.Queries[0])
+	}
+
+	r3, err := RequestFromYAML([]byte("start: 1600000000000\nqueries: [{metric: m, aggregator: sum}]\n"))
+	if err != nil || r3.Start != int64(1600000000) {
+		t.Errorf("got %#v, %v", r3, err)
+	}
+
+	rs := ResponseSet{{Metric: "m", Tags: TagSet{"a": "b"}, AggregateTags: []string{"c"}, DPS: DPmap{60: 1.5, 120: Point(math.NaN())}}}
+	b, err = yaml.Marshal(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rs2 ResponseSet
+	if err := yaml.Unmarshal(b, &rs2); err != nil {
+		t.Fatal(err)
+	}
+	if !rs2[0].Tags.Equal(rs[0].Tags) || rs2[0].DPS[60] != 1.5 || !math.IsNaN(float64(rs2[0].DPS[120])) {
+		t.Errorf("got %s", b)
+	}
+}
+
+func TestYAMLScalars(t *testing.T) {
+	var v struct {
+		Epoch    Epoch
+		Time     TimeSpec
+		Duration Duration
+	}
+	in := "epoch: \"60\"\ntime: 1600000000\nduration: 1h30m\n"
+	if err := yaml.Unmarshal([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Epoch != 60 || v.Time != "1600000000" || v.Duration != Hour+30*Minute {
+		t.Errorf("got %+v", v)
+	}
+	b, _ := yaml.Marshal(v)
+	if string(b) != "epoch: 60\ntime: \"1600000000\"\nduration: 90m\n" {
+		t.Errorf("got %s", b)
+	}
+}